@@ -0,0 +1,232 @@
+package anomaly
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/moira-alert/moira"
+)
+
+// Anomaly detection methods
+const (
+	// ZScore compares value with mean and standard deviation of values in window before it
+	ZScore = "zscore"
+	// HoltWinters compares value with Holt-Winters forecast and its seasonal deviation, season is one day
+	HoltWinters = "holt_winters"
+	// WeekOverWeek compares value with mean and standard deviation of values in window around the same time last week
+	WeekOverWeek = "week_over_week"
+)
+
+const (
+	day  = 24 * 60 * 60
+	week = 7 * day
+
+	defaultZScoreWindow       = 60 * 60
+	defaultWeekOverWeekWindow = 60 * 60
+	defaultHoltWintersWindow  = week
+
+	// Holt-Winters smoothing parameters are the same as graphite holtWintersForecast uses
+	holtWintersAlpha = 0.1
+	holtWintersBeta  = 0.0035
+	holtWintersGamma = 0.1
+)
+
+// Series contains metric values from StartTime with StepTime seconds between them, absent values are NaN
+type Series struct {
+	StartTime int64
+	StepTime  int64
+	Values    []float64
+}
+
+// Validate checks anomaly detection settings
+func Validate(settings *moira.AnomalyDetection) error {
+	switch settings.Method {
+	case ZScore, HoltWinters, WeekOverWeek:
+	default:
+		return fmt.Errorf("Unknown anomaly detection method '%s'", settings.Method)
+	}
+	if settings.Window < 0 {
+		return fmt.Errorf("Anomaly detection window can not be negative")
+	}
+	if settings.WarnDeviation <= 0 || settings.ErrorDeviation <= 0 {
+		return fmt.Errorf("Anomaly warn and error deviations must be positive")
+	}
+	if settings.ErrorDeviation < settings.WarnDeviation {
+		return fmt.Errorf("Anomaly error deviation can not be less than warn deviation")
+	}
+	return nil
+}
+
+// HistoryInterval returns how many seconds of metric history before checked value are used to calculate expected value
+func HistoryInterval(settings *moira.AnomalyDetection) int64 {
+	window := getWindow(settings)
+	if settings.Method == WeekOverWeek {
+		return week + window/2
+	}
+	return window
+}
+
+// Evaluate returns OK, WARN or ERROR state of value at timestamp by its deviation from value expected by history
+// Value is NODATA if history has not enough values to calculate expected value, for example if metric values
+// are not kept for whole history interval, so unchecked value is not reported as OK
+func Evaluate(settings *moira.AnomalyDetection, history Series, value float64, timestamp int64) string {
+	deviation, ok := Deviation(settings, history, value, timestamp)
+	switch {
+	case !ok:
+		return "NODATA"
+	case deviation >= settings.ErrorDeviation:
+		return "ERROR"
+	case deviation >= settings.WarnDeviation:
+		return "WARN"
+	default:
+		return "OK"
+	}
+}
+
+// Deviation returns how many expected deviations are between value at timestamp and expected value
+// Returns false if history has not enough values to calculate expected value
+func Deviation(settings *moira.AnomalyDetection, history Series, value float64, timestamp int64) (float64, bool) {
+	window := getWindow(settings)
+	var expected, expectedDeviation float64
+	var ok bool
+	switch settings.Method {
+	case ZScore:
+		expected, expectedDeviation, ok = getMeanAndStdDev(history.getValues(timestamp-window, timestamp))
+	case WeekOverWeek:
+		expected, expectedDeviation, ok = getMeanAndStdDev(history.getValues(timestamp-week-window/2, timestamp-week+window/2+1))
+	case HoltWinters:
+		expected, expectedDeviation, ok = getHoltWintersForecast(history.getValues(timestamp-window, timestamp), history.StepTime)
+	}
+	if !ok {
+		return 0, false
+	}
+	return getDeviation(value, expected, expectedDeviation), true
+}
+
+func getWindow(settings *moira.AnomalyDetection) int64 {
+	if settings.Window > 0 {
+		return settings.Window
+	}
+	switch settings.Method {
+	case HoltWinters:
+		return defaultHoltWintersWindow
+	case WeekOverWeek:
+		return defaultWeekOverWeekWindow
+	default:
+		return defaultZScoreWindow
+	}
+}
+
+// getValues returns values with timestamps from from till until not including until
+func (series Series) getValues(from, until int64) []float64 {
+	if series.StepTime <= 0 {
+		return nil
+	}
+	first := ceilDiv(from-series.StartTime, series.StepTime)
+	last := ceilDiv(until-series.StartTime, series.StepTime)
+	if first < 0 {
+		first = 0
+	}
+	if last > int64(len(series.Values)) {
+		last = int64(len(series.Values))
+	}
+	if first >= last {
+		return nil
+	}
+	return series.Values[first:last]
+}
+
+func ceilDiv(a, b int64) int64 {
+	if a <= 0 {
+		return a / b
+	}
+	return (a + b - 1) / b
+}
+
+// getMeanAndStdDev returns mean and population standard deviation of not absent values, at least two values are required
+func getMeanAndStdDev(values []float64) (float64, float64, bool) {
+	var sum float64
+	count := 0
+	for _, value := range values {
+		if !math.IsNaN(value) {
+			sum += value
+			count++
+		}
+	}
+	if count < 2 {
+		return 0, 0, false
+	}
+	mean := sum / float64(count)
+	var squares float64
+	for _, value := range values {
+		if !math.IsNaN(value) {
+			squares += (value - mean) * (value - mean)
+		}
+	}
+	return mean, math.Sqrt(squares / float64(count)), true
+}
+
+// getHoltWintersForecast returns forecast of value next to given values and its expected deviation
+// It is the same triple exponential smoothing as graphite holtWintersAnalysis, history must be longer than one season
+func getHoltWintersForecast(values []float64, step int64) (float64, float64, bool) {
+	if step <= 0 {
+		return 0, 0, false
+	}
+	seasonLength := int(day / step)
+	if seasonLength < 1 || len(values) <= seasonLength {
+		return 0, 0, false
+	}
+	intercepts := make([]float64, len(values))
+	slopes := make([]float64, len(values))
+	seasonals := make([]float64, len(values))
+	deviations := make([]float64, len(values))
+	getLast := func(series []float64, i int) float64 {
+		if i-seasonLength >= 0 {
+			return series[i-seasonLength]
+		}
+		return 0
+	}
+
+	nextPrediction := math.NaN()
+	for i, actual := range values {
+		// Absent values break smoothing, it is started again from next value
+		if math.IsNaN(actual) {
+			intercepts[i] = math.NaN()
+			nextPrediction = math.NaN()
+			continue
+		}
+		lastIntercept, lastSlope, prediction := actual, 0.0, nextPrediction
+		if i > 0 && !math.IsNaN(intercepts[i-1]) {
+			lastIntercept, lastSlope = intercepts[i-1], slopes[i-1]
+		}
+		if math.IsNaN(prediction) {
+			prediction = actual
+		}
+		lastSeasonal := getLast(seasonals, i)
+		nextLastSeasonal := getLast(seasonals, i+1)
+		lastSeasonalDeviation := getLast(deviations, i)
+
+		intercepts[i] = holtWintersAlpha*(actual-lastSeasonal) + (1-holtWintersAlpha)*(lastIntercept+lastSlope)
+		slopes[i] = holtWintersBeta*(intercepts[i]-lastIntercept) + (1-holtWintersBeta)*lastSlope
+		seasonals[i] = holtWintersGamma*(actual-intercepts[i]) + (1-holtWintersGamma)*lastSeasonal
+		nextPrediction = intercepts[i] + slopes[i] + nextLastSeasonal
+		deviations[i] = holtWintersGamma*math.Abs(actual-prediction) + (1-holtWintersGamma)*lastSeasonalDeviation
+	}
+	if math.IsNaN(nextPrediction) {
+		return 0, 0, false
+	}
+	return nextPrediction, getLast(deviations, len(values)), true
+}
+
+// getDeviation returns distance between value and expected value in expected deviations
+// Any difference from metric which has not changed before is infinite deviation
+func getDeviation(value, expected, expectedDeviation float64) float64 {
+	difference := math.Abs(value - expected)
+	if expectedDeviation == 0 {
+		if difference == 0 {
+			return 0
+		}
+		return math.Inf(1)
+	}
+	return difference / expectedDeviation
+}
@@ -0,0 +1,111 @@
+package anomaly
+
+import (
+	"math"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/moira-alert/moira"
+)
+
+func TestValidate(t *testing.T) {
+	Convey("Valid settings", t, func() {
+		So(Validate(&moira.AnomalyDetection{Method: ZScore, WarnDeviation: 3, ErrorDeviation: 5}), ShouldBeNil)
+		So(Validate(&moira.AnomalyDetection{Method: HoltWinters, Window: week, WarnDeviation: 3, ErrorDeviation: 3}), ShouldBeNil)
+	})
+
+	Convey("Invalid settings", t, func() {
+		So(Validate(&moira.AnomalyDetection{Method: "magic", WarnDeviation: 3, ErrorDeviation: 5}), ShouldNotBeNil)
+		So(Validate(&moira.AnomalyDetection{Method: ZScore, Window: -1, WarnDeviation: 3, ErrorDeviation: 5}), ShouldNotBeNil)
+		So(Validate(&moira.AnomalyDetection{Method: ZScore, ErrorDeviation: 5}), ShouldNotBeNil)
+		So(Validate(&moira.AnomalyDetection{Method: ZScore, WarnDeviation: 5, ErrorDeviation: 3}), ShouldNotBeNil)
+	})
+}
+
+func TestHistoryInterval(t *testing.T) {
+	Convey("History interval depends on method", t, func() {
+		So(HistoryInterval(&moira.AnomalyDetection{Method: ZScore}), ShouldEqual, 3600)
+		So(HistoryInterval(&moira.AnomalyDetection{Method: ZScore, Window: 600}), ShouldEqual, 600)
+		So(HistoryInterval(&moira.AnomalyDetection{Method: HoltWinters}), ShouldEqual, week)
+		So(HistoryInterval(&moira.AnomalyDetection{Method: WeekOverWeek, Window: 600}), ShouldEqual, week+300)
+	})
+}
+
+func TestZScore(t *testing.T) {
+	settings := &moira.AnomalyDetection{Method: ZScore, Window: 600, WarnDeviation: 2, ErrorDeviation: 4}
+	// values alternate 9 and 11, so mean is 10 and standard deviation is 1
+	history := Series{StartTime: 0, StepTime: 60, Values: make([]float64, 20)}
+	for i := range history.Values {
+		history.Values[i] = 9 + float64(i%2)*2
+	}
+
+	Convey("Values are compared with window before them", t, func() {
+		So(Evaluate(settings, history, 11, 1200), ShouldEqual, "OK")
+		So(Evaluate(settings, history, 12.5, 1200), ShouldEqual, "WARN")
+		So(Evaluate(settings, history, 5, 1200), ShouldEqual, "ERROR")
+
+		deviation, ok := Deviation(settings, history, 13, 1200)
+		So(ok, ShouldBeTrue)
+		So(deviation, ShouldEqual, 3)
+	})
+
+	Convey("Absent values are skipped", t, func() {
+		history := Series{StartTime: 0, StepTime: 60, Values: []float64{9, math.NaN(), 11, math.NaN()}}
+		deviation, ok := Deviation(settings, history, 13, 240)
+		So(ok, ShouldBeTrue)
+		So(deviation, ShouldEqual, 3)
+	})
+
+	Convey("Value is NODATA if history is not enough", t, func() {
+		So(Evaluate(settings, history, 100, 60), ShouldEqual, "NODATA")
+		So(Evaluate(settings, Series{StepTime: 60}, 100, 60), ShouldEqual, "NODATA")
+	})
+
+	Convey("Any change of constant metric is error", t, func() {
+		history := Series{StartTime: 0, StepTime: 60, Values: []float64{5, 5, 5, 5}}
+		So(Evaluate(settings, history, 5, 240), ShouldEqual, "OK")
+		So(Evaluate(settings, history, 5.1, 240), ShouldEqual, "ERROR")
+	})
+}
+
+func TestWeekOverWeek(t *testing.T) {
+	settings := &moira.AnomalyDetection{Method: WeekOverWeek, Window: 600, WarnDeviation: 2, ErrorDeviation: 4}
+	// last week values around checked time are 99 and 101, all other values are 0
+	history := Series{StartTime: 0, StepTime: 60, Values: make([]float64, (week+1200)/60)}
+	for i := (week - 300) / 60; i <= (week+300)/60; i++ {
+		history.Values[i] = 99 + float64(i%2)*2
+	}
+
+	Convey("Values are compared with the same time last week", t, func() {
+		So(Evaluate(settings, history, 100, 2*week), ShouldEqual, "OK")
+		So(Evaluate(settings, history, 103, 2*week), ShouldEqual, "WARN")
+		So(Evaluate(settings, history, 0, 2*week), ShouldEqual, "ERROR")
+	})
+}
+
+func TestHoltWinters(t *testing.T) {
+	settings := &moira.AnomalyDetection{Method: HoltWinters, WarnDeviation: 3, ErrorDeviation: 6}
+	step := int64(600)
+	// daily sine with small noise
+	expected := func(timestamp int64) float64 {
+		return 100 + 50*math.Sin(2*math.Pi*float64(timestamp%day)/day)
+	}
+	history := Series{StartTime: 0, StepTime: step, Values: make([]float64, week/step)}
+	for i := range history.Values {
+		history.Values[i] = expected(int64(i)*step) + float64(i%3) - 1
+	}
+	until := int64(week)
+
+	Convey("Seasonal values are expected", t, func() {
+		So(Evaluate(settings, history, expected(until), until), ShouldEqual, "OK")
+		// value which is normal at 6am is an anomaly at midnight
+		So(Evaluate(settings, history, expected(until+day/4), until), ShouldEqual, "ERROR")
+	})
+
+	Convey("History must be longer than season", t, func() {
+		short := Series{StartTime: 0, StepTime: step, Values: history.Values[:day/step]}
+		_, ok := Deviation(settings, short, 100, day)
+		So(ok, ShouldBeFalse)
+	})
+}
@@ -5,4 +5,8 @@ type Config struct {
 	Enabled    bool
 	EnableCORS bool
 	Listen     string
+	// MetricsTokens are bearer tokens allowed to push metrics, metrics ingestion is disabled if it is empty
+	MetricsTokens []string
+	// MetricsTTL is time checker keeps raw metric values, it is used to select retention archive of requested range
+	MetricsTTL int64
 }
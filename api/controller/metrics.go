@@ -0,0 +1,58 @@
+package controller
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/moira-alert/moira"
+	"github.com/moira-alert/moira/api"
+	"github.com/moira-alert/moira/api/dto"
+	"github.com/moira-alert/moira/filter"
+)
+
+// saveMetricsLock serializes requests because cache storage keeps last values of metrics and is not thread safe
+var saveMetricsLock sync.Mutex
+
+// SaveMetrics matches metrics by patterns, rounds them by retentions and saves matched ones the same way filter does,
+// metrics without timestamp get current time
+func SaveMetrics(database moira.Database, patternStorage *filter.PatternStorage, cacheStorage *filter.Storage, metrics []dto.MetricValue) (*dto.SavedMetrics, *api.ErrorResponse) {
+	now := time.Now().Unix()
+	matchedMetrics := make([]*moira.MatchedMetric, 0)
+	for i, metric := range metrics {
+		if err := metric.Validate(); err != nil {
+			return nil, api.ErrorInvalidRequest(fmt.Errorf("Invalid metric #%d: %s", i+1, err.Error()))
+		}
+		timestamp := metric.Timestamp
+		if timestamp == 0 {
+			timestamp = now
+		}
+		matchedMetric, err := patternStorage.MatchParsedMetric([]byte(metric.Metric), metric.Value, timestamp)
+		if err != nil {
+			return nil, api.ErrorInvalidRequest(fmt.Errorf("Invalid metric #%d: %s", i+1, err.Error()))
+		}
+		if matchedMetric != nil {
+			matchedMetrics = append(matchedMetrics, matchedMetric)
+		}
+	}
+
+	saveMetricsLock.Lock()
+	defer saveMetricsLock.Unlock()
+	buffer := make(map[string]*moira.MatchedMetric)
+	for _, matchedMetric := range matchedMetrics {
+		// buffer keeps single value of metric, so previous values are saved first
+		if _, ok := buffer[matchedMetric.Metric]; ok {
+			if err := database.SaveMetrics(buffer); err != nil {
+				return nil, api.ErrorInternalServer(err)
+			}
+			buffer = make(map[string]*moira.MatchedMetric)
+		}
+		cacheStorage.EnrichMatchedMetric(buffer, matchedMetric)
+	}
+	if len(buffer) > 0 {
+		if err := database.SaveMetrics(buffer); err != nil {
+			return nil, api.ErrorInternalServer(err)
+		}
+	}
+	return &dto.SavedMetrics{Received: len(metrics), Matched: len(matchedMetrics)}, nil
+}
@@ -0,0 +1,96 @@
+package controller
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/op/go-logging"
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/moira-alert/moira"
+	"github.com/moira-alert/moira/api"
+	"github.com/moira-alert/moira/api/dto"
+	"github.com/moira-alert/moira/filter"
+	"github.com/moira-alert/moira/metrics/graphite/go-metrics"
+	"github.com/moira-alert/moira/mock/moira-alert"
+)
+
+func TestSaveMetrics(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	dataBase := mock_moira_alert.NewMockDatabase(mockCtrl)
+	logger, _ := logging.GetLogger("Test")
+	filterMetrics := metrics.ConfigureFilterMetrics("test")
+
+	dataBase.EXPECT().GetPatternsVersion().Return(int64(0), nil)
+	dataBase.EXPECT().GetPatterns().Return([]string{"CI.*.duration"}, nil)
+	patternStorage, err := filter.NewPatternStorage(dataBase, filterMetrics, logger)
+	cacheStorage, err2 := filter.NewCacheStorage(filterMetrics, strings.NewReader("[default]\npattern = .*\nretentions = 60s:1d\n"), nil)
+
+	Convey("Create storages, should no error", t, func() {
+		So(err, ShouldBeNil)
+		So(err2, ShouldBeNil)
+	})
+
+	Convey("Matched metrics should be rounded by retention and saved", t, func() {
+		var savedBuffer map[string]*moira.MatchedMetric
+		dataBase.EXPECT().SaveMetrics(gomock.Any()).Do(func(buffer map[string]*moira.MatchedMetric) {
+			savedBuffer = buffer
+		}).Return(nil)
+		saved, err := SaveMetrics(dataBase, patternStorage, cacheStorage, []dto.MetricValue{
+			{Metric: "CI.build.duration", Value: 42, Timestamp: 1234567890},
+			{Metric: "CI.build.finished", Value: 1, Timestamp: 1234567890},
+		})
+		So(err, ShouldBeNil)
+		So(saved, ShouldResemble, &dto.SavedMetrics{Received: 2, Matched: 1})
+		So(savedBuffer, ShouldResemble, map[string]*moira.MatchedMetric{
+			"CI.build.duration": {
+				Metric:             "CI.build.duration",
+				Patterns:           []string{"CI.*.duration"},
+				Value:              42,
+				Timestamp:          1234567890,
+				RetentionTimestamp: 1234567920,
+				Retention:          60,
+			},
+		})
+	})
+
+	Convey("Several values of the same metric should be saved separately", t, func() {
+		dataBase.EXPECT().SaveMetrics(gomock.Any()).Return(nil).Times(2)
+		saved, err := SaveMetrics(dataBase, patternStorage, cacheStorage, []dto.MetricValue{
+			{Metric: "CI.deploy.duration", Value: 1, Timestamp: 1234567890},
+			{Metric: "CI.deploy.duration", Value: 2, Timestamp: 1234567950},
+		})
+		So(err, ShouldBeNil)
+		So(saved, ShouldResemble, &dto.SavedMetrics{Received: 2, Matched: 2})
+	})
+
+	Convey("Metric without timestamp should get current time", t, func() {
+		dataBase.EXPECT().SaveMetrics(gomock.Any()).Return(nil)
+		saved, err := SaveMetrics(dataBase, patternStorage, cacheStorage, []dto.MetricValue{{Metric: "CI.test.duration", Value: 1}})
+		So(err, ShouldBeNil)
+		So(saved.Matched, ShouldEqual, 1)
+	})
+
+	Convey("Unmatched metrics should not be saved", t, func() {
+		saved, err := SaveMetrics(dataBase, patternStorage, cacheStorage, []dto.MetricValue{{Metric: "Other.metric", Value: 1}})
+		So(err, ShouldBeNil)
+		So(saved, ShouldResemble, &dto.SavedMetrics{Received: 1, Matched: 0})
+	})
+
+	Convey("Invalid metric should return error", t, func() {
+		_, err := SaveMetrics(dataBase, patternStorage, cacheStorage, []dto.MetricValue{{Metric: "", Value: 1}})
+		So(err, ShouldResemble, api.ErrorInvalidRequest(fmt.Errorf("Invalid metric #1: Metric name can not be empty")))
+		_, err = SaveMetrics(dataBase, patternStorage, cacheStorage, []dto.MetricValue{{Metric: "CI.build duration", Value: 1}})
+		So(err, ShouldNotBeNil)
+	})
+
+	Convey("Database error should return error", t, func() {
+		expected := fmt.Errorf("Oooops! Can not save metrics")
+		dataBase.EXPECT().SaveMetrics(gomock.Any()).Return(expected)
+		_, err := SaveMetrics(dataBase, patternStorage, cacheStorage, []dto.MetricValue{{Metric: "CI.lint.duration", Value: 1, Timestamp: 1234567890}})
+		So(err, ShouldResemble, api.ErrorInternalServer(expected))
+	})
+}
@@ -199,7 +199,8 @@ func SetMetricsMaintenance(database moira.Database, triggerID string, metricsMai
 }
 
 // GetTriggerMetrics gets all trigger metrics values, default values from: now - 10min, to: now
-func GetTriggerMetrics(dataBase moira.Database, from, to int64, triggerID string) (dto.TriggerMetrics, *api.ErrorResponse) {
+// metricsTTL is time checker keeps raw metric values
+func GetTriggerMetrics(dataBase moira.Database, from, to, metricsTTL int64, triggerID string) (dto.TriggerMetrics, *api.ErrorResponse) {
 	trigger, err := dataBase.GetTrigger(triggerID)
 	if err != nil {
 		if err == database.ErrNil {
@@ -210,7 +211,7 @@ func GetTriggerMetrics(dataBase moira.Database, from, to int64, triggerID string
 
 	triggerMetrics := make(map[string][]moira.MetricValue)
 	for _, tar := range trigger.Targets {
-		result, err := target.EvaluateTarget(dataBase, tar, from, to, true)
+		result, err := target.EvaluateTarget(dataBase, tar, from, to, true, metricsTTL)
 		if err != nil {
 			return nil, api.ErrorInternalServer(err)
 		}
@@ -0,0 +1,36 @@
+// nolint
+package dto
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+)
+
+type MetricValue struct {
+	Metric    string  `json:"metric"`
+	Value     float64 `json:"value"`
+	Timestamp int64   `json:"timestamp,omitempty"`
+}
+
+func (metricValue *MetricValue) Validate() error {
+	if metricValue.Metric == "" {
+		return fmt.Errorf("Metric name can not be empty")
+	}
+	if math.IsNaN(metricValue.Value) || math.IsInf(metricValue.Value, 0) {
+		return fmt.Errorf("Value of metric %s must be finite number", metricValue.Metric)
+	}
+	if metricValue.Timestamp < 0 {
+		return fmt.Errorf("Timestamp of metric %s can not be negative", metricValue.Metric)
+	}
+	return nil
+}
+
+type SavedMetrics struct {
+	Received int `json:"received"`
+	Matched  int `json:"matched"`
+}
+
+func (*SavedMetrics) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
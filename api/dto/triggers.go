@@ -4,6 +4,7 @@ package dto
 import (
 	"fmt"
 	"github.com/moira-alert/moira"
+	"github.com/moira-alert/moira/anomaly"
 	"github.com/moira-alert/moira/api/middleware"
 	"github.com/moira-alert/moira/checker"
 	"github.com/moira-alert/moira/expression"
@@ -30,53 +31,68 @@ type Trigger struct {
 
 // TriggerModel is moira.Trigger api representation
 type TriggerModel struct {
-	ID         string              `json:"id"`
-	Name       string              `json:"name"`
-	Desc       *string             `json:"desc,omitempty"`
-	Targets    []string            `json:"targets"`
-	WarnValue  *float64            `json:"warn_value"`
-	ErrorValue *float64            `json:"error_value"`
-	Tags       []string            `json:"tags"`
-	TTLState   *string             `json:"ttl_state,omitempty"`
-	TTL        int64               `json:"ttl,omitempty"`
-	Schedule   *moira.ScheduleData `json:"sched,omitempty"`
-	Expression string              `json:"expression"`
-	Patterns   []string            `json:"patterns"`
+	ID              string                  `json:"id"`
+	Name            string                  `json:"name"`
+	Desc            *string                 `json:"desc,omitempty"`
+	Targets         []string                `json:"targets"`
+	WarnValue       *float64                `json:"warn_value"`
+	ErrorValue      *float64                `json:"error_value"`
+	WarnClearValue  *float64                `json:"warn_clear_value,omitempty"`
+	ErrorClearValue *float64                `json:"error_clear_value,omitempty"`
+	Tags            []string                `json:"tags"`
+	TTLState        *string                 `json:"ttl_state,omitempty"`
+	TTL             int64                   `json:"ttl,omitempty"`
+	Schedule        *moira.ScheduleData     `json:"sched,omitempty"`
+	Expression      string                  `json:"expression"`
+	Patterns        []string                `json:"patterns"`
+	PendingInterval int64                   `json:"pending_interval,omitempty"`
+	Anomaly         *moira.AnomalyDetection `json:"anomaly,omitempty"`
+	TriggerSource   string                  `json:"trigger_source,omitempty"`
 }
 
 // ToMoiraTrigger transforms TriggerModel to moira.Trigger
 func (model *TriggerModel) ToMoiraTrigger() *moira.Trigger {
 	return &moira.Trigger{
-		ID:         model.ID,
-		Name:       model.Name,
-		Desc:       model.Desc,
-		Targets:    model.Targets,
-		WarnValue:  model.WarnValue,
-		ErrorValue: model.ErrorValue,
-		Tags:       model.Tags,
-		TTLState:   model.TTLState,
-		TTL:        model.TTL,
-		Schedule:   model.Schedule,
-		Expression: &model.Expression,
-		Patterns:   model.Patterns,
+		ID:              model.ID,
+		Name:            model.Name,
+		Desc:            model.Desc,
+		Targets:         model.Targets,
+		WarnValue:       model.WarnValue,
+		ErrorValue:      model.ErrorValue,
+		WarnClearValue:  model.WarnClearValue,
+		ErrorClearValue: model.ErrorClearValue,
+		Tags:            model.Tags,
+		TTLState:        model.TTLState,
+		TTL:             model.TTL,
+		Schedule:        model.Schedule,
+		Expression:      &model.Expression,
+		Patterns:        model.Patterns,
+		PendingInterval: model.PendingInterval,
+		Anomaly:         model.Anomaly,
+		TriggerSource:   model.TriggerSource,
 	}
 }
 
 // CreateTriggerModel transforms moira.Trigger to TriggerModel
 func CreateTriggerModel(trigger *moira.Trigger) TriggerModel {
 	return TriggerModel{
-		ID:         trigger.ID,
-		Name:       trigger.Name,
-		Desc:       trigger.Desc,
-		Targets:    trigger.Targets,
-		WarnValue:  trigger.WarnValue,
-		ErrorValue: trigger.ErrorValue,
-		Tags:       trigger.Tags,
-		TTLState:   trigger.TTLState,
-		TTL:        trigger.TTL,
-		Schedule:   trigger.Schedule,
-		Expression: moira.UseString(trigger.Expression),
-		Patterns:   trigger.Patterns,
+		ID:              trigger.ID,
+		Name:            trigger.Name,
+		Desc:            trigger.Desc,
+		Targets:         trigger.Targets,
+		WarnValue:       trigger.WarnValue,
+		ErrorValue:      trigger.ErrorValue,
+		WarnClearValue:  trigger.WarnClearValue,
+		ErrorClearValue: trigger.ErrorClearValue,
+		Tags:            trigger.Tags,
+		TTLState:        trigger.TTLState,
+		TTL:             trigger.TTL,
+		Schedule:        trigger.Schedule,
+		Expression:      moira.UseString(trigger.Expression),
+		Patterns:        trigger.Patterns,
+		PendingInterval: trigger.PendingInterval,
+		Anomaly:         trigger.Anomaly,
+		TriggerSource:   trigger.TriggerSource,
 	}
 }
 
@@ -90,17 +106,33 @@ func (trigger *Trigger) Bind(request *http.Request) error {
 	if trigger.Name == "" {
 		return fmt.Errorf("trigger name is required")
 	}
-	if trigger.WarnValue == nil && trigger.Expression == "" {
-		return fmt.Errorf("warn_value is required")
+	if trigger.Anomaly != nil {
+		if err := anomaly.Validate(trigger.Anomaly); err != nil {
+			return err
+		}
+	} else {
+		if trigger.WarnValue == nil && trigger.Expression == "" {
+			return fmt.Errorf("warn_value is required")
+		}
+		if trigger.ErrorValue == nil && trigger.Expression == "" {
+			return fmt.Errorf("error_value is required")
+		}
 	}
-	if trigger.ErrorValue == nil && trigger.Expression == "" {
-		return fmt.Errorf("error_value is required")
+	if trigger.PendingInterval < 0 {
+		return fmt.Errorf("pending_interval can not be negative")
+	}
+	switch trigger.TriggerSource {
+	case moira.LocalTriggerSource, moira.GraphiteRemoteTriggerSource, moira.PrometheusRemoteTriggerSource:
+	default:
+		return fmt.Errorf("unknown trigger_source %s", trigger.TriggerSource)
 	}
 
 	triggerExpression := expression.TriggerExpression{
 		AdditionalTargetsValues: make(map[string]float64),
 		WarnValue:               trigger.WarnValue,
 		ErrorValue:              trigger.ErrorValue,
+		WarnClearValue:          trigger.WarnClearValue,
+		ErrorClearValue:         trigger.ErrorClearValue,
 		PreviousState:           checker.NODATA,
 		Expression:              &trigger.Expression,
 	}
@@ -111,6 +143,9 @@ func (trigger *Trigger) Bind(request *http.Request) error {
 		logger.Infof("Invalid graphite targets %s: %s\n", trigger.Targets, err.Error())
 		return fmt.Errorf("Invalid graphite targets: %s", err.Error())
 	}
+	if trigger.Anomaly != nil {
+		return nil
+	}
 	if _, err := triggerExpression.Evaluate(); err != nil {
 		logger.Infof("Invalid expression %s: %s\n", trigger.Expression, err.Error())
 		return err
@@ -125,14 +160,16 @@ func resolvePatterns(request *http.Request, trigger *Trigger, expressionValues *
 	timeSeriesNames := make(map[string]bool)
 
 	for _, tar := range trigger.Targets {
-		database := middleware.GetDatabase(request)
-		result, err := target.EvaluateTarget(database, tar, now-600, now, true)
-		if err != nil {
-			return err
-		}
-		trigger.Patterns = append(trigger.Patterns, result.Patterns...)
-		for _, timeSeries := range result.TimeSeries {
-			timeSeriesNames[timeSeries.Name] = true
+		if trigger.TriggerSource == moira.LocalTriggerSource {
+			database := middleware.GetDatabase(request)
+			result, err := target.EvaluateTarget(database, tar, now-600, now, true, 0)
+			if err != nil {
+				return err
+			}
+			trigger.Patterns = append(trigger.Patterns, result.Patterns...)
+			for _, timeSeries := range result.TimeSeries {
+				timeSeriesNames[timeSeries.Name] = true
+			}
 		}
 		if targetNum == 1 {
 			expressionValues.MainTargetValue = 42
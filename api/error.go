@@ -68,6 +68,15 @@ func ErrorForbidden(errorText string) *ErrorResponse {
 	}
 }
 
+// ErrorUnauthorized return 401 with given error text
+func ErrorUnauthorized(errorText string) *ErrorResponse {
+	return &ErrorResponse{
+		HTTPStatusCode: 401,
+		StatusText:     "Unauthorized",
+		ErrorText:      errorText,
+	}
+}
+
 // ErrNotFound is default router page not found
 var ErrNotFound = &ErrorResponse{HTTPStatusCode: 404, StatusText: "Page not found."}
 
@@ -11,16 +11,24 @@ import (
 	"github.com/moira-alert/moira"
 	"github.com/moira-alert/moira/api"
 	moira_middle "github.com/moira-alert/moira/api/middleware"
+	"github.com/moira-alert/moira/filter"
 )
 
 var database moira.Database
+var patternStorage *filter.PatternStorage
+var cacheStorage *filter.Storage
+var metricsTTL int64
 
 const contactKey moira_middle.ContextKey = "contact"
 const subscriptionKey moira_middle.ContextKey = "subscription"
 
 // NewHandler creates new api handler request uris based on github.com/go-chi/chi
-func NewHandler(db moira.Database, log moira.Logger, config *api.Config) http.Handler {
+// Metrics ingestion is enabled if metrics tokens are configured and pattern and cache storages are given
+func NewHandler(db moira.Database, log moira.Logger, config *api.Config, patterns *filter.PatternStorage, retentions *filter.Storage) http.Handler {
 	database = db
+	patternStorage = patterns
+	cacheStorage = retentions
+	metricsTTL = config.MetricsTTL
 	router := chi.NewRouter()
 	router.Use(render.SetContentType(render.ContentTypeJSON))
 	router.Use(moira_middle.RequestLogger(log))
@@ -40,6 +48,9 @@ func NewHandler(db moira.Database, log moira.Logger, config *api.Config) http.Ha
 		router.Route("/contact", contact)
 		router.Route("/subscription", subscription)
 		router.Route("/notification", notification)
+		if len(config.MetricsTokens) > 0 && patternStorage != nil && cacheStorage != nil {
+			router.With(moira_middle.TokenAuth(config.MetricsTokens)).Route("/metrics", metrics)
+		}
 	})
 	if config.EnableCORS {
 		return cors.AllowAll().Handler(router)
@@ -0,0 +1,37 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/go-chi/chi"
+	"github.com/go-chi/render"
+
+	"github.com/moira-alert/moira/api"
+	"github.com/moira-alert/moira/api/controller"
+	"github.com/moira-alert/moira/api/dto"
+)
+
+// maxMetricsRequestSize limits size of pushed metrics request body
+const maxMetricsRequestSize = 1 << 20
+
+func metrics(router chi.Router) {
+	router.Post("/", saveMetrics)
+}
+
+func saveMetrics(writer http.ResponseWriter, request *http.Request) {
+	metrics := make([]dto.MetricValue, 0)
+	if err := json.NewDecoder(http.MaxBytesReader(writer, request.Body, maxMetricsRequestSize)).Decode(&metrics); err != nil {
+		render.Render(writer, request, api.ErrorInvalidRequest(fmt.Errorf("Metrics must be JSON array of {metric, value, timestamp}: %s", err.Error())))
+		return
+	}
+	savedMetrics, err := controller.SaveMetrics(database, patternStorage, cacheStorage, metrics)
+	if err != nil {
+		render.Render(writer, request, err)
+		return
+	}
+	if err := render.Render(writer, request, savedMetrics); err != nil {
+		render.Render(writer, request, api.ErrorRender(err))
+	}
+}
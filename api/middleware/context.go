@@ -2,6 +2,7 @@ package middleware
 
 import (
 	"context"
+	"crypto/subtle"
 	"fmt"
 	"github.com/go-chi/chi"
 	"github.com/go-chi/render"
@@ -9,6 +10,7 @@ import (
 	"github.com/moira-alert/moira/api"
 	"net/http"
 	"strconv"
+	"strings"
 )
 
 // DatabaseContext sets to requests context configured database
@@ -121,3 +123,19 @@ func DateRange(defaultFrom, defaultTo string) func(next http.Handler) http.Handl
 		})
 	}
 }
+
+// TokenAuth allows only requests with "Authorization: Bearer <token>" header containing one of given tokens
+func TokenAuth(tokens []string) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+			token := strings.TrimPrefix(request.Header.Get("Authorization"), "Bearer ")
+			for _, allowed := range tokens {
+				if token != "" && subtle.ConstantTimeCompare([]byte(token), []byte(allowed)) == 1 {
+					next.ServeHTTP(writer, request)
+					return
+				}
+			}
+			render.Render(writer, request, api.ErrorUnauthorized("Valid bearer token is required"))
+		})
+	}
+}
@@ -0,0 +1,37 @@
+package checker
+
+import (
+	"math"
+
+	"github.com/moira-alert/moira/anomaly"
+	"github.com/moira-alert/moira/target"
+)
+
+// getAnomalyHistory gets main target timeseries of anomaly detection history before checked interval by timeseries names
+func (triggerChecker *TriggerChecker) getAnomalyHistory() (map[string]anomaly.Series, error) {
+	from := triggerChecker.From - anomaly.HistoryInterval(triggerChecker.trigger.Anomaly)
+	result, err := triggerChecker.evaluateTarget(triggerChecker.trigger.Targets[0], from, triggerChecker.Until)
+	if err != nil {
+		return nil, err
+	}
+	history := make(map[string]anomaly.Series, len(result.TimeSeries))
+	for _, timeSeries := range result.TimeSeries {
+		history[timeSeries.Name] = getAnomalySeries(timeSeries)
+	}
+	return history, nil
+}
+
+func getAnomalySeries(timeSeries *target.TimeSeries) anomaly.Series {
+	values := make([]float64, len(timeSeries.Values))
+	for i, value := range timeSeries.Values {
+		if len(timeSeries.IsAbsent) > i && timeSeries.IsAbsent[i] {
+			value = math.NaN()
+		}
+		values[i] = value
+	}
+	return anomaly.Series{
+		StartTime: int64(timeSeries.StartTime),
+		StepTime:  int64(timeSeries.StepTime),
+		Values:    values,
+	}
+}
@@ -0,0 +1,79 @@
+package checker
+
+import (
+	"math"
+	"testing"
+
+	"github.com/go-graphite/carbonapi/expr"
+	pb "github.com/go-graphite/carbonzipper/carbonzipperpb3"
+	"github.com/op/go-logging"
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/moira-alert/moira"
+	"github.com/moira-alert/moira/anomaly"
+	"github.com/moira-alert/moira/target"
+)
+
+func TestGetAnomalySeries(t *testing.T) {
+	Convey("Absent values are NaN", t, func() {
+		timeSeries := &target.TimeSeries{MetricData: expr.MetricData{FetchResponse: pb.FetchResponse{
+			Name:      "super.puper.metric",
+			StartTime: 10,
+			StopTime:  60,
+			StepTime:  10,
+			Values:    []float64{1, 2, 3, 4, 5},
+			IsAbsent:  []bool{false, true, false, false, true},
+		}}}
+		series := getAnomalySeries(timeSeries)
+		So(series.StartTime, ShouldEqual, 10)
+		So(series.StepTime, ShouldEqual, 10)
+		So(series.Values, ShouldHaveLength, 5)
+		So(series.Values[0], ShouldEqual, 1)
+		So(math.IsNaN(series.Values[1]), ShouldBeTrue)
+		So(series.Values[3], ShouldEqual, 4)
+		So(math.IsNaN(series.Values[4]), ShouldBeTrue)
+	})
+}
+
+func TestGetTimeSeriesAnomalyState(t *testing.T) {
+	triggerChecker := TriggerChecker{
+		TriggerID: "SuperId",
+		Until:     120,
+		trigger: &moira.Trigger{
+			Anomaly: &moira.AnomalyDetection{Method: anomaly.ZScore, Window: 100, WarnDeviation: 2, ErrorDeviation: 4},
+		},
+		anomalyHistory: map[string]anomaly.Series{
+			"main.metric": {StartTime: 0, StepTime: 10, Values: []float64{9, 11, 9, 11, 9, 11, 9, 11, 9, 11}},
+		},
+	}
+	logger, _ := logging.GetLogger("Test")
+	triggerChecker.Logger = logger
+	fetchResponse := pb.FetchResponse{
+		Name:      "main.metric",
+		StartTime: 100,
+		StopTime:  120,
+		StepTime:  10,
+		Values:    []float64{10, 20},
+		IsAbsent:  []bool{false, false},
+	}
+	tts := &triggerTimeSeries{
+		Main: []*target.TimeSeries{{MetricData: expr.MetricData{FetchResponse: fetchResponse}}},
+	}
+
+	Convey("Anomaly is detected instead of thresholds evaluation", t, func() {
+		state, err := triggerChecker.getTimeSeriesState(tts, tts.Main[0], moira.MetricState{State: OK}, 100, 0)
+		So(err, ShouldBeNil)
+		So(state.State, ShouldEqual, OK)
+
+		state, err = triggerChecker.getTimeSeriesState(tts, tts.Main[0], moira.MetricState{State: OK}, 110, 0)
+		So(err, ShouldBeNil)
+		So(state.State, ShouldEqual, ERROR)
+	})
+
+	Convey("Metric without enough history is NODATA", t, func() {
+		triggerChecker.anomalyHistory = map[string]anomaly.Series{}
+		state, err := triggerChecker.getTimeSeriesState(tts, tts.Main[0], moira.MetricState{State: OK}, 110, 0)
+		So(err, ShouldBeNil)
+		So(state.State, ShouldEqual, NODATA)
+	})
+}
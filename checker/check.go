@@ -3,6 +3,7 @@ package checker
 import (
 	"fmt"
 	"github.com/moira-alert/moira"
+	"github.com/moira-alert/moira/anomaly"
 	"github.com/moira-alert/moira/target"
 )
 
@@ -55,6 +56,13 @@ func (triggerChecker *TriggerChecker) handleTrigger() (moira.CheckData, error) {
 		return checkData, ErrTriggerHasOnlyWildcards
 	}
 
+	if triggerChecker.trigger.Anomaly != nil {
+		triggerChecker.anomalyHistory, err = triggerChecker.getAnomalyHistory()
+		if err != nil {
+			return checkData, err
+		}
+	}
+
 	for _, timeSeries := range triggerTimeSeries.Main {
 		triggerChecker.Logger.Debugf("[TriggerID:%s] Checking timeSeries %s: %v", triggerChecker.TriggerID, timeSeries.Name, timeSeries.Values)
 		triggerChecker.Logger.Debugf("[TriggerID:%s][TimeSeries:%s] Checking interval: %v - %v (%vs), step: %v", triggerChecker.TriggerID, timeSeries.Name, timeSeries.StartTime, timeSeries.StopTime, timeSeries.StepTime, timeSeries.StopTime-timeSeries.StartTime)
@@ -180,12 +188,20 @@ func (triggerChecker *TriggerChecker) getTimeSeriesState(triggerTimeSeries *trig
 
 	triggerExpression.WarnValue = triggerChecker.trigger.WarnValue
 	triggerExpression.ErrorValue = triggerChecker.trigger.ErrorValue
+	triggerExpression.WarnClearValue = triggerChecker.trigger.WarnClearValue
+	triggerExpression.ErrorClearValue = triggerChecker.trigger.ErrorClearValue
 	triggerExpression.PreviousState = lastState.State
 	triggerExpression.Expression = triggerChecker.trigger.Expression
 
-	expressionState, err := triggerExpression.Evaluate()
-	if err != nil {
-		return nil, err
+	var expressionState string
+	if triggerChecker.trigger.Anomaly != nil {
+		expressionState = anomaly.Evaluate(triggerChecker.trigger.Anomaly, triggerChecker.anomalyHistory[timeSeries.Name], triggerExpression.MainTargetValue, valueTimestamp)
+	} else {
+		state, err := triggerExpression.Evaluate()
+		if err != nil {
+			return nil, err
+		}
+		expressionState = state
 	}
 
 	return &moira.MetricState{
@@ -405,6 +405,7 @@ func TestCheckErrors(t *testing.T) {
 	Convey("GetTimeSeries error", t, func() {
 		dataBase.EXPECT().GetPatternMetrics(pattern).Return([]string{metric}, nil)
 		dataBase.EXPECT().GetMetricRetention(metric).Return(retention, nil)
+		dataBase.EXPECT().GetMetricRetentionArchives(metric).Return(nil, nil)
 		dataBase.EXPECT().GetMetricsValues([]string{metric}, triggerChecker.From, triggerChecker.Until).Return(nil, metricErr)
 		dataBase.EXPECT().SetTriggerLastCheck(triggerChecker.TriggerID, &moira.CheckData{
 			Metrics:        triggerChecker.lastCheck.Metrics,
@@ -1,14 +1,28 @@
 package checker
 
-import "time"
+import (
+	"time"
+
+	"github.com/moira-alert/moira/remote"
+)
 
 // Config represent checker config
 type Config struct {
-	Enabled              bool
-	NoDataCheckInterval  time.Duration
-	CheckInterval        time.Duration
-	MetricsTTL           int64
-	StopCheckingInterval int64
-	LogFile              string
-	LogLevel             string
+	Enabled                bool
+	NoDataCheckInterval    time.Duration
+	CheckInterval          time.Duration
+	RemoteCheckInterval    time.Duration
+	MetricsTTL             int64
+	StopCheckingInterval   int64
+	MaxPatternMetrics      int64
+	MaxParallelChecks      int
+	MaxCheckQueueSize      int
+	ShardingEnabled        bool
+	ShardID                string
+	ShardHeartbeatInterval time.Duration
+	ShardHeartbeatTTL      time.Duration
+	GraphiteRemote         remote.GraphiteConfig
+	PrometheusRemote       remote.PrometheusConfig
+	LogFile                string
+	LogLevel               string
 }
@@ -51,6 +51,7 @@ func (triggerChecker *TriggerChecker) compareChecks(currentCheck moira.CheckData
 }
 
 func (triggerChecker *TriggerChecker) compareStates(metric string, currentState moira.MetricState, lastState moira.MetricState) (moira.MetricState, error) {
+	currentState = triggerChecker.applyPendingInterval(currentState, lastState)
 	if lastState.EventTimestamp != 0 {
 		currentState.EventTimestamp = lastState.EventTimestamp
 	} else {
@@ -84,6 +85,29 @@ func (triggerChecker *TriggerChecker) compareStates(metric string, currentState
 	return currentState, err
 }
 
+// applyPendingInterval keeps metric in last state while new WARN or ERROR state lasts less than trigger pending interval
+// While metric is pending, its PendingState and PendingTimestamp keep new state and time metric is in it since
+// Metric leaves bad state without waiting, pending state is restarted if metric changes WARN to ERROR or vice versa
+func (triggerChecker *TriggerChecker) applyPendingInterval(currentState moira.MetricState, lastState moira.MetricState) moira.MetricState {
+	currentState.PendingState = ""
+	currentState.PendingTimestamp = 0
+	pendingInterval := triggerChecker.trigger.PendingInterval
+	if pendingInterval <= 0 || currentState.State == lastState.State || (currentState.State != WARN && currentState.State != ERROR) {
+		return currentState
+	}
+	pendingTimestamp := currentState.Timestamp
+	if lastState.PendingState == currentState.State {
+		pendingTimestamp = lastState.PendingTimestamp
+	}
+	if currentState.Timestamp-pendingTimestamp >= pendingInterval {
+		return currentState
+	}
+	currentState.PendingState = currentState.State
+	currentState.PendingTimestamp = pendingTimestamp
+	currentState.State = lastState.State
+	return currentState
+}
+
 func (triggerChecker *TriggerChecker) isTriggerSuppressed(event *moira.NotificationEvent, timestamp int64, stateMaintenance int64, metric string) bool {
 	if !triggerChecker.trigger.Schedule.IsScheduleAllows(timestamp) {
 		triggerChecker.Logger.Debugf("Event %v suppressed due to trigger schedule", event)
@@ -290,3 +290,55 @@ func TestCompareChecks(t *testing.T) {
 		})
 	})
 }
+
+func TestApplyPendingInterval(t *testing.T) {
+	triggerChecker := TriggerChecker{
+		TriggerID: "SuperId",
+		trigger:   &moira.Trigger{PendingInterval: 300},
+	}
+	lastState := moira.MetricState{
+		State:     OK,
+		Timestamp: 1502712000,
+	}
+
+	Convey("Metric goes to pending state", t, func() {
+		currentState := moira.MetricState{State: ERROR, Timestamp: 1502712060}
+		actual := triggerChecker.applyPendingInterval(currentState, lastState)
+		So(actual, ShouldResemble, moira.MetricState{State: OK, Timestamp: 1502712060, PendingState: ERROR, PendingTimestamp: 1502712060})
+
+		Convey("Metric stays pending until pending interval passes", func() {
+			currentState := moira.MetricState{State: ERROR, Timestamp: 1502712300}
+			actual := triggerChecker.applyPendingInterval(currentState, actual)
+			So(actual, ShouldResemble, moira.MetricState{State: OK, Timestamp: 1502712300, PendingState: ERROR, PendingTimestamp: 1502712060})
+
+			Convey("Metric changes state after pending interval", func() {
+				currentState := moira.MetricState{State: ERROR, Timestamp: 1502712360}
+				actual := triggerChecker.applyPendingInterval(currentState, actual)
+				So(actual, ShouldResemble, currentState)
+			})
+		})
+
+		Convey("Pending state is restarted if metric changes bad state", func() {
+			currentState := moira.MetricState{State: WARN, Timestamp: 1502712360}
+			actual := triggerChecker.applyPendingInterval(currentState, actual)
+			So(actual, ShouldResemble, moira.MetricState{State: OK, Timestamp: 1502712360, PendingState: WARN, PendingTimestamp: 1502712360})
+		})
+
+		Convey("Metric recovers without waiting", func() {
+			currentState := moira.MetricState{State: OK, Timestamp: 1502712120}
+			actual := triggerChecker.applyPendingInterval(currentState, actual)
+			So(actual, ShouldResemble, currentState)
+		})
+	})
+
+	Convey("NODATA state is not pending", t, func() {
+		currentState := moira.MetricState{State: NODATA, Timestamp: 1502712060}
+		So(triggerChecker.applyPendingInterval(currentState, lastState), ShouldResemble, currentState)
+	})
+
+	Convey("Metric changes state at once if pending interval is not set", t, func() {
+		triggerChecker := TriggerChecker{trigger: &moira.Trigger{}}
+		currentState := moira.MetricState{State: ERROR, Timestamp: 1502712060}
+		So(triggerChecker.applyPendingInterval(currentState, lastState), ShouldResemble, currentState)
+	})
+}
@@ -2,7 +2,9 @@ package checker
 
 import (
 	"fmt"
+	"github.com/moira-alert/moira"
 	"github.com/moira-alert/moira/expression"
+	"github.com/moira-alert/moira/remote"
 	"github.com/moira-alert/moira/target"
 	"math"
 )
@@ -19,9 +21,8 @@ func (triggerChecker *TriggerChecker) getTimeSeries(from, until int64) (*trigger
 	}
 	metricsArr := make([]string, 0)
 
-	isSimpleTrigger := triggerChecker.trigger.IsSimple()
 	for targetIndex, tar := range triggerChecker.trigger.Targets {
-		result, err := target.EvaluateTarget(triggerChecker.Database, tar, from, until, isSimpleTrigger)
+		result, err := triggerChecker.evaluateTarget(tar, from, until)
 		if err != nil {
 			return nil, nil, err
 		}
@@ -44,6 +45,18 @@ func (triggerChecker *TriggerChecker) getTimeSeries(from, until int64) (*trigger
 	return triggerTimeSeries, metricsArr, nil
 }
 
+// evaluateTarget evaluates target by trigger source, remote sources do not use metrics stored in database
+func (triggerChecker *TriggerChecker) evaluateTarget(tar string, from, until int64) (*target.EvaluationResult, error) {
+	switch triggerChecker.trigger.TriggerSource {
+	case moira.GraphiteRemoteTriggerSource:
+		return remote.EvaluateGraphiteTarget(&triggerChecker.Config.GraphiteRemote, tar, from, until)
+	case moira.PrometheusRemoteTriggerSource:
+		return remote.EvaluatePrometheusTarget(&triggerChecker.Config.PrometheusRemote, tar, from, until)
+	default:
+		return target.EvaluateTarget(triggerChecker.Database, tar, from, until, triggerChecker.trigger.IsSimple(), triggerChecker.Config.MetricsTTL)
+	}
+}
+
 func (*triggerTimeSeries) getMainTargetName() string {
 	return "t1"
 }
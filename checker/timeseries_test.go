@@ -61,6 +61,7 @@ func TestGetTimeSeries(t *testing.T) {
 
 	triggerChecker := &TriggerChecker{
 		Database: dataBase,
+		Config:   &Config{},
 		trigger: &moira.Trigger{
 			Targets:  []string{pattern},
 			Patterns: []string{pattern},
@@ -70,6 +71,7 @@ func TestGetTimeSeries(t *testing.T) {
 	Convey("Error test", t, func() {
 		dataBase.EXPECT().GetPatternMetrics(pattern).Return([]string{metric}, nil)
 		dataBase.EXPECT().GetMetricRetention(metric).Return(retention, nil)
+		dataBase.EXPECT().GetMetricRetentionArchives(metric).Return(nil, nil)
 		dataBase.EXPECT().GetMetricsValues([]string{metric}, from, until).Return(nil, metricErr)
 		actual, metrics, err := triggerChecker.getTimeSeries(from, until)
 		So(actual, ShouldBeNil)
@@ -107,6 +109,7 @@ func TestGetTimeSeries(t *testing.T) {
 		Convey("Only one target", func() {
 			dataBase.EXPECT().GetPatternMetrics(pattern).Return([]string{metric}, nil)
 			dataBase.EXPECT().GetMetricRetention(metric).Return(retention, nil)
+			dataBase.EXPECT().GetMetricRetentionArchives(metric).Return(nil, nil)
 			dataBase.EXPECT().GetMetricsValues([]string{metric}, from, until).Return(dataList, nil)
 			actual, metrics, err := triggerChecker.getTimeSeries(from, until)
 			fetchResponse := pb.FetchResponse{
@@ -133,10 +136,12 @@ func TestGetTimeSeries(t *testing.T) {
 
 			dataBase.EXPECT().GetPatternMetrics(pattern).Return([]string{metric}, nil)
 			dataBase.EXPECT().GetMetricRetention(metric).Return(retention, nil)
+			dataBase.EXPECT().GetMetricRetentionArchives(metric).Return(nil, nil)
 			dataBase.EXPECT().GetMetricsValues([]string{metric}, from, until).Return(dataList, nil)
 
 			dataBase.EXPECT().GetPatternMetrics(addPattern).Return([]string{addMetric}, nil)
 			dataBase.EXPECT().GetMetricRetention(addMetric).Return(retention, nil)
+			dataBase.EXPECT().GetMetricRetentionArchives(addMetric).Return(nil, nil)
 			dataBase.EXPECT().GetMetricsValues([]string{addMetric}, from, until).Return(dataList, nil)
 
 			actual, metrics, err := triggerChecker.getTimeSeries(from, until)
@@ -165,10 +170,12 @@ func TestGetTimeSeries(t *testing.T) {
 
 			dataBase.EXPECT().GetPatternMetrics(pattern).Return([]string{metric}, nil)
 			dataBase.EXPECT().GetMetricRetention(metric).Return(retention, nil)
+			dataBase.EXPECT().GetMetricRetentionArchives(metric).Return(nil, nil)
 			dataBase.EXPECT().GetMetricsValues([]string{metric}, from, until).Return(dataList, nil)
 
 			dataBase.EXPECT().GetPatternMetrics(addPattern).Return([]string{addMetric, addMetric2}, nil)
 			dataBase.EXPECT().GetMetricRetention(addMetric).Return(retention, nil)
+			dataBase.EXPECT().GetMetricRetentionArchives(addMetric).Return(nil, nil)
 			dataBase.EXPECT().GetMetricsValues([]string{addMetric, addMetric2}, from, until).Return(dataList, nil)
 
 			actual, metrics, err := triggerChecker.getTimeSeries(from, until)
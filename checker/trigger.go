@@ -3,6 +3,7 @@ package checker
 import (
 	"errors"
 	"github.com/moira-alert/moira"
+	"github.com/moira-alert/moira/anomaly"
 	"github.com/moira-alert/moira/database"
 	"github.com/moira-alert/moira/metrics/graphite"
 	"time"
@@ -24,6 +25,8 @@ type TriggerChecker struct {
 
 	ttl      int64
 	ttlState string
+
+	anomalyHistory map[string]anomaly.Series
 }
 
 // ErrTriggerNotExists used if trigger to check does not exists
@@ -1,34 +1,48 @@
 package worker
 
 import (
-	"sync"
+	"fmt"
+	"sync/atomic"
 	"time"
 
 	"github.com/moira-alert/moira"
+	"github.com/moira-alert/moira/database"
 )
 
 func (worker *Checker) metricsChecker(metricEventsChannel <-chan *moira.MetricEvent) error {
-	var handleMetricWG sync.WaitGroup
 	for {
 		metricEvent, ok := <-metricEventsChannel
 		if !ok {
-			handleMetricWG.Wait()
 			worker.Logger.Info("Checking for new event stopped")
 			return nil
 		}
-		if err := worker.handleMetricEvent(metricEvent, &handleMetricWG); err != nil {
+		if err := worker.handleMetricEvent(metricEvent); err != nil {
+			// Event is not acknowledged, so it is delivered again if streams transport is used
 			worker.Logger.Errorf("Failed to handle metricEvent: %s", err.Error())
 		}
 	}
 }
 
-func (worker *Checker) handleMetricEvent(metricEvent *moira.MetricEvent, handleMetricWG *sync.WaitGroup) error {
+func (worker *Checker) handleMetricEvent(metricEvent *moira.MetricEvent) error {
 	worker.lastData = time.Now().UTC().Unix()
 	pattern := metricEvent.Pattern
 	metric := metricEvent.Metric
 
-	if err := worker.Database.AddPatternMetric(pattern, metric); err != nil {
-		return err
+	if err := worker.Database.AddPatternMetric(pattern, metric, worker.Config.MaxPatternMetrics); err != nil {
+		if err != database.ErrPatternMetricsLimitExceeded {
+			return err
+		}
+		// Metric is not added to pattern metrics, so triggers checks are not affected by it
+		// and do not remove its values, values saved by filter are expired here instead
+		worker.Metrics.PatternMetricsLimitExceeded.Mark(1)
+		if err := worker.Database.ExpireMetricValues(metric, worker.Config.MetricsTTL); err != nil {
+			return err
+		}
+		if worker.Cache.Add(patternMetricsLimitCacheKey(pattern), true, time.Minute) == nil {
+			worker.Logger.Warningf("Pattern %s has %d metrics already, new metric %s is skipped", pattern, worker.Config.MaxPatternMetrics, metric)
+		}
+		worker.newMetricEventAck(metricEvent).release()
+		return nil
 	}
 	triggerIds, err := worker.Database.GetPatternTriggerIDs(pattern)
 	if err != nil {
@@ -40,7 +54,52 @@ func (worker *Checker) handleMetricEvent(metricEvent *moira.MetricEvent, handleM
 			return err
 		}
 	}
-	handleMetricWG.Wait()
-	worker.perform(triggerIds, worker.Config.CheckInterval, handleMetricWG)
+	// Events delivered by streams transport are received by only one checker, so it checks all triggers of event
+	if metricEvent.ID == "" {
+		triggerIds = worker.filterOwnTriggers(triggerIds)
+	}
+	worker.perform(triggerIds, worker.Config.CheckInterval, highPriority, worker.newMetricEventAck(metricEvent))
 	return nil
 }
+
+// metricEventAck acknowledges metric event when all checks of event triggers are performed
+// If any check is dropped, event is not acknowledged and it is delivered again if streams transport is used
+type metricEventAck struct {
+	pending int32
+	ack     func()
+}
+
+// newMetricEventAck creates ack of metric event, it is nil if event does not need acknowledgement
+// Ack is held by its creator until release is called
+func (worker *Checker) newMetricEventAck(metricEvent *moira.MetricEvent) *metricEventAck {
+	if metricEvent.ID == "" {
+		return nil
+	}
+	return &metricEventAck{
+		pending: 1,
+		ack: func() {
+			if err := worker.Database.AckMetricEvent(metricEvent); err != nil {
+				worker.Logger.Errorf("Failed to acknowledge metricEvent: %s", err.Error())
+			}
+		},
+	}
+}
+
+// add holds ack until one more check is performed
+func (ack *metricEventAck) add() {
+	if ack != nil {
+		atomic.AddInt32(&ack.pending, 1)
+	}
+}
+
+// release acknowledges metric event if nothing holds ack anymore
+func (ack *metricEventAck) release() {
+	if ack != nil && atomic.AddInt32(&ack.pending, -1) == 0 {
+		ack.ack()
+	}
+}
+
+// patternMetricsLimitCacheKey is used to log exceeded pattern metrics limit not more than once a minute
+func patternMetricsLimitCacheKey(pattern string) string {
+	return fmt.Sprintf("pattern-metrics-limit:%s", pattern)
+}
@@ -2,19 +2,27 @@ package worker
 
 import (
 	"runtime/debug"
-	"sync"
 	"time"
 
 	"github.com/moira-alert/moira/checker"
 )
 
-func (worker *Checker) perform(triggerIDs []string, cacheTTL time.Duration, wg *sync.WaitGroup) {
+// perform queues checks of triggers which are not checked during cacheTTL
+// Metric event ack, which can be nil, is released when all queued checks are performed
+func (worker *Checker) perform(triggerIDs []string, cacheTTL time.Duration, priority int, ack *metricEventAck) {
 	for _, triggerID := range triggerIDs {
-		if worker.needHandleTrigger(triggerID, cacheTTL) {
-			wg.Add(1)
-			go worker.handle(triggerID, wg)
+		if !worker.needHandleTrigger(triggerID, cacheTTL) {
+			continue
+		}
+		ack.add()
+		if dropped := worker.queue.push(triggerID, priority, ack); dropped != "" {
+			// Dropped check is not performed, so trigger must not wait cacheTTL for the next check
+			worker.Metrics.CheckQueueDropped.Mark(1)
+			worker.Cache.Delete(dropped)
 		}
 	}
+	ack.release()
+	worker.Metrics.CheckQueueLength.Update(int64(worker.queue.len()))
 }
 
 func (worker *Checker) needHandleTrigger(triggerID string, cacheTTL time.Duration) bool {
@@ -22,8 +30,23 @@ func (worker *Checker) needHandleTrigger(triggerID string, cacheTTL time.Duratio
 	return err == nil
 }
 
-func (worker *Checker) handle(triggerID string, wg *sync.WaitGroup) {
-	defer wg.Done()
+// checkWorker checks queued triggers until checker is stopped
+func (worker *Checker) checkWorker() error {
+	for {
+		check, ok := worker.queue.pop(&worker.tomb)
+		if !ok {
+			return nil
+		}
+		worker.Metrics.CheckQueueWait.UpdateSince(check.queuedAt)
+		worker.Metrics.CheckQueueLength.Update(int64(worker.queue.len()))
+		worker.handle(check.triggerID)
+		for _, ack := range check.acks {
+			ack.release()
+		}
+	}
+}
+
+func (worker *Checker) handle(triggerID string) {
 	defer func() {
 		if r := recover(); r != nil {
 			worker.Metrics.HandleError.Mark(1)
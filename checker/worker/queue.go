@@ -0,0 +1,107 @@
+package worker
+
+import (
+	"container/list"
+	"sync"
+	"time"
+
+	"gopkg.in/tomb.v2"
+)
+
+// Priorities of triggers checks, checks of triggers with new metric events and remote triggers are performed before NODATA checks
+const (
+	lowPriority = iota
+	highPriority
+)
+
+// checkQueue is bounded queue of triggers to check, every trigger is queued only once
+// If queue is full, the newest low priority check is dropped to queue high priority check
+type checkQueue struct {
+	sync.Mutex
+	maxSize int
+	// lists[priority] contains queued checks of given priority in order they are queued
+	lists   [2]*list.List
+	queued  map[string]*list.Element
+	pending chan struct{}
+}
+
+type queuedCheck struct {
+	triggerID string
+	priority  int
+	queuedAt  time.Time
+	// acks are released after check is performed, acks of dropped check are never released
+	acks []*metricEventAck
+}
+
+func newCheckQueue(maxSize int) *checkQueue {
+	return &checkQueue{
+		maxSize: maxSize,
+		lists:   [2]*list.List{list.New(), list.New()},
+		queued:  make(map[string]*list.Element),
+		pending: make(chan struct{}, maxSize),
+	}
+}
+
+// push queues trigger check with metric event ack, which can be nil,
+// already queued low priority check is moved to high priority queue if needed
+// If queue is full, returns ID of dropped trigger check, it is either this check or the newest low priority one
+func (queue *checkQueue) push(triggerID string, priority int, ack *metricEventAck) string {
+	queue.Lock()
+	defer queue.Unlock()
+	if element, ok := queue.queued[triggerID]; ok {
+		check := element.Value.(*queuedCheck)
+		check.addAck(ack)
+		if check.priority < priority {
+			queue.lists[check.priority].Remove(element)
+			check.priority = priority
+			queue.queued[triggerID] = queue.lists[priority].PushBack(check)
+		}
+		return ""
+	}
+	check := &queuedCheck{triggerID: triggerID, priority: priority, queuedAt: time.Now()}
+	check.addAck(ack)
+	if len(queue.queued) >= queue.maxSize {
+		dropped := queue.lists[lowPriority].Back()
+		if priority == lowPriority || dropped == nil {
+			return triggerID
+		}
+		droppedTriggerID := queue.lists[lowPriority].Remove(dropped).(*queuedCheck).triggerID
+		delete(queue.queued, droppedTriggerID)
+		queue.queued[triggerID] = queue.lists[priority].PushBack(check)
+		return droppedTriggerID
+	}
+	queue.queued[triggerID] = queue.lists[priority].PushBack(check)
+	queue.pending <- struct{}{}
+	return ""
+}
+
+// pop waits for queued check, returns false if tomb is dying
+func (queue *checkQueue) pop(tomb *tomb.Tomb) (*queuedCheck, bool) {
+	select {
+	case <-tomb.Dying():
+		return nil, false
+	case <-queue.pending:
+	}
+	queue.Lock()
+	defer queue.Unlock()
+	element := queue.lists[highPriority].Front()
+	if element == nil {
+		element = queue.lists[lowPriority].Front()
+	}
+	check := queue.lists[element.Value.(*queuedCheck).priority].Remove(element).(*queuedCheck)
+	delete(queue.queued, check.triggerID)
+	return check, true
+}
+
+func (check *queuedCheck) addAck(ack *metricEventAck) {
+	if ack != nil {
+		check.acks = append(check.acks, ack)
+	}
+}
+
+// len returns count of queued checks
+func (queue *checkQueue) len() int {
+	queue.Lock()
+	defer queue.Unlock()
+	return len(queue.queued)
+}
@@ -0,0 +1,146 @@
+package worker
+
+import (
+	"testing"
+	"time"
+
+	"github.com/patrickmn/go-cache"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/tomb.v2"
+
+	"github.com/moira-alert/moira/metrics/graphite/go-metrics"
+)
+
+func TestCheckQueue(t *testing.T) {
+	var tomb1 tomb.Tomb
+	popAll := func(queue *checkQueue) []string {
+		triggerIDs := make([]string, 0)
+		for queue.len() > 0 {
+			check, ok := queue.pop(&tomb1)
+			So(ok, ShouldBeTrue)
+			triggerIDs = append(triggerIDs, check.triggerID)
+		}
+		return triggerIDs
+	}
+
+	Convey("High priority checks are popped first in queued order", t, func() {
+		queue := newCheckQueue(10)
+		So(queue.push("1", lowPriority, nil), ShouldBeEmpty)
+		So(queue.push("2", highPriority, nil), ShouldBeEmpty)
+		So(queue.push("3", lowPriority, nil), ShouldBeEmpty)
+		So(queue.push("4", highPriority, nil), ShouldBeEmpty)
+		So(popAll(queue), ShouldResemble, []string{"2", "4", "1", "3"})
+	})
+
+	Convey("Trigger is queued only once", t, func() {
+		queue := newCheckQueue(10)
+		So(queue.push("1", highPriority, nil), ShouldBeEmpty)
+		So(queue.push("2", lowPriority, nil), ShouldBeEmpty)
+		So(queue.push("1", lowPriority, nil), ShouldBeEmpty)
+		So(queue.len(), ShouldEqual, 2)
+
+		Convey("Low priority check is moved to high priority", func() {
+			So(queue.push("3", highPriority, nil), ShouldBeEmpty)
+			So(queue.push("2", highPriority, nil), ShouldBeEmpty)
+			So(queue.len(), ShouldEqual, 3)
+			So(popAll(queue), ShouldResemble, []string{"1", "3", "2"})
+		})
+	})
+
+	Convey("Full queue", t, func() {
+		queue := newCheckQueue(2)
+		So(queue.push("1", lowPriority, nil), ShouldBeEmpty)
+		So(queue.push("2", lowPriority, nil), ShouldBeEmpty)
+
+		Convey("Drops low priority check", func() {
+			So(queue.push("3", lowPriority, nil), ShouldEqual, "3")
+			So(popAll(queue), ShouldResemble, []string{"1", "2"})
+		})
+
+		Convey("Drops the newest low priority check to queue high priority check", func() {
+			So(queue.push("3", highPriority, nil), ShouldEqual, "2")
+			So(queue.push("4", highPriority, nil), ShouldEqual, "1")
+			So(queue.push("5", highPriority, nil), ShouldEqual, "5")
+			So(popAll(queue), ShouldResemble, []string{"3", "4"})
+		})
+	})
+
+	Convey("Acks of every push are kept by queued check", t, func() {
+		queue := newCheckQueue(10)
+		ack1, ack2 := &metricEventAck{}, &metricEventAck{}
+		So(queue.push("1", lowPriority, ack1), ShouldBeEmpty)
+		So(queue.push("1", highPriority, nil), ShouldBeEmpty)
+		So(queue.push("1", highPriority, ack2), ShouldBeEmpty)
+		check, ok := queue.pop(&tomb1)
+		So(ok, ShouldBeTrue)
+		So(check.acks, ShouldResemble, []*metricEventAck{ack1, ack2})
+	})
+
+	Convey("Pop returns false if tomb is dying", t, func() {
+		var tomb2 tomb.Tomb
+		tomb2.Kill(nil)
+		_, ok := newCheckQueue(1).pop(&tomb2)
+		So(ok, ShouldBeFalse)
+	})
+}
+
+func TestPerform(t *testing.T) {
+	newWorker := func(queueSize int) *Checker {
+		return &Checker{
+			Metrics: metrics.ConfigureCheckerMetrics("test"),
+			Cache:   cache.New(time.Minute, time.Minute),
+			queue:   newCheckQueue(queueSize),
+		}
+	}
+	newAck := func(acked *int) *metricEventAck {
+		return &metricEventAck{pending: 1, ack: func() { *acked++ }}
+	}
+	var tomb1 tomb.Tomb
+
+	Convey("Metric event is acknowledged after all its checks are performed", t, func() {
+		worker := newWorker(10)
+		acked := 0
+		worker.perform([]string{"1", "2"}, time.Minute, highPriority, newAck(&acked))
+		So(acked, ShouldEqual, 0)
+
+		for i := 0; i < 2; i++ {
+			check, _ := worker.queue.pop(&tomb1)
+			So(acked, ShouldEqual, 0)
+			for _, ack := range check.acks {
+				ack.release()
+			}
+		}
+		So(acked, ShouldEqual, 1)
+	})
+
+	Convey("Metric event without checks to perform is acknowledged at once", t, func() {
+		worker := newWorker(10)
+		worker.perform([]string{"1"}, time.Minute, highPriority, nil)
+		acked := 0
+		worker.perform([]string{"1"}, time.Minute, highPriority, newAck(&acked))
+		So(acked, ShouldEqual, 1)
+	})
+
+	Convey("Dropped check", t, func() {
+		worker := newWorker(1)
+		worker.perform([]string{"1"}, time.Minute, lowPriority, nil)
+
+		Convey("Is not cached and its metric event is not acknowledged", func() {
+			acked := 0
+			worker.perform([]string{"2"}, time.Minute, lowPriority, newAck(&acked))
+			So(acked, ShouldEqual, 0)
+			_, cached := worker.Cache.Get("2")
+			So(cached, ShouldBeFalse)
+			_, cached = worker.Cache.Get("1")
+			So(cached, ShouldBeTrue)
+		})
+
+		Convey("Evicted by high priority check is not cached", func() {
+			worker.perform([]string{"2"}, time.Minute, highPriority, nil)
+			_, cached := worker.Cache.Get("1")
+			So(cached, ShouldBeFalse)
+			_, cached = worker.Cache.Get("2")
+			So(cached, ShouldBeTrue)
+		})
+	})
+}
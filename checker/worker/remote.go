@@ -0,0 +1,30 @@
+package worker
+
+import "time"
+
+// remoteTriggersChecker periodically checks triggers of remote sources,
+// they have no metric events and must be checked even if no metrics are received by filter
+func (worker *Checker) remoteTriggersChecker() error {
+	checkTicker := time.NewTicker(worker.Config.RemoteCheckInterval)
+	for {
+		select {
+		case <-worker.tomb.Dying():
+			checkTicker.Stop()
+			worker.Logger.Info("Remote triggers checker stopped")
+			return nil
+		case <-checkTicker.C:
+			if err := worker.checkRemoteTriggers(); err != nil {
+				worker.Logger.Errorf("Remote triggers check failed: %s", err.Error())
+			}
+		}
+	}
+}
+
+func (worker *Checker) checkRemoteTriggers() error {
+	triggerIds, err := worker.Database.GetRemoteTriggerIDs()
+	if err != nil {
+		return err
+	}
+	worker.perform(worker.filterOwnTriggers(triggerIds), worker.Config.CheckInterval, highPriority, nil)
+	return nil
+}
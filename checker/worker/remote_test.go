@@ -0,0 +1,59 @@
+package worker
+
+import (
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/op/go-logging"
+	"github.com/patrickmn/go-cache"
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/moira-alert/moira"
+	"github.com/moira-alert/moira/checker"
+	"github.com/moira-alert/moira/metrics/graphite/go-metrics"
+	"github.com/moira-alert/moira/mock/moira-alert"
+)
+
+func TestRemoteTriggersChecker(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	database := mock_moira_alert.NewMockDatabase(mockCtrl)
+	logger, _ := logging.GetLogger("Test")
+
+	Convey("Remote trigger is checked without metric events", t, func() {
+		worker := &Checker{
+			Logger:   logger,
+			Database: database,
+			Config: &checker.Config{
+				NoDataCheckInterval:  time.Hour,
+				CheckInterval:        time.Millisecond,
+				RemoteCheckInterval:  10 * time.Millisecond,
+				StopCheckingInterval: 30,
+				MaxParallelChecks:    1,
+			},
+			Metrics: metrics.ConfigureCheckerMetrics("test"),
+			Cache:   cache.New(time.Minute, time.Minute),
+		}
+		metricEvents := make(chan *moira.MetricEvent)
+		checked := make(chan string, 1)
+		database.EXPECT().SubscribeMetricEvents(gomock.Any()).Return(metricEvents, nil)
+		database.EXPECT().GetRemoteTriggerIDs().Return([]string{"remote"}, nil).MinTimes(1)
+		database.EXPECT().SetTriggerCheckLock("remote").Return(false, nil).Do(func(triggerID string) {
+			select {
+			case checked <- triggerID:
+			default:
+			}
+		}).MinTimes(1)
+
+		So(worker.Start(), ShouldBeNil)
+		var checkedTriggerID string
+		select {
+		case checkedTriggerID = <-checked:
+		case <-time.After(time.Second):
+		}
+		close(metricEvents)
+		So(worker.Stop(), ShouldBeNil)
+		So(checkedTriggerID, ShouldEqual, "remote")
+	})
+}
@@ -0,0 +1,121 @@
+package worker
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/moira-alert/moira/shard"
+)
+
+// checkerShards divides triggers between alive checkers by consistent hashing of trigger IDs
+// Every checker updates its heartbeat and rebuilds hash ring when set of alive checkers is changed,
+// so triggers of dead checker are moved to other checkers after heartbeat ttl
+type checkerShards struct {
+	sync.RWMutex
+	self     string
+	checkers []string
+	ring     *shard.Ring
+}
+
+// getShardID returns configured checker shard ID or unique ID of this process
+func getShardID(configured string) string {
+	if configured != "" {
+		return configured
+	}
+	hostname, _ := os.Hostname()
+	return fmt.Sprintf("%s:%d", hostname, os.Getpid())
+}
+
+// owns returns true if trigger belongs to this checker, every trigger belongs to the checker until ring is built
+func (shards *checkerShards) owns(triggerID string) bool {
+	shards.RLock()
+	defer shards.RUnlock()
+	if shards.ring == nil {
+		return true
+	}
+	return shards.ring.GetShard([]byte(triggerID)) == shards.self
+}
+
+// update rebuilds hash ring if set of alive checkers is changed, returns true if ring is rebuilt
+func (shards *checkerShards) update(checkers []string) (bool, error) {
+	alive := make([]string, 0, len(checkers)+1)
+	selfFound := false
+	for _, checker := range checkers {
+		selfFound = selfFound || checker == shards.self
+		alive = append(alive, checker)
+	}
+	// This checker is alive even if its heartbeat is not saved yet
+	if !selfFound {
+		alive = append(alive, shards.self)
+	}
+	sort.Strings(alive)
+	shards.Lock()
+	defer shards.Unlock()
+	if shards.ring != nil && strings.Join(alive, ",") == strings.Join(shards.checkers, ",") {
+		return false, nil
+	}
+	ring, err := shard.NewRing(alive, 0)
+	if err != nil {
+		return false, err
+	}
+	shards.checkers = alive
+	shards.ring = ring
+	return true, nil
+}
+
+// shardsHeartbeat updates checker heartbeat and rebalances triggers between alive checkers until checker is stopped
+func (worker *Checker) shardsHeartbeat() error {
+	heartbeatTicker := time.NewTicker(worker.Config.ShardHeartbeatInterval)
+	defer heartbeatTicker.Stop()
+	for {
+		select {
+		case <-worker.tomb.Dying():
+			if err := worker.Database.RemoveCheckerHeartbeat(worker.shards.self); err != nil {
+				worker.Logger.Errorf("Failed to remove checker heartbeat: %s", err.Error())
+			}
+			worker.Logger.Info("Checker shards heartbeat stopped")
+			return nil
+		case <-heartbeatTicker.C:
+			worker.updateShards()
+		}
+	}
+}
+
+// filterOwnTriggers returns triggers belonging to this checker, all triggers are returned if sharding is disabled
+func (worker *Checker) filterOwnTriggers(triggerIDs []string) []string {
+	if worker.shards == nil {
+		return triggerIDs
+	}
+	ownTriggerIDs := make([]string, 0, len(triggerIDs))
+	for _, triggerID := range triggerIDs {
+		if worker.shards.owns(triggerID) {
+			ownTriggerIDs = append(ownTriggerIDs, triggerID)
+		}
+	}
+	return ownTriggerIDs
+}
+
+// updateShards saves heartbeat of this checker and gets alive checkers, ring is not changed if database is not available
+func (worker *Checker) updateShards() {
+	if err := worker.Database.UpdateCheckerHeartbeat(worker.shards.self); err != nil {
+		worker.Logger.Errorf("Failed to update checker heartbeat: %s", err.Error())
+		return
+	}
+	checkers, err := worker.Database.GetAliveCheckers(int64(worker.Config.ShardHeartbeatTTL / time.Second))
+	if err != nil {
+		worker.Logger.Errorf("Failed to get alive checkers: %s", err.Error())
+		return
+	}
+	rebuilt, err := worker.shards.update(checkers)
+	if err != nil {
+		worker.Logger.Errorf("Failed to update checker shards: %s", err.Error())
+		return
+	}
+	if rebuilt {
+		worker.Logger.Infof("Triggers are divided between %d checkers: %s", len(worker.shards.checkers), strings.Join(worker.shards.checkers, ", "))
+	}
+}
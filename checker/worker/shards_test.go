@@ -0,0 +1,74 @@
+package worker
+
+import (
+	"fmt"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestCheckerShards(t *testing.T) {
+	triggerIDs := make([]string, 0, 1000)
+	for i := 0; i < 1000; i++ {
+		triggerIDs = append(triggerIDs, fmt.Sprintf("trigger-%d", i))
+	}
+	countOwn := func(shards *checkerShards) int {
+		count := 0
+		for _, triggerID := range triggerIDs {
+			if shards.owns(triggerID) {
+				count++
+			}
+		}
+		return count
+	}
+
+	Convey("Checker owns all triggers until ring is built", t, func() {
+		shards := &checkerShards{self: "checker1"}
+		So(countOwn(shards), ShouldEqual, len(triggerIDs))
+
+		Convey("Checker is added to alive checkers", func() {
+			rebuilt, err := shards.update(nil)
+			So(err, ShouldBeNil)
+			So(rebuilt, ShouldBeTrue)
+			So(shards.checkers, ShouldResemble, []string{"checker1"})
+			So(countOwn(shards), ShouldEqual, len(triggerIDs))
+		})
+	})
+
+	Convey("Every trigger is owned by exactly one checker", t, func() {
+		checkers := []string{"checker3", "checker1", "checker2"}
+		owners := make(map[string]int)
+		total := 0
+		for _, checker := range checkers {
+			shards := &checkerShards{self: checker}
+			_, err := shards.update(checkers)
+			So(err, ShouldBeNil)
+			owners[checker] = countOwn(shards)
+			total += owners[checker]
+		}
+		So(total, ShouldEqual, len(triggerIDs))
+		for _, checker := range checkers {
+			So(owners[checker], ShouldBeGreaterThan, 0)
+		}
+	})
+
+	Convey("Ring is rebuilt only if alive checkers are changed", t, func() {
+		shards := &checkerShards{self: "checker1"}
+		rebuilt, err := shards.update([]string{"checker2", "checker1"})
+		So(err, ShouldBeNil)
+		So(rebuilt, ShouldBeTrue)
+
+		rebuilt, err = shards.update([]string{"checker1", "checker2"})
+		So(err, ShouldBeNil)
+		So(rebuilt, ShouldBeFalse)
+
+		Convey("Triggers of dead checker are moved to alive checker", func() {
+			ownBefore := countOwn(shards)
+			rebuilt, err = shards.update([]string{"checker1"})
+			So(err, ShouldBeNil)
+			So(rebuilt, ShouldBeTrue)
+			So(ownBefore, ShouldBeLessThan, len(triggerIDs))
+			So(countOwn(shards), ShouldEqual, len(triggerIDs))
+		})
+	})
+}
@@ -1,6 +1,7 @@
 package worker
 
 import (
+	"runtime"
 	"time"
 
 	"github.com/patrickmn/go-cache"
@@ -11,6 +12,13 @@ import (
 	"github.com/moira-alert/moira/metrics/graphite"
 )
 
+// Defaults used if settings are not set
+const (
+	defaultMaxCheckQueueSize      = 100000
+	defaultShardHeartbeatInterval = 5 * time.Second
+	defaultRemoteCheckInterval    = time.Minute
+)
+
 // Checker represents workers for periodically triggers checking based by new events
 type Checker struct {
 	Logger   moira.Logger
@@ -19,21 +27,54 @@ type Checker struct {
 	Metrics  *graphite.CheckerMetrics
 	Cache    *cache.Cache
 	lastData int64
+	queue    *checkQueue
+	shards   *checkerShards
 	tomb     tomb.Tomb
 }
 
 // Start start schedule new MetricEvents and check for NODATA triggers
 func (worker *Checker) Start() error {
 	worker.lastData = time.Now().UTC().Unix()
+	if worker.Config.MaxParallelChecks <= 0 {
+		worker.Config.MaxParallelChecks = runtime.NumCPU()
+	}
+	if worker.Config.MaxCheckQueueSize <= 0 {
+		worker.Config.MaxCheckQueueSize = defaultMaxCheckQueueSize
+	}
+	if worker.Config.RemoteCheckInterval <= 0 {
+		worker.Config.RemoteCheckInterval = defaultRemoteCheckInterval
+	}
+	worker.queue = newCheckQueue(worker.Config.MaxCheckQueueSize)
+
+	if worker.Config.ShardingEnabled {
+		if worker.Config.ShardHeartbeatInterval <= 0 {
+			worker.Config.ShardHeartbeatInterval = defaultShardHeartbeatInterval
+		}
+		if worker.Config.ShardHeartbeatTTL < worker.Config.ShardHeartbeatInterval {
+			worker.Config.ShardHeartbeatTTL = 3 * worker.Config.ShardHeartbeatInterval
+		}
+		worker.shards = &checkerShards{self: getShardID(worker.Config.ShardID)}
+		worker.updateShards()
+		worker.tomb.Go(worker.shardsHeartbeat)
+		worker.Logger.Infof("Moira Checker shard %s started", worker.shards.self)
+	}
 
 	metricEventsChannel, err := worker.Database.SubscribeMetricEvents(&worker.tomb)
 	if err != nil {
 		return err
 	}
 
+	for i := 0; i < worker.Config.MaxParallelChecks; i++ {
+		worker.tomb.Go(worker.checkWorker)
+	}
+	worker.Logger.Infof("Moira Checker %d check workers started", worker.Config.MaxParallelChecks)
+
 	worker.tomb.Go(worker.noDataChecker)
 	worker.Logger.Info("Moira Checker NoData checker started")
 
+	worker.tomb.Go(worker.remoteTriggersChecker)
+	worker.Logger.Info("Moira Checker remote triggers checker started")
+
 	worker.tomb.Go(func() error {
 		return worker.metricsChecker(metricEventsChannel)
 	})
@@ -12,30 +12,41 @@ type config struct {
 }
 
 type apiConfig struct {
-	Listen     string `yaml:"listen"`
-	EnableCORS string `yaml:"enable_cors"`
+	Listen                   string                `yaml:"listen"`
+	EnableCORS               string                `yaml:"enable_cors"`
+	MetricsTokens            []string              `yaml:"metrics_tokens"`
+	MetricsRetentionConfig   string                `yaml:"metrics_retention_config"`
+	MetricsAggregationConfig string                `yaml:"metrics_aggregation_config"`
+	MetricsTTL               int64                 `yaml:"metrics_ttl"`
+	MetricRules              cmd.MetricRulesConfig `yaml:"metric_rules"`
 }
 
 func (config *apiConfig) getSettings() *api.Config {
 	return &api.Config{
-		Listen:     config.Listen,
-		EnableCORS: cmd.ToBool(config.EnableCORS),
+		Listen:        config.Listen,
+		EnableCORS:    cmd.ToBool(config.EnableCORS),
+		MetricsTokens: config.MetricsTokens,
+		MetricsTTL:    config.MetricsTTL,
 	}
 }
 
 func getDefault() config {
 	return config{
 		Redis: cmd.RedisConfig{
-			Host: "localhost",
-			Port: "6379",
+			Host:                     "localhost",
+			Port:                     "6379",
+			MetricEventsTransport:    "pubsub",
+			MetricEventsStreamMaxLen: 1000000,
 		},
 		Logger: cmd.LoggerConfig{
 			LogFile:  "stdout",
 			LogLevel: "debug",
 		},
 		API: apiConfig{
-			Listen:     ":8081",
-			EnableCORS: "true",
+			Listen:                 ":8081",
+			EnableCORS:             "true",
+			MetricsRetentionConfig: "/etc/moira/storage-schemas.conf",
+			MetricsTTL:             3600,
 		},
 	}
 }
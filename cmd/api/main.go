@@ -4,6 +4,7 @@ import (
 	"context"
 	"flag"
 	"fmt"
+	"io"
 	"net"
 	"net/http"
 	"os"
@@ -15,7 +16,11 @@ import (
 	"github.com/moira-alert/moira/api/handler"
 	"github.com/moira-alert/moira/cmd"
 	"github.com/moira-alert/moira/database/redis"
+	"github.com/moira-alert/moira/filter"
+	"github.com/moira-alert/moira/filter/patterns"
 	"github.com/moira-alert/moira/logging/go-logging"
+	"github.com/moira-alert/moira/metrics/graphite"
+	"github.com/moira-alert/moira/metrics/graphite/go-metrics"
 )
 
 const serviceName = "api"
@@ -73,7 +78,19 @@ func main() {
 
 	logger.Infof("Start listening by address: [%s]", apiConfig.Listen)
 
-	httpHandler := handler.NewHandler(database, logger, apiConfig)
+	var patternStorage *filter.PatternStorage
+	var cacheStorage *filter.Storage
+	if len(apiConfig.MetricsTokens) > 0 {
+		filterMetrics := metrics.ConfigureFilterMetrics(serviceName)
+		patternStorage, cacheStorage = newMetricsStorages(database, logger, filterMetrics, config.API)
+		refreshPatternWorker := patterns.NewRefreshPatternWorker(database, filterMetrics, logger, patternStorage)
+		if err := refreshPatternWorker.Start(); err != nil {
+			logger.Fatalf("Failed to refresh pattern storage: %s", err.Error())
+		}
+		defer stopRefreshPatternWorker(logger, refreshPatternWorker)
+	}
+
+	httpHandler := handler.NewHandler(database, logger, apiConfig, patternStorage, cacheStorage)
 	server := &http.Server{
 		Handler: httpHandler,
 	}
@@ -90,6 +107,48 @@ func main() {
 	logger.Infof("Moira API shutting down.")
 }
 
+// newMetricsStorages creates pattern and cache storages used by metrics ingestion
+func newMetricsStorages(database moira.Database, logger moira.Logger, filterMetrics *graphite.FilterMetrics, config apiConfig) (*filter.PatternStorage, *filter.Storage) {
+	retentionConfigFile, err := os.Open(config.MetricsRetentionConfig)
+	if err != nil {
+		logger.Fatalf("Error open retentions file [%s]: %s", config.MetricsRetentionConfig, err.Error())
+	}
+	defer retentionConfigFile.Close()
+
+	var aggregationConfigReader io.Reader
+	if config.MetricsAggregationConfig != "" {
+		aggregationConfigFile, err := os.Open(config.MetricsAggregationConfig)
+		if err != nil {
+			logger.Fatalf("Error open aggregation file [%s]: %s", config.MetricsAggregationConfig, err.Error())
+		}
+		defer aggregationConfigFile.Close()
+		aggregationConfigReader = aggregationConfigFile
+	}
+
+	cacheStorage, err := filter.NewCacheStorage(filterMetrics, retentionConfigFile, aggregationConfigReader)
+	if err != nil {
+		logger.Fatalf("Failed to initialize cache storage with config [%s]: %s", config.MetricsRetentionConfig, err.Error())
+	}
+	patternStorage, err := filter.NewPatternStorage(database, filterMetrics, logger)
+	if err != nil {
+		logger.Fatalf("Failed to refresh pattern storage: %s", err.Error())
+	}
+	if len(config.MetricRules) > 0 {
+		metricRules, err := filter.NewMetricRules(config.MetricRules.GetSettings())
+		if err != nil {
+			logger.Fatalf("Failed to initialize metric rules: %s", err.Error())
+		}
+		patternStorage.SetMetricRules(metricRules)
+	}
+	return patternStorage, cacheStorage
+}
+
+func stopRefreshPatternWorker(logger moira.Logger, refreshPatternWorker *patterns.RefreshPatternWorker) {
+	if err := refreshPatternWorker.Stop(); err != nil {
+		logger.Errorf("Failed to stop refresh pattern worker: %v", err)
+	}
+}
+
 // Stop Moira API HTTP server
 func Stop(logger moira.Logger, server *http.Server) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
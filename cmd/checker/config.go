@@ -3,47 +3,113 @@ package main
 import (
 	"github.com/moira-alert/moira/checker"
 	"github.com/moira-alert/moira/cmd"
+	"github.com/moira-alert/moira/remote"
 	"menteslibres.net/gosexy/to"
 )
 
 type config struct {
-	Redis    cmd.RedisConfig    `yaml:"redis"`
-	Graphite cmd.GraphiteConfig `yaml:"graphite"`
-	Logger   cmd.LoggerConfig   `yaml:"log"`
-	Checker  checkerConfig      `yaml:"checker"`
+	Redis      cmd.RedisConfig    `yaml:"redis"`
+	Graphite   cmd.GraphiteConfig `yaml:"graphite"`
+	Logger     cmd.LoggerConfig   `yaml:"log"`
+	Checker    checkerConfig      `yaml:"checker"`
+	Remote     remoteConfig       `yaml:"remote"`
+	Prometheus prometheusConfig   `yaml:"prometheus"`
 }
 
 type checkerConfig struct {
-	NoDataCheckInterval  string `yaml:"nodata_check_interval"`
-	CheckInterval        string `yaml:"check_interval"`
-	MetricsTTL           int64  `yaml:"metrics_ttl"`
-	StopCheckingInterval int64  `yaml:"stop_checking_interval"`
+	NoDataCheckInterval    string `yaml:"nodata_check_interval"`
+	CheckInterval          string `yaml:"check_interval"`
+	RemoteCheckInterval    string `yaml:"remote_check_interval"`
+	MetricsTTL             int64  `yaml:"metrics_ttl"`
+	StopCheckingInterval   int64  `yaml:"stop_checking_interval"`
+	MaxPatternMetrics      int64  `yaml:"max_pattern_metrics"`
+	MaxParallelChecks      int    `yaml:"max_parallel_checks"`
+	MaxCheckQueueSize      int    `yaml:"max_check_queue_size"`
+	Sharding               bool   `yaml:"sharding"`
+	ShardID                string `yaml:"shard_id"`
+	ShardHeartbeatInterval string `yaml:"shard_heartbeat_interval"`
+	ShardHeartbeatTTL      string `yaml:"shard_heartbeat_ttl"`
+}
+
+type remoteConfig struct {
+	URL      string `yaml:"url"`
+	Timeout  string `yaml:"timeout"`
+	User     string `yaml:"user"`
+	Password string `yaml:"password"`
+}
+
+func (config *remoteConfig) getSettings() remote.GraphiteConfig {
+	return remote.GraphiteConfig{
+		URL:      config.URL,
+		Timeout:  to.Duration(config.Timeout),
+		User:     config.User,
+		Password: config.Password,
+	}
+}
+
+type prometheusConfig struct {
+	URL      string `yaml:"url"`
+	Timeout  string `yaml:"timeout"`
+	Step     string `yaml:"step"`
+	User     string `yaml:"user"`
+	Password string `yaml:"password"`
+}
+
+func (config *prometheusConfig) getSettings() remote.PrometheusConfig {
+	return remote.PrometheusConfig{
+		URL:      config.URL,
+		Timeout:  to.Duration(config.Timeout),
+		Step:     to.Duration(config.Step),
+		User:     config.User,
+		Password: config.Password,
+	}
 }
 
 func (config *checkerConfig) getSettings() *checker.Config {
 	return &checker.Config{
-		MetricsTTL:           config.MetricsTTL,
-		CheckInterval:        to.Duration(config.CheckInterval),
-		NoDataCheckInterval:  to.Duration(config.NoDataCheckInterval),
-		StopCheckingInterval: config.StopCheckingInterval,
+		MetricsTTL:             config.MetricsTTL,
+		CheckInterval:          to.Duration(config.CheckInterval),
+		RemoteCheckInterval:    to.Duration(config.RemoteCheckInterval),
+		NoDataCheckInterval:    to.Duration(config.NoDataCheckInterval),
+		StopCheckingInterval:   config.StopCheckingInterval,
+		MaxPatternMetrics:      config.MaxPatternMetrics,
+		MaxParallelChecks:      config.MaxParallelChecks,
+		MaxCheckQueueSize:      config.MaxCheckQueueSize,
+		ShardingEnabled:        config.Sharding,
+		ShardID:                config.ShardID,
+		ShardHeartbeatInterval: to.Duration(config.ShardHeartbeatInterval),
+		ShardHeartbeatTTL:      to.Duration(config.ShardHeartbeatTTL),
 	}
 }
 
 func getDefault() config {
 	return config{
 		Redis: cmd.RedisConfig{
-			Host: "localhost",
-			Port: "6379",
+			Host:                     "localhost",
+			Port:                     "6379",
+			MetricEventsTransport:    "pubsub",
+			MetricEventsStreamMaxLen: 1000000,
 		},
 		Logger: cmd.LoggerConfig{
 			LogFile:  "stdout",
 			LogLevel: "debug",
 		},
 		Checker: checkerConfig{
-			NoDataCheckInterval:  "60s0ms",
-			CheckInterval:        "5s0ms",
-			MetricsTTL:           3600,
-			StopCheckingInterval: 30,
+			NoDataCheckInterval:    "60s0ms",
+			CheckInterval:          "5s0ms",
+			RemoteCheckInterval:    "60s0ms",
+			MetricsTTL:             3600,
+			StopCheckingInterval:   30,
+			MaxCheckQueueSize:      100000,
+			ShardHeartbeatInterval: "5s0ms",
+			ShardHeartbeatTTL:      "15s0ms",
+		},
+		Remote: remoteConfig{
+			Timeout: "60s0ms",
+		},
+		Prometheus: prometheusConfig{
+			Timeout: "60s0ms",
+			Step:    "60s0ms",
 		},
 		Graphite: cmd.GraphiteConfig{
 			URI:      "localhost:2003",
@@ -75,6 +75,8 @@ func main() {
 	}
 
 	checkerSettings := config.Checker.getSettings()
+	checkerSettings.GraphiteRemote = config.Remote.getSettings()
+	checkerSettings.PrometheusRemote = config.Prometheus.getSettings()
 	if triggerID != nil && *triggerID != "" {
 		checkSingleTrigger(database, checkerMetrics, checkerSettings)
 	}
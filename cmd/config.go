@@ -9,25 +9,57 @@ import (
 	"menteslibres.net/gosexy/to"
 
 	"github.com/moira-alert/moira/database/redis"
+	"github.com/moira-alert/moira/filter"
 	"github.com/moira-alert/moira/metrics/graphite"
 )
 
 // RedisConfig is redis config structure, which are taken on the start of moira
 type RedisConfig struct {
-	Host string `yaml:"host"`
-	Port string `yaml:"port"`
-	DBID int    `yaml:"dbid"`
+	Host                     string `yaml:"host"`
+	Port                     string `yaml:"port"`
+	DBID                     int    `yaml:"dbid"`
+	MetricEventsTransport    string `yaml:"metric_events_transport"`
+	MetricEventsStreamMaxLen int64  `yaml:"metric_events_stream_max_len"`
+	MetricEventsConsumer     string `yaml:"metric_events_consumer"`
 }
 
 // GetSettings return redis config parsed from moira config files
 func (config *RedisConfig) GetSettings() redis.Config {
 	return redis.Config{
-		Host: config.Host,
-		Port: config.Port,
-		DBID: config.DBID,
+		Host:                     config.Host,
+		Port:                     config.Port,
+		DBID:                     config.DBID,
+		MetricEventsTransport:    config.MetricEventsTransport,
+		MetricEventsStreamMaxLen: config.MetricEventsStreamMaxLen,
+		MetricEventsConsumer:     config.MetricEventsConsumer,
 	}
 }
 
+// MetricRuleConfig is rule applied to incoming metric before matching, which is taken on the start of moira
+type MetricRuleConfig struct {
+	Action      string `yaml:"action"`
+	Regex       string `yaml:"regex"`
+	Glob        string `yaml:"glob"`
+	Replacement string `yaml:"replacement"`
+}
+
+// MetricRulesConfig is list of rules applied in order to incoming metrics
+type MetricRulesConfig []MetricRuleConfig
+
+// GetSettings return metric rules config parsed from moira config files
+func (config MetricRulesConfig) GetSettings() []filter.MetricRuleConfig {
+	rules := make([]filter.MetricRuleConfig, 0, len(config))
+	for _, rule := range config {
+		rules = append(rules, filter.MetricRuleConfig{
+			Action:      rule.Action,
+			Regex:       rule.Regex,
+			Glob:        rule.Glob,
+			Replacement: rule.Replacement,
+		})
+	}
+	return rules
+}
+
 // GraphiteConfig is graphite metrics config, which are taken on the start of moira
 type GraphiteConfig struct {
 	Enabled  string `yaml:"enabled"`
@@ -2,6 +2,7 @@ package main
 
 import (
 	"github.com/moira-alert/moira/cmd"
+	"github.com/moira-alert/moira/filter/connection"
 )
 
 type config struct {
@@ -12,24 +13,87 @@ type config struct {
 }
 
 type filterConfig struct {
-	Listen          string `yaml:"listen"`
-	RetentionConfig string `yaml:"retention-config"`
+	Listen                 string                `yaml:"listen"`
+	ConnectionWorkers      int                   `yaml:"connection_workers"`
+	MaxLineSize            int                   `yaml:"max_line_size"`
+	RateLimit              float64               `yaml:"rate_limit"`
+	RateLimitBurst         int                   `yaml:"rate_limit_burst"`
+	FullChannelPolicy      string                `yaml:"full_channel_policy"`
+	TLSCertFile            string                `yaml:"tls_cert_file"`
+	TLSKeyFile             string                `yaml:"tls_key_file"`
+	TLSClientCAFile        string                `yaml:"tls_client_ca_file"`
+	TLSClientPrefixes      map[string][]string   `yaml:"tls_client_prefixes"`
+	PickleListen           string                `yaml:"pickle_listen"`
+	UDPListen              string                `yaml:"udp_listen"`
+	PrometheusListen       string                `yaml:"prometheus_listen"`
+	PrometheusMetricFormat string                `yaml:"prometheus_metric_format"`
+	InfluxListen           string                `yaml:"influx_listen"`
+	InfluxMetricFormat     string                `yaml:"influx_metric_format"`
+	OpenTSDBListen         string                `yaml:"opentsdb_listen"`
+	OpenTSDBMetricFormat   string                `yaml:"opentsdb_metric_format"`
+	RetentionConfig        string                `yaml:"retention-config"`
+	AggregationConfig      string                `yaml:"aggregation-config"`
+	AggregationRules       string                `yaml:"aggregation-rules"`
+	MetricRules            cmd.MetricRulesConfig `yaml:"metric_rules"`
+	Shards                 []string              `yaml:"shards"`
+	ShardSelf              string                `yaml:"shard_self"`
+	ShardReplicas          int                   `yaml:"shard_replicas"`
+	DebugListen            string                `yaml:"debug_listen"`
+	DebugStatsMinutes      int                   `yaml:"debug_stats_minutes"`
+}
+
+func (config *filterConfig) getHandlerConfig() connection.HandlerConfig {
+	return connection.HandlerConfig{
+		Workers:           config.ConnectionWorkers,
+		MaxLineSize:       config.MaxLineSize,
+		RateLimit:         config.RateLimit,
+		RateLimitBurst:    config.RateLimitBurst,
+		FullChannelPolicy: config.FullChannelPolicy,
+	}
+}
+
+func (config *filterConfig) getTLSConfig() connection.TLSConfig {
+	return connection.TLSConfig{
+		CertFile:       config.TLSCertFile,
+		KeyFile:        config.TLSKeyFile,
+		ClientCAFile:   config.TLSClientCAFile,
+		ClientPrefixes: config.TLSClientPrefixes,
+	}
+}
+
+func (config *filterConfig) getShardConfig() connection.ShardConfig {
+	return connection.ShardConfig{
+		Shards:   config.Shards,
+		Self:     config.ShardSelf,
+		Replicas: config.ShardReplicas,
+		TLS:      config.getTLSConfig(),
+	}
 }
 
 func getDefault() config {
 	return config{
 		Redis: cmd.RedisConfig{
-			Host: "localhost",
-			Port: "6379",
-			DBID: 0,
+			Host:                     "localhost",
+			Port:                     "6379",
+			DBID:                     0,
+			MetricEventsTransport:    "pubsub",
+			MetricEventsStreamMaxLen: 1000000,
 		},
 		Logger: cmd.LoggerConfig{
 			LogFile:  "stdout",
 			LogLevel: "debug",
 		},
 		Filter: filterConfig{
-			Listen:          ":2003",
-			RetentionConfig: "/etc/moira/storage-schemas.conf",
+			Listen:                 ":2003",
+			ConnectionWorkers:      16,
+			MaxLineSize:            4096,
+			FullChannelPolicy:      "block",
+			PrometheusMetricFormat: "tags",
+			InfluxMetricFormat:     "tags",
+			OpenTSDBMetricFormat:   "tags",
+			RetentionConfig:        "/etc/moira/storage-schemas.conf",
+			ShardReplicas:          100,
+			DebugStatsMinutes:      10,
 		},
 		Graphite: cmd.GraphiteConfig{
 			URI:      "localhost:2003",
@@ -3,6 +3,7 @@ package main
 import (
 	"flag"
 	"fmt"
+	"io"
 	"os"
 	"os/signal"
 	"syscall"
@@ -12,10 +13,12 @@ import (
 	"github.com/moira-alert/moira/database/redis"
 	"github.com/moira-alert/moira/filter"
 	"github.com/moira-alert/moira/filter/connection"
+	"github.com/moira-alert/moira/filter/debug_server"
 	"github.com/moira-alert/moira/filter/heartbeat"
 	"github.com/moira-alert/moira/filter/matched_metrics"
 	"github.com/moira-alert/moira/filter/patterns"
 	"github.com/moira-alert/moira/logging/go-logging"
+	"github.com/moira-alert/moira/metrics/graphite"
 	"github.com/moira-alert/moira/metrics/graphite/go-metrics"
 )
 
@@ -26,6 +29,9 @@ var (
 	configFileName         = flag.String("config", "/etc/moira/filter.yml", "path config file")
 	printVersion           = flag.Bool("version", false, "Print version and exit")
 	printDefaultConfigFlag = flag.Bool("default-config", false, "Print default config and exit")
+	replay                 = flag.Bool("replay", false, "Replay graphite plaintext dump files (plain or gzipped) given as arguments and exit")
+	replayRewriteTime      = flag.Bool("replay-rewrite-time", false, "Shift replayed timestamps so the first metric appears as sent now")
+	replayRealtime         = flag.Bool("replay-realtime", false, "Keep original intervals between replayed metrics")
 )
 
 // Moira filter bin version
@@ -76,7 +82,16 @@ func main() {
 		logger.Fatalf("Error open retentions file [%s]: %s", config.Filter.RetentionConfig, err.Error())
 	}
 
-	cacheStorage, err := filter.NewCacheStorage(cacheMetrics, retentionConfigFile)
+	var aggregationConfigReader io.Reader
+	if config.Filter.AggregationConfig != "" {
+		aggregationConfigFile, err := os.Open(config.Filter.AggregationConfig)
+		if err != nil {
+			logger.Fatalf("Error open aggregation file [%s]: %s", config.Filter.AggregationConfig, err.Error())
+		}
+		aggregationConfigReader = aggregationConfigFile
+	}
+
+	cacheStorage, err := filter.NewCacheStorage(cacheMetrics, retentionConfigFile, aggregationConfigReader)
 	if err != nil {
 		logger.Fatalf("Failed to initialize cache storage with config [%s]: %s", config.Filter.RetentionConfig, err.Error())
 	}
@@ -86,6 +101,39 @@ func main() {
 		logger.Fatalf("Failed to refresh pattern storage: %s", err.Error())
 	}
 
+	if len(config.Filter.MetricRules) > 0 {
+		metricRules, err := filter.NewMetricRules(config.Filter.MetricRules.GetSettings())
+		if err != nil {
+			logger.Fatalf("Failed to initialize metric rules: %s", err.Error())
+		}
+		patternStorage.SetMetricRules(metricRules)
+	}
+
+	// Aggregator must be attached to pattern storage before listeners start or metrics are replayed
+	var aggregator *filter.Aggregator
+	if config.Filter.AggregationRules != "" {
+		// Inputs of one aggregation rule can be owned by different shards, so every shard would emit partial value
+		if len(config.Filter.Shards) > 0 {
+			logger.Fatal("Aggregation rules can not be used with shards")
+		}
+		aggregator = newAggregator(config.Filter.AggregationRules, patternStorage)
+	}
+
+	if *replay {
+		replayMetrics(flag.Args(), database, cacheMetrics, patternStorage, cacheStorage)
+		return
+	}
+
+	// Debug server must attach match stats to pattern storage before listeners start
+	if config.Filter.DebugListen != "" {
+		debugServer, err := debugserver.NewServer(config.Filter.DebugListen, config.Filter.DebugStatsMinutes, logger, patternStorage)
+		if err != nil {
+			logger.Fatalf("Failed to start debug server: %s", err.Error())
+		}
+		debugServer.Start()
+		defer stopDebugServer(debugServer)
+	}
+
 	// Refresh Patterns on first init
 	refreshPatternWorker := patterns.NewRefreshPatternWorker(database, cacheMetrics, logger, patternStorage)
 
@@ -101,18 +149,85 @@ func main() {
 	heartbeatWorker.Start()
 	defer stopHeartbeatWorker(heartbeatWorker)
 
-	// Start metrics listener
-	listener, err := connection.NewListener(config.Filter.Listen, logger, patternStorage)
+	metricsChan := make(chan *moira.MatchedMetric, 10)
+
+	// Metrics owned by other filters are forwarded to them by all listeners
+	var shardForwarder *connection.ShardForwarder
+	if len(config.Filter.Shards) > 0 {
+		shardForwarder, err = connection.NewShardForwarder(config.Filter.getShardConfig(), logger, cacheMetrics)
+		if err != nil {
+			logger.Fatalf("Failed to start shard forwarder: %s", err.Error())
+		}
+	}
+
+	// Start metrics listeners
+	listener, err := connection.NewListener(config.Filter.Listen, logger, cacheMetrics, patternStorage, config.Filter.getHandlerConfig(), config.Filter.getTLSConfig(), shardForwarder)
 	if err != nil {
 		logger.Fatalf("Failed to start listen: %s", err.Error())
 	}
-	metricsChan := listener.Listen()
+	listener.Listen(metricsChan)
+	listeners := []metricsListener{listener}
+
+	if config.Filter.PickleListen != "" {
+		pickleListener, err := connection.NewPickleListener(config.Filter.PickleListen, logger, cacheMetrics, patternStorage, config.Filter.getHandlerConfig(), shardForwarder)
+		if err != nil {
+			logger.Fatalf("Failed to start listen pickle: %s", err.Error())
+		}
+		pickleListener.Listen(metricsChan)
+		listeners = append(listeners, pickleListener)
+	}
+
+	if config.Filter.UDPListen != "" {
+		udpListener, err := connection.NewUDPListener(config.Filter.UDPListen, logger, cacheMetrics, patternStorage, shardForwarder)
+		if err != nil {
+			logger.Fatalf("Failed to start listen udp: %s", err.Error())
+		}
+		udpListener.Listen(metricsChan)
+		listeners = append(listeners, udpListener)
+	}
+
+	if config.Filter.PrometheusListen != "" {
+		prometheusListener, err := connection.NewPrometheusListener(config.Filter.PrometheusListen, config.Filter.PrometheusMetricFormat, logger, patternStorage, shardForwarder)
+		if err != nil {
+			logger.Fatalf("Failed to start listen prometheus remote write: %s", err.Error())
+		}
+		prometheusListener.Listen(metricsChan)
+		listeners = append(listeners, prometheusListener)
+	}
+
+	if config.Filter.InfluxListen != "" {
+		influxListener, err := connection.NewInfluxListener(config.Filter.InfluxListen, config.Filter.InfluxMetricFormat, logger, cacheMetrics, patternStorage, config.Filter.getHandlerConfig(), shardForwarder)
+		if err != nil {
+			logger.Fatalf("Failed to start listen influx: %s", err.Error())
+		}
+		influxListener.Listen(metricsChan)
+		listeners = append(listeners, influxListener)
+	}
+
+	if config.Filter.OpenTSDBListen != "" {
+		openTSDBListener, err := connection.NewOpenTSDBListener(config.Filter.OpenTSDBListen, config.Filter.OpenTSDBMetricFormat, logger, cacheMetrics, patternStorage, config.Filter.getHandlerConfig(), shardForwarder)
+		if err != nil {
+			logger.Fatalf("Failed to start listen opentsdb: %s", err.Error())
+		}
+		openTSDBListener.Listen(metricsChan)
+		listeners = append(listeners, openTSDBListener)
+	}
+
+	// Forwarder is stopped after listeners to send all forwarded lines
+	if shardForwarder != nil {
+		listeners = append(listeners, shardForwarder)
+	}
+
+	if aggregator != nil {
+		aggregator.Start(metricsChan)
+		listeners = append(listeners, aggregator)
+	}
 
 	// Start metrics matcher
 	metricsMatcher := matchedmetrics.NewMetricsMatcher(cacheMetrics, logger, database, cacheStorage)
 	metricsMatcher.Start(metricsChan)
-	defer metricsMatcher.Wait()  // First stop listener
-	defer stopListener(listener) // Then waiting for metrics matcher handle all received events
+	defer metricsMatcher.Wait()                 // First stop listeners
+	defer stopListeners(listeners, metricsChan) // Then waiting for metrics matcher handle all received events
 
 	logger.Infof("Moira Filter started. Version: %s", MoiraVersion)
 	ch := make(chan os.Signal, 1)
@@ -121,9 +236,60 @@ func main() {
 	logger.Infof("Moira Filter shutting down.")
 }
 
-func stopListener(listener *connection.MetricsListener) {
-	if err := listener.Stop(); err != nil {
-		logger.Errorf("Failed to stop listener: %v", err)
+func newAggregator(rulesFileName string, patternStorage *filter.PatternStorage) *filter.Aggregator {
+	rulesFile, err := os.Open(rulesFileName)
+	if err != nil {
+		logger.Fatalf("Error open aggregation rules file [%s]: %s", rulesFileName, err.Error())
+	}
+	defer rulesFile.Close()
+	aggregator, err := filter.NewAggregator(logger, patternStorage, rulesFile)
+	if err != nil {
+		logger.Fatalf("Failed to initialize aggregator with rules [%s]: %s", rulesFileName, err.Error())
+	}
+	return aggregator
+}
+
+// replayMetrics passes metrics from dump files through patterns storage and saves matched metrics to database
+func replayMetrics(fileNames []string, database moira.Database, cacheMetrics *graphite.FilterMetrics, patternStorage *filter.PatternStorage, cacheStorage *filter.Storage) {
+	if len(fileNames) == 0 {
+		logger.Fatal("No files to replay")
+	}
+	metricsChan := make(chan *moira.MatchedMetric, 10)
+	metricsMatcher := matchedmetrics.NewReplayMetricsMatcher(cacheMetrics, logger, database, cacheStorage)
+	metricsMatcher.Start(metricsChan)
+
+	replayer := filter.NewReplayer(logger, patternStorage, filter.ReplayConfig{
+		RewriteTime: *replayRewriteTime,
+		Realtime:    *replayRealtime,
+	})
+	for _, fileName := range fileNames {
+		stats, err := replayer.ReplayFile(fileName, metricsChan)
+		if err != nil {
+			logger.Errorf("Failed to replay file [%s]: %s", fileName, err.Error())
+		}
+		logger.Infof("Replayed file [%s]: %d lines, %d invalid, %d matched", fileName, stats.Lines, stats.Invalid, stats.Matched)
+	}
+	replayer.Flush(metricsChan)
+	close(metricsChan)
+	metricsMatcher.Wait()
+}
+
+type metricsListener interface {
+	Stop() error
+}
+
+func stopListeners(listeners []metricsListener, metricsChan chan *moira.MatchedMetric) {
+	for _, listener := range listeners {
+		if err := listener.Stop(); err != nil {
+			logger.Errorf("Failed to stop listener: %v", err)
+		}
+	}
+	close(metricsChan)
+}
+
+func stopDebugServer(debugServer *debugserver.Server) {
+	if err := debugServer.Stop(); err != nil {
+		logger.Errorf("Failed to stop debug server: %v", err)
 	}
 }
 
@@ -4,3 +4,9 @@ import "fmt"
 
 // ErrNil return from database data storing methods if no object in DB
 var ErrNil = fmt.Errorf("Nil returned")
+
+// ErrPatternsChangesLost return from GetPatternsChanges if some changes since given version are not stored anymore
+var ErrPatternsChangesLost = fmt.Errorf("Patterns changes are lost")
+
+// ErrPatternMetricsLimitExceeded return from AddPatternMetric if pattern already has maximum number of metrics
+var ErrPatternMetricsLimitExceeded = fmt.Errorf("Pattern metrics limit exceeded")
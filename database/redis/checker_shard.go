@@ -0,0 +1,48 @@
+package redis
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/garyburd/redigo/redis"
+)
+
+// UpdateCheckerHeartbeat sets last heartbeat time of checker to now
+func (connector *DbConnector) UpdateCheckerHeartbeat(checkerID string) error {
+	c := connector.pool.Get()
+	defer c.Close()
+	if _, err := c.Do("ZADD", checkerHeartbeatsKey, time.Now().Unix(), checkerID); err != nil {
+		return fmt.Errorf("Failed to update checker %s heartbeat, error: %v", checkerID, err)
+	}
+	return nil
+}
+
+// GetAliveCheckers removes checkers without heartbeat for ttl seconds and returns IDs of other checkers
+func (connector *DbConnector) GetAliveCheckers(ttl int64) ([]string, error) {
+	c := connector.pool.Get()
+	defer c.Close()
+	c.Send("MULTI")
+	c.Send("ZREMRANGEBYSCORE", checkerHeartbeatsKey, "-inf", time.Now().Unix()-ttl)
+	c.Send("ZRANGE", checkerHeartbeatsKey, 0, -1)
+	rawResponse, err := redis.Values(c.Do("EXEC"))
+	if err != nil {
+		return nil, fmt.Errorf("Failed to EXEC: %v", err)
+	}
+	checkers, err := redis.Strings(rawResponse[1], nil)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to get alive checkers, error: %v", err)
+	}
+	return checkers, nil
+}
+
+// RemoveCheckerHeartbeat removes checker, so its triggers are moved to other checkers without waiting for heartbeat ttl
+func (connector *DbConnector) RemoveCheckerHeartbeat(checkerID string) error {
+	c := connector.pool.Get()
+	defer c.Close()
+	if _, err := c.Do("ZREM", checkerHeartbeatsKey, checkerID); err != nil {
+		return fmt.Errorf("Failed to remove checker %s heartbeat, error: %v", checkerID, err)
+	}
+	return nil
+}
+
+var checkerHeartbeatsKey = "moira-checker-heartbeats"
@@ -0,0 +1,44 @@
+package redis
+
+import (
+	"testing"
+	"time"
+
+	"github.com/op/go-logging"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestCheckerHeartbeats(t *testing.T) {
+	logger, _ := logging.GetLogger("dataBase")
+	dataBase := NewDatabase(logger, config)
+	dataBase.flush()
+	defer dataBase.flush()
+	Convey("Test checker heartbeats manipulation", t, func() {
+		checkers, err := dataBase.GetAliveCheckers(10)
+		So(err, ShouldBeNil)
+		So(checkers, ShouldBeEmpty)
+
+		So(dataBase.UpdateCheckerHeartbeat("checker1"), ShouldBeNil)
+		So(dataBase.UpdateCheckerHeartbeat("checker2"), ShouldBeNil)
+		checkers, err = dataBase.GetAliveCheckers(10)
+		So(err, ShouldBeNil)
+		So(checkers, ShouldHaveLength, 2)
+		So(checkers, ShouldContain, "checker1")
+		So(checkers, ShouldContain, "checker2")
+
+		So(dataBase.RemoveCheckerHeartbeat("checker2"), ShouldBeNil)
+		checkers, err = dataBase.GetAliveCheckers(10)
+		So(err, ShouldBeNil)
+		So(checkers, ShouldResemble, []string{"checker1"})
+
+		Convey("Checker without heartbeat for ttl is removed", func() {
+			c := dataBase.pool.Get()
+			defer c.Close()
+			_, err := c.Do("ZADD", checkerHeartbeatsKey, time.Now().Unix()-20, "checker3")
+			So(err, ShouldBeNil)
+			checkers, err := dataBase.GetAliveCheckers(10)
+			So(err, ShouldBeNil)
+			So(checkers, ShouldResemble, []string{"checker1"})
+		})
+	})
+}
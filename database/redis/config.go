@@ -1,8 +1,24 @@
 package redis
 
+// Metric events transports
+const (
+	// MetricEventsPubSub publishes metric events to redis channel, events are lost if no checker is subscribed
+	MetricEventsPubSub = "pubsub"
+	// MetricEventsStreams adds metric events to redis stream read by checkers consumer group,
+	// events are kept until checker acknowledges them
+	MetricEventsStreams = "streams"
+)
+
 // Config - Redis database connection config
 type Config struct {
 	Host string
 	Port string
 	DBID int
+	// MetricEventsTransport is MetricEventsPubSub or MetricEventsStreams, it must be the same for filters and checkers
+	MetricEventsTransport string
+	// MetricEventsStreamMaxLen limits approximate length of metric events stream, zero means no limit
+	MetricEventsStreamMaxLen int64
+	// MetricEventsConsumer is name of checker in metric events consumer group, hostname is used if it is empty
+	// Name must be unique for every checker and must not change on restart to resume reading not acknowledged events
+	MetricEventsConsumer string
 }
@@ -3,6 +3,7 @@ package redis
 import (
 	"fmt"
 	"net"
+	"os"
 	"time"
 
 	"github.com/garyburd/redigo/redis"
@@ -21,6 +22,10 @@ type DbConnector struct {
 	metricsCache    *cache.Cache
 	messengersCache *cache.Cache
 	sync            *redsync.Redsync
+
+	metricEventsStreams      bool
+	metricEventsStreamMaxLen int64
+	metricEventsConsumer     string
 }
 
 // NewDatabase creates Redis pool based on config
@@ -33,6 +38,19 @@ func NewDatabase(logger moira.Logger, config Config) *DbConnector {
 		metricsCache:    cache.New(time.Minute, time.Minute*60),
 		messengersCache: cache.New(cache.NoExpiration, cache.DefaultExpiration),
 		sync:            redsync.New([]redsync.Pool{pool}),
+
+		metricEventsStreamMaxLen: config.MetricEventsStreamMaxLen,
+		metricEventsConsumer:     config.MetricEventsConsumer,
+	}
+	switch config.MetricEventsTransport {
+	case MetricEventsStreams:
+		db.metricEventsStreams = true
+	case "", MetricEventsPubSub:
+	default:
+		logger.Warningf("Unknown metric events transport [%s], %s is used", config.MetricEventsTransport, MetricEventsPubSub)
+	}
+	if db.metricEventsConsumer == "" {
+		db.metricEventsConsumer, _ = os.Hostname()
 	}
 	return &db
 }
@@ -3,6 +3,8 @@ package redis
 import (
 	"encoding/json"
 	"fmt"
+	"strings"
+	"time"
 
 	"github.com/garyburd/redigo/redis"
 	"gopkg.in/tomb.v2"
@@ -23,6 +25,50 @@ func (connector *DbConnector) GetPatterns() ([]string, error) {
 	return patterns, nil
 }
 
+// GetPatternsVersion gets version of patterns list, it is incremented on every pattern added or removed
+func (connector *DbConnector) GetPatternsVersion() (int64, error) {
+	c := connector.pool.Get()
+	defer c.Close()
+	version, err := redis.Int64(c.Do("GET", patternsVersionKey))
+	if err != nil {
+		if err == redis.ErrNil {
+			return 0, nil
+		}
+		return 0, fmt.Errorf("Failed to get moira patterns version, error: %v", err)
+	}
+	return version, nil
+}
+
+// GetPatternsChanges gets patterns changes made after given version and current patterns list version
+// If some of these changes are already removed from changes log, then database.ErrPatternsChangesLost is returned
+func (connector *DbConnector) GetPatternsChanges(version int64) ([]moira.PatternChange, int64, error) {
+	c := connector.pool.Get()
+	defer c.Close()
+
+	c.Send("MULTI")
+	c.Send("GET", patternsVersionKey)
+	c.Send("ZRANGEBYSCORE", patternsChangesKey, fmt.Sprintf("(%d", version), "+inf")
+	rawResponse, err := redis.Values(c.Do("EXEC"))
+	if err != nil {
+		return nil, 0, fmt.Errorf("Failed to EXEC: %v", err)
+	}
+	currentVersion, err := redis.Int64(rawResponse[0], nil)
+	if err != nil && err != redis.ErrNil {
+		return nil, 0, fmt.Errorf("Failed to get moira patterns version, error: %v", err)
+	}
+	if currentVersion < version {
+		return nil, currentVersion, database.ErrPatternsChangesLost
+	}
+	changes, err := reply.PatternChanges(rawResponse[1], version)
+	if err != nil {
+		return nil, currentVersion, err
+	}
+	if int64(len(changes)) != currentVersion-version {
+		return nil, currentVersion, database.ErrPatternsChangesLost
+	}
+	return changes, currentVersion, nil
+}
+
 // GetMetricsValues gets metrics values for given interval
 func (connector *DbConnector) GetMetricsValues(metrics []string, from int64, until int64) (map[string][]*moira.MetricValue, error) {
 	c := connector.pool.Get()
@@ -90,14 +136,71 @@ func (connector *DbConnector) getMetricRetention(metric string) (int64, error) {
 	return retention, nil
 }
 
-// SaveMetrics saves new metrics
+// GetMetricRetentionArchives gets all archives of given metric retention, nil if metric has only one archive
+func (connector *DbConnector) GetMetricRetentionArchives(metric string) ([]moira.RetentionArchive, error) {
+	cacheKey := metricRetentionArchivesKey(metric)
+	if value, ok := connector.retentionCache.Get(cacheKey); ok {
+		if archives, ok := value.([]moira.RetentionArchive); ok {
+			return archives, nil
+		}
+	}
+	c := connector.pool.Get()
+	defer c.Close()
+
+	archives, err := reply.RetentionArchives(c.Do("GET", metricRetentionArchivesKey(metric)))
+	if err != nil {
+		return nil, fmt.Errorf("Failed GET metric retention archives:%s, error: %v", metric, err)
+	}
+	connector.retentionCache.Set(cacheKey, archives, 0)
+	return archives, nil
+}
+
+// GetMetricsArchiveValues gets metrics values downsampled to archive with given precision for given interval
+func (connector *DbConnector) GetMetricsArchiveValues(metrics []string, step int64, from int64, until int64) (map[string][]*moira.MetricValue, error) {
+	c := connector.pool.Get()
+	defer c.Close()
+
+	c.Send("MULTI")
+	for _, metric := range metrics {
+		c.Send("ZRANGEBYSCORE", metricArchiveDataKey(metric, step), from, until, "WITHSCORES")
+	}
+	resultByMetrics, err := redis.Values(c.Do("EXEC"))
+	if err != nil {
+		return nil, fmt.Errorf("Failed to EXEC: %v", err)
+	}
+
+	res := make(map[string][]*moira.MetricValue)
+	for i, resultByMetric := range resultByMetrics {
+		metricsValues, err := reply.MetricValues(resultByMetric)
+		if err != nil {
+			return nil, err
+		}
+		res[metrics[i]] = metricsValues
+	}
+	return res, nil
+}
+
+// SaveMetrics saves new metrics and recalculates points of their lower precision archives
 func (connector *DbConnector) SaveMetrics(metrics map[string]*moira.MatchedMetric) error {
 	c := connector.pool.Get()
 	defer c.Close()
+	for _, metric := range metrics {
+		if len(metric.Archives) > 1 {
+			// Archives are rolled up by EVALSHA, so script is loaded in case redis was restarted
+			if err := rollupArchivesScript.Load(c); err != nil {
+				return fmt.Errorf("Failed to load archives rollup script: %v", err)
+			}
+			break
+		}
+	}
 	for _, metric := range metrics {
 		metricValue := fmt.Sprintf("%v %v", metric.Timestamp, metric.Value)
 		c.Send("ZADD", metricDataKey(metric.Metric), metric.RetentionTimestamp, metricValue)
 		c.Send("SET", metricRetentionKey(metric.Metric), metric.Retention)
+		if len(metric.Archives) > 1 {
+			c.Send("SET", metricRetentionArchivesKey(metric.Metric), formatRetentionArchives(metric.Archives))
+			sendRollupArchives(c, metric)
+		}
 
 		for _, pattern := range metric.Patterns {
 			event, err := json.Marshal(&moira.MetricEvent{
@@ -107,6 +210,10 @@ func (connector *DbConnector) SaveMetrics(metrics map[string]*moira.MatchedMetri
 			if err != nil {
 				continue
 			}
+			if connector.metricEventsStreams {
+				sendAddMetricEvent(c, event, connector.metricEventsStreamMaxLen)
+				continue
+			}
 			c.Send("PUBLISH", metricEventKey, event)
 		}
 	}
@@ -114,7 +221,11 @@ func (connector *DbConnector) SaveMetrics(metrics map[string]*moira.MatchedMetri
 }
 
 // SubscribeMetricEvents creates subscription for new metrics and return channel for this events
+// If streams transport is used, events must be acknowledged by AckMetricEvent after they are handled
 func (connector *DbConnector) SubscribeMetricEvents(tomb *tomb.Tomb) (<-chan *moira.MetricEvent, error) {
+	if connector.metricEventsStreams {
+		return connector.subscribeMetricEventsStream(tomb)
+	}
 	metricsChannel := make(chan *moira.MetricEvent, 100)
 	dataChannel, err := connector.manageSubscriptions(tomb, metricEventKey)
 	if err != nil {
@@ -142,12 +253,17 @@ func (connector *DbConnector) SubscribeMetricEvents(tomb *tomb.Tomb) (<-chan *mo
 }
 
 // AddPatternMetric adds new metrics by given pattern
-func (connector *DbConnector) AddPatternMetric(pattern, metric string) error {
+// If limit is positive and pattern already has limit metrics, new metric is not added and database.ErrPatternMetricsLimitExceeded is returned
+func (connector *DbConnector) AddPatternMetric(pattern, metric string, limit int64) error {
 	c := connector.pool.Get()
 	defer c.Close()
-	if _, err := c.Do("SADD", patternMetricsKey(pattern), metric); err != nil {
+	added, err := redis.Int(addPatternMetricScript.Do(c, patternMetricsKey(pattern), metric, limit))
+	if err != nil {
 		return fmt.Errorf("Failed to SADD pattern-metrics, pattern: %s, metric: %s, error: %v", pattern, metric, err)
 	}
+	if added == 0 {
+		return database.ErrPatternMetricsLimitExceeded
+	}
 	return nil
 }
 
@@ -170,7 +286,7 @@ func (connector *DbConnector) GetPatternMetrics(pattern string) ([]string, error
 func (connector *DbConnector) RemovePattern(pattern string) error {
 	c := connector.pool.Get()
 	defer c.Close()
-	if _, err := c.Do("SREM", patternsListKey, pattern); err != nil {
+	if _, err := updatePatternsListScript.Do(c, patternsListKey, patternsVersionKey, patternsChangesKey, "SREM", pattern, patternsChangesLogSize); err != nil {
 		return fmt.Errorf("Failed to remove pattern: %s, error: %v", pattern, err)
 	}
 	return nil
@@ -190,7 +306,7 @@ func (connector *DbConnector) RemovePatternsMetrics(patterns []string) error {
 	return nil
 }
 
-// RemovePatternWithMetrics removes pattern metrics with data and given pattern
+// RemovePatternWithMetrics removes pattern metrics with data, lower precision archives and given pattern
 func (connector *DbConnector) RemovePatternWithMetrics(pattern string) error {
 	metrics, err := connector.GetPatternMetrics(pattern)
 	if err != nil {
@@ -198,15 +314,38 @@ func (connector *DbConnector) RemovePatternWithMetrics(pattern string) error {
 	}
 	c := connector.pool.Get()
 	defer c.Close()
+
 	c.Send("MULTI")
-	c.Send("SREM", patternsListKey, pattern)
 	for _, metric := range metrics {
+		c.Send("GET", metricRetentionArchivesKey(metric))
+	}
+	rawArchives, err := redis.Values(c.Do("EXEC"))
+	if err != nil {
+		return fmt.Errorf("Failed to EXEC: %v", err)
+	}
+
+	c.Send("MULTI")
+	sendRemovePattern(c, pattern)
+	for i, metric := range metrics {
 		c.Send("DEL", metricDataKey(metric))
+		archives, err := reply.RetentionArchives(rawArchives[i], nil)
+		if err != nil {
+			connector.logger.Warningf("Failed to get retention archives of metric %s: %v", metric, err)
+		}
+		if len(archives) > 1 {
+			for _, archive := range archives[1:] {
+				c.Send("DEL", metricArchiveDataKey(metric, archive.Step))
+			}
+		}
+		c.Send("DEL", metricRetentionArchivesKey(metric))
 	}
 	c.Send("DEL", patternMetricsKey(pattern))
 	if _, err = c.Do("EXEC"); err != nil {
 		return fmt.Errorf("Failed to EXEC: %v", err)
 	}
+	for _, metric := range metrics {
+		connector.retentionCache.Delete(metricRetentionArchivesKey(metric))
+	}
 	return nil
 }
 
@@ -223,14 +362,151 @@ func (connector *DbConnector) RemoveMetricValues(metric string, toTime int64) er
 	return nil
 }
 
+// ExpireMetricValues removes metric values older than ttl seconds and sets metric data expiration to ttl
+// It is used for metrics which are not added to pattern metrics, so their values are not removed by triggers checks
+func (connector *DbConnector) ExpireMetricValues(metric string, ttl int64) error {
+	if !connector.needRemoveMetrics(metric) {
+		return nil
+	}
+	c := connector.pool.Get()
+	defer c.Close()
+	c.Send("MULTI")
+	c.Send("ZREMRANGEBYSCORE", metricDataKey(metric), "-inf", time.Now().Unix()-ttl)
+	c.Send("EXPIRE", metricDataKey(metric), ttl)
+	c.Send("EXPIRE", metricRetentionKey(metric), ttl)
+	c.Send("EXPIRE", metricRetentionArchivesKey(metric), ttl)
+	if _, err := c.Do("EXEC"); err != nil {
+		return fmt.Errorf("Failed to EXEC: %v", err)
+	}
+	return nil
+}
+
 func (connector *DbConnector) needRemoveMetrics(metric string) bool {
 	err := connector.metricsCache.Add(metric, true, 0)
 	return err == nil
 }
 
 var patternsListKey = "moira-pattern-list"
+var patternsVersionKey = "moira-pattern-list-version"
+var patternsChangesKey = "moira-pattern-list-changes"
 var metricEventKey = "metric-event"
 
+// patternsChangesLogSize is the number of last patterns changes kept for incremental pattern tree updates
+const patternsChangesLogSize = 10000
+
+// updatePatternsListScript adds (SADD) or removes (SREM) pattern from patterns list
+// If patterns list is changed, it increments patterns version and logs the change as "<version>:<command>:<pattern>"
+var updatePatternsListScript = redis.NewScript(3, `
+if redis.call(ARGV[1], KEYS[1], ARGV[2]) == 0 then
+	return 0
+end
+local version = redis.call('INCR', KEYS[2])
+redis.call('ZADD', KEYS[3], version, version .. ':' .. ARGV[1] .. ':' .. ARGV[2])
+redis.call('ZREMRANGEBYSCORE', KEYS[3], '-inf', version - tonumber(ARGV[3]))
+return 1
+`)
+
+// rollupArchivesScript recalculates points of lower precision archives which contain given metric value
+// KEYS[1] is metric data key, KEYS[i] is data key of archive with ARGV[2*i+1] step and ARGV[2*i+2] ttl
+// ARGV[1] and ARGV[2] are aggregation method and xFilesFactor, ARGV[3] is value retention timestamp and ARGV[4] is its precision
+// Every archive point is aggregated from stored points of previous archive, as whisper does, so metric values saved
+// by any number of processes in any order give the same archives. Points of previous archive are read by their
+// retention timestamps in ascending order, value of the last member is used if there are several by timestamp
+var rollupArchivesScript = redis.NewScript(-1, `
+local method = ARGV[1]
+local xFilesFactor = tonumber(ARGV[2])
+local timestamp = tonumber(ARGV[3])
+local previousStep = tonumber(ARGV[4])
+for i = 2, #KEYS do
+	local step = tonumber(ARGV[2 * i + 1])
+	local ttl = tonumber(ARGV[2 * i + 2])
+	local start = timestamp - timestamp % step
+	local points = redis.call('ZRANGEBYSCORE', KEYS[i - 1], start, start + step - 1, 'WITHSCORES')
+	local timestamps = {}
+	local values = {}
+	for j = 1, #points, 2 do
+		local score = tonumber(points[j + 1])
+		local value = tonumber(string.match(points[j], '%S+$'))
+		if value ~= nil then
+			if values[score] == nil then
+				timestamps[#timestamps + 1] = score
+			end
+			values[score] = value
+		end
+	end
+	if #timestamps == 0 or #timestamps / math.max(math.floor(step / previousStep), 1) < xFilesFactor then
+		return
+	end
+	local result = values[timestamps[1]]
+	for j = 2, #timestamps do
+		local value = values[timestamps[j]]
+		if method == 'min' then
+			result = math.min(result, value)
+		elseif method == 'max' then
+			result = math.max(result, value)
+		elseif method == 'last' then
+			result = value
+		else
+			result = result + value
+		end
+	end
+	if method == 'average' then
+		result = result / #timestamps
+	end
+	redis.call('ZREMRANGEBYSCORE', KEYS[i], start, start)
+	redis.call('ZADD', KEYS[i], start, string.format('%d %.17g', start, result))
+	redis.call('ZREMRANGEBYSCORE', KEYS[i], '-inf', start - ttl)
+	redis.call('EXPIRE', KEYS[i], ttl + step)
+	previousStep = step
+end
+`)
+
+// sendRollupArchives recalculates points of metric lower precision archives by rollupArchivesScript
+// Archive keys TTL is prolonged, so archives of metrics which are not received anymore are removed
+func sendRollupArchives(c redis.Conn, metric *moira.MatchedMetric) error {
+	archives := metric.Archives[1:]
+	keysAndArgs := make([]interface{}, 0, 6+3*len(archives))
+	keysAndArgs = append(keysAndArgs, len(archives)+1, metricDataKey(metric.Metric))
+	for _, archive := range archives {
+		keysAndArgs = append(keysAndArgs, metricArchiveDataKey(metric.Metric, archive.Step))
+	}
+	keysAndArgs = append(keysAndArgs, metric.ArchiveAggregation.Method, metric.ArchiveAggregation.XFilesFactor, metric.RetentionTimestamp, metric.Archives[0].Step)
+	for _, archive := range archives {
+		keysAndArgs = append(keysAndArgs, archive.Step, archive.TTL)
+	}
+	return rollupArchivesScript.SendHash(c, keysAndArgs...)
+}
+
+// formatRetentionArchives formats archives as "step:ttl,step:ttl,..."
+func formatRetentionArchives(archives []moira.RetentionArchive) string {
+	rawArchives := make([]string, 0, len(archives))
+	for _, archive := range archives {
+		rawArchives = append(rawArchives, fmt.Sprintf("%d:%d", archive.Step, archive.TTL))
+	}
+	return strings.Join(rawArchives, ",")
+}
+
+// addPatternMetricScript adds metric to pattern metrics set if it is already there or set has less than limit metrics
+var addPatternMetricScript = redis.NewScript(1, `
+if redis.call('SISMEMBER', KEYS[1], ARGV[1]) == 1 then
+	return 1
+end
+local limit = tonumber(ARGV[2])
+if limit > 0 and redis.call('SCARD', KEYS[1]) >= limit then
+	return 0
+end
+redis.call('SADD', KEYS[1], ARGV[1])
+return 1
+`)
+
+func sendAddPattern(c redis.Conn, pattern string) error {
+	return updatePatternsListScript.Send(c, patternsListKey, patternsVersionKey, patternsChangesKey, "SADD", pattern, patternsChangesLogSize)
+}
+
+func sendRemovePattern(c redis.Conn, pattern string) error {
+	return updatePatternsListScript.Send(c, patternsListKey, patternsVersionKey, patternsChangesKey, "SREM", pattern, patternsChangesLogSize)
+}
+
 func patternMetricsKey(pattern string) string {
 	return fmt.Sprintf("moira-pattern-metrics:%s", pattern)
 }
@@ -239,6 +515,14 @@ func metricDataKey(metric string) string {
 	return fmt.Sprintf("moira-metric-data:%s", metric)
 }
 
+func metricRetentionArchivesKey(metric string) string {
+	return fmt.Sprintf("moira-metric-retention-archives:%s", metric)
+}
+
+func metricArchiveDataKey(metric string, step int64) string {
+	return fmt.Sprintf("moira-metric-archive-data:%d:%s", step, metric)
+}
+
 func metricRetentionKey(metric string) string {
 	return fmt.Sprintf("moira-metric-retention:%s", metric)
 }
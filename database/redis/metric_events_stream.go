@@ -0,0 +1,240 @@
+package redis
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/garyburd/redigo/redis"
+	"gopkg.in/tomb.v2"
+
+	"github.com/moira-alert/moira"
+	"github.com/moira-alert/moira/database/redis/reply"
+)
+
+var metricEventsStreamKey = "moira-metric-events-stream"
+var metricEventsGroup = "moira-checkers"
+
+// Metric events stream consuming settings
+const (
+	metricEventsStreamCount = 100
+	metricEventsStreamBlock = time.Second
+	// metricEventsClaimIdle is the time after which delivered and not acknowledged events are claimed to be delivered again
+	metricEventsClaimIdle     = time.Minute
+	metricEventsClaimInterval = 30 * time.Second
+	// metricEventsMaxDeliveries is the number of deliveries after which not acknowledged event is dropped
+	metricEventsMaxDeliveries = 5
+	metricEventsRetryDelay    = 5 * time.Second
+)
+
+// sendAddMetricEvent adds metric event to stream trimmed approximately to maxLen entries, stream is not trimmed if maxLen is not positive
+func sendAddMetricEvent(c redis.Conn, event []byte, maxLen int64) {
+	if maxLen > 0 {
+		c.Send("XADD", metricEventsStreamKey, "MAXLEN", "~", maxLen, "*", "event", event)
+		return
+	}
+	c.Send("XADD", metricEventsStreamKey, "*", "event", event)
+}
+
+// AckMetricEvent acknowledges metric event delivered by streams transport, so it is not delivered again
+// Events delivered by pubsub transport have no ID and are not acknowledged
+func (connector *DbConnector) AckMetricEvent(event *moira.MetricEvent) error {
+	if event.ID == "" {
+		return nil
+	}
+	c := connector.pool.Get()
+	defer c.Close()
+	if _, err := c.Do("XACK", metricEventsStreamKey, metricEventsGroup, event.ID); err != nil {
+		return fmt.Errorf("Failed to XACK metric event %s, error: %v", event.ID, err)
+	}
+	return nil
+}
+
+// subscribeMetricEventsStream reads metric events by consumer group, so every event is handled by only one checker
+// Events delivered to this consumer before restart are read first, events not acknowledged for a long time are claimed,
+// so events of stopped checkers and events of checks dropped by this checker are delivered again
+func (connector *DbConnector) subscribeMetricEventsStream(tomb *tomb.Tomb) (<-chan *moira.MetricEvent, error) {
+	if err := connector.createMetricEventsGroup(); err != nil {
+		return nil, err
+	}
+	metricsChannel := make(chan *moira.MetricEvent, metricEventsStreamCount)
+	go func() {
+		defer close(metricsChannel)
+		send := func(events []*moira.MetricEvent) bool {
+			for _, event := range events {
+				select {
+				case metricsChannel <- event:
+				case <-tomb.Dying():
+					return false
+				}
+			}
+			return true
+		}
+		// lastID is "0" based ID while pending events of this consumer are read, then only new events are read
+		lastID := "0"
+		lastClaim := time.Now()
+		for {
+			select {
+			case <-tomb.Dying():
+				connector.logger.Info("Calling shutdown, stop reading metric events stream...")
+				return
+			default:
+			}
+			if time.Since(lastClaim) >= metricEventsClaimInterval {
+				lastClaim = time.Now()
+				for start := "-"; start != ""; {
+					var events []*moira.MetricEvent
+					var err error
+					events, start, err = connector.claimMetricEvents(start)
+					if err != nil {
+						connector.logger.Errorf("Failed to claim metric events: %v", err)
+						break
+					}
+					if !send(events) {
+						return
+					}
+				}
+			}
+			events, err := connector.readMetricEvents(lastID)
+			if err != nil {
+				connector.logger.Errorf("Failed to read metric events stream: %v", err)
+				select {
+				case <-tomb.Dying():
+				case <-time.After(metricEventsRetryDelay):
+				}
+				continue
+			}
+			if lastID != ">" {
+				if len(events) == 0 {
+					lastID = ">"
+				} else {
+					lastID = events[len(events)-1].ID
+				}
+			}
+			if !send(events) {
+				return
+			}
+		}
+	}()
+	return metricsChannel, nil
+}
+
+// createMetricEventsGroup creates stream and consumer group if they don't exist
+func (connector *DbConnector) createMetricEventsGroup() error {
+	c := connector.pool.Get()
+	defer c.Close()
+	_, err := c.Do("XGROUP", "CREATE", metricEventsStreamKey, metricEventsGroup, "$", "MKSTREAM")
+	if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		return fmt.Errorf("Failed to create metric events consumer group, error: %v", err)
+	}
+	return nil
+}
+
+// readMetricEvents reads events after lastID, ">" means new events, which are waited for if stream is empty
+// Deleted or not valid entries are acknowledged and skipped
+func (connector *DbConnector) readMetricEvents(lastID string) ([]*moira.MetricEvent, error) {
+	c := connector.pool.Get()
+	defer c.Close()
+	args := []interface{}{"GROUP", metricEventsGroup, connector.metricEventsConsumer, "COUNT", metricEventsStreamCount}
+	if lastID == ">" {
+		args = append(args, "BLOCK", int64(metricEventsStreamBlock/time.Millisecond))
+	}
+	args = append(args, "STREAMS", metricEventsStreamKey, lastID)
+	events, invalidIDs, err := reply.MetricEventsStream(c.Do("XREADGROUP", args...))
+	if err != nil {
+		return nil, err
+	}
+	connector.ackMetricEvents(c, invalidIDs)
+	return events, nil
+}
+
+// claimMetricEvents claims page of pending events starting from start ID which are not acknowledged for metricEventsClaimIdle
+// Start ID of next page is returned, it is empty if there are no more pending events
+// Events delivered metricEventsMaxDeliveries times are acknowledged without handling
+func (connector *DbConnector) claimMetricEvents(start string) ([]*moira.MetricEvent, string, error) {
+	c := connector.pool.Get()
+	defer c.Close()
+	pending, err := redis.Values(c.Do("XPENDING", metricEventsStreamKey, metricEventsGroup, start, "+", metricEventsStreamCount))
+	if err != nil {
+		return nil, "", fmt.Errorf("Failed to XPENDING: %v", err)
+	}
+	next := ""
+	claimIdle := int64(metricEventsClaimIdle / time.Millisecond)
+	claimArgs := []interface{}{metricEventsStreamKey, metricEventsGroup, connector.metricEventsConsumer, claimIdle}
+	droppedIDs := make([]string, 0)
+	for _, rawPending := range pending {
+		var id, consumer string
+		var idle, deliveries int64
+		values, err := redis.Values(rawPending, nil)
+		if err == nil {
+			_, err = redis.Scan(values, &id, &consumer, &idle, &deliveries)
+		}
+		if err != nil {
+			return nil, "", fmt.Errorf("Pending metric event format is not valid: %v", err)
+		}
+		if len(pending) == metricEventsStreamCount {
+			next = getNextStreamID(id)
+		}
+		if idle < claimIdle {
+			continue
+		}
+		if deliveries >= metricEventsMaxDeliveries {
+			droppedIDs = append(droppedIDs, id)
+			continue
+		}
+		claimArgs = append(claimArgs, id)
+	}
+	if len(droppedIDs) > 0 {
+		connector.logger.Warningf("Metric events %s are delivered %d times and not acknowledged, drop them", strings.Join(droppedIDs, ", "), metricEventsMaxDeliveries)
+		connector.ackMetricEvents(c, droppedIDs)
+	}
+	if len(claimArgs) == 4 {
+		return make([]*moira.MetricEvent, 0), next, nil
+	}
+	events, invalidIDs, err := reply.MetricEventsStreamEntries(c.Do("XCLAIM", claimArgs...))
+	if err != nil {
+		return nil, "", err
+	}
+	connector.ackMetricEvents(c, invalidIDs)
+	if len(events) > 0 {
+		connector.logger.Infof("Claimed %d not acknowledged metric events", len(events))
+	}
+	return events, next, nil
+}
+
+// getNextStreamID returns the least stream entry ID greater than given "<milliseconds>-<sequence>" ID
+// Empty string is returned if ID is not valid
+func getNextStreamID(id string) string {
+	parts := strings.SplitN(id, "-", 2)
+	if len(parts) != 2 {
+		return ""
+	}
+	sequence, err := strconv.ParseUint(parts[1], 10, 64)
+	if err != nil {
+		return ""
+	}
+	if sequence == math.MaxUint64 {
+		milliseconds, err := strconv.ParseUint(parts[0], 10, 64)
+		if err != nil {
+			return ""
+		}
+		return fmt.Sprintf("%d-0", milliseconds+1)
+	}
+	return fmt.Sprintf("%s-%d", parts[0], sequence+1)
+}
+
+// ackMetricEvents acknowledges events which are not handled, errors are only logged
+func (connector *DbConnector) ackMetricEvents(c redis.Conn, ids []string) {
+	if len(ids) == 0 {
+		return
+	}
+	args := []interface{}{metricEventsStreamKey, metricEventsGroup}
+	for _, id := range ids {
+		args = append(args, id)
+	}
+	if _, err := c.Do("XACK", args...); err != nil {
+		connector.logger.Errorf("Failed to XACK metric events %s, error: %v", strings.Join(ids, ", "), err)
+	}
+}
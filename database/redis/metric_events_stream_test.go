@@ -0,0 +1,87 @@
+package redis
+
+import (
+	"testing"
+	"time"
+
+	"github.com/op/go-logging"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/tomb.v2"
+
+	"github.com/moira-alert/moira"
+)
+
+func TestMetricEventsStream(t *testing.T) {
+	logger, _ := logging.GetLogger("dataBase")
+	streamsConfig := Config{Port: "6379", Host: "localhost", MetricEventsTransport: MetricEventsStreams, MetricEventsConsumer: "checker1"}
+	dataBase := NewDatabase(logger, streamsConfig)
+	dataBase.flush()
+	defer dataBase.flush()
+	metric := "my.test.super.metric"
+	pattern := "my.test.*.metric*"
+	matchedMetric := &moira.MatchedMetric{
+		Patterns:           []string{pattern},
+		Metric:             metric,
+		Retention:          10,
+		RetentionTimestamp: 10,
+		Timestamp:          15,
+		Value:              1,
+	}
+
+	receive := func(ch <-chan *moira.MetricEvent) *moira.MetricEvent {
+		select {
+		case event := <-ch:
+			return event
+		case <-time.After(5 * time.Second):
+			return nil
+		}
+	}
+
+	Convey("Metric events are delivered by stream", t, func() {
+		var tomb1 tomb.Tomb
+		ch, err := dataBase.SubscribeMetricEvents(&tomb1)
+		So(err, ShouldBeNil)
+
+		So(dataBase.SaveMetrics(map[string]*moira.MatchedMetric{metric: matchedMetric}), ShouldBeNil)
+		event := receive(ch)
+		So(event, ShouldNotBeNil)
+		So(event.Metric, ShouldEqual, metric)
+		So(event.Pattern, ShouldEqual, pattern)
+		So(event.ID, ShouldNotBeEmpty)
+		tomb1.Kill(nil)
+
+		Convey("Not acknowledged event is delivered again after restart", func() {
+			var tomb2 tomb.Tomb
+			ch, err := dataBase.SubscribeMetricEvents(&tomb2)
+			So(err, ShouldBeNil)
+			redelivered := receive(ch)
+			So(redelivered, ShouldResemble, event)
+			So(dataBase.AckMetricEvent(redelivered), ShouldBeNil)
+			tomb2.Kill(nil)
+
+			Convey("Acknowledged event is not delivered again", func() {
+				var tomb3 tomb.Tomb
+				ch, err := dataBase.SubscribeMetricEvents(&tomb3)
+				So(err, ShouldBeNil)
+				So(receive(ch), ShouldBeNil)
+				tomb3.Kill(nil)
+			})
+		})
+	})
+
+	Convey("Event without ID is not acknowledged", t, func() {
+		So(dataBase.AckMetricEvent(&moira.MetricEvent{Metric: metric, Pattern: pattern}), ShouldBeNil)
+	})
+}
+
+func TestGetNextStreamID(t *testing.T) {
+	Convey("Next ID has the next sequence number", t, func() {
+		So(getNextStreamID("1526913240000-0"), ShouldEqual, "1526913240000-1")
+		So(getNextStreamID("1526913240000-18446744073709551615"), ShouldEqual, "1526913240001-0")
+	})
+
+	Convey("Not valid ID has no next ID", t, func() {
+		So(getNextStreamID("1526913240000"), ShouldBeEmpty)
+		So(getNextStreamID("1526913240000-a"), ShouldBeEmpty)
+	})
+}
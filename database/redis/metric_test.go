@@ -2,12 +2,15 @@ package redis
 
 import (
 	"testing"
+	"time"
 
+	"github.com/garyburd/redigo/redis"
 	"github.com/op/go-logging"
 	. "github.com/smartystreets/goconvey/convey"
 	"gopkg.in/tomb.v2"
 
 	"github.com/moira-alert/moira"
+	"github.com/moira-alert/moira/database"
 )
 
 func TestMetricsStoring(t *testing.T) {
@@ -27,14 +30,14 @@ func TestMetricsStoring(t *testing.T) {
 		So(actual, ShouldBeEmpty)
 
 		//But you still can add new metrics by this pattern
-		err = dataBase.AddPatternMetric(pattern, metric1)
+		err = dataBase.AddPatternMetric(pattern, metric1, 0)
 		So(err, ShouldBeNil)
 
 		actualMetric, err := dataBase.GetPatternMetrics(pattern)
 		So(err, ShouldBeNil)
 		So(actualMetric, ShouldHaveLength, 1)
 
-		err = dataBase.AddPatternMetric(pattern, metric2)
+		err = dataBase.AddPatternMetric(pattern, metric2, 0)
 		So(err, ShouldBeNil)
 
 		actualMetric, err = dataBase.GetPatternMetrics(pattern)
@@ -181,6 +184,63 @@ func TestMetricsStoring(t *testing.T) {
 	})
 }
 
+func TestPatternsChanges(t *testing.T) {
+	logger, _ := logging.GetLogger("dataBase")
+	dataBase := NewDatabase(logger, config)
+	dataBase.flush()
+	defer dataBase.flush()
+	pattern1 := "my.test.*.metric*"
+	pattern2 := "my.test.super.*"
+	Convey("Patterns changes are logged only if patterns list changes", t, func() {
+		version, err := dataBase.GetPatternsVersion()
+		So(err, ShouldBeNil)
+		So(version, ShouldEqual, 0)
+
+		trigger := moira.Trigger{ID: "id", Patterns: []string{pattern1, pattern2}}
+		So(dataBase.SaveTrigger(trigger.ID, &trigger), ShouldBeNil)
+		So(dataBase.SaveTrigger(trigger.ID, &trigger), ShouldBeNil)
+
+		version, err = dataBase.GetPatternsVersion()
+		So(err, ShouldBeNil)
+		So(version, ShouldEqual, 2)
+
+		changes, version, err := dataBase.GetPatternsChanges(0)
+		So(err, ShouldBeNil)
+		So(version, ShouldEqual, 2)
+		So(changes, ShouldResemble, []moira.PatternChange{{Pattern: pattern1}, {Pattern: pattern2}})
+
+		So(dataBase.RemovePattern(pattern1), ShouldBeNil)
+		So(dataBase.RemovePattern(pattern1), ShouldBeNil)
+
+		changes, version, err = dataBase.GetPatternsChanges(2)
+		So(err, ShouldBeNil)
+		So(version, ShouldEqual, 3)
+		So(changes, ShouldResemble, []moira.PatternChange{{Pattern: pattern1, Removed: true}})
+
+		changes, version, err = dataBase.GetPatternsChanges(3)
+		So(err, ShouldBeNil)
+		So(version, ShouldEqual, 3)
+		So(changes, ShouldBeEmpty)
+	})
+
+	Convey("Trimmed changes log should return ErrPatternsChangesLost", t, func() {
+		c := dataBase.pool.Get()
+		defer c.Close()
+		c.Do("ZREMRANGEBYSCORE", patternsChangesKey, "-inf", 1)
+
+		_, version, err := dataBase.GetPatternsChanges(0)
+		So(err, ShouldEqual, database.ErrPatternsChangesLost)
+		So(version, ShouldEqual, 3)
+
+		changes, _, err := dataBase.GetPatternsChanges(1)
+		So(err, ShouldBeNil)
+		So(changes, ShouldHaveLength, 2)
+
+		_, _, err = dataBase.GetPatternsChanges(10)
+		So(err, ShouldEqual, database.ErrPatternsChangesLost)
+	})
+}
+
 func TestMetricSubscription(t *testing.T) {
 	logger, _ := logging.GetLogger("dataBase")
 	dataBase := NewDatabase(logger, config)
@@ -246,6 +306,158 @@ func TestMetricSubscription(t *testing.T) {
 	})
 }
 
+func TestPatternMetricsLimit(t *testing.T) {
+	logger, _ := logging.GetLogger("dataBase")
+	dataBase := NewDatabase(logger, config)
+	dataBase.flush()
+	defer dataBase.flush()
+	pattern := "my.test.*.metric"
+
+	Convey("Pattern metrics are added until limit is reached", t, func() {
+		So(dataBase.AddPatternMetric(pattern, "my.test.1.metric", 2), ShouldBeNil)
+		So(dataBase.AddPatternMetric(pattern, "my.test.2.metric", 2), ShouldBeNil)
+		So(dataBase.AddPatternMetric(pattern, "my.test.3.metric", 2), ShouldEqual, database.ErrPatternMetricsLimitExceeded)
+
+		Convey("Already added metric is accepted", func() {
+			So(dataBase.AddPatternMetric(pattern, "my.test.1.metric", 2), ShouldBeNil)
+		})
+
+		Convey("Zero limit means no limit", func() {
+			So(dataBase.AddPatternMetric(pattern, "my.test.3.metric", 0), ShouldBeNil)
+		})
+
+		actual, err := dataBase.GetPatternMetrics(pattern)
+		So(err, ShouldBeNil)
+		So(len(actual), ShouldBeLessThanOrEqualTo, 3)
+	})
+
+	Convey("Values of metric over limit are expired", t, func() {
+		dataBase.flush()
+		metric := "my.test.3.metric"
+		now := time.Now().Unix()
+		err := dataBase.SaveMetrics(map[string]*moira.MatchedMetric{metric: {
+			Metric:             metric,
+			Patterns:           []string{pattern},
+			Value:              1,
+			Timestamp:          now - 7200,
+			RetentionTimestamp: now - 7200,
+			Retention:          60,
+		}})
+		So(err, ShouldBeNil)
+		err = dataBase.SaveMetrics(map[string]*moira.MatchedMetric{metric: {
+			Metric:             metric,
+			Patterns:           []string{pattern},
+			Value:              2,
+			Timestamp:          now,
+			RetentionTimestamp: now,
+			Retention:          60,
+		}})
+		So(err, ShouldBeNil)
+
+		So(dataBase.ExpireMetricValues(metric, 3600), ShouldBeNil)
+
+		values, err := dataBase.GetMetricsValues([]string{metric}, 0, now)
+		So(err, ShouldBeNil)
+		So(values[metric], ShouldResemble, []*moira.MetricValue{{RetentionTimestamp: now, Timestamp: now, Value: 2}})
+
+		c := dataBase.pool.Get()
+		defer c.Close()
+		ttl, err := redis.Int64(c.Do("TTL", metricDataKey(metric)))
+		So(err, ShouldBeNil)
+		So(ttl, ShouldBeGreaterThan, 0)
+		So(ttl, ShouldBeLessThanOrEqualTo, 3600)
+	})
+}
+
+func TestMetricArchivesStoring(t *testing.T) {
+	logger, _ := logging.GetLogger("dataBase")
+	dataBase := NewDatabase(logger, config)
+	dataBase.flush()
+	defer dataBase.flush()
+	metric := "my.test.super.metric"
+	archives := []moira.RetentionArchive{{Step: 10, TTL: 3600}, {Step: 60, TTL: 86400}, {Step: 120, TTL: 172800}}
+	save := func(aggregation moira.ArchiveAggregation, retentionTimestamp int64, value float64) {
+		err := dataBase.SaveMetrics(map[string]*moira.MatchedMetric{metric: {
+			Metric:             metric,
+			Retention:          10,
+			RetentionTimestamp: retentionTimestamp,
+			Timestamp:          retentionTimestamp + 3,
+			Value:              value,
+			Archives:           archives,
+			ArchiveAggregation: aggregation,
+		}})
+		So(err, ShouldBeNil)
+	}
+	getArchiveValues := func(step int64, from int64, until int64) []*moira.MetricValue {
+		values, err := dataBase.GetMetricsArchiveValues([]string{metric}, step, from, until)
+		So(err, ShouldBeNil)
+		return values[metric]
+	}
+
+	Convey("Metric with single archive has no retention archives", t, func() {
+		actual, err := dataBase.GetMetricRetentionArchives("other.metric")
+		So(err, ShouldBeNil)
+		So(actual, ShouldBeNil)
+	})
+
+	Convey("Archive points are aggregated from stored values when enough of them are known", t, func() {
+		average := moira.ArchiveAggregation{Method: moira.ArchiveAggregationAverage, XFilesFactor: 0.5}
+		save(average, 120, 1)
+		save(average, 130, 2)
+		So(getArchiveValues(60, 0, 200), ShouldBeEmpty)
+
+		actualArchives, err := dataBase.GetMetricRetentionArchives(metric)
+		So(err, ShouldBeNil)
+		So(actualArchives, ShouldResemble, archives)
+
+		save(average, 140, 6)
+		So(getArchiveValues(60, 0, 200), ShouldResemble, []*moira.MetricValue{{Timestamp: 120, RetentionTimestamp: 120, Value: 3}})
+
+		Convey("Values saved again by other filter, should give the same point", func() {
+			save(average, 130, 2)
+			save(average, 120, 1)
+			So(getArchiveValues(60, 0, 200), ShouldResemble, []*moira.MetricValue{{Timestamp: 120, RetentionTimestamp: 120, Value: 3}})
+		})
+	})
+
+	Convey("Every archive is aggregated from points of previous archive", t, func() {
+		dataBase.flush()
+		sum := moira.ArchiveAggregation{Method: moira.ArchiveAggregationSum}
+		save(sum, 120, 1)
+		save(sum, 130, 2)
+		save(sum, 180, 4)
+
+		So(getArchiveValues(60, 0, 300), ShouldResemble, []*moira.MetricValue{
+			{Timestamp: 120, RetentionTimestamp: 120, Value: 3},
+			{Timestamp: 180, RetentionTimestamp: 180, Value: 4},
+		})
+		So(getArchiveValues(120, 0, 300), ShouldResemble, []*moira.MetricValue{{Timestamp: 120, RetentionTimestamp: 120, Value: 7}})
+
+		Convey("Archive points older than archive TTL are removed", func() {
+			save(sum, 86520, 5)
+			So(getArchiveValues(60, 0, 100000), ShouldResemble, []*moira.MetricValue{
+				{Timestamp: 180, RetentionTimestamp: 180, Value: 4},
+				{Timestamp: 86520, RetentionTimestamp: 86520, Value: 5},
+			})
+		})
+	})
+
+	Convey("Pattern with metrics removed, should remove metric archives", t, func() {
+		dataBase.flush()
+		pattern := "my.test.*.metric"
+		So(dataBase.AddPatternMetric(pattern, metric, 0), ShouldBeNil)
+		save(moira.ArchiveAggregation{Method: moira.ArchiveAggregationLast}, 120, 1)
+		So(getArchiveValues(60, 0, 200), ShouldHaveLength, 1)
+
+		So(dataBase.RemovePatternWithMetrics(pattern), ShouldBeNil)
+		So(getArchiveValues(60, 0, 200), ShouldBeEmpty)
+		So(getArchiveValues(120, 0, 200), ShouldBeEmpty)
+		actualArchives, err := dataBase.GetMetricRetentionArchives(metric)
+		So(err, ShouldBeNil)
+		So(actualArchives, ShouldBeNil)
+	})
+}
+
 func TestMetricsStoringErrorConnection(t *testing.T) {
 	logger, _ := logging.GetLogger("dataBase")
 	dataBase := NewDatabase(logger, emptyConfig)
@@ -267,7 +479,7 @@ func TestMetricsStoringErrorConnection(t *testing.T) {
 		So(actual2, ShouldEqual, 0)
 		So(err, ShouldNotBeNil)
 
-		err = dataBase.AddPatternMetric("123", "123234")
+		err = dataBase.AddPatternMetric("123", "123234", 0)
 		So(err, ShouldNotBeNil)
 
 		actual, err = dataBase.GetPatternMetrics("123")
@@ -8,6 +8,71 @@ import (
 	"strings"
 )
 
+// PatternChanges converts redis DB reply "<version>:<SADD|SREM>:<pattern>" to moira.PatternChange objects
+// Changes must follow each other starting from given version, otherwise only changes before the gap are returned
+func PatternChanges(values interface{}, version int64) ([]moira.PatternChange, error) {
+	rawChanges, err := redis.Strings(values, nil)
+	if err != nil {
+		if err == redis.ErrNil {
+			return make([]moira.PatternChange, 0), nil
+		}
+		return nil, fmt.Errorf("Failed to read patterns changes: %s", err.Error())
+	}
+	changes := make([]moira.PatternChange, 0, len(rawChanges))
+	for _, rawChange := range rawChanges {
+		changeParts := strings.SplitN(rawChange, ":", 3)
+		if len(changeParts) != 3 {
+			return nil, fmt.Errorf("Pattern change format is not valid: %s", rawChange)
+		}
+		changeVersion, err := strconv.ParseInt(changeParts[0], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("Pattern change version format is not valid: %s", err.Error())
+		}
+		if changeVersion != version+1 {
+			break
+		}
+		version = changeVersion
+		switch changeParts[1] {
+		case "SADD":
+			changes = append(changes, moira.PatternChange{Pattern: changeParts[2]})
+		case "SREM":
+			changes = append(changes, moira.PatternChange{Pattern: changeParts[2], Removed: true})
+		default:
+			return nil, fmt.Errorf("Pattern change command is not valid: %s", rawChange)
+		}
+	}
+	return changes, nil
+}
+
+// RetentionArchives converts redis DB reply "<step>:<ttl>,<step>:<ttl>,..." to moira.RetentionArchive objects
+// Metric has only one archive if there is no reply, then nil is returned
+func RetentionArchives(rep interface{}, err error) ([]moira.RetentionArchive, error) {
+	rawArchives, err := redis.String(rep, err)
+	if err != nil {
+		if err == redis.ErrNil {
+			return nil, nil
+		}
+		return nil, err
+	}
+	archives := make([]moira.RetentionArchive, 0)
+	for _, rawArchive := range strings.Split(rawArchives, ",") {
+		archiveParts := strings.Split(rawArchive, ":")
+		if len(archiveParts) != 2 {
+			return nil, fmt.Errorf("Retention archive format is not valid: %s", rawArchive)
+		}
+		step, err := strconv.ParseInt(archiveParts[0], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("Retention archive step format is not valid: %s", err.Error())
+		}
+		ttl, err := strconv.ParseInt(archiveParts[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("Retention archive TTL format is not valid: %s", err.Error())
+		}
+		archives = append(archives, moira.RetentionArchive{Step: step, TTL: ttl})
+	}
+	return archives, nil
+}
+
 // MetricValues converts redis DB reply struct "RetentionTimestamp Value" "Timestamp" to moira.MetricValue object
 func MetricValues(values interface{}) ([]*moira.MetricValue, error) {
 	resultByMetricArr, err := redis.Values(values, nil)
@@ -0,0 +1,73 @@
+package reply
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/garyburd/redigo/redis"
+
+	"github.com/moira-alert/moira"
+)
+
+// metricEventsStreamField is the field of stream entry containing json encoded metric event
+const metricEventsStreamField = "event"
+
+// MetricEventsStream converts redis DB reply of XREADGROUP from single stream to moira.MetricEvent objects
+// IDs of entries which are deleted from stream or can not be parsed are returned separately, so they can be acknowledged
+func MetricEventsStream(rep interface{}, err error) ([]*moira.MetricEvent, []string, error) {
+	streams, err := redis.Values(rep, err)
+	if err != nil {
+		if err == redis.ErrNil {
+			return make([]*moira.MetricEvent, 0), nil, nil
+		}
+		return nil, nil, fmt.Errorf("Failed to read metric events stream: %s", err.Error())
+	}
+	if len(streams) == 0 {
+		return make([]*moira.MetricEvent, 0), nil, nil
+	}
+	stream, err := redis.Values(streams[0], nil)
+	if err != nil || len(stream) != 2 {
+		return nil, nil, fmt.Errorf("Metric events stream format is not valid")
+	}
+	return MetricEventsStreamEntries(stream[1], nil)
+}
+
+// MetricEventsStreamEntries converts redis DB reply of stream entries "<id> [<field> <value> ...]" to moira.MetricEvent objects
+// IDs of entries which are deleted from stream or can not be parsed are returned separately, so they can be acknowledged
+func MetricEventsStreamEntries(rep interface{}, err error) ([]*moira.MetricEvent, []string, error) {
+	entries, err := redis.Values(rep, err)
+	if err != nil {
+		if err == redis.ErrNil {
+			return make([]*moira.MetricEvent, 0), nil, nil
+		}
+		return nil, nil, fmt.Errorf("Failed to read metric events stream entries: %s", err.Error())
+	}
+	events := make([]*moira.MetricEvent, 0, len(entries))
+	invalidIDs := make([]string, 0)
+	for _, rawEntry := range entries {
+		if rawEntry == nil {
+			continue
+		}
+		entry, err := redis.Values(rawEntry, nil)
+		if err != nil || len(entry) != 2 {
+			return nil, nil, fmt.Errorf("Metric events stream entry format is not valid")
+		}
+		id, err := redis.String(entry[0], nil)
+		if err != nil {
+			return nil, nil, fmt.Errorf("Metric events stream entry id format is not valid: %s", err.Error())
+		}
+		fields, err := redis.StringMap(entry[1], nil)
+		if err != nil {
+			invalidIDs = append(invalidIDs, id)
+			continue
+		}
+		event := &moira.MetricEvent{}
+		if err := json.Unmarshal([]byte(fields[metricEventsStreamField]), event); err != nil {
+			invalidIDs = append(invalidIDs, id)
+			continue
+		}
+		event.ID = id
+		events = append(events, event)
+	}
+	return events, invalidIDs, nil
+}
@@ -11,19 +11,24 @@ import (
 
 // Duty hack for moira.Trigger TTL int64 and stored trigger TTL string compatibility
 type triggerStorageElement struct {
-	ID               string              `json:"id"`
-	Name             string              `json:"name"`
-	Desc             *string             `json:"desc,omitempty"`
-	Targets          []string            `json:"targets"`
-	WarnValue        *float64            `json:"warn_value"`
-	ErrorValue       *float64            `json:"error_value"`
-	Tags             []string            `json:"tags"`
-	TTLState         *string             `json:"ttl_state,omitempty"`
-	Schedule         *moira.ScheduleData `json:"sched,omitempty"`
-	Expression       *string             `json:"expr,omitempty"`
-	PythonExpression *string             `json:"expression,omitempty"`
-	Patterns         []string            `json:"patterns"`
-	TTL              string              `json:"ttl,omitempty"`
+	ID               string                  `json:"id"`
+	Name             string                  `json:"name"`
+	Desc             *string                 `json:"desc,omitempty"`
+	Targets          []string                `json:"targets"`
+	WarnValue        *float64                `json:"warn_value"`
+	ErrorValue       *float64                `json:"error_value"`
+	WarnClearValue   *float64                `json:"warn_clear_value,omitempty"`
+	ErrorClearValue  *float64                `json:"error_clear_value,omitempty"`
+	Tags             []string                `json:"tags"`
+	TTLState         *string                 `json:"ttl_state,omitempty"`
+	Schedule         *moira.ScheduleData     `json:"sched,omitempty"`
+	Expression       *string                 `json:"expr,omitempty"`
+	PythonExpression *string                 `json:"expression,omitempty"`
+	Patterns         []string                `json:"patterns"`
+	TTL              string                  `json:"ttl,omitempty"`
+	PendingInterval  int64                   `json:"pending_interval,omitempty"`
+	Anomaly          *moira.AnomalyDetection `json:"anomaly,omitempty"`
+	TriggerSource    string                  `json:"trigger_source,omitempty"`
 }
 
 func (storageElement *triggerStorageElement) toTrigger() moira.Trigger {
@@ -34,6 +39,8 @@ func (storageElement *triggerStorageElement) toTrigger() moira.Trigger {
 		Targets:          storageElement.Targets,
 		WarnValue:        storageElement.WarnValue,
 		ErrorValue:       storageElement.ErrorValue,
+		WarnClearValue:   storageElement.WarnClearValue,
+		ErrorClearValue:  storageElement.ErrorClearValue,
 		Tags:             storageElement.Tags,
 		TTLState:         storageElement.TTLState,
 		Schedule:         storageElement.Schedule,
@@ -41,6 +48,9 @@ func (storageElement *triggerStorageElement) toTrigger() moira.Trigger {
 		PythonExpression: storageElement.PythonExpression,
 		Patterns:         storageElement.Patterns,
 		TTL:              getTriggerTTL(storageElement.TTL),
+		PendingInterval:  storageElement.PendingInterval,
+		Anomaly:          storageElement.Anomaly,
+		TriggerSource:    storageElement.TriggerSource,
 	}
 }
 
@@ -52,6 +62,8 @@ func toTriggerStorageElement(trigger *moira.Trigger, triggerID string) *triggerS
 		Targets:          trigger.Targets,
 		WarnValue:        trigger.WarnValue,
 		ErrorValue:       trigger.ErrorValue,
+		WarnClearValue:   trigger.WarnClearValue,
+		ErrorClearValue:  trigger.ErrorClearValue,
 		Tags:             trigger.Tags,
 		TTLState:         trigger.TTLState,
 		Schedule:         trigger.Schedule,
@@ -59,6 +71,9 @@ func toTriggerStorageElement(trigger *moira.Trigger, triggerID string) *triggerS
 		PythonExpression: trigger.PythonExpression,
 		Patterns:         trigger.Patterns,
 		TTL:              getTriggerTTLString(trigger.TTL),
+		PendingInterval:  trigger.PendingInterval,
+		Anomaly:          trigger.Anomaly,
+		TriggerSource:    trigger.TriggerSource,
 	}
 }
 
@@ -22,6 +22,17 @@ func (connector *DbConnector) GetTriggerIDs() ([]string, error) {
 	return triggerIds, nil
 }
 
+// GetRemoteTriggerIDs gets IDs of triggers which values are fetched from remote sources
+func (connector *DbConnector) GetRemoteTriggerIDs() ([]string, error) {
+	c := connector.pool.Get()
+	defer c.Close()
+	triggerIds, err := redis.Strings(c.Do("SMEMBERS", remoteTriggersListKey))
+	if err != nil {
+		return nil, fmt.Errorf("Failed to get remote triggers-list: %s", err.Error())
+	}
+	return triggerIds, nil
+}
+
 // GetTrigger gets trigger and trigger tags by given ID and return it in merged object
 func (connector *DbConnector) GetTrigger(triggerID string) (moira.Trigger, error) {
 	c := connector.pool.Get()
@@ -120,8 +131,13 @@ func (connector *DbConnector) SaveTrigger(triggerID string, trigger *moira.Trigg
 	}
 	c.Do("SET", triggerKey(triggerID), bytes)
 	c.Do("SADD", triggersListKey, triggerID)
+	if trigger.TriggerSource != moira.LocalTriggerSource {
+		c.Send("SADD", remoteTriggersListKey, triggerID)
+	} else {
+		c.Send("SREM", remoteTriggersListKey, triggerID)
+	}
 	for _, pattern := range trigger.Patterns {
-		c.Do("SADD", patternsListKey, pattern)
+		sendAddPattern(c, pattern)
 		c.Do("SADD", patternTriggersKey(pattern), triggerID)
 	}
 	for _, tag := range trigger.Tags {
@@ -166,6 +182,7 @@ func (connector *DbConnector) RemoveTrigger(triggerID string) error {
 	c.Send("DEL", triggerKey(triggerID))
 	c.Send("DEL", triggerTagsKey(triggerID))
 	c.Send("SREM", triggersListKey, triggerID)
+	c.Send("SREM", remoteTriggersListKey, triggerID)
 	for _, tag := range trigger.Tags {
 		c.Send("SREM", tagTriggersKey(tag), triggerID)
 	}
@@ -274,6 +291,7 @@ func leftJoin(left, right []string) []string {
 }
 
 var triggersListKey = "moira-triggers-list"
+var remoteTriggersListKey = "moira-remote-triggers-list"
 
 func triggerKey(triggerID string) string {
 	return fmt.Sprintf("moira-trigger:%s", triggerID)
@@ -256,6 +256,33 @@ func TestTriggerStoring(t *testing.T) {
 			So(err, ShouldBeNil)
 			So(actualTriggerChecks, ShouldResemble, []*moira.TriggerCheck{nil})
 		})
+
+		Convey("Test remote triggers list", func() {
+			trigger := triggers[0]
+			trigger.TriggerSource = moira.PrometheusRemoteTriggerSource
+			err := dataBase.SaveTrigger(trigger.ID, &trigger)
+			So(err, ShouldBeNil)
+
+			ids, err := dataBase.GetRemoteTriggerIDs()
+			So(err, ShouldBeNil)
+			So(ids, ShouldResemble, []string{trigger.ID})
+
+			trigger.TriggerSource = moira.LocalTriggerSource
+			err = dataBase.SaveTrigger(trigger.ID, &trigger)
+			So(err, ShouldBeNil)
+			ids, err = dataBase.GetRemoteTriggerIDs()
+			So(err, ShouldBeNil)
+			So(ids, ShouldBeEmpty)
+
+			trigger.TriggerSource = moira.GraphiteRemoteTriggerSource
+			err = dataBase.SaveTrigger(trigger.ID, &trigger)
+			So(err, ShouldBeNil)
+			err = dataBase.RemoveTrigger(trigger.ID)
+			So(err, ShouldBeNil)
+			ids, err = dataBase.GetRemoteTriggerIDs()
+			So(err, ShouldBeNil)
+			So(ids, ShouldBeEmpty)
+		})
 	})
 }
 
@@ -269,6 +296,10 @@ func TestTriggerErrorConnection(t *testing.T) {
 		So(err, ShouldNotBeNil)
 		So(actual, ShouldBeNil)
 
+		actual, err = dataBase.GetRemoteTriggerIDs()
+		So(err, ShouldNotBeNil)
+		So(actual, ShouldBeNil)
+
 		actual1, err := dataBase.GetTrigger("")
 		So(err, ShouldNotBeNil)
 		So(actual1, ShouldResemble, moira.Trigger{})
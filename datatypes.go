@@ -91,6 +91,12 @@ type ScheduledNotification struct {
 	Timestamp int64             `json:"timestamp"`
 }
 
+// PatternChange represents pattern added to or removed from patterns list
+type PatternChange struct {
+	Pattern string
+	Removed bool
+}
+
 // MatchedMetric represent parsed and matched metric data
 type MatchedMetric struct {
 	Metric             string
@@ -99,6 +105,33 @@ type MatchedMetric struct {
 	Timestamp          int64
 	RetentionTimestamp int64
 	Retention          int
+	// Archives contains all archives of metric retention if it has lower precision archives besides the first one
+	Archives []RetentionArchive
+	// ArchiveAggregation defines how points of lower precision archives are calculated, it is set with Archives
+	ArchiveAggregation ArchiveAggregation
+}
+
+// RetentionArchive represents single archive of metric retention, values are kept with Step precision for TTL seconds
+type RetentionArchive struct {
+	Step int64
+	TTL  int64
+}
+
+// Methods of archive aggregation
+const (
+	ArchiveAggregationAverage = "average"
+	ArchiveAggregationSum     = "sum"
+	ArchiveAggregationMin     = "min"
+	ArchiveAggregationMax     = "max"
+	ArchiveAggregationLast    = "last"
+)
+
+// ArchiveAggregation defines how lower precision archive point is calculated from points of previous archive,
+// as storage-aggregation.conf does. Archive point is saved only if known part of previous archive points
+// is not less than XFilesFactor
+type ArchiveAggregation struct {
+	Method       string
+	XFilesFactor float64
 }
 
 // MetricValue represent metric data
@@ -108,21 +141,43 @@ type MetricValue struct {
 	Value              float64 `json:"value"`
 }
 
+// Trigger sources, local source reads metrics received by filter from database
+const (
+	LocalTriggerSource            = ""
+	GraphiteRemoteTriggerSource   = "graphite_remote"
+	PrometheusRemoteTriggerSource = "prometheus_remote"
+)
+
 // Trigger represents trigger data object
 type Trigger struct {
-	ID               string        `json:"id"`
-	Name             string        `json:"name"`
-	Desc             *string       `json:"desc,omitempty"`
-	Targets          []string      `json:"targets"`
-	WarnValue        *float64      `json:"warn_value"`
-	ErrorValue       *float64      `json:"error_value"`
-	Tags             []string      `json:"tags"`
-	TTLState         *string       `json:"ttl_state,omitempty"`
-	TTL              int64         `json:"ttl,omitempty"`
-	Schedule         *ScheduleData `json:"sched,omitempty"`
-	Expression       *string       `json:"expression,omitempty"`
-	PythonExpression *string       `json:"python_expression,omitempty"`
-	Patterns         []string      `json:"patterns"`
+	ID               string            `json:"id"`
+	Name             string            `json:"name"`
+	Desc             *string           `json:"desc,omitempty"`
+	Targets          []string          `json:"targets"`
+	WarnValue        *float64          `json:"warn_value"`
+	ErrorValue       *float64          `json:"error_value"`
+	WarnClearValue   *float64          `json:"warn_clear_value,omitempty"`
+	ErrorClearValue  *float64          `json:"error_clear_value,omitempty"`
+	Tags             []string          `json:"tags"`
+	TTLState         *string           `json:"ttl_state,omitempty"`
+	TTL              int64             `json:"ttl,omitempty"`
+	Schedule         *ScheduleData     `json:"sched,omitempty"`
+	Expression       *string           `json:"expression,omitempty"`
+	PythonExpression *string           `json:"python_expression,omitempty"`
+	Patterns         []string          `json:"patterns"`
+	PendingInterval  int64             `json:"pending_interval,omitempty"`
+	Anomaly          *AnomalyDetection `json:"anomaly,omitempty"`
+	TriggerSource    string            `json:"trigger_source,omitempty"`
+}
+
+// AnomalyDetection represents settings of trigger which compares metric values with values expected by metric history
+// instead of warn and error thresholds, deviations are measured in standard deviations of expected value
+// Window is seconds of history used to calculate expected value, history older than checker metrics ttl is read from retention archives
+type AnomalyDetection struct {
+	Method         string  `json:"method"`
+	Window         int64   `json:"window,omitempty"`
+	WarnDeviation  float64 `json:"warn_deviation"`
+	ErrorDeviation float64 `json:"error_deviation"`
 }
 
 // TriggerCheck represent trigger data with last check data and check timestamp
@@ -145,18 +200,22 @@ type CheckData struct {
 
 // MetricState represent metric state data for given timestamp
 type MetricState struct {
-	EventTimestamp int64    `json:"event_timestamp"`
-	State          string   `json:"state"`
-	Suppressed     bool     `json:"suppressed"`
-	Timestamp      int64    `json:"timestamp"`
-	Value          *float64 `json:"value,omitempty"`
-	Maintenance    int64    `json:"maintenance,omitempty"`
+	EventTimestamp   int64    `json:"event_timestamp"`
+	State            string   `json:"state"`
+	Suppressed       bool     `json:"suppressed"`
+	Timestamp        int64    `json:"timestamp"`
+	Value            *float64 `json:"value,omitempty"`
+	Maintenance      int64    `json:"maintenance,omitempty"`
+	PendingState     string   `json:"pending_state,omitempty"`
+	PendingTimestamp int64    `json:"pending_timestamp,omitempty"`
 }
 
 // MetricEvent represent filter metric event
 type MetricEvent struct {
 	Metric  string `json:"metric"`
 	Pattern string `json:"pattern"`
+	// ID is redis stream entry ID of event delivered by streams transport, it is used to acknowledge event
+	ID string `json:"-"`
 }
 
 // GetSubjectState returns the most critical state of events
@@ -264,14 +323,14 @@ func (checkData CheckData) GetEventTimestamp() int64 {
 }
 
 // IsSimple checks triggers patterns
-// If patterns more than one or it contains standard graphite wildcard symbols,
+// If patterns more than one or it contains standard graphite wildcard symbols or seriesByTag call,
 // when this target can contain more then one metrics, and is it not simple trigger
 func (trigger *Trigger) IsSimple() bool {
 	if len(trigger.Targets) > 1 || len(trigger.Patterns) > 1 {
 		return false
 	}
 	for _, pattern := range trigger.Patterns {
-		if strings.ContainsAny(pattern, "*{?[") {
+		if strings.ContainsAny(pattern, "*{?[") || strings.HasPrefix(pattern, "seriesByTag(") {
 			return false
 		}
 	}
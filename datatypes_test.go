@@ -198,6 +198,7 @@ func TestTrigger_IsSimple(t *testing.T) {
 			{Patterns: []string{"1{23"}, Targets: []string{"123"}},
 			{Patterns: []string{"[123"}, Targets: []string{"123"}},
 			{Patterns: []string{"[12*3"}, Targets: []string{"123"}},
+			{Patterns: []string{"seriesByTag('name=123')"}, Targets: []string{"seriesByTag('name=123')"}},
 		}
 
 		for _, trigger := range triggers {
@@ -9,6 +9,10 @@ import (
 var default1, _ = govaluate.NewEvaluableExpression("t1 >= ERROR_VALUE ? ERROR : (t1 >= WARN_VALUE ? WARN : OK)")
 var default2, _ = govaluate.NewEvaluableExpression("t1 <= ERROR_VALUE ? ERROR : (t1 <= WARN_VALUE ? WARN : OK)")
 
+// Hysteresis expressions keep metric in bad state until value crosses clear value, which is lower (or higher) than raise value
+var hysteresis1, _ = govaluate.NewEvaluableExpression("(t1 >= ERROR_VALUE || (PREV_STATE == ERROR && t1 >= ERROR_CLEAR_VALUE)) ? ERROR : ((t1 >= WARN_VALUE || ((PREV_STATE == ERROR || PREV_STATE == WARN) && t1 >= WARN_CLEAR_VALUE)) ? WARN : OK)")
+var hysteresis2, _ = govaluate.NewEvaluableExpression("(t1 <= ERROR_VALUE || (PREV_STATE == ERROR && t1 <= ERROR_CLEAR_VALUE)) ? ERROR : ((t1 <= WARN_VALUE || ((PREV_STATE == ERROR || PREV_STATE == WARN) && t1 <= WARN_CLEAR_VALUE)) ? WARN : OK)")
+
 var cache = make(map[string]*govaluate.EvaluableExpression)
 
 // ErrInvalidExpression represents bad expression or its state error
@@ -27,6 +31,9 @@ type TriggerExpression struct {
 	WarnValue  *float64
 	ErrorValue *float64
 
+	WarnClearValue  *float64
+	ErrorClearValue *float64
+
 	MainTargetValue         float64
 	AdditionalTargetsValues map[string]float64
 	PreviousState           string
@@ -53,6 +60,16 @@ func (triggerExpression TriggerExpression) Get(name string) (interface{}, error)
 			return nil, fmt.Errorf("No value with name ERROR_VALUE")
 		}
 		return *triggerExpression.ErrorValue, nil
+	case "WARN_CLEAR_VALUE":
+		if triggerExpression.WarnClearValue == nil {
+			return triggerExpression.Get("WARN_VALUE")
+		}
+		return *triggerExpression.WarnClearValue, nil
+	case "ERROR_CLEAR_VALUE":
+		if triggerExpression.ErrorClearValue == nil {
+			return triggerExpression.Get("ERROR_VALUE")
+		}
+		return *triggerExpression.ErrorClearValue, nil
 	case "t1":
 		return triggerExpression.MainTargetValue, nil
 	case "PREV_STATE":
@@ -95,10 +112,37 @@ func getSimpleExpression(triggerExpression *TriggerExpression) (*govaluate.Evalu
 	if triggerExpression.ErrorValue == nil || triggerExpression.WarnValue == nil {
 		return nil, fmt.Errorf("Error value and Warning value can not be empty")
 	}
-	if *triggerExpression.ErrorValue > *triggerExpression.WarnValue {
-		return default1, nil
+	raising := *triggerExpression.ErrorValue > *triggerExpression.WarnValue
+	if triggerExpression.WarnClearValue == nil && triggerExpression.ErrorClearValue == nil {
+		if raising {
+			return default1, nil
+		}
+		return default2, nil
+	}
+	if err := checkClearValue("Warning", triggerExpression.WarnValue, triggerExpression.WarnClearValue, raising); err != nil {
+		return nil, err
+	}
+	if err := checkClearValue("Error", triggerExpression.ErrorValue, triggerExpression.ErrorClearValue, raising); err != nil {
+		return nil, err
+	}
+	if raising {
+		return hysteresis1, nil
+	}
+	return hysteresis2, nil
+}
+
+// checkClearValue checks that metric returns from bad state on the same side of threshold as it is normally in
+func checkClearValue(name string, value, clearValue *float64, raising bool) error {
+	if clearValue == nil {
+		return nil
+	}
+	if raising && *clearValue > *value {
+		return fmt.Errorf("%s clear value can not be greater than %s value", name, strings.ToLower(name))
+	}
+	if !raising && *clearValue < *value {
+		return fmt.Errorf("%s clear value can not be less than %s value", name, strings.ToLower(name))
 	}
-	return default2, nil
+	return nil
 }
 
 func getUserExpression(triggerExpression string) (*govaluate.EvaluableExpression, error) {
@@ -159,3 +159,69 @@ func runGetExpressionValuesTest(getExpressionValuesTests []getExpressionValuesTe
 		So(result, ShouldResemble, getExpressionValuesTest.expectedValue)
 	}
 }
+
+func TestHysteresisExpression(t *testing.T) {
+	Convey("Test raising thresholds", t, func() {
+		warnValue, warnClearValue := 60.0, 50.0
+		errorValue, errorClearValue := 90.0, 80.0
+		evaluate := func(value float64, previousState string) string {
+			result, err := (&TriggerExpression{
+				MainTargetValue: value,
+				WarnValue:       &warnValue,
+				ErrorValue:      &errorValue,
+				WarnClearValue:  &warnClearValue,
+				ErrorClearValue: &errorClearValue,
+				PreviousState:   previousState,
+			}).Evaluate()
+			So(err, ShouldBeNil)
+			return result
+		}
+
+		So(evaluate(85, "OK"), ShouldResemble, "WARN")
+		So(evaluate(90, "OK"), ShouldResemble, "ERROR")
+		So(evaluate(85, "ERROR"), ShouldResemble, "ERROR")
+		So(evaluate(80, "ERROR"), ShouldResemble, "ERROR")
+		So(evaluate(79, "ERROR"), ShouldResemble, "WARN")
+		So(evaluate(55, "ERROR"), ShouldResemble, "WARN")
+		So(evaluate(49, "ERROR"), ShouldResemble, "OK")
+		So(evaluate(55, "WARN"), ShouldResemble, "WARN")
+		So(evaluate(55, "OK"), ShouldResemble, "OK")
+		So(evaluate(55, "NODATA"), ShouldResemble, "OK")
+	})
+
+	Convey("Test falling thresholds with only error clear value", t, func() {
+		warnValue := 30.0
+		errorValue, errorClearValue := 10.0, 20.0
+		evaluate := func(value float64, previousState string) string {
+			result, err := (&TriggerExpression{
+				MainTargetValue: value,
+				WarnValue:       &warnValue,
+				ErrorValue:      &errorValue,
+				ErrorClearValue: &errorClearValue,
+				PreviousState:   previousState,
+			}).Evaluate()
+			So(err, ShouldBeNil)
+			return result
+		}
+
+		So(evaluate(15, "OK"), ShouldResemble, "WARN")
+		So(evaluate(15, "ERROR"), ShouldResemble, "ERROR")
+		So(evaluate(25, "ERROR"), ShouldResemble, "WARN")
+		So(evaluate(35, "ERROR"), ShouldResemble, "OK")
+		So(evaluate(35, "WARN"), ShouldResemble, "OK")
+	})
+
+	Convey("Test clear value on wrong side of threshold", t, func() {
+		warnValue, warnClearValue := 60.0, 70.0
+		errorValue := 90.0
+		result, err := (&TriggerExpression{MainTargetValue: 10.0, WarnValue: &warnValue, ErrorValue: &errorValue, WarnClearValue: &warnClearValue}).Evaluate()
+		So(err, ShouldResemble, ErrInvalidExpression{fmt.Errorf("Warning clear value can not be greater than warning value")})
+		So(result, ShouldBeEmpty)
+
+		warnValue, warnClearValue = 30.0, 20.0
+		errorValue = 10.0
+		result, err = (&TriggerExpression{MainTargetValue: 10.0, WarnValue: &warnValue, ErrorValue: &errorValue, WarnClearValue: &warnClearValue}).Evaluate()
+		So(err, ShouldResemble, ErrInvalidExpression{fmt.Errorf("Warning clear value can not be less than warning value")})
+		So(result, ShouldBeEmpty)
+	})
+}
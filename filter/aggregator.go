@@ -0,0 +1,335 @@
+package filter
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/tomb.v2"
+
+	"github.com/moira-alert/moira"
+	"github.com/moira-alert/moira/tagged"
+)
+
+// Aggregation methods supported by aggregation rules
+const (
+	AggregationSum   = "sum"
+	AggregationAvg   = "avg"
+	AggregationMin   = "min"
+	AggregationMax   = "max"
+	AggregationCount = "count"
+)
+
+var aggregationRuleRegexp = regexp.MustCompile(`^(\S+)\s+\((\d+)\)\s*=\s*(\S+)\s+(\S+)$`)
+var aggregationFieldRegexp = regexp.MustCompile(`<<?([^<>]+)>>?`)
+
+// Aggregator aggregates incoming metrics by carbon-aggregator style rules
+// Every rule looks like "<output template> (<frequency>) = <method> <input pattern>",
+// values of metrics matched by input pattern are aggregated over frequency seconds window
+// and aggregated value is matched by patterns as new metric named by output template
+type Aggregator struct {
+	logger          moira.Logger
+	patternsStorage *PatternStorage
+	rules           []*aggregationRule
+	tomb            tomb.Tomb
+}
+
+// aggregationRule is single parsed aggregation rule with its opened windows
+type aggregationRule struct {
+	sync.Mutex
+	output    string
+	frequency int64
+	method    string
+	input     *regexp.Regexp
+	buckets   map[aggregationKey]*aggregationBucket
+	// values with window start not after closedUntil are too late, their windows are already emitted
+	closedUntil int64
+}
+
+type aggregationKey struct {
+	metric    string
+	timestamp int64
+}
+
+type aggregationBucket struct {
+	sum   float64
+	count int
+	min   float64
+	max   float64
+}
+
+// NewAggregator parses aggregation rules from reader and attaches aggregator to patterns storage
+func NewAggregator(logger moira.Logger, patternsStorage *PatternStorage, reader io.Reader) (*Aggregator, error) {
+	rules, err := parseAggregationRules(bufio.NewScanner(reader))
+	if err != nil {
+		return nil, err
+	}
+	aggregator := &Aggregator{
+		logger:          logger,
+		patternsStorage: patternsStorage,
+		rules:           rules,
+	}
+	patternsStorage.aggregator = aggregator
+	return aggregator, nil
+}
+
+// Start every second emits aggregated values of closed windows to metricsChan
+func (aggregator *Aggregator) Start(metricsChan chan *moira.MatchedMetric) {
+	aggregator.tomb.Go(func() error {
+		flushTicker := time.NewTicker(time.Second)
+		defer flushTicker.Stop()
+		for {
+			select {
+			case <-aggregator.tomb.Dying():
+				aggregator.logger.Info("Moira Filter Aggregator stopped")
+				return nil
+			case now := <-flushTicker.C:
+				for _, matchedMetric := range aggregator.flush(now.Unix()) {
+					metricsChan <- matchedMetric
+				}
+			}
+		}
+	})
+	aggregator.logger.Infof("Moira Filter Aggregator started with %d rules", len(aggregator.rules))
+}
+
+// Stop stops aggregator, values of windows which are not closed yet are discarded
+func (aggregator *Aggregator) Stop() error {
+	aggregator.tomb.Kill(nil)
+	return aggregator.tomb.Wait()
+}
+
+// add puts metric value into windows of all rules matching the metric
+func (aggregator *Aggregator) add(metric string, value float64, timestamp int64) {
+	if math.IsNaN(value) || math.IsInf(value, 0) {
+		return
+	}
+	for _, rule := range aggregator.rules {
+		output, ok := rule.getOutputMetric(metric)
+		if !ok {
+			continue
+		}
+		if !rule.add(output, value, timestamp) {
+			aggregator.patternsStorage.metrics.AggregationLateMetrics.Mark(1)
+		}
+	}
+}
+
+// flush removes windows closed till now and returns their aggregated values matched by patterns
+// Window is closed one frequency after its end to wait for metrics sent with delay
+func (aggregator *Aggregator) flush(now int64) []*moira.MatchedMetric {
+	matchedMetrics := make([]*moira.MatchedMetric, 0)
+	for _, rule := range aggregator.rules {
+		for key, value := range rule.flush(now) {
+			aggregator.patternsStorage.metrics.AggregatedMetrics.Mark(1)
+			matched := aggregator.patternsStorage.matchPattern([]byte(key.metric))
+			if len(matched) == 0 {
+				continue
+			}
+			if aggregator.patternsStorage.stats != nil {
+				aggregator.patternsStorage.stats.add(matched, time.Unix(now, 0))
+			}
+			matchedMetrics = append(matchedMetrics, &moira.MatchedMetric{
+				Metric:             key.metric,
+				Patterns:           matched,
+				Value:              value,
+				Timestamp:          key.timestamp,
+				RetentionTimestamp: key.timestamp,
+				Retention:          int(rule.frequency),
+			})
+		}
+	}
+	return matchedMetrics
+}
+
+// getOutputMetric returns output metric name if metric matches rule input pattern
+func (rule *aggregationRule) getOutputMetric(metric string) (string, bool) {
+	match := rule.input.FindStringSubmatch(metric)
+	if match == nil {
+		return "", false
+	}
+	fields := make(map[string]string)
+	for i, name := range rule.input.SubexpNames() {
+		if name != "" {
+			fields[name] = match[i]
+		}
+	}
+	output := aggregationFieldRegexp.ReplaceAllStringFunc(rule.output, func(field string) string {
+		return fields[strings.Trim(field, "<>")]
+	})
+	if tagged.IsTaggedMetric([]byte(output)) {
+		taggedMetric, err := tagged.ParseMetric(output)
+		if err != nil {
+			return "", false
+		}
+		output = taggedMetric.String()
+	}
+	return output, true
+}
+
+// add puts value into window, returns false if window is already closed
+func (rule *aggregationRule) add(output string, value float64, timestamp int64) bool {
+	windowStart := timestamp - timestamp%rule.frequency
+	rule.Lock()
+	defer rule.Unlock()
+	if windowStart <= rule.closedUntil {
+		return false
+	}
+	key := aggregationKey{metric: output, timestamp: windowStart}
+	bucket, ok := rule.buckets[key]
+	if !ok {
+		rule.buckets[key] = &aggregationBucket{sum: value, count: 1, min: value, max: value}
+		return true
+	}
+	bucket.sum += value
+	bucket.count++
+	bucket.min = math.Min(bucket.min, value)
+	bucket.max = math.Max(bucket.max, value)
+	return true
+}
+
+// flush removes windows closed till now and returns their aggregated values
+func (rule *aggregationRule) flush(now int64) map[aggregationKey]float64 {
+	rule.Lock()
+	defer rule.Unlock()
+	closedUntil := now - 2*rule.frequency
+	if closedUntil > rule.closedUntil {
+		rule.closedUntil = closedUntil
+	}
+	values := make(map[aggregationKey]float64)
+	for key, bucket := range rule.buckets {
+		if key.timestamp > rule.closedUntil {
+			continue
+		}
+		values[key] = bucket.getValue(rule.method)
+		delete(rule.buckets, key)
+	}
+	return values
+}
+
+func (bucket *aggregationBucket) getValue(method string) float64 {
+	switch method {
+	case AggregationAvg:
+		return bucket.sum / float64(bucket.count)
+	case AggregationMin:
+		return bucket.min
+	case AggregationMax:
+		return bucket.max
+	case AggregationCount:
+		return float64(bucket.count)
+	default:
+		return bucket.sum
+	}
+}
+
+func parseAggregationRules(rulesScanner *bufio.Scanner) ([]*aggregationRule, error) {
+	rules := make([]*aggregationRule, 0)
+	for rulesScanner.Scan() {
+		line := strings.TrimSpace(rulesScanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		rule, err := parseAggregationRule(line)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, rule)
+	}
+	return rules, rulesScanner.Err()
+}
+
+// parseAggregationRule parses rule "<output template> (<frequency>) = <method> <input pattern>"
+func parseAggregationRule(line string) (*aggregationRule, error) {
+	parts := aggregationRuleRegexp.FindStringSubmatch(line)
+	if parts == nil {
+		return nil, fmt.Errorf("invalid aggregation rule '%s'", line)
+	}
+	frequency, err := strconv.ParseInt(parts[2], 10, 64)
+	if err != nil || frequency <= 0 {
+		return nil, fmt.Errorf("invalid frequency in aggregation rule '%s'", line)
+	}
+	switch parts[3] {
+	case AggregationSum, AggregationAvg, AggregationMin, AggregationMax, AggregationCount:
+	default:
+		return nil, fmt.Errorf("unknown aggregation method '%s' in aggregation rule '%s'", parts[3], line)
+	}
+	input, err := compileAggregationPattern(parts[4])
+	if err != nil {
+		return nil, fmt.Errorf("invalid input pattern in aggregation rule '%s': %s", line, err.Error())
+	}
+	fields := make(map[string]bool)
+	for _, name := range input.SubexpNames() {
+		fields[name] = true
+	}
+	for _, field := range aggregationFieldRegexp.FindAllStringSubmatch(parts[1], -1) {
+		if !fields[field[1]] {
+			return nil, fmt.Errorf("unknown field '%s' in output of aggregation rule '%s'", field[1], line)
+		}
+	}
+	return &aggregationRule{
+		output:    parts[1],
+		frequency: frequency,
+		method:    parts[3],
+		input:     input,
+		buckets:   make(map[aggregationKey]*aggregationBucket),
+	}, nil
+}
+
+// compileAggregationPattern compiles input pattern to regexp the same way as carbon-aggregator does
+// <field> captures single path part, <<field>> captures one or more path parts,
+// * matches any chars inside path part and {a,b} matches any of listed alternatives
+func compileAggregationPattern(pattern string) (*regexp.Regexp, error) {
+	parts := strings.Split(pattern, ".")
+	regexpParts := make([]string, 0, len(parts))
+	for _, part := range parts {
+		if part == "*" {
+			regexpParts = append(regexpParts, `[^.]+`)
+			continue
+		}
+		var buffer bytes.Buffer
+		for len(part) > 0 {
+			switch {
+			case strings.HasPrefix(part, "<<"):
+				end := strings.Index(part, ">>")
+				if end < 0 {
+					return nil, fmt.Errorf("unclosed field in '%s'", pattern)
+				}
+				buffer.WriteString(fmt.Sprintf(`(?P<%s>.+)`, part[2:end]))
+				part = part[end+2:]
+			case part[0] == '<':
+				end := strings.Index(part, ">")
+				if end < 0 {
+					return nil, fmt.Errorf("unclosed field in '%s'", pattern)
+				}
+				buffer.WriteString(fmt.Sprintf(`(?P<%s>[^.]+)`, part[1:end]))
+				part = part[end+1:]
+			case part[0] == '{':
+				end := strings.Index(part, "}")
+				if end < 0 {
+					return nil, fmt.Errorf("unclosed braces in '%s'", pattern)
+				}
+				alternatives := strings.Split(part[1:end], ",")
+				for i, alternative := range alternatives {
+					alternatives[i] = regexp.QuoteMeta(alternative)
+				}
+				buffer.WriteString("(?:" + strings.Join(alternatives, "|") + ")")
+				part = part[end+1:]
+			case part[0] == '*':
+				buffer.WriteString(`[^.]*`)
+				part = part[1:]
+			default:
+				buffer.WriteString(regexp.QuoteMeta(part[:1]))
+				part = part[1:]
+			}
+		}
+		regexpParts = append(regexpParts, buffer.String())
+	}
+	return regexp.Compile("^" + strings.Join(regexpParts, `\.`) + "$")
+}
@@ -0,0 +1,145 @@
+package filter
+
+import (
+	"bufio"
+	"strings"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/op/go-logging"
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/moira-alert/moira"
+	"github.com/moira-alert/moira/metrics/graphite/go-metrics"
+	"github.com/moira-alert/moira/mock/moira-alert"
+)
+
+var testAggregationRules = `
+# comment
+<env>.applications.<app>.all.requests (60) = sum <env>.applications.<app>.*.requests
+<env>.applications.<app>.all.latency (60) = avg <env>.applications.<app>.*.latency
+<env>.applications.all.latency.max (60) = max <env>.applications.*.*.latency
+<env>.hosts.count (10) = count <env>.hosts.{web,db}*.<<metric>>
+`
+
+func TestParseAggregationRules(t *testing.T) {
+	Convey("Given valid rules, should parse them", t, func() {
+		rules, err := parseAggregationRules(bufio.NewScanner(strings.NewReader(testAggregationRules)))
+		So(err, ShouldBeNil)
+		So(rules, ShouldHaveLength, 4)
+		So(rules[0].output, ShouldEqual, "<env>.applications.<app>.all.requests")
+		So(rules[0].frequency, ShouldEqual, 60)
+		So(rules[0].method, ShouldEqual, AggregationSum)
+		So(rules[0].input.String(), ShouldEqual, `^(?P<env>[^.]+)\.applications\.(?P<app>[^.]+)\.[^.]+\.requests$`)
+		So(rules[3].input.String(), ShouldEqual, `^(?P<env>[^.]+)\.hosts\.(?:web|db)[^.]*\.(?P<metric>.+)$`)
+	})
+
+	Convey("Given invalid rules, should return error", t, func() {
+		invalidRules := []string{
+			"out.metric = sum in.metric",
+			"out.metric (0) = sum in.metric",
+			"out.metric (60) = median in.metric",
+			"out.<app> (60) = sum in.<host>",
+			"out.metric (60) = sum in.<app",
+			"out.metric (60) = sum in.{a,b",
+		}
+		for _, rule := range invalidRules {
+			_, err := parseAggregationRules(bufio.NewScanner(strings.NewReader(rule)))
+			So(err, ShouldNotBeNil)
+		}
+	})
+}
+
+func TestAggregationRuleOutput(t *testing.T) {
+	rules, _ := parseAggregationRules(bufio.NewScanner(strings.NewReader(testAggregationRules)))
+
+	Convey("Matching metric should give output metric with fields substituted", t, func() {
+		output, ok := rules[0].getOutputMetric("prod.applications.api.host1.requests")
+		So(ok, ShouldBeTrue)
+		So(output, ShouldEqual, "prod.applications.api.all.requests")
+
+		_, ok = rules[3].getOutputMetric("prod.hosts.web01.cpu.user")
+		So(ok, ShouldBeTrue)
+	})
+
+	Convey("Not matching metric should give nothing", t, func() {
+		_, ok := rules[0].getOutputMetric("prod.applications.api.requests")
+		So(ok, ShouldBeFalse)
+		_, ok = rules[0].getOutputMetric("prod.applications.api.host1.requests.rate")
+		So(ok, ShouldBeFalse)
+		_, ok = rules[3].getOutputMetric("prod.hosts.cache01.cpu")
+		So(ok, ShouldBeFalse)
+	})
+}
+
+func TestAggregator(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	database := mock_moira_alert.NewMockDatabase(mockCtrl)
+	logger, _ := logging.GetLogger("Filter")
+	filterMetrics := metrics.ConfigureFilterMetrics("test")
+
+	database.EXPECT().GetPatternsVersion().Return(int64(0), nil)
+	database.EXPECT().GetPatterns().Return([]string{"prod.applications.*.all.*", "prod.hosts.count"}, nil)
+	patternsStorage, err := NewPatternStorage(database, filterMetrics, logger)
+	aggregator, err2 := NewAggregator(logger, patternsStorage, strings.NewReader(testAggregationRules))
+
+	Convey("Create pattern storage and aggregator, should no error", t, func() {
+		So(err, ShouldBeNil)
+		So(err2, ShouldBeNil)
+	})
+
+	Convey("Incoming metrics should be aggregated and matched after window is closed", t, func() {
+		lines := []string{
+			"prod.applications.api.host1.requests 10 1234567860",
+			"prod.applications.api.host2.requests 5 1234567875",
+			"prod.applications.api.host1.requests 1 1234567920",
+			"prod.applications.api.host1.latency 100 1234567861",
+			"prod.applications.api.host2.latency 300 1234567862",
+			"prod.applications.web.host3.latency 500 1234567863",
+			"prod.hosts.web01.cpu 1 1234567861",
+			"prod.hosts.db01.cpu.user 1 1234567862",
+		}
+		for _, line := range lines {
+			patternsStorage.ProcessIncomingMetric([]byte(line))
+		}
+
+		So(aggregator.flush(1234567870), ShouldBeEmpty)
+
+		matchedMetrics := aggregator.flush(1234567920)
+		So(matchedMetrics, ShouldHaveLength, 1)
+		So(*matchedMetrics[0], ShouldResemble, moira.MatchedMetric{
+			Metric:             "prod.hosts.count",
+			Patterns:           []string{"prod.hosts.count"},
+			Value:              2,
+			Timestamp:          1234567860,
+			RetentionTimestamp: 1234567860,
+			Retention:          10,
+		})
+
+		So(toValues(aggregator.flush(1234567980)), ShouldResemble, map[string]float64{
+			"prod.applications.api.all.requests": 15,
+			"prod.applications.api.all.latency":  200,
+			"prod.applications.web.all.latency":  500,
+		})
+
+		So(toValues(aggregator.flush(1234568040)), ShouldResemble, map[string]float64{
+			"prod.applications.api.all.requests": 1,
+		})
+		So(filterMetrics.AggregatedMetrics.Count(), ShouldEqual, 6)
+	})
+
+	Convey("Metrics of already emitted windows should be skipped", t, func() {
+		patternsStorage.ProcessIncomingMetric([]byte("prod.applications.api.host1.requests 10 1234567860"))
+		So(filterMetrics.AggregationLateMetrics.Count(), ShouldEqual, 1)
+		So(aggregator.flush(1234568100), ShouldBeEmpty)
+	})
+}
+
+func toValues(matchedMetrics []*moira.MatchedMetric) map[string]float64 {
+	values := make(map[string]float64)
+	for _, matchedMetric := range matchedMetrics {
+		values[matchedMetric.Metric] = matchedMetric.Value
+	}
+	return values
+}
@@ -2,6 +2,7 @@ package filter
 
 import (
 	"bufio"
+	"fmt"
 	"github.com/moira-alert/moira"
 	"github.com/moira-alert/moira/metrics/graphite"
 	"io"
@@ -12,14 +13,27 @@ import (
 
 var defaultRetention = 60
 
+// defaultRetentionItem is retention of metrics matched by no retention pattern, it must not be modified
+var defaultRetentionItem = &retentionCacheItem{value: defaultRetention}
+
+var defaultArchiveAggregation = moira.ArchiveAggregation{Method: moira.ArchiveAggregationAverage, XFilesFactor: 0.5}
+
 type retentionMatcher struct {
 	pattern   *regexp.Regexp
 	retention int
+	archives  []moira.RetentionArchive
 }
 
 type retentionCacheItem struct {
-	value     int
-	timestamp int64
+	value       int
+	archives    []moira.RetentionArchive
+	aggregation moira.ArchiveAggregation
+	timestamp   int64
+}
+
+type aggregationMatcher struct {
+	pattern *regexp.Regexp
+	moira.ArchiveAggregation
 }
 
 // Storage struct to store retention matchers
@@ -28,10 +42,12 @@ type Storage struct {
 	retentions      []retentionMatcher
 	retentionsCache map[string]*retentionCacheItem
 	metricsCache    map[string]*moira.MatchedMetric
+	aggregations    []aggregationMatcher
 }
 
 // NewCacheStorage create new Storage
-func NewCacheStorage(metrics *graphite.FilterMetrics, reader io.Reader) (*Storage, error) {
+// aggregationReader contains storage-aggregation.conf, it is optional and may be nil
+func NewCacheStorage(metrics *graphite.FilterMetrics, reader io.Reader, aggregationReader io.Reader) (*Storage, error) {
 	storage := &Storage{
 		retentionsCache: make(map[string]*retentionCacheItem),
 		metricsCache:    make(map[string]*moira.MatchedMetric),
@@ -41,35 +57,61 @@ func NewCacheStorage(metrics *graphite.FilterMetrics, reader io.Reader) (*Storag
 	if err := storage.buildRetentions(bufio.NewScanner(reader)); err != nil {
 		return nil, err
 	}
+	if aggregationReader != nil {
+		if err := storage.buildAggregations(bufio.NewScanner(aggregationReader)); err != nil {
+			return nil, err
+		}
+	}
 	return storage, nil
 }
 
-// EnrichMatchedMetric calculate retention and filter cached values
+// EnrichMatchedMetric calculate retention, archives and filter cached values
+// Points of lower precision archives are aggregated by database from stored points of previous archives
 func (storage *Storage) EnrichMatchedMetric(buffer map[string]*moira.MatchedMetric, m *moira.MatchedMetric) {
-	m.Retention = storage.getRetention(m)
+	retention := storage.getRetention(m)
+	m.Retention = retention.value
 	m.RetentionTimestamp = roundToNearestRetention(m.Timestamp, int64(m.Retention))
 	if ex, ok := storage.metricsCache[m.Metric]; ok && ex.RetentionTimestamp == m.RetentionTimestamp && ex.Value == m.Value {
 		return
 	}
 	storage.metricsCache[m.Metric] = m
+	if len(retention.archives) > 1 {
+		m.Archives = retention.archives
+		m.ArchiveAggregation = retention.aggregation
+	}
 	buffer[m.Metric] = m
 }
 
-// getRetention returns first matched retention for metric
-func (storage *Storage) getRetention(m *moira.MatchedMetric) int {
+// getRetention returns first matched retention with its archives and archive aggregation for metric
+func (storage *Storage) getRetention(m *moira.MatchedMetric) *retentionCacheItem {
 	if item, ok := storage.retentionsCache[m.Metric]; ok && item.timestamp+60 > m.Timestamp {
-		return item.value
+		return item
 	}
 	for _, matcher := range storage.retentions {
 		if matcher.pattern.MatchString(m.Metric) {
-			storage.retentionsCache[m.Metric] = &retentionCacheItem{
+			item := &retentionCacheItem{
 				value:     matcher.retention,
+				archives:  matcher.archives,
 				timestamp: m.Timestamp,
 			}
-			return matcher.retention
+			if len(matcher.archives) > 1 {
+				item.aggregation = storage.getAggregation(m.Metric)
+			}
+			storage.retentionsCache[m.Metric] = item
+			return item
 		}
 	}
-	return defaultRetention
+	return defaultRetentionItem
+}
+
+// getAggregation returns first matched archive aggregation for metric
+func (storage *Storage) getAggregation(metric string) moira.ArchiveAggregation {
+	for _, matcher := range storage.aggregations {
+		if matcher.pattern.MatchString(metric) {
+			return matcher.ArchiveAggregation
+		}
+	}
+	return defaultArchiveAggregation
 }
 
 func (storage *Storage) buildRetentions(retentionScanner *bufio.Scanner) error {
@@ -88,20 +130,114 @@ func (storage *Storage) buildRetentions(retentionScanner *bufio.Scanner) error {
 
 		retentionScanner.Scan()
 		line = retentionScanner.Text()
-		retentions := strings.TrimSpace(strings.Split(line, "=")[1])
-		retention, err := rawRetentionToSeconds(retentions[0:strings.Index(retentions, ":")])
+		archives, err := parseRetentionArchives(strings.TrimSpace(strings.Split(line, "=")[1]))
 		if err != nil {
 			return err
 		}
 
 		storage.retentions = append(storage.retentions, retentionMatcher{
 			pattern:   pattern,
-			retention: retention,
+			retention: int(archives[0].Step),
+			archives:  archives,
 		})
 	}
 	return retentionScanner.Err()
 }
 
+// parseRetentionArchives parses retentions "precision:ttl,precision:ttl,..."
+// ttl is the number of points if it has no unit, as whisper does
+// Precision of every next archive must be divisible by precision of previous one
+func parseRetentionArchives(retentions string) ([]moira.RetentionArchive, error) {
+	archives := make([]moira.RetentionArchive, 0)
+	for _, rawArchive := range strings.Split(retentions, ",") {
+		archiveParts := strings.Split(strings.TrimSpace(rawArchive), ":")
+		if len(archiveParts) != 2 {
+			return nil, fmt.Errorf("invalid retention archive '%s'", rawArchive)
+		}
+		step, err := rawRetentionToSeconds(archiveParts[0])
+		if err != nil {
+			return nil, err
+		}
+		if step <= 0 {
+			return nil, fmt.Errorf("invalid precision of retention archive '%s'", rawArchive)
+		}
+		ttl, err := strconv.Atoi(archiveParts[1])
+		if err == nil {
+			ttl *= step
+		} else if ttl, err = rawRetentionToSeconds(archiveParts[1]); err != nil {
+			return nil, err
+		}
+		if len(archives) > 0 {
+			previous := archives[len(archives)-1]
+			if int64(step) <= previous.Step || int64(step)%previous.Step != 0 {
+				return nil, fmt.Errorf("precision of retention archive '%s' is not divisible by previous archive precision", rawArchive)
+			}
+		}
+		archives = append(archives, moira.RetentionArchive{Step: int64(step), TTL: int64(ttl)})
+	}
+	return archives, nil
+}
+
+// buildAggregations parses storage-aggregation.conf sections with pattern, xFilesFactor and aggregationMethod
+func (storage *Storage) buildAggregations(aggregationScanner *bufio.Scanner) error {
+	storage.aggregations = make([]aggregationMatcher, 0)
+	var matcher *aggregationMatcher
+	appendMatcher := func() error {
+		if matcher == nil {
+			return nil
+		}
+		if matcher.pattern == nil {
+			return fmt.Errorf("aggregation section has no pattern")
+		}
+		storage.aggregations = append(storage.aggregations, *matcher)
+		return nil
+	}
+
+	for aggregationScanner.Scan() {
+		line := strings.TrimSpace(aggregationScanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if strings.HasPrefix(line, "[") {
+			if err := appendMatcher(); err != nil {
+				return err
+			}
+			matcher = &aggregationMatcher{ArchiveAggregation: defaultArchiveAggregation}
+			continue
+		}
+		lineParts := strings.SplitN(line, "=", 2)
+		if matcher == nil || len(lineParts) != 2 {
+			continue
+		}
+		value := strings.TrimSpace(lineParts[1])
+		switch strings.TrimSpace(lineParts[0]) {
+		case "pattern":
+			pattern, err := regexp.Compile(value)
+			if err != nil {
+				return err
+			}
+			matcher.pattern = pattern
+		case "xFilesFactor":
+			xFilesFactor, err := strconv.ParseFloat(value, 64)
+			if err != nil || xFilesFactor < 0 || xFilesFactor > 1 {
+				return fmt.Errorf("invalid xFilesFactor '%s'", value)
+			}
+			matcher.XFilesFactor = xFilesFactor
+		case "aggregationMethod":
+			switch value {
+			case moira.ArchiveAggregationAverage, moira.ArchiveAggregationSum, moira.ArchiveAggregationMin, moira.ArchiveAggregationMax, moira.ArchiveAggregationLast:
+				matcher.Method = value
+			default:
+				return fmt.Errorf("unknown aggregation method '%s'", value)
+			}
+		}
+	}
+	if err := appendMatcher(); err != nil {
+		return err
+	}
+	return aggregationScanner.Err()
+}
+
 func rawRetentionToSeconds(rawRetention string) (int, error) {
 	retention, err := strconv.Atoi(rawRetention)
 	if err == nil {
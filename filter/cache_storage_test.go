@@ -167,7 +167,7 @@ var matchedMetrics = []moira.MatchedMetric{
 
 func TestCacheStorage(t *testing.T) {
 	metrics2 := metrics.ConfigureFilterMetrics("test")
-	storage, err := NewCacheStorage(metrics2, strings.NewReader(testRetentions))
+	storage, err := NewCacheStorage(metrics2, strings.NewReader(testRetentions), nil)
 
 	Convey("Test good retentions", t, func() {
 		So(err, ShouldBeEmpty)
@@ -185,7 +185,7 @@ func TestCacheStorage(t *testing.T) {
 		So(len(buffer), ShouldEqual, len(matchedMetrics))
 	})
 
-	storage, _ = NewCacheStorage(metrics2, strings.NewReader(testRetentions))
+	storage, _ = NewCacheStorage(metrics2, strings.NewReader(testRetentions), nil)
 
 	Convey("Test add one metric twice, should buffer len is 1", t, func() {
 		buffer := make(map[string]*moira.MatchedMetric)
@@ -198,7 +198,7 @@ func TestCacheStorage(t *testing.T) {
 
 func TestRetentions(t *testing.T) {
 	metrics2 := metrics.ConfigureFilterMetrics("test")
-	storage, _ := NewCacheStorage(metrics2, strings.NewReader(testRetentions))
+	storage, _ := NewCacheStorage(metrics2, strings.NewReader(testRetentions), nil)
 
 	Convey("Simple metric, should 60sec", t, func() {
 		buffer := make(map[string]*moira.MatchedMetric)
@@ -230,3 +230,82 @@ func TestRetentions(t *testing.T) {
 		So(metr.RetentionTimestamp, should.Equal, 120)
 	})
 }
+
+var testAggregations = `
+	[min]
+	pattern = \.min$
+	xFilesFactor = 0.1
+	aggregationMethod = min
+
+	[count]
+	pattern = \.count$
+	xFilesFactor = 0
+	aggregationMethod = sum
+
+	[default]
+	pattern = .*
+	aggregationMethod = average
+	`
+
+func TestParseRetentionArchives(t *testing.T) {
+	Convey("Valid retentions, should parse all archives", t, func() {
+		archives, err := parseRetentionArchives("10s:1h, 1m:1d,10m:1440")
+		So(err, ShouldBeNil)
+		So(archives, ShouldResemble, []moira.RetentionArchive{{Step: 10, TTL: 3600}, {Step: 60, TTL: 86400}, {Step: 600, TTL: 864000}})
+	})
+
+	Convey("Invalid retentions, should return error", t, func() {
+		for _, retentions := range []string{"60s", "0:1d", "60s:1d,90s:7d", "60s:1d,60s:7d", "1m:1d,", "a:1d"} {
+			_, err := parseRetentionArchives(retentions)
+			So(err, ShouldNotBeNil)
+		}
+	})
+}
+
+func TestAggregations(t *testing.T) {
+	metrics2 := metrics.ConfigureFilterMetrics("test")
+
+	Convey("Invalid aggregation config, should return error", t, func() {
+		for _, aggregations := range []string{
+			"[a]\nxFilesFactor = 0.1",
+			"[a]\npattern = .*\nxFilesFactor = 2",
+			"[a]\npattern = .*\naggregationMethod = median",
+			"[a]\npattern = (",
+		} {
+			_, err := NewCacheStorage(metrics2, strings.NewReader(testRetentions), strings.NewReader(aggregations))
+			So(err, ShouldNotBeNil)
+		}
+	})
+
+	storage, err := NewCacheStorage(metrics2, strings.NewReader(testRetentions), strings.NewReader(testAggregations))
+
+	Convey("Valid aggregation config, should match first section", t, func() {
+		So(err, ShouldBeNil)
+		So(storage.getAggregation("Simple.metric.min"), ShouldResemble, moira.ArchiveAggregation{Method: moira.ArchiveAggregationMin, XFilesFactor: 0.1})
+		So(storage.getAggregation("Simple.metric.count"), ShouldResemble, moira.ArchiveAggregation{Method: moira.ArchiveAggregationSum, XFilesFactor: 0})
+		So(storage.getAggregation("Simple.metric"), ShouldResemble, defaultArchiveAggregation)
+	})
+
+	Convey("Metric with multiple archives, should get archives and their aggregation", t, func() {
+		enrich := func(metric string, value float64, timestamp int64) *moira.MatchedMetric {
+			buffer := make(map[string]*moira.MatchedMetric)
+			matchedMetric := &moira.MatchedMetric{Metric: metric, Value: value, Timestamp: timestamp}
+			storage.EnrichMatchedMetric(buffer, matchedMetric)
+			return matchedMetric
+		}
+
+		matchedMetric := enrich("Simple.metric.count", 1, 6000)
+		So(matchedMetric.Archives, ShouldResemble, []moira.RetentionArchive{{Step: 60, TTL: 172800}, {Step: 600, TTL: 2592000}, {Step: 6000, TTL: 7776000}})
+		So(matchedMetric.ArchiveAggregation, ShouldResemble, moira.ArchiveAggregation{Method: moira.ArchiveAggregationSum, XFilesFactor: 0})
+
+		matchedMetric = enrich("Simple.metric", 1, 6000)
+		So(matchedMetric.Archives, ShouldHaveLength, 3)
+		So(matchedMetric.ArchiveAggregation, ShouldResemble, defaultArchiveAggregation)
+
+		Convey("Metric with single archive, should get no archives", func() {
+			matchedMetric := enrich("Other.metric", 1, 6000)
+			So(matchedMetric.Archives, ShouldBeNil)
+			So(matchedMetric.ArchiveAggregation, ShouldResemble, moira.ArchiveAggregation{})
+		})
+	})
+}
@@ -2,7 +2,32 @@ package filter
 
 // Config is filter configuration settings
 type Config struct {
-	Enabled         bool
-	Listen          string
-	RetentionConfig string
+	Enabled                bool
+	Listen                 string
+	ConnectionWorkers      int
+	MaxLineSize            int
+	RateLimit              float64
+	RateLimitBurst         int
+	FullChannelPolicy      string
+	TLSCertFile            string
+	TLSKeyFile             string
+	TLSClientCAFile        string
+	TLSClientPrefixes      map[string][]string
+	PickleListen           string
+	UDPListen              string
+	PrometheusListen       string
+	PrometheusMetricFormat string
+	InfluxListen           string
+	InfluxMetricFormat     string
+	OpenTSDBListen         string
+	OpenTSDBMetricFormat   string
+	RetentionConfig        string
+	AggregationConfig      string
+	AggregationRules       string
+	MetricRules            []MetricRuleConfig
+	Shards                 []string
+	ShardSelf              string
+	ShardReplicas          int
+	DebugListen            string
+	DebugStatsMinutes      int
 }
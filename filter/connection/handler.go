@@ -2,29 +2,131 @@ package connection
 
 import (
 	"bufio"
+	"fmt"
 	"io"
 	"net"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/moira-alert/moira"
 	"github.com/moira-alert/moira/filter"
+	"github.com/moira-alert/moira/metrics/graphite"
 )
 
+// Behaviors of connection handler when matched metrics channel is full
+const (
+	// FullChannelBlock waits until channel has free space, so client connection is not read meanwhile
+	FullChannelBlock = "block"
+	// FullChannelDrop drops matched metric
+	FullChannelDrop = "drop"
+	// FullChannelDisconnect drops matched metric and closes client connection
+	FullChannelDisconnect = "disconnect"
+)
+
+// Default connection handler limits
+const (
+	defaultWorkers     = 16
+	defaultMaxLineSize = 4096
+)
+
+// HandlerConfig contains connection handler limits
+type HandlerConfig struct {
+	// Workers is the number of goroutines processing lines of all connections
+	Workers int
+	// MaxLineSize is the maximum line length in bytes, longer lines are skipped
+	MaxLineSize int
+	// RateLimit is the maximum lines (pickle messages) per second received from single remote address, zero means no limit
+	RateLimit float64
+	// RateLimitBurst is the number of lines (pickle messages) remote address can send at once above RateLimit
+	RateLimitBurst int
+	// FullChannelPolicy is one of FullChannelBlock, FullChannelDrop and FullChannelDisconnect
+	FullChannelPolicy string
+}
+
 // Handler handling connection data and shift it to MatchedMetrics channel
+// Connection goroutines read messages, which are converted to metrics by worker pool shared by all connections
 type Handler struct {
 	logger          moira.Logger
 	patternsStorage *filter.PatternStorage
-	wg              sync.WaitGroup
-	terminate       chan bool
+	metrics         *graphite.FilterMetrics
+	config          HandlerConfig
+	rateLimiters    *rateLimiters
+	clientPrefixes  map[string][]string
+	forwarder       *ShardForwarder
+	// metricFormat is metric name format of protocols with tags, see MetricFormatTags and MetricFormatPath
+	metricFormat string
+	// readMessage reads next message of connection, nil message is skipped
+	readMessage func(buffer *bufio.Reader) ([]byte, error)
+	// processMessage appends metrics of message matched by patterns to matchedMetrics
+	processMessage func(message []byte, matchedMetrics []*moira.MatchedMetric) []*moira.MatchedMetric
+	messages       chan messageJob
+	wg             sync.WaitGroup
+	workersWg      sync.WaitGroup
+	terminate      chan bool
+}
+
+// messageJob is received message waiting for processing in worker pool
+type messageJob struct {
+	message            []byte
+	connection         *clientConnection
+	matchedMetricsChan chan *moira.MatchedMetric
 }
 
-// NewConnectionsHandler creates new Handler
-func NewConnectionsHandler(logger moira.Logger, patternsStorage *filter.PatternStorage) *Handler {
-	return &Handler{
+// clientConnection is client connection which can be closed by worker due to full channel
+type clientConnection struct {
+	net.Conn
+	disconnected int32
+}
+
+// NewConnectionsHandler creates new Handler of graphite plaintext protocol and starts its worker pool
+func NewConnectionsHandler(logger moira.Logger, patternsStorage *filter.PatternStorage, metrics *graphite.FilterMetrics, config HandlerConfig) (*Handler, error) {
+	handler, err := newConnectionsHandler(logger, patternsStorage, metrics, config)
+	if err != nil {
+		return nil, err
+	}
+	handler.readMessage = handler.readLine
+	handler.processMessage = handler.processPlaintextLine
+	handler.start()
+	return handler, nil
+}
+
+func newConnectionsHandler(logger moira.Logger, patternsStorage *filter.PatternStorage, metrics *graphite.FilterMetrics, config HandlerConfig) (*Handler, error) {
+	switch config.FullChannelPolicy {
+	case "":
+		config.FullChannelPolicy = FullChannelBlock
+	case FullChannelBlock, FullChannelDrop, FullChannelDisconnect:
+	default:
+		return nil, fmt.Errorf("Unknown full channel policy [%s]", config.FullChannelPolicy)
+	}
+	if config.Workers <= 0 {
+		config.Workers = defaultWorkers
+	}
+	if config.MaxLineSize <= 0 {
+		config.MaxLineSize = defaultMaxLineSize
+	}
+
+	handler := &Handler{
 		logger:          logger,
 		patternsStorage: patternsStorage,
+		metrics:         metrics,
+		config:          config,
+		rateLimiters:    newRateLimiters(config.RateLimit, config.RateLimitBurst),
+		messages:        make(chan messageJob, config.Workers),
 		terminate:       make(chan bool, 1),
 	}
+	return handler, nil
+}
+
+// start starts worker pool, handler messages reader and processor must be set before it
+func (handler *Handler) start() {
+	for i := 0; i < handler.config.Workers; i++ {
+		handler.workersWg.Add(1)
+		go func() {
+			defer handler.workersWg.Done()
+			handler.processMessages()
+		}()
+	}
 }
 
 // HandleConnection convert every line from connection to metric and send it to MatchedMetric channel
@@ -32,35 +134,144 @@ func (handler *Handler) HandleConnection(connection net.Conn, matchedMetricsChan
 	handler.wg.Add(1)
 	go func() {
 		defer handler.wg.Done()
-		handler.handle(connection, matchedMetricsChan)
+		handler.handle(&clientConnection{Conn: connection}, matchedMetricsChan)
 	}()
 }
 
-func (handler *Handler) handle(connection net.Conn, matchedMetricsChan chan *moira.MatchedMetric) {
-	buffer := bufio.NewReader(connection)
+func (handler *Handler) handle(connection *clientConnection, matchedMetricsChan chan *moira.MatchedMetric) {
+	// one more byte for line delimiter
+	buffer := bufio.NewReaderSize(connection, handler.config.MaxLineSize+1)
+	limiter := handler.rateLimiters.acquire(connection.RemoteAddr())
+	defer handler.rateLimiters.release(connection.RemoteAddr())
 
 	go func(conn net.Conn) {
 		<-handler.terminate
 		conn.Close()
 	}(connection)
 
+	allowedPrefixes, err := authorizeClient(connection.Conn, handler.clientPrefixes)
+	if err != nil {
+		handler.logger.Warningf("%s rejected: %s", connection.RemoteAddr(), err.Error())
+		connection.Close()
+		return
+	}
+
+	rateLimited := false
+	forbidden := false
 	for {
-		lineBytes, err := buffer.ReadBytes('\n')
+		message, err := handler.readMessage(buffer)
 		if err != nil {
-			connection.Close()
-			if err != io.EOF {
-				handler.logger.Errorf("read failed: %s", err)
-			}
+			handler.closeConnection(connection, err)
 			break
 		}
-		lineBytes = lineBytes[:len(lineBytes)-1]
-		handler.wg.Add(1)
-		go func(ch chan *moira.MatchedMetric) {
-			defer handler.wg.Done()
-			if m := handler.patternsStorage.ProcessIncomingMetric(lineBytes); m != nil {
-				ch <- m
+		if message == nil {
+			continue
+		}
+
+		if !handler.allowMessage(connection, limiter, &rateLimited) {
+			continue
+		}
+
+		if allowedPrefixes != nil && !hasAllowedPrefix(message, allowedPrefixes) {
+			handler.metrics.LinesForbidden.Mark(1)
+			if !forbidden {
+				handler.logger.Warningf("%s sent metric with not allowed prefix: %s", connection.RemoteAddr(), message)
+				forbidden = true
 			}
-		}(matchedMetricsChan)
+			continue
+		}
+
+		handler.messages <- messageJob{
+			message:            message,
+			connection:         connection,
+			matchedMetricsChan: matchedMetricsChan,
+		}
+	}
+}
+
+// closeConnection closes connection after read error
+func (handler *Handler) closeConnection(connection *clientConnection, err error) {
+	connection.Close()
+	if atomic.LoadInt32(&connection.disconnected) == 1 {
+		handler.logger.Infof("%s disconnected: matched metrics channel is full", connection.RemoteAddr())
+	} else if err != io.EOF {
+		handler.logger.Errorf("read failed: %s", err)
+	}
+}
+
+// allowMessage checks connection rate limit, exceeding is logged once per connection
+func (handler *Handler) allowMessage(connection *clientConnection, limiter *rateLimiter, rateLimited *bool) bool {
+	if limiter == nil || limiter.allow(time.Now()) {
+		return true
+	}
+	handler.metrics.LinesRateLimited.Mark(1)
+	if !*rateLimited {
+		handler.logger.Warningf("%s exceeded rate limit of %v lines per second", connection.RemoteAddr(), handler.config.RateLimit)
+		*rateLimited = true
+	}
+	return false
+}
+
+// readLine reads line without delimiter, too long line is skipped
+func (handler *Handler) readLine(buffer *bufio.Reader) ([]byte, error) {
+	lineBytes, err := buffer.ReadSlice('\n')
+	if err == bufio.ErrBufferFull {
+		handler.metrics.LinesTooLong.Mark(1)
+		return nil, skipLine(buffer)
+	}
+	if err != nil {
+		return nil, err
+	}
+	line := make([]byte, len(lineBytes)-1)
+	copy(line, lineBytes)
+	return line, nil
+}
+
+// skipLine reads and discards the rest of too long line
+func skipLine(buffer *bufio.Reader) error {
+	for {
+		_, err := buffer.ReadSlice('\n')
+		if err != bufio.ErrBufferFull {
+			return err
+		}
+	}
+}
+
+func (handler *Handler) processMessages() {
+	matchedMetrics := make([]*moira.MatchedMetric, 0)
+	for job := range handler.messages {
+		matchedMetrics = handler.processMessage(job.message, matchedMetrics[:0])
+		for _, matchedMetric := range matchedMetrics {
+			handler.sendMatchedMetric(job.connection, job.matchedMetricsChan, matchedMetric)
+		}
+	}
+}
+
+// processPlaintextLine matches graphite plaintext line, lines of metrics owned by other shards are forwarded instead
+func (handler *Handler) processPlaintextLine(line []byte, matchedMetrics []*moira.MatchedMetric) []*moira.MatchedMetric {
+	if handler.forwarder != nil && handler.forwarder.forward(line) {
+		return matchedMetrics
+	}
+	if matchedMetric := handler.patternsStorage.ProcessIncomingMetric(line); matchedMetric != nil {
+		matchedMetrics = append(matchedMetrics, matchedMetric)
+	}
+	return matchedMetrics
+}
+
+// sendMatchedMetric sends metric to matched metrics channel according to full channel policy
+func (handler *Handler) sendMatchedMetric(connection *clientConnection, matchedMetricsChan chan *moira.MatchedMetric, matchedMetric *moira.MatchedMetric) {
+	if handler.config.FullChannelPolicy == FullChannelBlock {
+		matchedMetricsChan <- matchedMetric
+		return
+	}
+	select {
+	case matchedMetricsChan <- matchedMetric:
+	default:
+		handler.metrics.MatchedMetricsDropped.Mark(1)
+		if handler.config.FullChannelPolicy == FullChannelDisconnect && atomic.CompareAndSwapInt32(&connection.disconnected, 0, 1) {
+			handler.metrics.ConnectionsDisconnected.Mark(1)
+			connection.Close()
+		}
 	}
 }
 
@@ -68,4 +279,6 @@ func (handler *Handler) handle(connection net.Conn, matchedMetricsChan chan *moi
 func (handler *Handler) StopHandlingConnections() {
 	close(handler.terminate)
 	handler.wg.Wait()
+	close(handler.messages)
+	handler.workersWg.Wait()
 }
@@ -0,0 +1,102 @@
+package connection
+
+import (
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/op/go-logging"
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/moira-alert/moira"
+	"github.com/moira-alert/moira/metrics/graphite/go-metrics"
+)
+
+func TestHandleConnection(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	logger, _ := logging.GetLogger("Filter")
+	patternsStorage := newTestPatternStorage(t, mockCtrl, logger, []string{"Simple.matching.pattern", "Star.single.*"})
+
+	Convey("Given unknown full channel policy, should return error", t, func() {
+		_, err := NewConnectionsHandler(logger, patternsStorage, metrics.ConfigureFilterMetrics("test"), HandlerConfig{FullChannelPolicy: "wait"})
+		So(err, ShouldNotBeNil)
+	})
+
+	Convey("Given too long line, should skip it and handle next lines", t, func() {
+		handlerMetrics := metrics.ConfigureFilterMetrics("test")
+		handler, err := NewConnectionsHandler(logger, patternsStorage, handlerMetrics, HandlerConfig{MaxLineSize: 64})
+		So(err, ShouldBeNil)
+		metricsChan := make(chan *moira.MatchedMetric, 10)
+		sendLines(handler, metricsChan, []string{
+			"Star.single." + strings.Repeat("long", 100) + " 1 1234567890",
+			"Star.single.short 2 1234567890",
+			"Simple.matching.pattern 3 1234567890",
+		})
+
+		So(len(metricsChan), ShouldEqual, 2)
+		So(handlerMetrics.LinesTooLong.Count(), ShouldEqual, 1)
+	})
+
+	Convey("Given rate limit, should skip lines above it", t, func() {
+		handlerMetrics := metrics.ConfigureFilterMetrics("test")
+		handler, err := NewConnectionsHandler(logger, patternsStorage, handlerMetrics, HandlerConfig{RateLimit: 0.001, RateLimitBurst: 2})
+		So(err, ShouldBeNil)
+		metricsChan := make(chan *moira.MatchedMetric, 10)
+		sendLines(handler, metricsChan, []string{
+			"Star.single.one 1 1234567890",
+			"Star.single.two 2 1234567890",
+			"Star.single.three 3 1234567890",
+			"Star.single.four 4 1234567890",
+		})
+
+		So(len(metricsChan), ShouldEqual, 2)
+		So(handlerMetrics.LinesRateLimited.Count(), ShouldEqual, 2)
+		So(handler.rateLimiters.limiters, ShouldBeEmpty)
+	})
+
+	Convey("Given full channel and drop policy, should drop matched metrics", t, func() {
+		handlerMetrics := metrics.ConfigureFilterMetrics("test")
+		handler, err := NewConnectionsHandler(logger, patternsStorage, handlerMetrics, HandlerConfig{FullChannelPolicy: FullChannelDrop})
+		So(err, ShouldBeNil)
+		metricsChan := make(chan *moira.MatchedMetric, 1)
+		sendLines(handler, metricsChan, []string{
+			"Star.single.one 1 1234567890",
+			"Star.single.two 2 1234567890",
+			"Star.single.three 3 1234567890",
+		})
+
+		So(len(metricsChan), ShouldEqual, 1)
+		So(handlerMetrics.MatchedMetricsDropped.Count(), ShouldEqual, 2)
+		So(handlerMetrics.ConnectionsDisconnected.Count(), ShouldEqual, 0)
+	})
+
+	Convey("Given full channel and disconnect policy, should close connection", t, func() {
+		handlerMetrics := metrics.ConfigureFilterMetrics("test")
+		handler, err := NewConnectionsHandler(logger, patternsStorage, handlerMetrics, HandlerConfig{Workers: 1, FullChannelPolicy: FullChannelDisconnect})
+		So(err, ShouldBeNil)
+		metricsChan := make(chan *moira.MatchedMetric)
+		sendLines(handler, metricsChan, []string{
+			"Star.single.one 1 1234567890",
+			"Star.single.two 2 1234567890",
+		})
+
+		So(handlerMetrics.MatchedMetricsDropped.Count(), ShouldBeGreaterThanOrEqualTo, 1)
+		So(handlerMetrics.ConnectionsDisconnected.Count(), ShouldEqual, 1)
+	})
+}
+
+// sendLines writes lines to handled connection, closes it and waits for handler to process all lines
+func sendLines(handler *Handler, metricsChan chan *moira.MatchedMetric, lines []string) {
+	server, client := net.Pipe()
+	handler.HandleConnection(server, metricsChan)
+	for _, line := range lines {
+		if _, err := client.Write([]byte(line + "\n")); err != nil {
+			break
+		}
+	}
+	client.Close()
+	handler.wg.Wait()
+	handler.StopHandlingConnections()
+}
@@ -0,0 +1,51 @@
+package connection
+
+import (
+	"strings"
+	"time"
+
+	"github.com/moira-alert/moira"
+	"github.com/moira-alert/moira/filter"
+	"github.com/moira-alert/moira/metrics/graphite"
+)
+
+// NewInfluxConnectionsHandler creates new Handler of influxdb line protocol and starts its worker pool
+// format defines how measurement, tags and fields are converted to metric name, see MetricFormatTags and MetricFormatPath
+func NewInfluxConnectionsHandler(logger moira.Logger, patternsStorage *filter.PatternStorage, metrics *graphite.FilterMetrics, config HandlerConfig, format string) (*Handler, error) {
+	handler, err := newConnectionsHandler(logger, patternsStorage, metrics, config)
+	if err != nil {
+		return nil, err
+	}
+	handler.metricFormat = format
+	handler.readMessage = handler.readLine
+	handler.processMessage = handler.processInfluxLine
+	handler.start()
+	return handler, nil
+}
+
+// processInfluxLine parses influxdb line and matches metric of every field, empty lines and comments are skipped
+func (handler *Handler) processInfluxLine(lineBytes []byte, matchedMetrics []*moira.MatchedMetric) []*moira.MatchedMetric {
+	line := strings.TrimRight(string(lineBytes), "\r")
+	if line == "" || strings.HasPrefix(line, "#") {
+		return matchedMetrics
+	}
+	point, err := parseInfluxLine(line)
+	if err != nil {
+		handler.logger.Infof("cannot parse input: %v", err)
+		return matchedMetrics
+	}
+	timestamp := point.timestamp / int64(time.Second)
+	if point.timestamp == 0 {
+		timestamp = time.Now().Unix()
+	}
+
+	for _, metric := range point.getMetrics(handler.metricFormat) {
+		if handler.forwarder != nil && handler.forwarder.forwardMetric([]byte(metric.name), metric.value, timestamp) {
+			continue
+		}
+		if m := handler.patternsStorage.ProcessParsedMetric([]byte(metric.name), metric.value, timestamp); m != nil {
+			matchedMetrics = append(matchedMetrics, m)
+		}
+	}
+	return matchedMetrics
+}
@@ -0,0 +1,60 @@
+package connection
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/op/go-logging"
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/moira-alert/moira"
+	"github.com/moira-alert/moira/metrics/graphite/go-metrics"
+)
+
+func TestInfluxHandlerProcessLine(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	logger, _ := logging.GetLogger("Filter")
+	patternsStorage := newTestPatternStorage(t, mockCtrl, logger, []string{"seriesByTag('name=cpu.usage_idle')", "mem.used.host.*"})
+
+	Convey("Given tags format, should match tagged series", t, func() {
+		handler := &Handler{logger: logger, patternsStorage: patternsStorage, metricFormat: MetricFormatTags}
+		matchedMetrics := handler.processInfluxLine([]byte("cpu,host=web1 usage_idle=98.5,usage_user=1.5 1234567890000000000\r"), nil)
+		So(matchedMetrics, ShouldHaveLength, 1)
+		So(matchedMetrics[0].Metric, ShouldEqual, "cpu.usage_idle;host=web1")
+		So(matchedMetrics[0].Value, ShouldEqual, 98.5)
+		So(matchedMetrics[0].Timestamp, ShouldEqual, 1234567890)
+	})
+
+	Convey("Given path format, should match graphite path", t, func() {
+		handler := &Handler{logger: logger, patternsStorage: patternsStorage, metricFormat: MetricFormatPath}
+		matchedMetrics := handler.processInfluxLine([]byte("mem,host=web1 used=1024i"), nil)
+		So(matchedMetrics, ShouldHaveLength, 1)
+		So(matchedMetrics[0].Metric, ShouldEqual, "mem.used.host.web1")
+		So(matchedMetrics[0].Timestamp, ShouldBeGreaterThanOrEqualTo, time.Now().Unix()-1)
+	})
+
+	Convey("Given malformed line, should match nothing", t, func() {
+		handler := &Handler{logger: logger, patternsStorage: patternsStorage, metricFormat: MetricFormatTags}
+		So(handler.processInfluxLine([]byte("cpu,host=web1 usage_idle"), nil), ShouldBeEmpty)
+		So(handler.processInfluxLine([]byte("# comment"), nil), ShouldBeEmpty)
+	})
+
+	Convey("Given connection, should skip too long lines and handle next lines by worker pool", t, func() {
+		handlerMetrics := metrics.ConfigureFilterMetrics("test")
+		handler, err := NewInfluxConnectionsHandler(logger, patternsStorage, handlerMetrics, HandlerConfig{MaxLineSize: 64}, MetricFormatPath)
+		So(err, ShouldBeNil)
+		metricsChan := make(chan *moira.MatchedMetric, 10)
+		sendLines(handler, metricsChan, []string{
+			"mem,host=" + strings.Repeat("long", 100) + " used=1",
+			"",
+			"mem,host=web1 used=2,free=3",
+			"mem,host=web2 used=4",
+		})
+
+		So(len(metricsChan), ShouldEqual, 2)
+		So(handlerMetrics.LinesTooLong.Count(), ShouldEqual, 1)
+	})
+}
@@ -0,0 +1,152 @@
+package connection
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// influxPoint is single line of influxdb line protocol
+type influxPoint struct {
+	measurement string
+	tags        []metricTag
+	fields      []influxField
+	// timestamp is unix time in nanoseconds, zero if line has no timestamp
+	timestamp int64
+}
+
+type influxField struct {
+	name  string
+	value float64
+}
+
+// parseInfluxLine parses influxdb line protocol line "measurement,tag=value field=1.0,other=2i timestamp"
+// String fields are skipped, booleans are converted to 1 and 0
+// See https://docs.influxdata.com/influxdb/v1.7/write_protocols/line_protocol_reference/
+func parseInfluxLine(line string) (*influxPoint, error) {
+	sections := splitInfluxEscaped(line, ' ')
+	if len(sections) < 2 || len(sections) > 3 {
+		return nil, fmt.Errorf("influx line must contain measurement, fields and optional timestamp: '%s'", line)
+	}
+
+	keyParts := splitInfluxEscaped(sections[0], ',')
+	point := &influxPoint{measurement: unescapeInflux(keyParts[0])}
+	if point.measurement == "" {
+		return nil, fmt.Errorf("measurement is empty: '%s'", line)
+	}
+	for _, tagPart := range keyParts[1:] {
+		name, value, err := splitInfluxKeyValue(tagPart)
+		if err != nil {
+			return nil, fmt.Errorf("invalid tag in '%s': %s", line, err.Error())
+		}
+		point.tags = append(point.tags, metricTag{name: unescapeInflux(name), value: unescapeInflux(value)})
+	}
+
+	for _, fieldPart := range splitInfluxEscaped(sections[1], ',') {
+		name, rawValue, err := splitInfluxKeyValue(fieldPart)
+		if err != nil {
+			return nil, fmt.Errorf("invalid field in '%s': %s", line, err.Error())
+		}
+		if strings.HasPrefix(rawValue, `"`) {
+			continue
+		}
+		value, err := parseInfluxFieldValue(rawValue)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value of field '%s' in '%s': %s", name, line, err.Error())
+		}
+		point.fields = append(point.fields, influxField{name: unescapeInflux(name), value: value})
+	}
+
+	if len(sections) == 3 {
+		timestamp, err := strconv.ParseInt(sections[2], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid timestamp in '%s': %s", line, err.Error())
+		}
+		point.timestamp = timestamp
+	}
+	return point, nil
+}
+
+func parseInfluxFieldValue(value string) (float64, error) {
+	switch value {
+	case "t", "T", "true", "True", "TRUE":
+		return 1, nil
+	case "f", "F", "false", "False", "FALSE":
+		return 0, nil
+	}
+	switch {
+	case strings.HasSuffix(value, "i"):
+		integer, err := strconv.ParseInt(value[:len(value)-1], 10, 64)
+		return float64(integer), err
+	case strings.HasSuffix(value, "u"):
+		integer, err := strconv.ParseUint(value[:len(value)-1], 10, 64)
+		return float64(integer), err
+	}
+	float, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0, err
+	}
+	if math.IsNaN(float) || math.IsInf(float, 0) {
+		return 0, fmt.Errorf("value must be finite number")
+	}
+	return float, nil
+}
+
+// splitInfluxKeyValue splits "key=value" by first unescaped equal sign
+func splitInfluxKeyValue(s string) (string, string, error) {
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '=':
+			if i == 0 || i == len(s)-1 {
+				return "", "", fmt.Errorf("empty key or value: '%s'", s)
+			}
+			return s[:i], s[i+1:], nil
+		}
+	}
+	return "", "", fmt.Errorf("no '=' in '%s'", s)
+}
+
+// splitInfluxEscaped splits string by separator, ignoring escaped separators and ones inside double quoted strings
+func splitInfluxEscaped(s string, separator byte) []string {
+	parts := make([]string, 0)
+	start := 0
+	quoted := false
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '"':
+			// only string field values can be quoted
+			if quoted || (i > 0 && s[i-1] == '=') {
+				quoted = !quoted
+			}
+		case separator:
+			if !quoted {
+				parts = append(parts, s[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(parts, s[start:])
+}
+
+var influxUnescaper = strings.NewReplacer(`\,`, ",", `\ `, " ", `\=`, "=")
+
+func unescapeInflux(s string) string {
+	return influxUnescaper.Replace(s)
+}
+
+// getMetrics converts every numeric field of point to graphite metric "measurement.field" with point tags in given format
+func (point *influxPoint) getMetrics(format string) []influxField {
+	metrics := make([]influxField, 0, len(point.fields))
+	for _, field := range point.fields {
+		metrics = append(metrics, influxField{
+			name:  buildMetricName([]string{point.measurement, field.name}, point.tags, format),
+			value: field.value,
+		})
+	}
+	return metrics
+}
@@ -0,0 +1,77 @@
+package connection
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestParseInfluxLine(t *testing.T) {
+	Convey("Given line with tags, fields and timestamp, should parse all of them", t, func() {
+		point, err := parseInfluxLine("cpu,host=web1,cpu=cpu0 usage_idle=98.5,usage_user=1i,online=true,note=\"a, b=c\" 1234567890000000000")
+		So(err, ShouldBeNil)
+		So(point.measurement, ShouldEqual, "cpu")
+		So(point.tags, ShouldResemble, []metricTag{{"host", "web1"}, {"cpu", "cpu0"}})
+		So(point.fields, ShouldResemble, []influxField{{"usage_idle", 98.5}, {"usage_user", 1}, {"online", 1}})
+		So(point.timestamp, ShouldEqual, 1234567890000000000)
+	})
+
+	Convey("Given line without tags and timestamp, should parse it", t, func() {
+		point, err := parseInfluxLine("mem used=12u,free=-1.5e3,ok=F")
+		So(err, ShouldBeNil)
+		So(point.measurement, ShouldEqual, "mem")
+		So(point.tags, ShouldBeEmpty)
+		So(point.fields, ShouldResemble, []influxField{{"used", 12}, {"free", -1500}, {"ok", 0}})
+		So(point.timestamp, ShouldEqual, 0)
+	})
+
+	Convey("Given line with escaped chars, should unescape them", t, func() {
+		point, err := parseInfluxLine(`disk\ io,path=/var\,log,mode\=x=r\ w read\ bytes=10`)
+		So(err, ShouldBeNil)
+		So(point.measurement, ShouldEqual, "disk io")
+		So(point.tags, ShouldResemble, []metricTag{{"path", "/var,log"}, {"mode=x", "r w"}})
+		So(point.fields, ShouldResemble, []influxField{{"read bytes", 10}})
+	})
+
+	Convey("Given invalid lines, should return error", t, func() {
+		invalidLines := []string{
+			"cpu",
+			"cpu usage=1 123 456",
+			",host=web1 usage=1",
+			"cpu,host usage=1",
+			"cpu,host= usage=1",
+			"cpu usage",
+			"cpu usage=",
+			"cpu usage=abc",
+			"cpu usage=1.5i",
+			"cpu usage=NaN",
+			"cpu usage=1 12:00",
+		}
+		for _, line := range invalidLines {
+			_, err := parseInfluxLine(line)
+			So(err, ShouldNotBeNil)
+		}
+	})
+}
+
+func TestInfluxPointGetMetrics(t *testing.T) {
+	point := &influxPoint{
+		measurement: "cpu",
+		tags:        []metricTag{{"host", "web1.example.com"}, {"cpu", "cpu0"}},
+		fields:      []influxField{{"usage_idle", 98.5}, {"usage user", 1}},
+	}
+
+	Convey("Given tags format, should return tagged series", t, func() {
+		So(point.getMetrics(MetricFormatTags), ShouldResemble, []influxField{
+			{"cpu.usage_idle;cpu=cpu0;host=web1.example.com", 98.5},
+			{"cpu.usage_user;cpu=cpu0;host=web1.example.com", 1},
+		})
+	})
+
+	Convey("Given path format, should return graphite paths", t, func() {
+		So(point.getMetrics(MetricFormatPath), ShouldResemble, []influxField{
+			{"cpu.usage_idle.cpu.cpu0.host.web1_example_com", 98.5},
+			{"cpu.usage_user.cpu.cpu0.host.web1_example_com", 1},
+		})
+	})
+}
@@ -1,6 +1,7 @@
 package connection
 
 import (
+	"crypto/tls"
 	"fmt"
 	"net"
 	"time"
@@ -9,18 +10,96 @@ import (
 
 	"github.com/moira-alert/moira"
 	"github.com/moira-alert/moira/filter"
+	"github.com/moira-alert/moira/metrics/graphite"
 )
 
+// connectionHandler handles accepted connections according to the listener protocol
+type connectionHandler interface {
+	HandleConnection(connection net.Conn, matchedMetricsChan chan *moira.MatchedMetric)
+	StopHandlingConnections()
+}
+
 // MetricsListener is facade for standard net.MetricsListener and accept connection for handling it
 type MetricsListener struct {
-	listener *net.TCPListener
-	handler  *Handler
-	logger   moira.Logger
-	tomb     tomb.Tomb
+	listener  *net.TCPListener
+	tlsConfig *tls.Config
+	handler   connectionHandler
+	logger    moira.Logger
+	tomb      tomb.Tomb
 }
 
-// NewListener creates new listener
-func NewListener(port string, logger moira.Logger, patternStorage *filter.PatternStorage) (*MetricsListener, error) {
+// NewListener creates new listener for graphite plaintext protocol
+// Connections are accepted over tls if tlsConfig has certificate
+// Lines of metrics owned by other shards are sent to them by forwarder if it is not nil
+func NewListener(port string, logger moira.Logger, metrics *graphite.FilterMetrics, patternStorage *filter.PatternStorage, config HandlerConfig, tlsConfig TLSConfig, forwarder *ShardForwarder) (*MetricsListener, error) {
+	handler, err := NewConnectionsHandler(logger, patternStorage, metrics, config)
+	if err != nil {
+		return nil, err
+	}
+	if forwarder != nil {
+		handler.forwarder = forwarder
+		handler.rateLimiters.exemptHosts = forwarder.peerHosts
+	}
+	if !tlsConfig.enabled() {
+		return newTCPListener(port, logger, handler)
+	}
+	serverTLSConfig, err := newTLSConfig(tlsConfig)
+	if err != nil {
+		return nil, err
+	}
+	handler.clientPrefixes = tlsConfig.ClientPrefixes
+	listener, err := newTCPListener(port, logger, handler)
+	if err != nil {
+		return nil, err
+	}
+	listener.tlsConfig = serverTLSConfig
+	return listener, nil
+}
+
+// NewPickleListener creates new listener for graphite pickle protocol
+// Metrics owned by other shards are sent to them by forwarder if it is not nil
+func NewPickleListener(port string, logger moira.Logger, metrics *graphite.FilterMetrics, patternStorage *filter.PatternStorage, config HandlerConfig, forwarder *ShardForwarder) (*MetricsListener, error) {
+	handler, err := NewPickleConnectionsHandler(logger, patternStorage, metrics, config)
+	if err != nil {
+		return nil, err
+	}
+	handler.forwarder = forwarder
+	return newTCPListener(port, logger, handler)
+}
+
+// NewInfluxListener creates new listener for influxdb line protocol
+// format defines how measurement, tags and fields are converted to metric name, see MetricFormatTags and MetricFormatPath
+// Metrics owned by other shards are sent to them by forwarder if it is not nil
+func NewInfluxListener(port string, format string, logger moira.Logger, metrics *graphite.FilterMetrics, patternStorage *filter.PatternStorage, config HandlerConfig, forwarder *ShardForwarder) (*MetricsListener, error) {
+	format, err := getMetricFormat(format)
+	if err != nil {
+		return nil, err
+	}
+	handler, err := NewInfluxConnectionsHandler(logger, patternStorage, metrics, config, format)
+	if err != nil {
+		return nil, err
+	}
+	handler.forwarder = forwarder
+	return newTCPListener(port, logger, handler)
+}
+
+// NewOpenTSDBListener creates new listener for OpenTSDB telnet protocol
+// format defines how metric and tags are converted to metric name, see MetricFormatTags and MetricFormatPath
+// Metrics owned by other shards are sent to them by forwarder if it is not nil
+func NewOpenTSDBListener(port string, format string, logger moira.Logger, metrics *graphite.FilterMetrics, patternStorage *filter.PatternStorage, config HandlerConfig, forwarder *ShardForwarder) (*MetricsListener, error) {
+	format, err := getMetricFormat(format)
+	if err != nil {
+		return nil, err
+	}
+	handler, err := NewOpenTSDBConnectionsHandler(logger, patternStorage, metrics, config, format)
+	if err != nil {
+		return nil, err
+	}
+	handler.forwarder = forwarder
+	return newTCPListener(port, logger, handler)
+}
+
+func newTCPListener(port string, logger moira.Logger, handler connectionHandler) (*MetricsListener, error) {
 	address, err := net.ResolveTCPAddr("tcp", port)
 	if nil != err {
 		return nil, fmt.Errorf("Failed to resolve tcp address [%s]: %s", port, err.Error())
@@ -32,15 +111,14 @@ func NewListener(port string, logger moira.Logger, patternStorage *filter.Patter
 	listener := MetricsListener{
 		listener: newListener,
 		logger:   logger,
-		handler:  NewConnectionsHandler(logger, patternStorage),
+		handler:  handler,
 	}
 	return &listener, nil
 }
 
 // Listen waits for new data in connection and handles it in ConnectionHandler
 // All handled data sets to metricsChan
-func (listener *MetricsListener) Listen() chan *moira.MatchedMetric {
-	metricsChan := make(chan *moira.MatchedMetric, 10)
+func (listener *MetricsListener) Listen(metricsChan chan *moira.MatchedMetric) {
 	listener.tomb.Go(func() error {
 		for {
 			select {
@@ -49,7 +127,6 @@ func (listener *MetricsListener) Listen() chan *moira.MatchedMetric {
 					listener.logger.Info("Stopping listener...")
 					listener.listener.Close()
 					listener.handler.StopHandlingConnections()
-					close(metricsChan)
 					listener.logger.Info("Moira Filter Listener stopped")
 					return nil
 				}
@@ -64,12 +141,14 @@ func (listener *MetricsListener) Listen() chan *moira.MatchedMetric {
 				listener.logger.Infof("Failed to accept connection: %s", err.Error())
 				continue
 			}
+			if listener.tlsConfig != nil {
+				conn = tls.Server(conn, listener.tlsConfig)
+			}
 			listener.logger.Infof("%s connected", conn.RemoteAddr())
 			listener.handler.HandleConnection(conn, metricsChan)
 		}
 	})
-	listener.logger.Info("Moira Filter Listener Started")
-	return metricsChan
+	listener.logger.Infof("Moira Filter Listener Started on %s", listener.listener.Addr())
 }
 
 // Stop stops listening connection
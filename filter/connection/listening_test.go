@@ -0,0 +1,26 @@
+package connection
+
+import (
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/moira-alert/moira"
+	"github.com/moira-alert/moira/filter"
+	"github.com/moira-alert/moira/metrics/graphite/go-metrics"
+	"github.com/moira-alert/moira/mock/moira-alert"
+)
+
+// newTestPatternStorage creates pattern storage of given patterns over database mocked by given controller
+func newTestPatternStorage(t *testing.T, mockCtrl *gomock.Controller, logger moira.Logger, patterns []string) *filter.PatternStorage {
+	database := mock_moira_alert.NewMockDatabase(mockCtrl)
+	database.EXPECT().GetPatternsVersion().Return(int64(0), nil)
+	database.EXPECT().GetPatterns().Return(patterns, nil)
+	patternsStorage, err := filter.NewPatternStorage(database, metrics.ConfigureFilterMetrics("test"), logger)
+
+	Convey("Create new pattern storage, should no error", t, func() {
+		So(err, ShouldBeNil)
+	})
+	return patternsStorage
+}
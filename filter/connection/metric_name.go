@@ -0,0 +1,79 @@
+package connection
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/moira-alert/moira/tagged"
+)
+
+// Metric name conversion formats for protocols with labeled series
+const (
+	// MetricFormatTags converts series to graphite tagged series "name;label=value"
+	MetricFormatTags = "tags"
+	// MetricFormatPath converts series to graphite path "name.label.value"
+	MetricFormatPath = "path"
+)
+
+// metricTag is single label of series in protocols with labeled series
+type metricTag struct {
+	name  string
+	value string
+}
+
+// getMetricFormat validates metric name format, empty format means MetricFormatTags
+func getMetricFormat(format string) (string, error) {
+	switch format {
+	case "":
+		return MetricFormatTags, nil
+	case MetricFormatTags, MetricFormatPath:
+		return format, nil
+	default:
+		return "", fmt.Errorf("Unknown metric format [%s]", format)
+	}
+}
+
+// buildMetricName converts series name parts and labels to graphite metric name in given format
+// Name parts are joined with dots, labels with empty values are skipped
+func buildMetricName(nameParts []string, tags []metricTag, format string) string {
+	sortedTags := make([]metricTag, 0, len(tags))
+	for _, tag := range tags {
+		if tag.value == "" || tag.name == tagged.NameTag {
+			continue
+		}
+		sortedTags = append(sortedTags, tag)
+	}
+	sort.Slice(sortedTags, func(i, j int) bool { return sortedTags[i].name < sortedTags[j].name })
+
+	switch format {
+	case MetricFormatPath:
+		parts := make([]string, 0, len(nameParts)+2*len(sortedTags))
+		for _, part := range nameParts {
+			parts = append(parts, sanitizeMetricPart(part, true))
+		}
+		for _, tag := range sortedTags {
+			parts = append(parts, sanitizeMetricPart(tag.name, true), sanitizeMetricPart(tag.value, true))
+		}
+		return strings.Join(parts, ".")
+	default:
+		metric := tagged.Metric{
+			Name: sanitizeMetricPart(strings.Join(nameParts, "."), false),
+			Tags: make(map[string]string, len(sortedTags)),
+		}
+		for _, tag := range sortedTags {
+			metric.Tags[sanitizeMetricPart(tag.name, false)] = sanitizeMetricPart(tag.value, false)
+		}
+		return metric.String()
+	}
+}
+
+// sanitizeMetricPart replaces chars which are not allowed in graphite metric names with underscore
+func sanitizeMetricPart(value string, replaceDots bool) string {
+	return strings.Map(func(r rune) rune {
+		if r <= ' ' || r > '~' || r == ';' || r == '=' || r == '~' || r == '!' || r == '^' || (replaceDots && r == '.') {
+			return '_'
+		}
+		return r
+	}, value)
+}
@@ -0,0 +1,148 @@
+package connection
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/moira-alert/moira"
+	"github.com/moira-alert/moira/filter"
+	"github.com/moira-alert/moira/metrics/graphite"
+)
+
+// openTSDBVersion is reply to telnet "version" command, some collectors use it to check connection
+const openTSDBVersion = "Moira OpenTSDB telnet listener\n"
+
+// OpenTSDBHandler handling connection data in OpenTSDB telnet protocol and shift it to MatchedMetrics channel
+// Commands are processed by connection goroutine, so replies are sent in order commands are received
+type OpenTSDBHandler struct {
+	*Handler
+}
+
+// openTSDBPoint is single OpenTSDB "put" command
+type openTSDBPoint struct {
+	metric    string
+	timestamp int64
+	value     float64
+	tags      []metricTag
+}
+
+// NewOpenTSDBConnectionsHandler creates new OpenTSDBHandler
+// format defines how metric and tags are converted to metric name, see MetricFormatTags and MetricFormatPath
+func NewOpenTSDBConnectionsHandler(logger moira.Logger, patternsStorage *filter.PatternStorage, metrics *graphite.FilterMetrics, config HandlerConfig, format string) (*OpenTSDBHandler, error) {
+	handler, err := newConnectionsHandler(logger, patternsStorage, metrics, config)
+	if err != nil {
+		return nil, err
+	}
+	handler.metricFormat = format
+	return &OpenTSDBHandler{Handler: handler}, nil
+}
+
+// HandleConnection convert every "put" command from connection to metric and send it to MatchedMetric channel
+func (handler *OpenTSDBHandler) HandleConnection(connection net.Conn, matchedMetricsChan chan *moira.MatchedMetric) {
+	handler.wg.Add(1)
+	go func() {
+		defer handler.wg.Done()
+		handler.handle(&clientConnection{Conn: connection}, matchedMetricsChan)
+	}()
+}
+
+// handle processes commands in order they are received, errors are replied to client as OpenTSDB does
+func (handler *OpenTSDBHandler) handle(connection *clientConnection, matchedMetricsChan chan *moira.MatchedMetric) {
+	// one more byte for line delimiter
+	buffer := bufio.NewReaderSize(connection, handler.config.MaxLineSize+1)
+	limiter := handler.rateLimiters.acquire(connection.RemoteAddr())
+	defer handler.rateLimiters.release(connection.RemoteAddr())
+
+	go func(conn net.Conn) {
+		<-handler.terminate
+		conn.Close()
+	}(connection)
+
+	rateLimited := false
+	for {
+		lineBytes, err := handler.readLine(buffer)
+		if err != nil {
+			handler.closeConnection(connection, err)
+			break
+		}
+		if lineBytes == nil || !handler.allowMessage(connection, limiter, &rateLimited) {
+			continue
+		}
+		line := strings.TrimRight(string(lineBytes), "\r")
+		command := strings.SplitN(strings.TrimSpace(line), " ", 2)[0]
+		switch command {
+		case "":
+		case "put":
+			matchedMetric, err := handler.processLine(line)
+			if err != nil {
+				handler.logger.Infof("cannot parse input: %v", err)
+				fmt.Fprintf(connection, "put: illegal argument: %s\n", err.Error())
+				continue
+			}
+			if matchedMetric != nil {
+				handler.sendMatchedMetric(connection, matchedMetricsChan, matchedMetric)
+			}
+		case "version":
+			io.WriteString(connection, openTSDBVersion)
+		case "exit":
+			connection.Close()
+			return
+		default:
+			fmt.Fprintf(connection, "unknown command: %s\n", command)
+		}
+	}
+}
+
+// processLine parses "put" command and returns metric matched by patterns, metric owned by other shard is forwarded instead
+func (handler *OpenTSDBHandler) processLine(line string) (*moira.MatchedMetric, error) {
+	point, err := parseOpenTSDBPut(line)
+	if err != nil {
+		return nil, err
+	}
+	metric := []byte(buildMetricName(strings.Split(point.metric, "."), point.tags, handler.metricFormat))
+	if handler.forwarder != nil && handler.forwarder.forwardMetric(metric, point.value, point.timestamp) {
+		return nil, nil
+	}
+	return handler.patternsStorage.ProcessParsedMetric(metric, point.value, point.timestamp), nil
+}
+
+// parseOpenTSDBPut parses OpenTSDB telnet command "put <metric> <timestamp> <value> <tagk1=tagv1 ...>"
+// Timestamp is unix time in seconds or milliseconds
+// See http://opentsdb.net/docs/build/html/api_telnet/put.html
+func parseOpenTSDBPut(line string) (*openTSDBPoint, error) {
+	fields := strings.Fields(line)
+	if len(fields) < 4 || fields[0] != "put" {
+		return nil, fmt.Errorf("put command must contain metric, timestamp and value: '%s'", line)
+	}
+	point := &openTSDBPoint{metric: fields[1]}
+
+	timestamp, err := strconv.ParseInt(fields[2], 10, 64)
+	if err != nil || timestamp <= 0 {
+		return nil, fmt.Errorf("invalid timestamp in '%s'", line)
+	}
+	// OpenTSDB treats timestamps with more than 10 digits as milliseconds
+	if timestamp > 9999999999 {
+		timestamp /= 1000
+	}
+	point.timestamp = timestamp
+
+	value, err := strconv.ParseFloat(fields[3], 64)
+	if err != nil || math.IsNaN(value) || math.IsInf(value, 0) {
+		return nil, fmt.Errorf("invalid value in '%s'", line)
+	}
+	point.value = value
+
+	for _, tag := range fields[4:] {
+		parts := strings.SplitN(tag, "=", 2)
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return nil, fmt.Errorf("invalid tag '%s' in '%s'", tag, line)
+		}
+		point.tags = append(point.tags, metricTag{name: parts[0], value: parts[1]})
+	}
+	return point, nil
+}
@@ -0,0 +1,122 @@
+package connection
+
+import (
+	"bufio"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/op/go-logging"
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/moira-alert/moira"
+	"github.com/moira-alert/moira/metrics/graphite/go-metrics"
+)
+
+func TestParseOpenTSDBPut(t *testing.T) {
+	Convey("Given invalid put commands, should return errors", t, func() {
+		invalidLines := []string{
+			"put sys.cpu.user 1234567890",
+			"get sys.cpu.user 1234567890 42",
+			"put sys.cpu.user now 42",
+			"put sys.cpu.user 1234567890 value",
+			"put sys.cpu.user 1234567890 NaN",
+			"put sys.cpu.user 1234567890 42 host",
+			"put sys.cpu.user 1234567890 42 =web1",
+			"put sys.cpu.user 1234567890 42 host=",
+		}
+		for _, line := range invalidLines {
+			_, err := parseOpenTSDBPut(line)
+			So(err, ShouldNotBeNil)
+		}
+	})
+
+	Convey("Given valid put commands, should parse them", t, func() {
+		point, err := parseOpenTSDBPut("put sys.cpu.user 1234567890 42.5 host=web1 cpu=0")
+		So(err, ShouldBeNil)
+		So(point, ShouldResemble, &openTSDBPoint{
+			metric:    "sys.cpu.user",
+			timestamp: 1234567890,
+			value:     42.5,
+			tags:      []metricTag{{name: "host", value: "web1"}, {name: "cpu", value: "0"}},
+		})
+
+		point, err = parseOpenTSDBPut("put  sys.cpu.user  1234567890123 -1")
+		So(err, ShouldBeNil)
+		So(point.timestamp, ShouldEqual, 1234567890)
+		So(point.value, ShouldEqual, -1)
+		So(point.tags, ShouldBeEmpty)
+	})
+}
+
+func TestOpenTSDBHandler(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	logger, _ := logging.GetLogger("Filter")
+	patternsStorage := newTestPatternStorage(t, mockCtrl, logger, []string{"seriesByTag('name=sys.cpu.user')", "sys.mem.used.host.*"})
+
+	Convey("Given tags format, should match tagged series", t, func() {
+		handler := &OpenTSDBHandler{Handler: &Handler{patternsStorage: patternsStorage, metricFormat: MetricFormatTags}}
+		matchedMetric, err := handler.processLine("put sys.cpu.user 1234567890 42 host=web1 cpu=0")
+		So(err, ShouldBeNil)
+		So(matchedMetric.Metric, ShouldEqual, "sys.cpu.user;cpu=0;host=web1")
+		So(matchedMetric.Value, ShouldEqual, 42)
+		So(matchedMetric.Timestamp, ShouldEqual, 1234567890)
+	})
+
+	Convey("Given path format, should match graphite path", t, func() {
+		handler := &OpenTSDBHandler{Handler: &Handler{patternsStorage: patternsStorage, metricFormat: MetricFormatPath}}
+		matchedMetric, err := handler.processLine("put sys.mem.used 1234567890 1024 host=web1.example.com")
+		So(err, ShouldBeNil)
+		So(matchedMetric.Metric, ShouldEqual, "sys.mem.used.host.web1_example_com")
+	})
+
+	Convey("Handle connection, should send matched metrics and reply to commands", t, func() {
+		handler, err := NewOpenTSDBConnectionsHandler(logger, patternsStorage, metrics.ConfigureFilterMetrics("test"), HandlerConfig{}, MetricFormatTags)
+		So(err, ShouldBeNil)
+		metricsChan := make(chan *moira.MatchedMetric, 10)
+		client, server := net.Pipe()
+		handler.HandleConnection(server, metricsChan)
+
+		reader := bufio.NewReader(client)
+		client.Write([]byte("version\n"))
+		reply, _ := reader.ReadString('\n')
+		So(reply, ShouldEqual, openTSDBVersion)
+
+		client.Write([]byte("put sys.cpu.user 1234567890 oops\r\n"))
+		reply, _ = reader.ReadString('\n')
+		So(reply, ShouldStartWith, "put: illegal argument: ")
+
+		client.Write([]byte("put sys.cpu.user 1234567890 1 host=web1\n"))
+		matchedMetric := <-metricsChan
+		So(matchedMetric.Metric, ShouldEqual, "sys.cpu.user;host=web1")
+
+		client.Close()
+		handler.StopHandlingConnections()
+	})
+	Convey("Handle connection, should skip too long lines and apply full channel policy", t, func() {
+		handlerMetrics := metrics.ConfigureFilterMetrics("test")
+		handler, err := NewOpenTSDBConnectionsHandler(logger, patternsStorage, handlerMetrics, HandlerConfig{MaxLineSize: 64, FullChannelPolicy: FullChannelDrop}, MetricFormatTags)
+		So(err, ShouldBeNil)
+		metricsChan := make(chan *moira.MatchedMetric, 1)
+		client, server := net.Pipe()
+		handler.HandleConnection(server, metricsChan)
+
+		reader := bufio.NewReader(client)
+		client.Write([]byte("put sys.cpu.user 1234567890 1 host=" + strings.Repeat("long", 100) + "\n"))
+		client.Write([]byte("put sys.cpu.user 1234567890 2 host=web1\n"))
+		client.Write([]byte("put sys.cpu.user 1234567890 3 host=web2\n"))
+		client.Write([]byte("version\n"))
+		reply, _ := reader.ReadString('\n')
+		So(reply, ShouldEqual, openTSDBVersion)
+
+		So(len(metricsChan), ShouldEqual, 1)
+		So((<-metricsChan).Value, ShouldEqual, 2)
+		So(handlerMetrics.LinesTooLong.Count(), ShouldEqual, 1)
+		So(handlerMetrics.MatchedMetricsDropped.Count(), ShouldEqual, 1)
+
+		client.Close()
+		handler.StopHandlingConnections()
+	})
+}
@@ -0,0 +1,145 @@
+package connection
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math/big"
+	"strconv"
+
+	pickle "github.com/lomik/og-rek"
+
+	"github.com/moira-alert/moira"
+	"github.com/moira-alert/moira/filter"
+	"github.com/moira-alert/moira/metrics/graphite"
+)
+
+// maxPickleMessageSize is the same limit as carbon MetricPickleReceiver uses
+const maxPickleMessageSize = 1 << 20
+
+// pickleMetric is single datapoint decoded from pickle message
+type pickleMetric struct {
+	metric    []byte
+	value     float64
+	timestamp int64
+}
+
+// NewPickleConnectionsHandler creates new Handler of graphite pickle protocol and starts its worker pool
+// Every pickle message is processed by single worker
+func NewPickleConnectionsHandler(logger moira.Logger, patternsStorage *filter.PatternStorage, metrics *graphite.FilterMetrics, config HandlerConfig) (*Handler, error) {
+	handler, err := newConnectionsHandler(logger, patternsStorage, metrics, config)
+	if err != nil {
+		return nil, err
+	}
+	handler.readMessage = func(buffer *bufio.Reader) ([]byte, error) {
+		return readPickleMessage(buffer)
+	}
+	handler.processMessage = handler.processPickleMessage
+	handler.start()
+	return handler, nil
+}
+
+// processPickleMessage matches all datapoints of pickle message
+func (handler *Handler) processPickleMessage(message []byte, matchedMetrics []*moira.MatchedMetric) []*moira.MatchedMetric {
+	metrics, err := parsePickleMessage(message)
+	if err != nil {
+		handler.logger.Infof("cannot parse pickle message: %v", err)
+		return matchedMetrics
+	}
+	for _, metric := range metrics {
+		if handler.forwarder != nil && handler.forwarder.forwardMetric(metric.metric, metric.value, metric.timestamp) {
+			continue
+		}
+		if m := handler.patternsStorage.ProcessParsedMetric(metric.metric, metric.value, metric.timestamp); m != nil {
+			matchedMetrics = append(matchedMetrics, m)
+		}
+	}
+	return matchedMetrics
+}
+
+// readPickleMessage reads single length-prefixed pickle message
+func readPickleMessage(reader io.Reader) ([]byte, error) {
+	var length uint32
+	if err := binary.Read(reader, binary.BigEndian, &length); err != nil {
+		return nil, err
+	}
+	if length > maxPickleMessageSize {
+		return nil, fmt.Errorf("pickle message length %d exceeds limit %d", length, maxPickleMessageSize)
+	}
+	message := make([]byte, length)
+	if _, err := io.ReadFull(reader, message); err != nil {
+		return nil, err
+	}
+	return message, nil
+}
+
+// parsePickleMessage decodes pickled list of (path, (timestamp, value)) tuples
+// Malformed datapoints are skipped, error is returned only if whole message can not be decoded
+func parsePickleMessage(message []byte) ([]pickleMetric, error) {
+	decoded, err := pickle.NewDecoder(bytes.NewReader(message)).Decode()
+	if err != nil {
+		return nil, fmt.Errorf("cannot unpickle message: %s", err.Error())
+	}
+	datapoints, ok := decoded.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("unexpected pickle message type %T, list expected", decoded)
+	}
+
+	metrics := make([]pickleMetric, 0, len(datapoints))
+	for _, datapoint := range datapoints {
+		metric, err := parsePickleDatapoint(datapoint)
+		if err != nil {
+			continue
+		}
+		metrics = append(metrics, metric)
+	}
+	return metrics, nil
+}
+
+func parsePickleDatapoint(datapoint interface{}) (pickleMetric, error) {
+	item, ok := datapoint.([]interface{})
+	if !ok || len(item) != 2 {
+		return pickleMetric{}, fmt.Errorf("datapoint must be (path, (timestamp, value)) tuple")
+	}
+	path, ok := item[0].(string)
+	if !ok {
+		return pickleMetric{}, fmt.Errorf("metric path must be string, got %T", item[0])
+	}
+	point, ok := item[1].([]interface{})
+	if !ok || len(point) != 2 {
+		return pickleMetric{}, fmt.Errorf("point must be (timestamp, value) tuple")
+	}
+	timestamp, err := pickleToFloat64(point[0])
+	if err != nil {
+		return pickleMetric{}, err
+	}
+	value, err := pickleToFloat64(point[1])
+	if err != nil {
+		return pickleMetric{}, err
+	}
+	return pickleMetric{
+		metric:    []byte(path),
+		value:     value,
+		timestamp: int64(timestamp),
+	}, nil
+}
+
+func pickleToFloat64(value interface{}) (float64, error) {
+	switch v := value.(type) {
+	case float64:
+		return v, nil
+	case int64:
+		return float64(v), nil
+	case int:
+		return float64(v), nil
+	case *big.Int:
+		f, _ := new(big.Float).SetInt(v).Float64()
+		return f, nil
+	case string:
+		return strconv.ParseFloat(v, 64)
+	default:
+		return 0, fmt.Errorf("cannot convert %T to number", value)
+	}
+}
@@ -0,0 +1,116 @@
+package connection
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/op/go-logging"
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/moira-alert/moira"
+	"github.com/moira-alert/moira/metrics/graphite/go-metrics"
+)
+
+// [('One.two.three', (1234567890, 12.5)), ('Four.five', (1234567891, 7))] pickled with protocol 2
+var validPickleMessage = []byte("\x80\x02]q\x00(X\r\x00\x00\x00One.two.threeq\x01J\xd2\x02\x96IG@)\x00\x00\x00\x00\x00\x00\x86q\x02\x86q\x03X\t\x00\x00\x00Four.fiveq\x04J\xd3\x02\x96IK\x07\x86q\x05\x86q\x06e.")
+
+// [('One.two.three', (1234567890, 12.5)), ('Bad',), ('Four.five', (1234567891, '7'))] pickled with protocol 2
+var partiallyValidPickleMessage = []byte("\x80\x02]q\x00(X\r\x00\x00\x00One.two.threeq\x01J\xd2\x02\x96IG@)\x00\x00\x00\x00\x00\x00\x86q\x02\x86q\x03X\x03\x00\x00\x00Badq\x04\x85q\x05X\t\x00\x00\x00Four.fiveq\x06J\xd3\x02\x96IX\x01\x00\x00\x007q\x07\x86q\x08\x86q\te.")
+
+// {'a': 1} pickled with protocol 2
+var dictPickleMessage = []byte("\x80\x02}q\x00X\x01\x00\x00\x00aq\x01K\x01s.")
+
+func TestParsePickleMessage(t *testing.T) {
+	expected := []pickleMetric{
+		{metric: []byte("One.two.three"), value: 12.5, timestamp: 1234567890},
+		{metric: []byte("Four.five"), value: 7, timestamp: 1234567891},
+	}
+
+	Convey("Given valid pickle message, should return all datapoints", t, func() {
+		metrics, err := parsePickleMessage(validPickleMessage)
+		So(err, ShouldBeNil)
+		So(metrics, ShouldResemble, expected)
+	})
+
+	Convey("Given message with malformed datapoint, should skip it", t, func() {
+		metrics, err := parsePickleMessage(partiallyValidPickleMessage)
+		So(err, ShouldBeNil)
+		So(metrics, ShouldResemble, expected)
+	})
+
+	Convey("Given pickled dict, should return error", t, func() {
+		metrics, err := parsePickleMessage(dictPickleMessage)
+		So(err, ShouldNotBeNil)
+		So(metrics, ShouldBeNil)
+	})
+
+	Convey("Given garbage, should return error", t, func() {
+		_, err := parsePickleMessage([]byte("One.two.three 12 1234567890"))
+		So(err, ShouldNotBeNil)
+	})
+}
+
+func TestReadPickleMessage(t *testing.T) {
+	Convey("Given two length-prefixed messages, should read them one by one", t, func() {
+		stream := &bytes.Buffer{}
+		for _, message := range [][]byte{validPickleMessage, dictPickleMessage} {
+			binary.Write(stream, binary.BigEndian, uint32(len(message)))
+			stream.Write(message)
+		}
+
+		message, err := readPickleMessage(stream)
+		So(err, ShouldBeNil)
+		So(message, ShouldResemble, validPickleMessage)
+		message, err = readPickleMessage(stream)
+		So(err, ShouldBeNil)
+		So(message, ShouldResemble, dictPickleMessage)
+		_, err = readPickleMessage(stream)
+		So(err, ShouldEqual, io.EOF)
+	})
+
+	Convey("Given too large message length, should return error", t, func() {
+		stream := &bytes.Buffer{}
+		binary.Write(stream, binary.BigEndian, uint32(maxPickleMessageSize+1))
+		_, err := readPickleMessage(stream)
+		So(err, ShouldNotBeNil)
+	})
+
+	Convey("Given truncated message, should return error", t, func() {
+		stream := &bytes.Buffer{}
+		binary.Write(stream, binary.BigEndian, uint32(len(validPickleMessage)))
+		stream.Write(validPickleMessage[:10])
+		_, err := readPickleMessage(stream)
+		So(err, ShouldEqual, io.ErrUnexpectedEOF)
+	})
+}
+
+func TestPickleHandleConnection(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	logger, _ := logging.GetLogger("Filter")
+	patternsStorage := newTestPatternStorage(t, mockCtrl, logger, []string{"One.two.three", "Four.five"})
+
+	Convey("Given rate limit, should process messages below it by worker pool", t, func() {
+		handlerMetrics := metrics.ConfigureFilterMetrics("test")
+		handler, err := NewPickleConnectionsHandler(logger, patternsStorage, handlerMetrics, HandlerConfig{RateLimit: 0.001, RateLimitBurst: 2})
+		So(err, ShouldBeNil)
+		metricsChan := make(chan *moira.MatchedMetric, 10)
+
+		server, client := net.Pipe()
+		handler.HandleConnection(server, metricsChan)
+		for i := 0; i < 3; i++ {
+			binary.Write(client, binary.BigEndian, uint32(len(validPickleMessage)))
+			client.Write(validPickleMessage)
+		}
+		client.Close()
+		handler.wg.Wait()
+		handler.StopHandlingConnections()
+
+		So(len(metricsChan), ShouldEqual, 4)
+		So(handlerMetrics.LinesRateLimited.Count(), ShouldEqual, 1)
+	})
+}
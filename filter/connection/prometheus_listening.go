@@ -0,0 +1,135 @@
+package connection
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"net"
+	"net/http"
+	"time"
+
+	"gopkg.in/tomb.v2"
+
+	"github.com/moira-alert/moira"
+	"github.com/moira-alert/moira/filter"
+)
+
+// maxRemoteWriteRequestSize limits size of compressed prometheus remote write request body
+const maxRemoteWriteRequestSize = 32 << 20
+
+// PrometheusListener receives prometheus remote_write requests over http
+type PrometheusListener struct {
+	listener        net.Listener
+	server          *http.Server
+	format          string
+	patternsStorage *filter.PatternStorage
+	forwarder       *ShardForwarder
+	logger          moira.Logger
+	tomb            tomb.Tomb
+}
+
+// NewPrometheusListener creates new prometheus remote write listener
+// format defines how series labels are converted to metric name, see MetricFormatTags and MetricFormatPath
+// Samples of metrics owned by other shards are sent to them by forwarder if it is not nil
+func NewPrometheusListener(port string, format string, logger moira.Logger, patternsStorage *filter.PatternStorage, forwarder *ShardForwarder) (*PrometheusListener, error) {
+	format, err := getMetricFormat(format)
+	if err != nil {
+		return nil, err
+	}
+	listener, err := net.Listen("tcp", port)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to listen on [%s]: %s", port, err.Error())
+	}
+	prometheusListener := PrometheusListener{
+		listener:        listener,
+		format:          format,
+		patternsStorage: patternsStorage,
+		forwarder:       forwarder,
+		logger:          logger,
+	}
+	return &prometheusListener, nil
+}
+
+// Listen serves remote write requests and sends matched metrics to metricsChan
+func (listener *PrometheusListener) Listen(metricsChan chan *moira.MatchedMetric) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v1/write", func(writer http.ResponseWriter, request *http.Request) {
+		listener.handleRemoteWrite(writer, request, metricsChan)
+	})
+	listener.server = &http.Server{Handler: mux}
+	listener.tomb.Go(func() error {
+		err := listener.server.Serve(listener.listener)
+		if err != nil && err != http.ErrServerClosed {
+			listener.logger.Errorf("Prometheus listener failed: %s", err.Error())
+		}
+		return nil
+	})
+	listener.logger.Infof("Moira Filter Prometheus Listener Started on %s", listener.listener.Addr())
+}
+
+func (listener *PrometheusListener) handleRemoteWrite(writer http.ResponseWriter, request *http.Request, metricsChan chan *moira.MatchedMetric) {
+	if request.Method != http.MethodPost {
+		writer.Header().Set("Allow", http.MethodPost)
+		http.Error(writer, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	compressed, err := ioutil.ReadAll(http.MaxBytesReader(writer, request.Body, maxRemoteWriteRequestSize))
+	if err != nil {
+		http.Error(writer, fmt.Sprintf("cannot read request body: %s", err.Error()), http.StatusBadRequest)
+		return
+	}
+	data, err := decodeSnappy(compressed)
+	if err != nil {
+		http.Error(writer, err.Error(), http.StatusBadRequest)
+		return
+	}
+	timeSeries, err := parseWriteRequest(data)
+	if err != nil {
+		http.Error(writer, err.Error(), http.StatusBadRequest)
+		return
+	}
+	for _, matchedMetric := range listener.matchTimeSeries(timeSeries) {
+		metricsChan <- matchedMetric
+	}
+	writer.WriteHeader(http.StatusNoContent)
+}
+
+// matchTimeSeries converts prometheus samples to graphite metrics and returns ones matched by patterns
+func (listener *PrometheusListener) matchTimeSeries(timeSeries []*promTimeSeries) []*moira.MatchedMetric {
+	matchedMetrics := make([]*moira.MatchedMetric, 0)
+	for _, series := range timeSeries {
+		name, err := series.getMetricName(listener.format)
+		if err != nil {
+			listener.logger.Debugf("cannot convert prometheus series: %v", err)
+			continue
+		}
+		for _, sample := range series.Samples {
+			if math.IsNaN(sample.Value) || math.IsInf(sample.Value, 0) {
+				continue
+			}
+			if listener.forwarder != nil && listener.forwarder.forwardMetric([]byte(name), sample.Value, sample.Timestamp/1000) {
+				continue
+			}
+			matchedMetric := listener.patternsStorage.ProcessParsedMetric([]byte(name), sample.Value, sample.Timestamp/1000)
+			if matchedMetric != nil {
+				matchedMetrics = append(matchedMetrics, matchedMetric)
+			}
+		}
+	}
+	return matchedMetrics
+}
+
+// Stop stops http server, waiting for active requests to complete
+func (listener *PrometheusListener) Stop() error {
+	if listener.server == nil {
+		return listener.listener.Close()
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	err := listener.server.Shutdown(ctx)
+	listener.tomb.Kill(nil)
+	listener.tomb.Wait()
+	listener.logger.Info("Moira Filter Prometheus Listener stopped")
+	return err
+}
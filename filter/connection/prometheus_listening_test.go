@@ -0,0 +1,72 @@
+package connection
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/golang/snappy"
+	"github.com/op/go-logging"
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/moira-alert/moira"
+)
+
+func TestHandleRemoteWrite(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	logger, _ := logging.GetLogger("Filter")
+	patternsStorage := newTestPatternStorage(t, mockCtrl, logger, []string{"seriesByTag('name=up')", "node_load1.instance.*"})
+
+	listener := &PrometheusListener{
+		format:          MetricFormatTags,
+		patternsStorage: patternsStorage,
+		logger:          logger,
+	}
+	writeRequest := encodeWriteRequest(
+		newTimeSeries(map[string]string{"__name__": "up", "job": "api"}, promSample{1, 1234567890000}, promSample{0, 1234567950000}),
+		newTimeSeries(map[string]string{"__name__": "node_load1", "instance": "web1"}, promSample{0.5, 1234567890000}),
+	)
+	body := snappy.Encode(nil, writeRequest)
+
+	Convey("Given tags format, should match tagged series", t, func() {
+		listener.format = MetricFormatTags
+		metricsChan := make(chan *moira.MatchedMetric, 10)
+		recorder := httptest.NewRecorder()
+		listener.handleRemoteWrite(recorder, httptest.NewRequest(http.MethodPost, "/api/v1/write", bytes.NewReader(body)), metricsChan)
+
+		So(recorder.Code, ShouldEqual, http.StatusNoContent)
+		So(len(metricsChan), ShouldEqual, 2)
+		matchedMetric := <-metricsChan
+		So(matchedMetric.Metric, ShouldEqual, "up;job=api")
+		So(matchedMetric.Patterns, ShouldResemble, []string{"seriesByTag('name=up')"})
+		So(matchedMetric.Value, ShouldEqual, 1)
+		So(matchedMetric.Timestamp, ShouldEqual, 1234567890)
+		So((<-metricsChan).Timestamp, ShouldEqual, 1234567950)
+	})
+
+	Convey("Given path format, should match graphite path", t, func() {
+		listener.format = MetricFormatPath
+		metricsChan := make(chan *moira.MatchedMetric, 10)
+		recorder := httptest.NewRecorder()
+		listener.handleRemoteWrite(recorder, httptest.NewRequest(http.MethodPost, "/api/v1/write", bytes.NewReader(body)), metricsChan)
+
+		So(recorder.Code, ShouldEqual, http.StatusNoContent)
+		So(len(metricsChan), ShouldEqual, 1)
+		So((<-metricsChan).Metric, ShouldEqual, "node_load1.instance.web1")
+	})
+
+	Convey("Given invalid requests, should return error status", t, func() {
+		metricsChan := make(chan *moira.MatchedMetric, 10)
+		recorder := httptest.NewRecorder()
+		listener.handleRemoteWrite(recorder, httptest.NewRequest(http.MethodGet, "/api/v1/write", nil), metricsChan)
+		So(recorder.Code, ShouldEqual, http.StatusMethodNotAllowed)
+
+		recorder = httptest.NewRecorder()
+		listener.handleRemoteWrite(recorder, httptest.NewRequest(http.MethodPost, "/api/v1/write", bytes.NewReader(writeRequest)), metricsChan)
+		So(recorder.Code, ShouldEqual, http.StatusBadRequest)
+		So(len(metricsChan), ShouldEqual, 0)
+	})
+}
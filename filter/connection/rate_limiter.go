@@ -0,0 +1,116 @@
+package connection
+
+import (
+	"net"
+	"sync"
+	"time"
+)
+
+// rateLimiter is token bucket limiting lines rate of single remote address
+type rateLimiter struct {
+	sync.Mutex
+	rate        float64
+	burst       float64
+	tokens      float64
+	last        time.Time
+	connections int
+}
+
+func newRateLimiter(rate float64, burst int) *rateLimiter {
+	bucket := float64(burst)
+	if bucket < rate {
+		bucket = rate
+	}
+	if bucket < 1 {
+		bucket = 1
+	}
+	return &rateLimiter{
+		rate:   rate,
+		burst:  bucket,
+		tokens: bucket,
+		last:   time.Now(),
+	}
+}
+
+// allow takes one token from bucket, returns false if bucket is empty
+func (limiter *rateLimiter) allow(now time.Time) bool {
+	limiter.Lock()
+	defer limiter.Unlock()
+	if elapsed := now.Sub(limiter.last).Seconds(); elapsed > 0 {
+		limiter.tokens += elapsed * limiter.rate
+		if limiter.tokens > limiter.burst {
+			limiter.tokens = limiter.burst
+		}
+		limiter.last = now
+	}
+	if limiter.tokens < 1 {
+		return false
+	}
+	limiter.tokens--
+	return true
+}
+
+// rateLimiters contains rate limiters shared by all connections from the same remote address
+type rateLimiters struct {
+	sync.Mutex
+	rate     float64
+	burst    int
+	limiters map[string]*rateLimiter
+	// exemptHosts are hosts of other filters forwarding lines, they are not rate limited
+	exemptHosts map[string]bool
+}
+
+func newRateLimiters(rate float64, burst int) *rateLimiters {
+	return &rateLimiters{
+		rate:     rate,
+		burst:    burst,
+		limiters: make(map[string]*rateLimiter),
+	}
+}
+
+// acquire returns rate limiter of given remote address, nil if rate is unlimited
+// Every acquired limiter must be released when connection is closed
+func (limiters *rateLimiters) acquire(address net.Addr) *rateLimiter {
+	host := remoteHost(address)
+	if limiters.rate <= 0 || limiters.exemptHosts[host] {
+		return nil
+	}
+	limiters.Lock()
+	defer limiters.Unlock()
+	limiter, ok := limiters.limiters[host]
+	if !ok {
+		limiter = newRateLimiter(limiters.rate, limiters.burst)
+		limiters.limiters[host] = limiter
+	}
+	limiter.connections++
+	return limiter
+}
+
+// release removes rate limiter of given remote address if there are no more connections from it
+func (limiters *rateLimiters) release(address net.Addr) {
+	host := remoteHost(address)
+	if limiters.rate <= 0 || limiters.exemptHosts[host] {
+		return
+	}
+	limiters.Lock()
+	defer limiters.Unlock()
+	limiter, ok := limiters.limiters[host]
+	if !ok {
+		return
+	}
+	limiter.connections--
+	if limiter.connections <= 0 {
+		delete(limiters.limiters, host)
+	}
+}
+
+func remoteHost(address net.Addr) string {
+	if address == nil {
+		return ""
+	}
+	host, _, err := net.SplitHostPort(address.String())
+	if err != nil {
+		return address.String()
+	}
+	return host
+}
@@ -0,0 +1,88 @@
+package connection
+
+import (
+	"fmt"
+
+	"github.com/gogo/protobuf/proto"
+	"github.com/golang/snappy"
+)
+
+const prometheusNameLabel = "__name__"
+
+// maxSnappyDecodedSize limits size of decompressed prometheus remote write request
+const maxSnappyDecodedSize = 64 << 20
+
+// promWriteRequest is prometheus remote write request, messages are declared as in prompb/remote.proto and prompb/types.proto
+type promWriteRequest struct {
+	Timeseries []*promTimeSeries `protobuf:"bytes,1,rep,name=timeseries"`
+}
+
+type promTimeSeries struct {
+	Labels  []*promLabel  `protobuf:"bytes,1,rep,name=labels"`
+	Samples []*promSample `protobuf:"bytes,2,rep,name=samples"`
+}
+
+type promLabel struct {
+	Name  string `protobuf:"bytes,1,opt,name=name,proto3"`
+	Value string `protobuf:"bytes,2,opt,name=value,proto3"`
+}
+
+type promSample struct {
+	Value     float64 `protobuf:"fixed64,1,opt,name=value,proto3"`
+	Timestamp int64   `protobuf:"varint,2,opt,name=timestamp,proto3"`
+}
+
+func (request *promWriteRequest) Reset()         { *request = promWriteRequest{} }
+func (request *promWriteRequest) String() string { return proto.CompactTextString(request) }
+func (*promWriteRequest) ProtoMessage()          {}
+
+func (series *promTimeSeries) Reset()         { *series = promTimeSeries{} }
+func (series *promTimeSeries) String() string { return proto.CompactTextString(series) }
+func (*promTimeSeries) ProtoMessage()         {}
+
+func (label *promLabel) Reset()         { *label = promLabel{} }
+func (label *promLabel) String() string { return proto.CompactTextString(label) }
+func (*promLabel) ProtoMessage()        {}
+
+func (sample *promSample) Reset()         { *sample = promSample{} }
+func (sample *promSample) String() string { return proto.CompactTextString(sample) }
+func (*promSample) ProtoMessage()         {}
+
+// decodeSnappy decompresses snappy block format, which is used by prometheus remote write protocol
+// Decoded length is checked before data is decompressed
+func decodeSnappy(compressed []byte) ([]byte, error) {
+	decodedLength, err := snappy.DecodedLen(compressed)
+	if err != nil {
+		return nil, err
+	}
+	if decodedLength > maxSnappyDecodedSize {
+		return nil, fmt.Errorf("snappy: decoded length %d exceeds limit %d", decodedLength, maxSnappyDecodedSize)
+	}
+	return snappy.Decode(nil, compressed)
+}
+
+// parseWriteRequest decodes prometheus prompb.WriteRequest protobuf message
+func parseWriteRequest(data []byte) ([]*promTimeSeries, error) {
+	request := &promWriteRequest{}
+	if err := proto.Unmarshal(data, request); err != nil {
+		return nil, fmt.Errorf("cannot decode remote write request: %s", err.Error())
+	}
+	return request.Timeseries, nil
+}
+
+// getMetricName converts prometheus series labels to graphite metric name in given format
+func (series *promTimeSeries) getMetricName(format string) (string, error) {
+	name := ""
+	labels := make([]metricTag, 0, len(series.Labels))
+	for _, label := range series.Labels {
+		if label.Name == prometheusNameLabel {
+			name = label.Value
+			continue
+		}
+		labels = append(labels, metricTag{name: label.Name, value: label.Value})
+	}
+	if name == "" {
+		return "", fmt.Errorf("series has no %s label", prometheusNameLabel)
+	}
+	return buildMetricName([]string{name}, labels, format), nil
+}
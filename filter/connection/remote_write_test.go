@@ -0,0 +1,119 @@
+package connection
+
+import (
+	"encoding/binary"
+	"strings"
+	"testing"
+
+	"github.com/gogo/protobuf/proto"
+	"github.com/golang/snappy"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestDecodeSnappy(t *testing.T) {
+	Convey("Given snappy block, should decode it", t, func() {
+		data := []byte("my.metric.name my.metric.name my.metric.name 12345 " + strings.Repeat("a", 34))
+		decoded, err := decodeSnappy(snappy.Encode(nil, data))
+		So(err, ShouldBeNil)
+		So(decoded, ShouldResemble, data)
+	})
+
+	Convey("Given corrupted blocks, should return error", t, func() {
+		corrupted := [][]byte{
+			{},
+			{0xff},
+			{0x05, 0x10, 'a', 'b'},
+			{0x02, 0x05, 0x01},
+		}
+		for _, data := range corrupted {
+			_, err := decodeSnappy(data)
+			So(err, ShouldNotBeNil)
+		}
+	})
+
+	Convey("Given block with too long decoded length, should return error without decoding", t, func() {
+		buffer := make([]byte, binary.MaxVarintLen64)
+		_, err := decodeSnappy(buffer[:binary.PutUvarint(buffer, maxSnappyDecodedSize+1)])
+		So(err, ShouldNotBeNil)
+	})
+}
+
+func TestParseWriteRequest(t *testing.T) {
+	Convey("Given write request with several series, should parse labels and samples", t, func() {
+		request := encodeWriteRequest(
+			newTimeSeries(map[string]string{"__name__": "http_requests_total", "job": "api", "code": "200"}, promSample{1.5, 1234567890000}, promSample{2.5, 1234567950000}),
+			newTimeSeries(map[string]string{"__name__": "up"}, promSample{1, 1234567890000}),
+		)
+		timeSeries, err := parseWriteRequest(request)
+		So(err, ShouldBeNil)
+		So(timeSeries, ShouldHaveLength, 2)
+		So(timeSeries[0].Labels, ShouldHaveLength, 3)
+		So(timeSeries[0].Samples, ShouldResemble, []*promSample{{1.5, 1234567890000}, {2.5, 1234567950000}})
+		So(timeSeries[1].Labels, ShouldResemble, []*promLabel{{"__name__", "up"}})
+		So(timeSeries[1].Samples, ShouldResemble, []*promSample{{1, 1234567890000}})
+	})
+
+	Convey("Given write request with unknown fields, should skip them", t, func() {
+		// varint field 2 with value 42 and fixed32 field 3 with value 7
+		request := []byte{0x10, 0x2a, 0x1d, 0x07, 0x00, 0x00, 0x00}
+		request = append(request, encodeWriteRequest(newTimeSeries(map[string]string{"__name__": "up"}, promSample{1, 1000}))...)
+		timeSeries, err := parseWriteRequest(request)
+		So(err, ShouldBeNil)
+		So(timeSeries, ShouldHaveLength, 1)
+	})
+
+	Convey("Given truncated write request, should return error", t, func() {
+		request := encodeWriteRequest(newTimeSeries(map[string]string{"__name__": "up"}, promSample{1, 1000}))
+		_, err := parseWriteRequest(request[:len(request)-1])
+		So(err, ShouldNotBeNil)
+		_, err = parseWriteRequest([]byte{0x0a})
+		So(err, ShouldNotBeNil)
+	})
+}
+
+func TestGetMetricName(t *testing.T) {
+	series := promTimeSeries{
+		Labels: []*promLabel{
+			{"job", "api server"},
+			{"__name__", "http_requests_total"},
+			{"instance", "web1.example.com:9090"},
+			{"empty", ""},
+		},
+	}
+
+	Convey("Given tags format, should return tagged series", t, func() {
+		name, err := series.getMetricName(MetricFormatTags)
+		So(err, ShouldBeNil)
+		So(name, ShouldEqual, "http_requests_total;instance=web1.example.com:9090;job=api_server")
+	})
+
+	Convey("Given path format, should return graphite path", t, func() {
+		name, err := series.getMetricName(MetricFormatPath)
+		So(err, ShouldBeNil)
+		So(name, ShouldEqual, "http_requests_total.instance.web1_example_com:9090.job.api_server")
+	})
+
+	Convey("Given series without name, should return error", t, func() {
+		_, err := (&promTimeSeries{Labels: []*promLabel{{"job", "api"}}}).getMetricName(MetricFormatTags)
+		So(err, ShouldNotBeNil)
+	})
+}
+
+func newTimeSeries(labels map[string]string, samples ...promSample) *promTimeSeries {
+	series := &promTimeSeries{}
+	for name, value := range labels {
+		series.Labels = append(series.Labels, &promLabel{Name: name, Value: value})
+	}
+	for i := range samples {
+		series.Samples = append(series.Samples, &samples[i])
+	}
+	return series
+}
+
+func encodeWriteRequest(timeSeries ...*promTimeSeries) []byte {
+	request, err := proto.Marshal(&promWriteRequest{Timeseries: timeSeries})
+	if err != nil {
+		panic(err)
+	}
+	return request
+}
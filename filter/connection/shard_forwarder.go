@@ -0,0 +1,278 @@
+package connection
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"strconv"
+	"time"
+
+	"gopkg.in/tomb.v2"
+
+	"github.com/moira-alert/moira"
+	"github.com/moira-alert/moira/metrics/graphite"
+	"github.com/moira-alert/moira/shard"
+	"github.com/moira-alert/moira/tagged"
+)
+
+// Shard peer connection settings
+const (
+	shardPeerQueueSize      = 10000
+	shardPeerDialTimeout    = 5 * time.Second
+	shardPeerWriteTimeout   = 10 * time.Second
+	shardPeerReconnectDelay = time.Second
+)
+
+// ShardConfig contains filter sharding settings, sharding is disabled if Shards is empty
+type ShardConfig struct {
+	// Shards are graphite plaintext listener addresses of all filters, the list must be the same on every filter
+	Shards []string
+	// Self is the address of this filter in Shards
+	Self string
+	// Replicas is the number of points every shard has on hash ring
+	Replicas int
+	// TLS is listener tls settings, the same on every filter, if it is enabled lines are sent to other shards over tls
+	// with listener certificate as client certificate, so client prefixes must allow all metrics to filters certificates
+	TLS TLSConfig
+}
+
+// ShardForwarder routes metrics by metric name hash, metrics owned by other shards are sent to them as plaintext lines
+type ShardForwarder struct {
+	ring      *shard.Ring
+	self      string
+	peers     map[string]*shardPeer
+	peerHosts map[string]bool
+	metrics   *graphite.FilterMetrics
+	logger    moira.Logger
+}
+
+// shardPeer sends queued lines to other filter over single tcp connection
+type shardPeer struct {
+	address   string
+	tlsConfig *tls.Config
+	lines     chan []byte
+	dropped   graphite.Meter
+	logger    moira.Logger
+	tomb      tomb.Tomb
+}
+
+// NewShardForwarder creates hash ring of shards, registers per shard metrics and starts connections to other shards
+func NewShardForwarder(config ShardConfig, logger moira.Logger, metrics *graphite.FilterMetrics) (*ShardForwarder, error) {
+	ring, err := shard.NewRing(config.Shards, config.Replicas)
+	if err != nil {
+		return nil, err
+	}
+	var tlsConfig *tls.Config
+	if config.TLS.enabled() {
+		if tlsConfig, err = newShardTLSConfig(config.TLS); err != nil {
+			return nil, err
+		}
+	}
+	forwarder := &ShardForwarder{
+		ring:      ring,
+		self:      config.Self,
+		peers:     make(map[string]*shardPeer),
+		peerHosts: make(map[string]bool),
+		metrics:   metrics,
+		logger:    logger,
+	}
+	selfFound := false
+	for _, shard := range ring.Shards() {
+		metrics.ShardsRoutedMetrics.AddMetric(shard, fmt.Sprintf("filter.shards.%s.routed", getGraphiteShardIdent(shard)))
+		if shard == config.Self {
+			selfFound = true
+			continue
+		}
+		metrics.ShardsDroppedMetrics.AddMetric(shard, fmt.Sprintf("filter.shards.%s.dropped", getGraphiteShardIdent(shard)))
+		dropped, _ := metrics.ShardsDroppedMetrics.GetMetric(shard)
+		forwarder.peers[shard] = &shardPeer{
+			address:   shard,
+			tlsConfig: tlsConfig,
+			lines:     make(chan []byte, shardPeerQueueSize),
+			dropped:   dropped,
+			logger:    logger,
+		}
+		forwarder.addPeerHosts(shard)
+	}
+	if !selfFound {
+		return nil, fmt.Errorf("Shard [%s] of this filter is not in shards list", config.Self)
+	}
+	for _, peer := range forwarder.peers {
+		peer.start()
+	}
+	logger.Infof("Moira Filter Shard Forwarder started, %d shards", len(ring.Shards()))
+	return forwarder, nil
+}
+
+// addPeerHosts resolves shard address host, connections from it are not rate limited
+func (forwarder *ShardForwarder) addPeerHosts(shard string) {
+	host, _, err := net.SplitHostPort(shard)
+	if err != nil {
+		host = shard
+	}
+	forwarder.peerHosts[host] = true
+	addresses, err := net.LookupHost(host)
+	if err != nil {
+		forwarder.logger.Warningf("Failed to resolve shard [%s]: %s", shard, err.Error())
+		return
+	}
+	for _, address := range addresses {
+		forwarder.peerHosts[address] = true
+	}
+}
+
+// forward sends line to shard owning its metric, returns false if line should be processed locally
+// Lines without metric name are processed locally, so they are reported as invalid
+func (forwarder *ShardForwarder) forward(line []byte) bool {
+	end := bytes.IndexByte(line, ' ')
+	if end <= 0 {
+		return false
+	}
+	shard := forwarder.route(line[:end])
+	if shard == forwarder.self {
+		return false
+	}
+	forwarder.peers[shard].send(append([]byte(nil), line...))
+	return true
+}
+
+// forwardMetric sends metric decoded by other protocol listener to shard owning it as plaintext line,
+// returns false if metric should be processed locally
+func (forwarder *ShardForwarder) forwardMetric(metric []byte, value float64, timestamp int64) bool {
+	shard := forwarder.route(metric)
+	if shard == forwarder.self {
+		return false
+	}
+	line := make([]byte, 0, len(metric)+32)
+	line = append(line, metric...)
+	line = append(line, ' ')
+	line = strconv.AppendFloat(line, value, 'f', -1, 64)
+	line = append(line, ' ')
+	line = strconv.AppendInt(line, timestamp, 10)
+	forwarder.peers[shard].send(line)
+	return true
+}
+
+// route returns shard owning metric and counts metric routed to it
+// Tagged metric is owned by shard of its canonical name, so all orders of its tags go to the same shard
+func (forwarder *ShardForwarder) route(metric []byte) string {
+	if tagged.IsTaggedMetric(metric) {
+		if taggedMetric, err := tagged.ParseMetric(string(metric)); err == nil {
+			metric = []byte(taggedMetric.String())
+		}
+	}
+	shard := forwarder.ring.GetShard(metric)
+	if routed, ok := forwarder.metrics.ShardsRoutedMetrics.GetMetric(shard); ok {
+		routed.Mark(1)
+	}
+	return shard
+}
+
+// Stop sends queued lines and closes connections to other shards
+func (forwarder *ShardForwarder) Stop() error {
+	for _, peer := range forwarder.peers {
+		peer.stop()
+	}
+	forwarder.logger.Info("Moira Filter Shard Forwarder stopped")
+	return nil
+}
+
+// send queues line, line is dropped if peer queue is full
+func (peer *shardPeer) send(line []byte) {
+	select {
+	case peer.lines <- line:
+	default:
+		peer.dropped.Mark(1)
+	}
+}
+
+func (peer *shardPeer) start() {
+	peer.tomb.Go(func() error {
+		for {
+			connection, err := peer.dial()
+			if err != nil {
+				peer.logger.Warningf("Failed to connect to shard [%s]: %s", peer.address, err.Error())
+				if !peer.waitReconnect() {
+					return nil
+				}
+				continue
+			}
+			err = peer.writeLines(connection)
+			connection.Close()
+			if err == nil {
+				return nil
+			}
+			peer.logger.Warningf("Failed to send lines to shard [%s]: %s", peer.address, err.Error())
+			if !peer.waitReconnect() {
+				return nil
+			}
+		}
+	})
+}
+
+func (peer *shardPeer) dial() (net.Conn, error) {
+	dialer := &net.Dialer{Timeout: shardPeerDialTimeout}
+	if peer.tlsConfig == nil {
+		return dialer.Dial("tcp", peer.address)
+	}
+	return tls.DialWithDialer(dialer, "tcp", peer.address, peer.tlsConfig)
+}
+
+// waitReconnect drops lines queued during reconnect delay, returns false if peer is stopped
+func (peer *shardPeer) waitReconnect() bool {
+	timer := time.NewTimer(shardPeerReconnectDelay)
+	defer timer.Stop()
+	for {
+		select {
+		case <-peer.tomb.Dying():
+			return false
+		case <-peer.lines:
+			peer.dropped.Mark(1)
+		case <-timer.C:
+			return true
+		}
+	}
+}
+
+// writeLines writes queued lines to connection until peer is stopped, buffer is flushed when queue is empty
+func (peer *shardPeer) writeLines(connection net.Conn) error {
+	writer := bufio.NewWriter(connection)
+	write := func(line []byte) error {
+		connection.SetWriteDeadline(time.Now().Add(shardPeerWriteTimeout))
+		writer.Write(line)
+		return writer.WriteByte('\n')
+	}
+	for {
+		select {
+		case line := <-peer.lines:
+			if err := write(line); err != nil {
+				peer.dropped.Mark(1)
+				return err
+			}
+			if len(peer.lines) == 0 {
+				if err := writer.Flush(); err != nil {
+					return err
+				}
+			}
+		case <-peer.tomb.Dying():
+			for len(peer.lines) > 0 {
+				if err := write(<-peer.lines); err != nil {
+					return err
+				}
+			}
+			return writer.Flush()
+		}
+	}
+}
+
+func (peer *shardPeer) stop() {
+	peer.tomb.Kill(nil)
+	peer.tomb.Wait()
+}
+
+// getGraphiteShardIdent replaces chars of shard address which are special in graphite metric names
+func getGraphiteShardIdent(shard string) string {
+	return sanitizeMetricPart(shard, true)
+}
@@ -0,0 +1,205 @@
+package connection
+
+import (
+	"bufio"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"sort"
+	"testing"
+
+	"github.com/op/go-logging"
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/moira-alert/moira/metrics/graphite/go-metrics"
+)
+
+func TestShardForwarder(t *testing.T) {
+	logger, _ := logging.GetLogger("Filter")
+
+	Convey("Given self not in shards, should return error", t, func() {
+		_, err := NewShardForwarder(ShardConfig{Shards: []string{"filter1:2003"}, Self: "filter2:2003"}, logger, metrics.ConfigureFilterMetrics("test"))
+		So(err, ShouldNotBeNil)
+	})
+
+	Convey("Given two shards, lines of peer shard should be sent to it", t, func() {
+		peerListener, err := net.Listen("tcp", "127.0.0.1:0")
+		So(err, ShouldBeNil)
+		defer peerListener.Close()
+		peerLines := make(chan []string, 1)
+		go func() {
+			received := make([]string, 0)
+			connection, err := peerListener.Accept()
+			if err == nil {
+				scanner := bufio.NewScanner(connection)
+				for scanner.Scan() {
+					received = append(received, scanner.Text())
+				}
+			}
+			peerLines <- received
+		}()
+
+		peer := peerListener.Addr().String()
+		forwarderMetrics := metrics.ConfigureFilterMetrics("test")
+		forwarder, err := NewShardForwarder(ShardConfig{Shards: []string{"self:2003", peer}, Self: "self:2003"}, logger, forwarderMetrics)
+		So(err, ShouldBeNil)
+
+		local := make([]string, 0)
+		forwarded := make([]string, 0)
+		for i := 0; i < 100; i++ {
+			line := fmt.Sprintf("Sharded.metric.%d 1 1234567890", i)
+			if forwarder.forward([]byte(line)) {
+				forwarded = append(forwarded, line)
+			} else {
+				local = append(local, line)
+			}
+		}
+		So(forwarder.forward([]byte("Invalid")), ShouldBeFalse)
+		So(forwarder.Stop(), ShouldBeNil)
+
+		So(local, ShouldNotBeEmpty)
+		So(forwarded, ShouldNotBeEmpty)
+		received := <-peerLines
+		sort.Strings(received)
+		sort.Strings(forwarded)
+		So(received, ShouldResemble, forwarded)
+
+		selfRouted, _ := forwarderMetrics.ShardsRoutedMetrics.GetMetric("self:2003")
+		So(selfRouted.Count(), ShouldEqual, len(local))
+		peerRouted, _ := forwarderMetrics.ShardsRoutedMetrics.GetMetric(peer)
+		So(peerRouted.Count(), ShouldEqual, len(forwarded))
+	})
+
+	Convey("Given metrics decoded by other protocols, they should be sent to peer shard as plaintext lines", t, func() {
+		peerListener, err := net.Listen("tcp", "127.0.0.1:0")
+		So(err, ShouldBeNil)
+		defer peerListener.Close()
+		peerLines := make(chan []string, 1)
+		go func() {
+			received := make([]string, 0)
+			connection, err := peerListener.Accept()
+			if err == nil {
+				scanner := bufio.NewScanner(connection)
+				for scanner.Scan() {
+					received = append(received, scanner.Text())
+				}
+			}
+			peerLines <- received
+		}()
+
+		peer := peerListener.Addr().String()
+		forwarder, err := NewShardForwarder(ShardConfig{Shards: []string{"self:2003", peer}, Self: "self:2003"}, logger, metrics.ConfigureFilterMetrics("test"))
+		So(err, ShouldBeNil)
+
+		forwarded := make([]string, 0)
+		for i := 0; i < 100; i++ {
+			metric := fmt.Sprintf("Sharded.metric.%d", i)
+			if forwarder.forwardMetric([]byte(metric), 1.5, 1234567890) {
+				forwarded = append(forwarded, metric+" 1.5 1234567890")
+			}
+		}
+		So(forwarder.Stop(), ShouldBeNil)
+
+		So(forwarded, ShouldNotBeEmpty)
+		received := <-peerLines
+		sort.Strings(received)
+		sort.Strings(forwarded)
+		So(received, ShouldResemble, forwarded)
+	})
+
+	Convey("Given tagged metrics, every order of tags should be routed to the same shard", t, func() {
+		forwarder, err := NewShardForwarder(ShardConfig{Shards: []string{"self:2003", "127.0.0.1:1", "127.0.0.2:1"}, Self: "self:2003"}, logger, metrics.ConfigureFilterMetrics("test"))
+		So(err, ShouldBeNil)
+		defer forwarder.Stop()
+
+		for i := 0; i < 100; i++ {
+			shard := forwarder.route([]byte(fmt.Sprintf("Sharded.metric;x=%d;y=2", i)))
+			So(forwarder.route([]byte(fmt.Sprintf("Sharded.metric;y=2;x=%d", i))), ShouldEqual, shard)
+		}
+	})
+
+	Convey("Given tls settings, lines should be sent over tls with listener certificate", t, func() {
+		dir, err := ioutil.TempDir("", "moira-shards-tls")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+		ca := newTestCertificate(t, "ca", nil, nil)
+		peerCertificate := newTestCertificate(t, "peer", []net.IP{net.ParseIP("127.0.0.1")}, ca)
+		selfCertificate := newTestCertificate(t, "self", nil, ca)
+		clientCAs := x509.NewCertPool()
+		clientCAs.AddCert(ca.certificate)
+
+		peerListener, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{
+			Certificates: []tls.Certificate{peerCertificate.tlsCertificate()},
+			ClientCAs:    clientCAs,
+			ClientAuth:   tls.RequireAndVerifyClientCert,
+		})
+		So(err, ShouldBeNil)
+		defer peerListener.Close()
+		type peerResult struct {
+			client string
+			lines  []string
+		}
+		results := make(chan peerResult, 1)
+		go func() {
+			result := peerResult{lines: make([]string, 0)}
+			connection, err := peerListener.Accept()
+			if err == nil {
+				scanner := bufio.NewScanner(connection)
+				for scanner.Scan() {
+					result.lines = append(result.lines, scanner.Text())
+				}
+				if peerCertificates := connection.(*tls.Conn).ConnectionState().PeerCertificates; len(peerCertificates) > 0 {
+					result.client = peerCertificates[0].Subject.CommonName
+				}
+			}
+			results <- result
+		}()
+
+		peer := peerListener.Addr().String()
+		forwarder, err := NewShardForwarder(ShardConfig{
+			Shards: []string{"self:2003", peer},
+			Self:   "self:2003",
+			TLS: TLSConfig{
+				CertFile:     selfCertificate.writeCertificate(t, dir, "self.crt"),
+				KeyFile:      selfCertificate.writeKey(t, dir, "self.key"),
+				ClientCAFile: ca.writeCertificate(t, dir, "ca.crt"),
+			},
+		}, logger, metrics.ConfigureFilterMetrics("test"))
+		So(err, ShouldBeNil)
+
+		forwarded := make([]string, 0)
+		for i := 0; i < 100; i++ {
+			line := fmt.Sprintf("Sharded.metric.%d 1 1234567890", i)
+			if forwarder.forward([]byte(line)) {
+				forwarded = append(forwarded, line)
+			}
+		}
+		So(forwarder.Stop(), ShouldBeNil)
+
+		result := <-results
+		So(result.client, ShouldEqual, "self")
+		sort.Strings(result.lines)
+		sort.Strings(forwarded)
+		So(result.lines, ShouldResemble, forwarded)
+	})
+
+	Convey("Given listener with forwarder, shard peers should not be rate limited", t, func() {
+		forwarder, err := NewShardForwarder(ShardConfig{Shards: []string{"self:2003", "127.0.0.1:2003"}, Self: "self:2003"}, logger, metrics.ConfigureFilterMetrics("test"))
+		So(err, ShouldBeNil)
+		defer forwarder.Stop()
+		listener, err := NewListener("127.0.0.1:0", logger, metrics.ConfigureFilterMetrics("test"), nil, HandlerConfig{RateLimit: 1}, TLSConfig{}, forwarder)
+		So(err, ShouldBeNil)
+		defer listener.listener.Close()
+		limiters := listener.handler.(*Handler).rateLimiters
+
+		peerAddress := &net.TCPAddr{IP: net.ParseIP("127.0.0.1"), Port: 40000}
+		So(limiters.acquire(peerAddress), ShouldBeNil)
+		limiters.release(peerAddress)
+		clientAddress := &net.TCPAddr{IP: net.ParseIP("127.0.0.2"), Port: 40000}
+		So(limiters.acquire(clientAddress), ShouldNotBeNil)
+		limiters.release(clientAddress)
+	})
+}
@@ -0,0 +1,145 @@
+package connection
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"time"
+)
+
+// tlsHandshakeTimeout limits time client has to complete tls handshake
+const tlsHandshakeTimeout = 10 * time.Second
+
+// TLSConfig contains metrics listener tls settings, tls is disabled if CertFile is empty
+type TLSConfig struct {
+	// CertFile and KeyFile are PEM encoded listener certificate and its private key
+	CertFile string
+	KeyFile  string
+	// ClientCAFile is PEM encoded CA certificates, if it is set clients must present certificate signed by one of them
+	ClientCAFile string
+	// ClientPrefixes restricts metrics clients can send by client certificate CN or SAN
+	// Clients with certificate not listed here are rejected, all clients can send any metrics if it is empty
+	ClientPrefixes map[string][]string
+}
+
+func (config TLSConfig) enabled() bool {
+	return config.CertFile != ""
+}
+
+// newTLSConfig loads listener certificate and client CA certificates
+func newTLSConfig(config TLSConfig) (*tls.Config, error) {
+	certificate, err := tls.LoadX509KeyPair(config.CertFile, config.KeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to load tls certificate [%s]: %s", config.CertFile, err.Error())
+	}
+	tlsConfig := &tls.Config{
+		Certificates: []tls.Certificate{certificate},
+		MinVersion:   tls.VersionTLS12,
+	}
+	if config.ClientCAFile == "" {
+		if len(config.ClientPrefixes) > 0 {
+			return nil, fmt.Errorf("Client prefixes require client CA file to verify client certificates")
+		}
+		return tlsConfig, nil
+	}
+	clientCAs, err := loadCertPool(config.ClientCAFile)
+	if err != nil {
+		return nil, err
+	}
+	tlsConfig.ClientCAs = clientCAs
+	tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	return tlsConfig, nil
+}
+
+// newShardTLSConfig creates tls config used to connect to listeners of other filters
+// Listener certificate is presented as client certificate, other filters certificates are verified by client CA certificates
+func newShardTLSConfig(config TLSConfig) (*tls.Config, error) {
+	certificate, err := tls.LoadX509KeyPair(config.CertFile, config.KeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to load tls certificate [%s]: %s", config.CertFile, err.Error())
+	}
+	tlsConfig := &tls.Config{
+		Certificates: []tls.Certificate{certificate},
+		MinVersion:   tls.VersionTLS12,
+	}
+	if config.ClientCAFile != "" {
+		rootCAs, err := loadCertPool(config.ClientCAFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.RootCAs = rootCAs
+	}
+	return tlsConfig, nil
+}
+
+func loadCertPool(caFile string) (*x509.CertPool, error) {
+	caCertificates, err := ioutil.ReadFile(caFile)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read client CA file [%s]: %s", caFile, err.Error())
+	}
+	certPool := x509.NewCertPool()
+	if !certPool.AppendCertsFromPEM(caCertificates) {
+		return nil, fmt.Errorf("No certificates found in client CA file [%s]", caFile)
+	}
+	return certPool, nil
+}
+
+// authorizeClient completes tls handshake and returns metric prefixes allowed for client certificate
+// nil prefixes mean that client can send any metrics
+func authorizeClient(connection net.Conn, clientPrefixes map[string][]string) ([][]byte, error) {
+	tlsConnection, ok := connection.(*tls.Conn)
+	if !ok {
+		return nil, nil
+	}
+	tlsConnection.SetDeadline(time.Now().Add(tlsHandshakeTimeout))
+	if err := tlsConnection.Handshake(); err != nil {
+		return nil, fmt.Errorf("tls handshake failed: %s", err.Error())
+	}
+	tlsConnection.SetDeadline(time.Time{})
+	if len(clientPrefixes) == 0 {
+		return nil, nil
+	}
+
+	peerCertificates := tlsConnection.ConnectionState().PeerCertificates
+	if len(peerCertificates) == 0 {
+		return nil, fmt.Errorf("client has no certificate")
+	}
+	allowedPrefixes := make([][]byte, 0)
+	identities := getCertificateIdentities(peerCertificates[0])
+	for _, identity := range identities {
+		for _, prefix := range clientPrefixes[identity] {
+			allowedPrefixes = append(allowedPrefixes, []byte(prefix))
+		}
+	}
+	if len(allowedPrefixes) == 0 {
+		return nil, fmt.Errorf("client certificate %v is not allowed", identities)
+	}
+	return allowedPrefixes, nil
+}
+
+// getCertificateIdentities returns certificate CN and SAN dns names, emails and ip addresses
+func getCertificateIdentities(certificate *x509.Certificate) []string {
+	identities := make([]string, 0)
+	if certificate.Subject.CommonName != "" {
+		identities = append(identities, certificate.Subject.CommonName)
+	}
+	identities = append(identities, certificate.DNSNames...)
+	identities = append(identities, certificate.EmailAddresses...)
+	for _, ip := range certificate.IPAddresses {
+		identities = append(identities, ip.String())
+	}
+	return identities
+}
+
+// hasAllowedPrefix checks if metric name in line starts with one of prefixes
+func hasAllowedPrefix(line []byte, prefixes [][]byte) bool {
+	for _, prefix := range prefixes {
+		if bytes.HasPrefix(line, prefix) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,170 @@
+package connection
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/op/go-logging"
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/moira-alert/moira"
+	"github.com/moira-alert/moira/metrics/graphite/go-metrics"
+)
+
+func TestTLSListener(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	logger, _ := logging.GetLogger("Filter")
+	patternsStorage := newTestPatternStorage(t, mockCtrl, logger, []string{"Simple.matching.pattern", "Star.single.*"})
+
+	dir, err := ioutil.TempDir("", "moira-tls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	ca := newTestCertificate(t, "ca", nil, nil)
+	server := newTestCertificate(t, "localhost", []net.IP{net.ParseIP("127.0.0.1")}, ca)
+	client := newTestCertificate(t, "client.example.com", nil, ca)
+	unknownClient := newTestCertificate(t, "unknown.example.com", nil, ca)
+	tlsConfig := TLSConfig{
+		CertFile:       server.writeCertificate(t, dir, "server.crt"),
+		KeyFile:        server.writeKey(t, dir, "server.key"),
+		ClientCAFile:   ca.writeCertificate(t, dir, "ca.crt"),
+		ClientPrefixes: map[string][]string{"client.example.com": {"Star.single."}},
+	}
+	rootCAs := x509.NewCertPool()
+	rootCAs.AddCert(ca.certificate)
+
+	Convey("Given client prefixes without client CA, should return error", t, func() {
+		_, err := NewListener("127.0.0.1:0", logger, metrics.ConfigureFilterMetrics("test"), patternsStorage, HandlerConfig{}, TLSConfig{
+			CertFile:       tlsConfig.CertFile,
+			KeyFile:        tlsConfig.KeyFile,
+			ClientPrefixes: tlsConfig.ClientPrefixes,
+		}, nil)
+		So(err, ShouldNotBeNil)
+	})
+
+	Convey("Given tls listener", t, func() {
+		listenerMetrics := metrics.ConfigureFilterMetrics("test")
+		listener, err := NewListener("127.0.0.1:0", logger, listenerMetrics, patternsStorage, HandlerConfig{}, tlsConfig, nil)
+		So(err, ShouldBeNil)
+		metricsChan := make(chan *moira.MatchedMetric, 10)
+		listener.Listen(metricsChan)
+		address := listener.listener.Addr().String()
+
+		send := func(certificates []tls.Certificate, lines string) error {
+			conn, err := tls.Dial("tcp", address, &tls.Config{RootCAs: rootCAs, Certificates: certificates})
+			if err != nil {
+				return err
+			}
+			defer conn.Close()
+			if _, err := conn.Write([]byte(lines)); err != nil {
+				return err
+			}
+			conn.CloseWrite()
+			_, err = conn.Read(make([]byte, 1))
+			return nil
+		}
+
+		Convey("Allowed client should send only metrics with allowed prefixes", func() {
+			err := send([]tls.Certificate{client.tlsCertificate()}, "Star.single.one 1 1234567890\nSimple.matching.pattern 2 1234567890\n")
+			So(err, ShouldBeNil)
+			So(listener.Stop(), ShouldBeNil)
+			So(len(metricsChan), ShouldEqual, 1)
+			So((<-metricsChan).Metric, ShouldEqual, "Star.single.one")
+			So(listenerMetrics.LinesForbidden.Count(), ShouldEqual, 1)
+		})
+
+		Convey("Client with unknown certificate should be rejected", func() {
+			send([]tls.Certificate{unknownClient.tlsCertificate()}, "Star.single.one 1 1234567890\n")
+			So(listener.Stop(), ShouldBeNil)
+			So(len(metricsChan), ShouldEqual, 0)
+		})
+
+		Convey("Client without certificate should be rejected", func() {
+			send(nil, "Star.single.one 1 1234567890\n")
+			So(listener.Stop(), ShouldBeNil)
+			So(len(metricsChan), ShouldEqual, 0)
+		})
+	})
+}
+
+type testCertificate struct {
+	certificate *x509.Certificate
+	key         *ecdsa.PrivateKey
+}
+
+// newTestCertificate creates certificate signed by parent, self-signed CA certificate is created if parent is nil
+func newTestCertificate(t *testing.T, commonName string, ips []net.IP, parent *testCertificate) *testCertificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	serialNumber, err := rand.Int(rand.Reader, big.NewInt(1<<62))
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: serialNumber,
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		IPAddresses:  ips,
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	signer := &testCertificate{certificate: template, key: key}
+	if parent == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+		template.KeyUsage |= x509.KeyUsageCertSign
+	} else {
+		signer = parent
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, signer.certificate, &key.PublicKey, signer.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certificate, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testCertificate{certificate: certificate, key: key}
+}
+
+func (certificate *testCertificate) tlsCertificate() tls.Certificate {
+	return tls.Certificate{Certificate: [][]byte{certificate.certificate.Raw}, PrivateKey: certificate.key}
+}
+
+func (certificate *testCertificate) writeCertificate(t *testing.T, dir string, name string) string {
+	return writePEM(t, filepath.Join(dir, name), "CERTIFICATE", certificate.certificate.Raw)
+}
+
+func (certificate *testCertificate) writeKey(t *testing.T, dir string, name string) string {
+	der, err := x509.MarshalECPrivateKey(certificate.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return writePEM(t, filepath.Join(dir, name), "EC PRIVATE KEY", der)
+}
+
+func writePEM(t *testing.T, fileName string, blockType string, der []byte) string {
+	if err := ioutil.WriteFile(fileName, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return fileName
+}
@@ -0,0 +1,112 @@
+package connection
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"time"
+
+	"gopkg.in/tomb.v2"
+
+	"github.com/moira-alert/moira"
+	"github.com/moira-alert/moira/filter"
+	"github.com/moira-alert/moira/metrics/graphite"
+)
+
+// maxDatagramSize is the maximum size of udp payload
+const maxDatagramSize = 65535
+
+// UDPMetricsListener receives graphite plaintext protocol lines from udp datagrams
+type UDPMetricsListener struct {
+	conn            *net.UDPConn
+	patternsStorage *filter.PatternStorage
+	metrics         *graphite.FilterMetrics
+	forwarder       *ShardForwarder
+	logger          moira.Logger
+	tomb            tomb.Tomb
+}
+
+// NewUDPListener creates new udp listener
+// Lines of metrics owned by other shards are sent to them by forwarder if it is not nil
+func NewUDPListener(port string, logger moira.Logger, metrics *graphite.FilterMetrics, patternsStorage *filter.PatternStorage, forwarder *ShardForwarder) (*UDPMetricsListener, error) {
+	address, err := net.ResolveUDPAddr("udp", port)
+	if nil != err {
+		return nil, fmt.Errorf("Failed to resolve udp address [%s]: %s", port, err.Error())
+	}
+	conn, err := net.ListenUDP("udp", address)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to listen udp on [%s]: %s", port, err.Error())
+	}
+	listener := UDPMetricsListener{
+		conn:            conn,
+		patternsStorage: patternsStorage,
+		metrics:         metrics,
+		forwarder:       forwarder,
+		logger:          logger,
+	}
+	return &listener, nil
+}
+
+// Listen reads datagrams, splits it into lines and sends matched metrics to metricsChan
+// Matched metrics are dropped if metricsChan is full, so the socket is never blocked
+func (listener *UDPMetricsListener) Listen(metricsChan chan *moira.MatchedMetric) {
+	listener.tomb.Go(func() error {
+		buffer := make([]byte, maxDatagramSize)
+		for {
+			select {
+			case <-listener.tomb.Dying():
+				{
+					listener.logger.Info("Stopping udp listener...")
+					listener.conn.Close()
+					listener.logger.Info("Moira Filter UDP Listener stopped")
+					return nil
+				}
+			default:
+			}
+			listener.conn.SetReadDeadline(time.Now().Add(1e9))
+			n, _, err := listener.conn.ReadFromUDP(buffer)
+			if err != nil {
+				if opErr, ok := err.(*net.OpError); ok && opErr.Timeout() {
+					continue
+				}
+				listener.logger.Infof("Failed to read datagram: %s", err.Error())
+				continue
+			}
+			listener.handleDatagram(buffer[:n], metricsChan)
+		}
+	})
+	listener.logger.Infof("Moira Filter UDP Listener Started on %s", listener.conn.LocalAddr())
+}
+
+func (listener *UDPMetricsListener) handleDatagram(datagram []byte, metricsChan chan *moira.MatchedMetric) {
+	for _, lineBytes := range bytes.Split(datagram, []byte{'\n'}) {
+		lineBytes = bytes.TrimSuffix(lineBytes, []byte{'\r'})
+		if len(lineBytes) == 0 {
+			continue
+		}
+		listener.metrics.UDPMetricsReceived.Mark(1)
+		if listener.forwarder != nil && listener.forwarder.forward(lineBytes) {
+			continue
+		}
+		matchedMetric, err := listener.patternsStorage.ParseAndMatchMetric(lineBytes)
+		if err != nil {
+			listener.metrics.UDPMetricsMalformed.Mark(1)
+			listener.logger.Debugf("cannot parse udp input: %v", err)
+			continue
+		}
+		if matchedMetric == nil {
+			continue
+		}
+		select {
+		case metricsChan <- matchedMetric:
+		default:
+			listener.metrics.UDPMetricsDropped.Mark(1)
+		}
+	}
+}
+
+// Stop stops listening udp socket
+func (listener *UDPMetricsListener) Stop() error {
+	listener.tomb.Kill(nil)
+	return listener.tomb.Wait()
+}
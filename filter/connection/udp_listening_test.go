@@ -0,0 +1,62 @@
+package connection
+
+import (
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/op/go-logging"
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/moira-alert/moira"
+	"github.com/moira-alert/moira/metrics/graphite/go-metrics"
+)
+
+func TestHandleDatagram(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	logger, _ := logging.GetLogger("Filter")
+	patternsStorage := newTestPatternStorage(t, mockCtrl, logger, []string{"Simple.matching.pattern", "Star.single.*"})
+
+	listener := &UDPMetricsListener{
+		patternsStorage: patternsStorage,
+		logger:          logger,
+	}
+
+	Convey("Given datagram with several lines, should match all of them", t, func() {
+		listener.metrics = metrics.ConfigureFilterMetrics("test")
+		metricsChan := make(chan *moira.MatchedMetric, 10)
+		datagram := "Simple.matching.pattern 12 1234567890\nStar.single.one 13 1234567890\r\nNot.matching 14 1234567890\n\n"
+		listener.handleDatagram([]byte(datagram), metricsChan)
+
+		So(len(metricsChan), ShouldEqual, 2)
+		So((<-metricsChan).Metric, ShouldEqual, "Simple.matching.pattern")
+		So((<-metricsChan).Metric, ShouldEqual, "Star.single.one")
+		So(listener.metrics.UDPMetricsReceived.Count(), ShouldEqual, 3)
+		So(listener.metrics.UDPMetricsMalformed.Count(), ShouldEqual, 0)
+		So(listener.metrics.UDPMetricsDropped.Count(), ShouldEqual, 0)
+	})
+
+	Convey("Given datagram with malformed lines, should count them", t, func() {
+		listener.metrics = metrics.ConfigureFilterMetrics("test")
+		metricsChan := make(chan *moira.MatchedMetric, 10)
+		datagram := "Simple.matching.pattern 12\nStar.single.one 13 1234567890\nStar.single.two twelve 1234567890"
+		listener.handleDatagram([]byte(datagram), metricsChan)
+
+		So(len(metricsChan), ShouldEqual, 1)
+		So(listener.metrics.UDPMetricsReceived.Count(), ShouldEqual, 3)
+		So(listener.metrics.UDPMetricsMalformed.Count(), ShouldEqual, 2)
+		So(listener.metrics.UDPMetricsDropped.Count(), ShouldEqual, 0)
+	})
+
+	Convey("Given full metrics channel, should drop matched metrics", t, func() {
+		listener.metrics = metrics.ConfigureFilterMetrics("test")
+		metricsChan := make(chan *moira.MatchedMetric, 1)
+		datagram := "Star.single.one 1 1234567890\nStar.single.two 2 1234567890\nStar.single.three 3 1234567890"
+		listener.handleDatagram([]byte(datagram), metricsChan)
+
+		So(len(metricsChan), ShouldEqual, 1)
+		So((<-metricsChan).Metric, ShouldEqual, "Star.single.one")
+		So(listener.metrics.UDPMetricsReceived.Count(), ShouldEqual, 3)
+		So(listener.metrics.UDPMetricsDropped.Count(), ShouldEqual, 2)
+	})
+}
@@ -0,0 +1,123 @@
+package debugserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+
+	"gopkg.in/tomb.v2"
+
+	"github.com/moira-alert/moira"
+	"github.com/moira-alert/moira/filter"
+)
+
+// Server serves filter introspection http endpoints:
+// GET /patterns returns count of metrics matched by every pattern in last minutes,
+// GET /patterns/unmatched returns patterns which have matched nothing since start,
+// GET /match?metric=<name> returns patterns matched by metric name
+type Server struct {
+	listener        net.Listener
+	server          *http.Server
+	patternsStorage *filter.PatternStorage
+	stats           *filter.MatchStats
+	logger          moira.Logger
+	tomb            tomb.Tomb
+}
+
+type patternsStatsResponse struct {
+	Minutes   int                        `json:"minutes"`
+	StartTime int64                      `json:"start_time"`
+	Patterns  []filter.PatternMatchStats `json:"patterns"`
+}
+
+type unmatchedPatternsResponse struct {
+	StartTime int64    `json:"start_time"`
+	Patterns  []string `json:"patterns"`
+}
+
+type matchResponse struct {
+	Metric   string   `json:"metric"`
+	Patterns []string `json:"patterns"`
+}
+
+// NewServer creates debug server and attaches match stats to patterns storage
+func NewServer(port string, minutes int, logger moira.Logger, patternsStorage *filter.PatternStorage) (*Server, error) {
+	listener, err := net.Listen("tcp", port)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to listen on [%s]: %s", port, err.Error())
+	}
+	stats := filter.NewMatchStats(minutes)
+	patternsStorage.SetMatchStats(stats)
+	return &Server{
+		listener:        listener,
+		patternsStorage: patternsStorage,
+		stats:           stats,
+		logger:          logger,
+	}, nil
+}
+
+// Start serves debug endpoints
+func (server *Server) Start() {
+	server.server = &http.Server{Handler: server.handler()}
+	server.tomb.Go(func() error {
+		err := server.server.Serve(server.listener)
+		if err != nil && err != http.ErrServerClosed {
+			server.logger.Errorf("Debug server failed: %s", err.Error())
+		}
+		return nil
+	})
+	server.logger.Infof("Moira Filter Debug Server started on %s", server.listener.Addr())
+}
+
+// Stop stops debug server
+func (server *Server) Stop() error {
+	if server.server == nil {
+		return server.listener.Close()
+	}
+	err := server.server.Close()
+	server.tomb.Wait()
+	server.logger.Info("Moira Filter Debug Server stopped")
+	return err
+}
+
+func (server *Server) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/patterns", func(writer http.ResponseWriter, request *http.Request) {
+		server.render(writer, request, patternsStatsResponse{
+			Minutes:   server.stats.Minutes(),
+			StartTime: server.stats.StartTime().Unix(),
+			Patterns:  server.patternsStorage.GetPatternsMatchStats(),
+		})
+	})
+	mux.HandleFunc("/patterns/unmatched", func(writer http.ResponseWriter, request *http.Request) {
+		server.render(writer, request, unmatchedPatternsResponse{
+			StartTime: server.stats.StartTime().Unix(),
+			Patterns:  server.patternsStorage.GetUnmatchedPatterns(),
+		})
+	})
+	mux.HandleFunc("/match", func(writer http.ResponseWriter, request *http.Request) {
+		metric := request.URL.Query().Get("metric")
+		if metric == "" {
+			http.Error(writer, "metric is required", http.StatusBadRequest)
+			return
+		}
+		server.render(writer, request, matchResponse{
+			Metric:   metric,
+			Patterns: server.patternsStorage.MatchPattern(metric),
+		})
+	})
+	return mux
+}
+
+func (server *Server) render(writer http.ResponseWriter, request *http.Request, response interface{}) {
+	if request.Method != http.MethodGet {
+		writer.Header().Set("Allow", http.MethodGet)
+		http.Error(writer, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	writer.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(writer).Encode(response); err != nil {
+		server.logger.Errorf("Failed to write debug response: %s", err.Error())
+	}
+}
@@ -0,0 +1,69 @@
+package debugserver
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/op/go-logging"
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/moira-alert/moira/filter"
+	"github.com/moira-alert/moira/metrics/graphite/go-metrics"
+	"github.com/moira-alert/moira/mock/moira-alert"
+)
+
+func TestServer(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	database := mock_moira_alert.NewMockDatabase(mockCtrl)
+	logger, _ := logging.GetLogger("Filter")
+
+	database.EXPECT().GetPatternsVersion().Return(int64(0), nil)
+	database.EXPECT().GetPatterns().Return([]string{"Debug.*.requests", "Debug.*.errors"}, nil)
+	patternsStorage, err := filter.NewPatternStorage(database, metrics.ConfigureFilterMetrics("test"), logger)
+	server, err2 := NewServer("127.0.0.1:0", 5, logger, patternsStorage)
+	defer server.Stop()
+	handler := server.handler()
+	patternsStorage.ParseAndMatchMetric([]byte("Debug.first.requests 1 1234567890"))
+
+	get := func(url string, response interface{}) int {
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, url, nil))
+		if recorder.Code == http.StatusOK {
+			So(json.Unmarshal(recorder.Body.Bytes(), response), ShouldBeNil)
+		}
+		return recorder.Code
+	}
+
+	Convey("Create server, should no error", t, func() {
+		So(err, ShouldBeNil)
+		So(err2, ShouldBeNil)
+	})
+
+	Convey("Patterns stats should contain matched metrics counts", t, func() {
+		response := patternsStatsResponse{}
+		So(get("/patterns", &response), ShouldEqual, http.StatusOK)
+		So(response.Minutes, ShouldEqual, 5)
+		So(len(response.Patterns), ShouldEqual, 2)
+		So(response.Patterns[0].Pattern, ShouldEqual, "Debug.*.errors")
+		So(response.Patterns[0].Matched, ShouldEqual, 0)
+		So(response.Patterns[1].Pattern, ShouldEqual, "Debug.*.requests")
+		So(response.Patterns[1].Matched, ShouldEqual, 1)
+	})
+
+	Convey("Unmatched patterns should be returned", t, func() {
+		response := unmatchedPatternsResponse{}
+		So(get("/patterns/unmatched", &response), ShouldEqual, http.StatusOK)
+		So(response.Patterns, ShouldResemble, []string{"Debug.*.errors"})
+	})
+
+	Convey("Metric should be matched by patterns", t, func() {
+		response := matchResponse{}
+		So(get("/match?metric=Debug.second.errors", &response), ShouldEqual, http.StatusOK)
+		So(response, ShouldResemble, matchResponse{Metric: "Debug.second.errors", Patterns: []string{"Debug.*.errors"}})
+		So(get("/match", &response), ShouldEqual, http.StatusBadRequest)
+	})
+}
@@ -0,0 +1,131 @@
+package filter
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// globChars are chars which make path part a pattern instead of exact name
+const globChars = "{*?["
+
+// expandBracesRegexp finds the last brace group in pattern, it is the same regexp as graphite-web uses
+var expandBracesRegexp = regexp.MustCompile(`.*(\{.*?[^\\]?\})`)
+
+// isGlob checks if path part contains wildcards
+func isGlob(part string) bool {
+	return strings.ContainsAny(part, globChars)
+}
+
+// compileGlob compiles graphite path part pattern to regexp
+// Braces are expanded first and every variant is matched as fnmatch pattern, exactly as graphite-web does
+func compileGlob(part string) (*regexp.Regexp, error) {
+	variants := expandBraces(part)
+	var buffer bytes.Buffer
+	buffer.WriteString("^(?s:")
+	for i, variant := range variants {
+		if i > 0 {
+			buffer.WriteString("|")
+		}
+		buffer.WriteString(fnmatchToRegexp(variant))
+	}
+	buffer.WriteString(")$")
+	return regexp.Compile(buffer.String())
+}
+
+// expandBraces returns all variants of pattern with brace groups expanded, innermost groups are expanded first
+// {a,b}c gives ac and bc, {a,{b,c}} gives a, b and c
+func expandBraces(pattern string) []string {
+	result := make([]string, 0)
+	seen := make(map[string]bool)
+	var expand func(s string)
+	expand = func(s string) {
+		match := expandBracesRegexp.FindStringSubmatchIndex(s)
+		if match == nil {
+			variant := strings.Replace(s, `\}`, "}", -1)
+			if !seen[variant] {
+				seen[variant] = true
+				result = append(result, variant)
+			}
+			return
+		}
+		openBrace, closeBrace := match[2], match[3]
+		group := s[openBrace:closeBrace]
+		if strings.Contains(group, ",") {
+			for _, alternative := range strings.Split(strings.Trim(group, "{}"), ",") {
+				expand(s[:openBrace] + alternative + s[closeBrace:])
+			}
+			return
+		}
+		expand(s[:openBrace] + removeOuterBraces(group) + s[closeBrace:])
+	}
+	expand(pattern)
+	return result
+}
+
+func removeOuterBraces(s string) string {
+	if strings.HasPrefix(s, "{") && strings.HasSuffix(s, "}") {
+		return s[1 : len(s)-1]
+	}
+	return s
+}
+
+// fnmatchToRegexp translates shell-style pattern to regexp the same way as python fnmatch module does
+// * matches everything, ? matches any single char, [seq] matches any char in seq, [!seq] matches any char not in seq
+func fnmatchToRegexp(pattern string) string {
+	var buffer bytes.Buffer
+	i, n := 0, len(pattern)
+	for i < n {
+		c := pattern[i]
+		i++
+		switch c {
+		case '*':
+			for i < n && pattern[i] == '*' {
+				i++
+			}
+			buffer.WriteString(".*")
+		case '?':
+			buffer.WriteString(".")
+		case '[':
+			j := i
+			if j < n && pattern[j] == '!' {
+				j++
+			}
+			if j < n && pattern[j] == ']' {
+				j++
+			}
+			for j < n && pattern[j] != ']' {
+				j++
+			}
+			if j >= n {
+				buffer.WriteString(`\[`)
+				continue
+			}
+			buffer.WriteString(charClassToRegexp(pattern[i:j]))
+			i = j + 1
+		default:
+			buffer.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	return buffer.String()
+}
+
+// charClassToRegexp translates fnmatch [seq] content to regexp char class, ranges like 0-9 are kept
+func charClassToRegexp(seq string) string {
+	var buffer bytes.Buffer
+	buffer.WriteString("[")
+	if strings.HasPrefix(seq, "!") {
+		buffer.WriteString("^")
+		seq = seq[1:]
+	}
+	for i := 0; i < len(seq); i++ {
+		if seq[i] == '-' && i > 0 && i < len(seq)-1 {
+			buffer.WriteByte('-')
+			continue
+		}
+		buffer.WriteString(fmt.Sprintf(`\x%02X`, seq[i]))
+	}
+	buffer.WriteString("]")
+	return buffer.String()
+}
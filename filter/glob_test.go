@@ -0,0 +1,135 @@
+package filter
+
+import (
+	"sort"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestGlobConformance(t *testing.T) {
+	Convey("Given graphite-web conformance cases, should match the same entries", t, func() {
+		for _, testCase := range globConformanceCases {
+			glob, err := compileGlob(testCase.pattern)
+			matched := make([]string, 0)
+			if err == nil {
+				for _, entry := range globConformanceEntries {
+					if glob.MatchString(entry) {
+						matched = append(matched, entry)
+					}
+				}
+			}
+			sort.Strings(matched)
+			So(matched, ShouldResemble, testCase.expected)
+		}
+	})
+}
+
+func TestExpandBraces(t *testing.T) {
+	Convey("Should expand all brace groups including nested ones", t, func() {
+		So(expandBraces("abc"), ShouldResemble, []string{"abc"})
+		So(expandBraces("a{b,c}d"), ShouldResemble, []string{"abd", "acd"})
+		So(expandBraces("{a,b}{c,d}"), ShouldResemble, []string{"ac", "bc", "ad", "bd"})
+		So(expandBraces("{a,{b,c}}"), ShouldResemble, []string{"a", "b", "c"})
+		So(expandBraces("server[0-9]{a,b}"), ShouldResemble, []string{"server[0-9]a", "server[0-9]b"})
+		So(expandBraces("{a,b"), ShouldResemble, []string{"{a,b"})
+	})
+}
+
+func TestMatchTreeGlobPatterns(t *testing.T) {
+	patterns := []string{
+		"Nested.{a,{b,c}}.value",
+		"Several.{web,db}-{1,2}.value",
+		"Range.{web,db}[0-9].value",
+		"Negation.[!0-9]*.value",
+		"Invalid.[z-a].value",
+	}
+	storage := &PatternStorage{}
+	storage.buildTree(patterns)
+
+	Convey("Should match metrics by every kind of glob", t, func() {
+		cases := []struct {
+			metric   string
+			expected []string
+		}{
+			{"Nested.a.value", []string{"Nested.{a,{b,c}}.value"}},
+			{"Nested.c.value", []string{"Nested.{a,{b,c}}.value"}},
+			{"Nested.d.value", []string{}},
+			{"Several.web-2.value", []string{"Several.{web,db}-{1,2}.value"}},
+			{"Several.db-1.value", []string{"Several.{web,db}-{1,2}.value"}},
+			{"Several.db-3.value", []string{}},
+			{"Range.web1.value", []string{"Range.{web,db}[0-9].value"}},
+			{"Range.db9.value", []string{"Range.{web,db}[0-9].value"}},
+			{"Range.dbx.value", []string{}},
+			{"Negation.host1.value", []string{"Negation.[!0-9]*.value"}},
+			{"Negation.1host.value", []string{}},
+			{"Invalid.z.value", []string{}},
+		}
+		for _, testCase := range cases {
+			So(storage.matchPattern([]byte(testCase.metric)), ShouldResemble, testCase.expected)
+		}
+	})
+}
+
+var globConformanceEntries = []string{"a", "b", "c", "d", "e", "ab", "ac", "ad", "bc", "bd", "abc", "acb", "a1", "a2", "b1", "1", "2", "9", "12", "x", "xaycz", "xbydz", "xaydz", "web1", "web3", "db1", "db2", "server1a", "server2b", "servera", "a}", "b}", "]", "[", "a[", "a[]", "-", "{", "{a", "{a,b", "}", "ae", "bce", "cde", "axb", "ba", "aab", "aa", "abb", "*", "?", "a+b", "(a)", "$a", "^a", "aXb", "abx", "yy", "ax", "ayy", "axx", "2x", "ac1"}
+
+// globConformanceCases contains patterns and entries matched by them, expected results are produced by graphite-web
+// match_entries function (brace expansion and python fnmatch) with globConformanceEntries
+var globConformanceCases = []struct {
+	pattern  string
+	expected []string
+}{
+	{"*", []string{"$a", "(a)", "*", "-", "1", "12", "2", "2x", "9", "?", "[", "]", "^a", "a", "a+b", "a1", "a2", "aXb", "a[", "a[]", "aa", "aab", "ab", "abb", "abc", "abx", "ac", "ac1", "acb", "ad", "ae", "ax", "axb", "axx", "ayy", "a}", "b", "b1", "ba", "bc", "bce", "bd", "b}", "c", "cde", "d", "db1", "db2", "e", "server1a", "server2b", "servera", "web1", "web3", "x", "xaycz", "xaydz", "xbydz", "yy", "{", "{a", "{a,b", "}"}},
+	{"a*", []string{"a", "a+b", "a1", "a2", "aXb", "a[", "a[]", "aa", "aab", "ab", "abb", "abc", "abx", "ac", "ac1", "acb", "ad", "ae", "ax", "axb", "axx", "ayy", "a}"}},
+	{"*b", []string{"a+b", "aXb", "aab", "ab", "abb", "acb", "axb", "b", "server2b", "{a,b"}},
+	{"a*b", []string{"a+b", "aXb", "aab", "ab", "abb", "acb", "axb"}},
+	{"a?c", []string{"abc"}},
+	{"??", []string{"$a", "12", "2x", "^a", "a1", "a2", "a[", "aa", "ab", "ac", "ad", "ae", "ax", "a}", "b1", "ba", "bc", "bd", "b}", "yy", "{a"}},
+	{"abc", []string{"abc"}},
+	{"a{b,c}", []string{"ab", "ac"}},
+	{"{a,b}c", []string{"ac", "bc"}},
+	{"{a,b}{c,d}", []string{"ac", "ad", "bc", "bd"}},
+	{"x{a,b}y{c,d}z", []string{"xaycz", "xaydz", "xbydz"}},
+	{"{a,{b,c}}", []string{"a", "b", "c"}},
+	{"{a,b{c,d}}e", []string{"ae", "bce"}},
+	{"{{a,b},{c,d}}", []string{"a", "b", "c", "d"}},
+	{"{a}", []string{"a"}},
+	{"{}", []string{}},
+	{"{,a}", []string{"a"}},
+	{"a{,b}", []string{"a", "ab"}},
+	{"{a,b", []string{"{a,b"}},
+	{"a}", []string{"a}"}},
+	{"[0-9]", []string{"1", "2", "9"}},
+	{"[0-9][0-9]", []string{"12"}},
+	{"a[bc]", []string{"ab", "ac"}},
+	{"a[!bc]", []string{"a1", "a2", "a[", "aa", "ad", "ae", "ax", "a}"}},
+	{"[!0-9]*", []string{"$a", "(a)", "*", "-", "?", "[", "]", "^a", "a", "a+b", "a1", "a2", "aXb", "a[", "a[]", "aa", "aab", "ab", "abb", "abc", "abx", "ac", "ac1", "acb", "ad", "ae", "ax", "axb", "axx", "ayy", "a}", "b", "b1", "ba", "bc", "bce", "bd", "b}", "c", "cde", "d", "db1", "db2", "e", "server1a", "server2b", "servera", "web1", "web3", "x", "xaycz", "xaydz", "xbydz", "yy", "{", "{a", "{a,b", "}"}},
+	{"{web,db}[0-9]", []string{"db1", "db2", "web1", "web3"}},
+	{"{web[1-2],db[!1]}", []string{"db2", "web1"}},
+	{"server[0-9]{a,b}", []string{"server1a", "server2b"}},
+	{"[a-c]{1,2}", []string{"a1", "a2", "b1"}},
+	{"[]]", []string{"]"}},
+	{"[!]]", []string{"*", "-", "1", "2", "9", "?", "[", "a", "b", "c", "d", "e", "x", "{", "}"}},
+	{"[", []string{"["}},
+	{"a[", []string{"a["}},
+	{"[!", []string{}},
+	{"a[]", []string{"a[]"}},
+	{"[-a]", []string{"-", "a"}},
+	{"[a-]", []string{"-", "a"}},
+	{"*{1,2}", []string{"1", "12", "2", "a1", "a2", "ac1", "b1", "db1", "db2", "web1"}},
+	{"{a*,*b}", []string{"a", "a+b", "a1", "a2", "aXb", "a[", "a[]", "aa", "aab", "ab", "abb", "abc", "abx", "ac", "ac1", "acb", "ad", "ae", "ax", "axb", "axx", "ayy", "a}", "b", "server2b", "{a,b"}},
+	{"?{x,yy}", []string{"2x", "ax", "ayy"}},
+	{"a\\}", []string{"a}"}},
+	{"{a,b\\}}", []string{"a"}},
+	{"[{]", []string{"{"}},
+	{"{[ab],c}", []string{"a", "b", "c"}},
+	{"{a,b}*{c,d}", []string{"abc", "ac", "ad", "bc", "bd"}},
+	{"**", []string{"$a", "(a)", "*", "-", "1", "12", "2", "2x", "9", "?", "[", "]", "^a", "a", "a+b", "a1", "a2", "aXb", "a[", "a[]", "aa", "aab", "ab", "abb", "abc", "abx", "ac", "ac1", "acb", "ad", "ae", "ax", "axb", "axx", "ayy", "a}", "b", "b1", "ba", "bc", "bce", "bd", "b}", "c", "cde", "d", "db1", "db2", "e", "server1a", "server2b", "servera", "web1", "web3", "x", "xaycz", "xaydz", "xbydz", "yy", "{", "{a", "{a,b", "}"}},
+	{"*a*", []string{"$a", "(a)", "^a", "a", "a+b", "a1", "a2", "aXb", "a[", "a[]", "aa", "aab", "ab", "abb", "abc", "abx", "ac", "ac1", "acb", "ad", "ae", "ax", "axb", "axx", "ayy", "a}", "ba", "server1a", "servera", "xaycz", "xaydz", "{a", "{a,b"}},
+	{"[*]", []string{"*"}},
+	{"[?]", []string{"?"}},
+	{"a+b", []string{"a+b"}},
+	{"(a)", []string{"(a)"}},
+	{"$a", []string{"$a"}},
+	{"^a", []string{"^a"}},
+}
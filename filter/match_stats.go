@@ -0,0 +1,133 @@
+package filter
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// MatchStats counts metrics matched by every pattern in per-minute buckets of last minutes
+// Counters are updated by atomic operations, so matching workers do not wait for each other
+type MatchStats struct {
+	minutes   int
+	startTime time.Time
+	// patterns maps pattern to its *patternMatchCounter
+	patterns sync.Map
+}
+
+// PatternMatchStats contains count of metrics matched by pattern
+type PatternMatchStats struct {
+	Pattern string `json:"pattern"`
+	// Matched is count of metrics matched in last minutes
+	Matched int64 `json:"matched"`
+	// Total is count of metrics matched since filter start
+	Total int64 `json:"total"`
+	// LastMatch is unix time of last matched metric, 0 if pattern has matched nothing
+	LastMatch int64 `json:"last_match"`
+}
+
+type patternMatchCounter struct {
+	total     int64
+	lastMatch int64
+	// buckets[i] contains minute in high 32 bits and count of matches in this minute in low 32 bits,
+	// bucket is chosen by minute modulo buckets count
+	buckets []int64
+}
+
+// NewMatchStats creates new MatchStats keeping counts of last minutes
+func NewMatchStats(minutes int) *MatchStats {
+	if minutes < 1 {
+		minutes = 1
+	}
+	return &MatchStats{
+		minutes:   minutes,
+		startTime: time.Now(),
+	}
+}
+
+// Minutes returns count of minutes matches are counted for
+func (stats *MatchStats) Minutes() int {
+	return stats.minutes
+}
+
+// StartTime returns time stats are collected since
+func (stats *MatchStats) StartTime() time.Time {
+	return stats.startTime
+}
+
+// add counts single metric matched by patterns at given time
+func (stats *MatchStats) add(patterns []string, now time.Time) {
+	minute := now.Unix() / 60
+	bucket := int(minute % int64(stats.minutes))
+	for _, pattern := range patterns {
+		counter, ok := stats.patterns.Load(pattern)
+		if !ok {
+			counter, _ = stats.patterns.LoadOrStore(pattern, &patternMatchCounter{buckets: make([]int64, stats.minutes)})
+		}
+		counter.(*patternMatchCounter).add(bucket, minute, now.Unix())
+	}
+}
+
+// get returns stats of given patterns at given time, patterns without matches have zero counts
+func (stats *MatchStats) get(patterns []string, now time.Time) []PatternMatchStats {
+	firstMinute := now.Unix()/60 - int64(stats.minutes) + 1
+	result := make([]PatternMatchStats, 0, len(patterns))
+	for _, pattern := range patterns {
+		patternStats := PatternMatchStats{Pattern: pattern}
+		if counter, ok := stats.patterns.Load(pattern); ok {
+			counter := counter.(*patternMatchCounter)
+			patternStats.Total = atomic.LoadInt64(&counter.total)
+			patternStats.LastMatch = atomic.LoadInt64(&counter.lastMatch)
+			for i := range counter.buckets {
+				if minute, count := counter.get(i); minute >= firstMinute {
+					patternStats.Matched += count
+				}
+			}
+		}
+		result = append(result, patternStats)
+	}
+	return result
+}
+
+// getUnmatched returns patterns which have matched nothing since stats start
+func (stats *MatchStats) getUnmatched(patterns []string) []string {
+	unmatched := make([]string, 0)
+	for _, pattern := range patterns {
+		if _, ok := stats.patterns.Load(pattern); !ok {
+			unmatched = append(unmatched, pattern)
+		}
+	}
+	return unmatched
+}
+
+// prune removes stats of patterns which are not current anymore
+func (stats *MatchStats) prune(isCurrent func(pattern string) bool) {
+	stats.patterns.Range(func(pattern, _ interface{}) bool {
+		if !isCurrent(pattern.(string)) {
+			stats.patterns.Delete(pattern)
+		}
+		return true
+	})
+}
+
+// add counts match in bucket of given minute, count of previous minute kept in bucket is dropped
+func (counter *patternMatchCounter) add(bucket int, minute int64, now int64) {
+	for {
+		old := atomic.LoadInt64(&counter.buckets[bucket])
+		value := minute<<32 | 1
+		if old>>32 == minute {
+			value = old + 1
+		}
+		if atomic.CompareAndSwapInt64(&counter.buckets[bucket], old, value) {
+			break
+		}
+	}
+	atomic.AddInt64(&counter.total, 1)
+	atomic.StoreInt64(&counter.lastMatch, now)
+}
+
+// get returns minute and count of matches kept in bucket
+func (counter *patternMatchCounter) get(bucket int) (int64, int64) {
+	value := atomic.LoadInt64(&counter.buckets[bucket])
+	return value >> 32, value & (1<<32 - 1)
+}
@@ -0,0 +1,120 @@
+package filter
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/op/go-logging"
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/moira-alert/moira"
+	"github.com/moira-alert/moira/metrics/graphite/go-metrics"
+	"github.com/moira-alert/moira/mock/moira-alert"
+)
+
+func TestMatchStats(t *testing.T) {
+	start := time.Unix(1234567800, 0)
+	patterns := []string{"Pattern.first", "Pattern.second", "Pattern.unmatched"}
+
+	Convey("Matches should be counted only in last minutes", t, func() {
+		stats := NewMatchStats(2)
+		stats.add([]string{"Pattern.first", "Pattern.second"}, start)
+		stats.add([]string{"Pattern.first"}, start.Add(30*time.Second))
+		stats.add([]string{"Pattern.first"}, start.Add(time.Minute))
+
+		So(stats.get(patterns, start.Add(time.Minute)), ShouldResemble, []PatternMatchStats{
+			{Pattern: "Pattern.first", Matched: 3, Total: 3, LastMatch: 1234567860},
+			{Pattern: "Pattern.second", Matched: 1, Total: 1, LastMatch: 1234567800},
+			{Pattern: "Pattern.unmatched"},
+		})
+		So(stats.get(patterns, start.Add(2*time.Minute)), ShouldResemble, []PatternMatchStats{
+			{Pattern: "Pattern.first", Matched: 1, Total: 3, LastMatch: 1234567860},
+			{Pattern: "Pattern.second", Matched: 0, Total: 1, LastMatch: 1234567800},
+			{Pattern: "Pattern.unmatched"},
+		})
+
+		stats.add([]string{"Pattern.first"}, start.Add(3*time.Minute))
+		So(stats.get(patterns[:1], start.Add(3*time.Minute)), ShouldResemble, []PatternMatchStats{
+			{Pattern: "Pattern.first", Matched: 1, Total: 4, LastMatch: 1234567980},
+		})
+		So(stats.getUnmatched(patterns), ShouldResemble, []string{"Pattern.unmatched"})
+	})
+
+	Convey("Concurrent matches should all be counted", t, func() {
+		stats := NewMatchStats(2)
+		var wg sync.WaitGroup
+		for i := 0; i < 8; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for j := 0; j < 1000; j++ {
+					stats.add([]string{"Pattern.first"}, start)
+				}
+			}()
+		}
+		wg.Wait()
+
+		So(stats.get(patterns[:1], start), ShouldResemble, []PatternMatchStats{
+			{Pattern: "Pattern.first", Matched: 8000, Total: 8000, LastMatch: 1234567800},
+		})
+	})
+
+	Convey("Prune should remove stats of not current patterns", t, func() {
+		stats := NewMatchStats(2)
+		stats.add([]string{"Pattern.first", "Pattern.second"}, start)
+		stats.prune(func(pattern string) bool {
+			return pattern == "Pattern.first"
+		})
+
+		So(stats.getUnmatched(patterns), ShouldResemble, []string{"Pattern.second", "Pattern.unmatched"})
+	})
+}
+
+func TestPatternStorageMatchStats(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	database := mock_moira_alert.NewMockDatabase(mockCtrl)
+	logger, _ := logging.GetLogger("Filter")
+
+	database.EXPECT().GetPatternsVersion().Return(int64(0), nil)
+	database.EXPECT().GetPatterns().Return([]string{"Stats.*.requests", "Stats.*.errors", "seriesByTag('name=Stats.tagged')"}, nil)
+	patternsStorage, err := NewPatternStorage(database, metrics.ConfigureFilterMetrics("test"), logger)
+
+	Convey("Create pattern storage, should no error", t, func() {
+		So(err, ShouldBeNil)
+	})
+
+	Convey("Without match stats, should return nil", t, func() {
+		So(patternsStorage.GetPatternsMatchStats(), ShouldBeNil)
+		So(patternsStorage.GetUnmatchedPatterns(), ShouldBeNil)
+	})
+
+	Convey("With match stats, matched metrics should be counted", t, func() {
+		patternsStorage.SetMatchStats(NewMatchStats(10))
+		patternsStorage.ParseAndMatchMetric([]byte("Stats.first.requests 1 1234567890"))
+		patternsStorage.ParseAndMatchMetric([]byte("Stats.second.requests 1 1234567890"))
+		patternsStorage.ParseAndMatchMetric([]byte("Stats.tagged 1 1234567890"))
+
+		So(patternsStorage.GetPatterns(), ShouldResemble, []string{"Stats.*.errors", "Stats.*.requests", "seriesByTag('name=Stats.tagged')"})
+		patternsStats := patternsStorage.GetPatternsMatchStats()
+		So(len(patternsStats), ShouldEqual, 3)
+		So(patternsStats[0].Matched, ShouldEqual, 0)
+		So(patternsStats[1].Matched, ShouldEqual, 2)
+		So(patternsStats[2].Matched, ShouldEqual, 1)
+		So(patternsStorage.GetUnmatchedPatterns(), ShouldResemble, []string{"Stats.*.errors"})
+		So(patternsStorage.MatchPattern("Stats.any.errors"), ShouldResemble, []string{"Stats.*.errors"})
+	})
+
+	Convey("Update tree removing patterns, should drop their match stats", t, func() {
+		database.EXPECT().GetPatternsChanges(int64(0)).Return([]moira.PatternChange{
+			{Pattern: "Stats.*.requests", Removed: true},
+			{Pattern: "seriesByTag('name=Stats.tagged')", Removed: true},
+		}, int64(1), nil)
+		So(patternsStorage.UpdateTree(), ShouldBeNil)
+
+		So(patternsStorage.GetPatterns(), ShouldResemble, []string{"Stats.*.errors"})
+		So(patternsStorage.stats.getUnmatched([]string{"Stats.*.requests", "seriesByTag('name=Stats.tagged')"}), ShouldResemble, []string{"Stats.*.requests", "seriesByTag('name=Stats.tagged')"})
+	})
+}
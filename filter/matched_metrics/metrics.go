@@ -16,6 +16,8 @@ type MetricsMatcher struct {
 	database     moira.Database
 	cacheStorage *filter.Storage
 	waitGroup    *sync.WaitGroup
+	// saveEveryPoint makes matcher save buffered value before it is replaced by next value of same metric
+	saveEveryPoint bool
 }
 
 // NewMetricsMatcher creates new MetricsMatcher
@@ -29,6 +31,14 @@ func NewMetricsMatcher(metrics *graphite.FilterMetrics, logger moira.Logger, dat
 	}
 }
 
+// NewReplayMetricsMatcher creates new MetricsMatcher which saves every point of replayed metrics.
+// Live metrics matcher keeps only last value of metric in buffer, so replayed history would lose points
+func NewReplayMetricsMatcher(metrics *graphite.FilterMetrics, logger moira.Logger, database moira.Database, cacheStorage *filter.Storage) *MetricsMatcher {
+	matcher := NewMetricsMatcher(metrics, logger, database, cacheStorage)
+	matcher.saveEveryPoint = true
+	return matcher
+}
+
 // Start process matched metrics from channel and save it in cache storage
 func (matcher *MetricsMatcher) Start(channel chan *moira.MatchedMetric) {
 	matcher.waitGroup.Add(1)
@@ -39,9 +49,17 @@ func (matcher *MetricsMatcher) Start(channel chan *moira.MatchedMetric) {
 			select {
 			case metric, ok := <-channel:
 				if !ok {
+					if len(buffer) > 0 {
+						matcher.save(buffer)
+					}
 					matcher.logger.Info("Moira Filter Metrics Matcher stopped")
 					return
 				}
+				if matcher.saveEveryPoint {
+					if _, ok := buffer[metric.Metric]; ok {
+						buffer = matcher.flush(buffer)
+					}
+				}
 				matcher.cacheStorage.EnrichMatchedMetric(buffer, metric)
 				if len(buffer) < 10 {
 					continue
@@ -51,10 +69,7 @@ func (matcher *MetricsMatcher) Start(channel chan *moira.MatchedMetric) {
 			if len(buffer) == 0 {
 				continue
 			}
-			timer := time.Now()
-			matcher.save(buffer)
-			matcher.metrics.SavingTimer.UpdateSince(timer)
-			buffer = make(map[string]*moira.MatchedMetric)
+			buffer = matcher.flush(buffer)
 		}
 	}()
 	matcher.logger.Info("Moira Filter Metrics Matcher started")
@@ -65,6 +80,14 @@ func (matcher *MetricsMatcher) Wait() {
 	matcher.waitGroup.Wait()
 }
 
+// flush saves buffer and returns new empty buffer
+func (matcher *MetricsMatcher) flush(buffer map[string]*moira.MatchedMetric) map[string]*moira.MatchedMetric {
+	timer := time.Now()
+	matcher.save(buffer)
+	matcher.metrics.SavingTimer.UpdateSince(timer)
+	return make(map[string]*moira.MatchedMetric)
+}
+
 func (matcher *MetricsMatcher) save(buffer map[string]*moira.MatchedMetric) {
 	if err := matcher.database.SaveMetrics(buffer); err != nil {
 		matcher.logger.Infof("Failed to save value in cache storage: %s", err.Error())
@@ -0,0 +1,95 @@
+package matchedmetrics
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/op/go-logging"
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/moira-alert/moira"
+	"github.com/moira-alert/moira/filter"
+	"github.com/moira-alert/moira/metrics/graphite/go-metrics"
+	"github.com/moira-alert/moira/mock/moira-alert"
+)
+
+func TestMetricsMatcher(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	database := mock_moira_alert.NewMockDatabase(mockCtrl)
+	logger, _ := logging.GetLogger("Filter")
+	filterMetrics := metrics.ConfigureFilterMetrics("test")
+
+	database.EXPECT().GetPatternsVersion().Return(int64(0), nil)
+	database.EXPECT().GetPatterns().Return([]string{"Replay.*.requests"}, nil)
+	patternsStorage, err := filter.NewPatternStorage(database, filterMetrics, logger)
+	cacheStorage, cacheErr := filter.NewCacheStorage(filterMetrics, strings.NewReader(""), nil)
+
+	Convey("Create pattern and cache storages, should no error", t, func() {
+		So(err, ShouldBeNil)
+		So(cacheErr, ShouldBeNil)
+	})
+
+	Convey("Replay many points of one metric, should save every point", t, func() {
+		const pointsCount = 25
+		var dump bytes.Buffer
+		for i := 0; i < pointsCount; i++ {
+			fmt.Fprintf(&dump, "Replay.first.requests %d %d\n", i, 1234567800+i*60)
+		}
+		savedValues := make([]float64, 0, pointsCount)
+		database.EXPECT().SaveMetrics(gomock.Any()).Do(func(buffer map[string]*moira.MatchedMetric) {
+			for _, metric := range buffer {
+				savedValues = append(savedValues, metric.Value)
+			}
+		}).Return(nil).AnyTimes()
+
+		metricsChan := make(chan *moira.MatchedMetric, 10)
+		matcher := NewReplayMetricsMatcher(filterMetrics, logger, database, cacheStorage)
+		matcher.Start(metricsChan)
+		replayer := filter.NewReplayer(logger, patternsStorage, filter.ReplayConfig{})
+		stats, err := replayer.Replay(&dump, metricsChan)
+		replayer.Flush(metricsChan)
+		close(metricsChan)
+		matcher.Wait()
+
+		So(err, ShouldBeNil)
+		So(stats.Matched, ShouldEqual, pointsCount)
+		So(savedValues, ShouldHaveLength, pointsCount)
+		for i, value := range savedValues {
+			So(value, ShouldEqual, i)
+		}
+	})
+	Convey("Receive many points of one metric, should save last buffered point once", t, func() {
+		var saveCalls int
+		var savedValues []float64
+		liveDatabase := mock_moira_alert.NewMockDatabase(mockCtrl)
+		liveDatabase.EXPECT().SaveMetrics(gomock.Any()).Do(func(buffer map[string]*moira.MatchedMetric) {
+			saveCalls++
+			for _, metric := range buffer {
+				savedValues = append(savedValues, metric.Value)
+			}
+		}).Return(nil).AnyTimes()
+
+		metricsChan := make(chan *moira.MatchedMetric, 10)
+		matcher := NewMetricsMatcher(filterMetrics, logger, liveDatabase, cacheStorage)
+		matcher.Start(metricsChan)
+		for i := 0; i < 5; i++ {
+			metricsChan <- &moira.MatchedMetric{
+				Metric:             "Live.first.requests",
+				Patterns:           []string{"Live.*.requests"},
+				Value:              float64(i),
+				Timestamp:          int64(1234567800 + i*60),
+				RetentionTimestamp: int64(1234567800 + i*60),
+				Retention:          60,
+			}
+		}
+		close(metricsChan)
+		matcher.Wait()
+
+		So(saveCalls, ShouldEqual, 1)
+		So(savedValues, ShouldResemble, []float64{4})
+	})
+}
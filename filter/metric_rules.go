@@ -0,0 +1,147 @@
+package filter
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Actions of metric rules
+const (
+	// MetricRuleAllow keeps matched metric as is and stops applying next rules
+	MetricRuleAllow = "allow"
+	// MetricRuleDrop drops matched metric
+	MetricRuleDrop = "drop"
+	// MetricRuleRewrite replaces all regex matches in metric name with replacement, $1 is expanded to regex group
+	MetricRuleRewrite = "rewrite"
+	// MetricRuleRename replaces whole name of matched metric with replacement, $1 is expanded to regex group
+	MetricRuleRename = "rename"
+)
+
+// MetricRuleConfig is metric rule settings, rule matches metrics by Regex or by graphite Glob
+type MetricRuleConfig struct {
+	Action      string
+	Regex       string
+	Glob        string
+	Replacement string
+}
+
+// MetricRules contains rules applied in order to incoming metrics before they are matched by patterns
+type MetricRules struct {
+	rules []*metricRule
+}
+
+type metricRule struct {
+	action      string
+	regex       *regexp.Regexp
+	globParts   [][]byte
+	globs       []*regexp.Regexp
+	replacement []byte
+}
+
+// NewMetricRules validates and compiles metric rules
+func NewMetricRules(configs []MetricRuleConfig) (*MetricRules, error) {
+	rules := make([]*metricRule, 0, len(configs))
+	for i, config := range configs {
+		rule, err := newMetricRule(config)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid metric rule #%d: %s", i+1, err.Error())
+		}
+		rules = append(rules, rule)
+	}
+	return &MetricRules{rules: rules}, nil
+}
+
+func newMetricRule(config MetricRuleConfig) (*metricRule, error) {
+	rule := &metricRule{
+		action:      config.Action,
+		replacement: []byte(config.Replacement),
+	}
+	switch config.Action {
+	case MetricRuleAllow, MetricRuleDrop:
+	case MetricRuleRewrite, MetricRuleRename:
+		if config.Replacement == "" {
+			return nil, fmt.Errorf("replacement is required for %s action", config.Action)
+		}
+	default:
+		return nil, fmt.Errorf("unknown action '%s'", config.Action)
+	}
+
+	switch {
+	case config.Regex != "" && config.Glob != "":
+		return nil, fmt.Errorf("only one of regex and glob can be set")
+	case config.Regex != "":
+		regex, err := regexp.Compile(config.Regex)
+		if err != nil {
+			return nil, err
+		}
+		rule.regex = regex
+	case config.Glob != "":
+		if config.Action == MetricRuleRewrite {
+			return nil, fmt.Errorf("rewrite action requires regex")
+		}
+		for _, part := range strings.Split(config.Glob, ".") {
+			var glob *regexp.Regexp
+			if isGlob(part) {
+				compiled, err := compileGlob(part)
+				if err != nil {
+					return nil, err
+				}
+				glob = compiled
+			}
+			rule.globParts = append(rule.globParts, []byte(part))
+			rule.globs = append(rule.globs, glob)
+		}
+	default:
+		return nil, fmt.Errorf("regex or glob is required")
+	}
+	return rule, nil
+}
+
+// apply applies rules to metric name, returns new metric name and false if metric is dropped
+func (rules *MetricRules) apply(metric []byte) ([]byte, bool) {
+	for _, rule := range rules.rules {
+		match, ok := rule.match(metric)
+		if !ok {
+			continue
+		}
+		switch rule.action {
+		case MetricRuleAllow:
+			return metric, true
+		case MetricRuleDrop:
+			return nil, false
+		case MetricRuleRewrite:
+			metric = rule.regex.ReplaceAll(metric, rule.replacement)
+		case MetricRuleRename:
+			if rule.regex != nil {
+				metric = rule.regex.Expand(nil, rule.replacement, metric, match)
+			} else {
+				metric = rule.replacement
+			}
+		}
+	}
+	return metric, true
+}
+
+// match checks if rule matches metric, regex submatch indexes are returned for regex rules
+func (rule *metricRule) match(metric []byte) ([]int, bool) {
+	if rule.regex != nil {
+		match := rule.regex.FindSubmatchIndex(metric)
+		return match, match != nil
+	}
+	parts := bytes.Split(metric, []byte("."))
+	if len(parts) != len(rule.globParts) {
+		return nil, false
+	}
+	for i, part := range parts {
+		if rule.globs[i] != nil {
+			if !rule.globs[i].Match(part) {
+				return nil, false
+			}
+		} else if !bytes.Equal(part, rule.globParts[i]) {
+			return nil, false
+		}
+	}
+	return nil, true
+}
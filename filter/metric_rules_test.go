@@ -0,0 +1,111 @@
+package filter
+
+import (
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/op/go-logging"
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/moira-alert/moira/metrics/graphite/go-metrics"
+	"github.com/moira-alert/moira/mock/moira-alert"
+)
+
+func TestNewMetricRules(t *testing.T) {
+	Convey("Given invalid rules, should return error", t, func() {
+		invalidRules := []MetricRuleConfig{
+			{Action: "keep", Regex: ".*"},
+			{Action: MetricRuleDrop},
+			{Action: MetricRuleDrop, Regex: ".*", Glob: "*"},
+			{Action: MetricRuleDrop, Regex: "("},
+			{Action: MetricRuleRename, Regex: ".*"},
+			{Action: MetricRuleRewrite, Glob: "*.id", Replacement: "id"},
+		}
+		for _, rule := range invalidRules {
+			_, err := NewMetricRules([]MetricRuleConfig{rule})
+			So(err, ShouldNotBeNil)
+		}
+	})
+}
+
+func TestApplyMetricRules(t *testing.T) {
+	rules, err := NewMetricRules([]MetricRuleConfig{
+		{Action: MetricRuleAllow, Glob: "Important.*.requests"},
+		{Action: MetricRuleDrop, Glob: "*.debug.*"},
+		{Action: MetricRuleDrop, Regex: `^Leak\.`},
+		{Action: MetricRuleRewrite, Regex: `\.id_[0-9]+\.`, Replacement: ".id."},
+		{Action: MetricRuleRename, Regex: `^Old\.([^.]+)\.(.*)$`, Replacement: "New.${1}.${2}"},
+		{Action: MetricRuleRename, Glob: "Legacy.{cpu,mem}", Replacement: "Legacy.system"},
+	})
+
+	Convey("Rules should be valid", t, func() {
+		So(err, ShouldBeNil)
+	})
+
+	Convey("Rules should be applied in order", t, func() {
+		cases := []struct {
+			metric   string
+			expected string
+			kept     bool
+		}{
+			{"Simple.metric", "Simple.metric", true},
+			{"App.debug.metric", "", false},
+			{"App.debug.metric.more", "App.debug.metric.more", true},
+			{"Leak.user.1", "", false},
+			{"Important.debug.requests", "Important.debug.requests", true},
+			{"App.users.id_123.requests", "App.users.id.requests", true},
+			{"Old.app.users.id_42.requests", "New.app.users.id.requests", true},
+			{"Legacy.cpu", "Legacy.system", true},
+			{"Legacy.disk", "Legacy.disk", true},
+		}
+		for _, testCase := range cases {
+			metric, kept := rules.apply([]byte(testCase.metric))
+			So(kept, ShouldEqual, testCase.kept)
+			So(string(metric), ShouldEqual, testCase.expected)
+		}
+	})
+}
+
+func TestMatchMetricWithRules(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	database := mock_moira_alert.NewMockDatabase(mockCtrl)
+	logger, _ := logging.GetLogger("Filter")
+	filterMetrics := metrics.ConfigureFilterMetrics("test")
+
+	database.EXPECT().GetPatternsVersion().Return(int64(0), nil)
+	database.EXPECT().GetPatterns().Return([]string{"App.*.requests"}, nil)
+	patternsStorage, err := NewPatternStorage(database, filterMetrics, logger)
+	rules, err2 := NewMetricRules([]MetricRuleConfig{
+		{Action: MetricRuleDrop, Glob: "App.debug.requests"},
+		{Action: MetricRuleRewrite, Regex: `^App\.users\.id_[0-9]+\.`, Replacement: "App.users."},
+		{Action: MetricRuleRename, Glob: "App.broken", Replacement: "App broken"},
+	})
+	patternsStorage.SetMetricRules(rules)
+
+	Convey("Create pattern storage and rules, should no error", t, func() {
+		So(err, ShouldBeNil)
+		So(err2, ShouldBeNil)
+	})
+
+	Convey("Dropped metric should not be matched", t, func() {
+		matchedMetric, err := patternsStorage.ParseAndMatchMetric([]byte("App.debug.requests 1 1234567890"))
+		So(err, ShouldBeNil)
+		So(matchedMetric, ShouldBeNil)
+		So(filterMetrics.RulesDroppedMetrics.Count(), ShouldEqual, 1)
+	})
+
+	Convey("Rewritten metric should be matched by new name", t, func() {
+		matchedMetric, err := patternsStorage.ParseAndMatchMetric([]byte("App.users.id_42.requests 1 1234567890"))
+		So(err, ShouldBeNil)
+		So(matchedMetric.Metric, ShouldEqual, "App.users.requests")
+		So(matchedMetric.Patterns, ShouldResemble, []string{"App.*.requests"})
+		So(filterMetrics.RulesRenamedMetrics.Count(), ShouldEqual, 1)
+	})
+
+	Convey("Metric renamed to invalid name should be skipped", t, func() {
+		matchedMetric, err := patternsStorage.ParseAndMatchMetric([]byte("App.broken 1 1234567890"))
+		So(err, ShouldNotBeNil)
+		So(matchedMetric, ShouldBeNil)
+	})
+}
@@ -29,7 +29,7 @@ func NewRefreshPatternWorker(database moira.Database, metrics *graphite.FilterMe
 	}
 }
 
-// Start process to refresh pattern tree every second
+// Start process to update pattern tree with patterns changes every second
 func (worker *RefreshPatternWorker) Start() error {
 	err := worker.patternStorage.RefreshTree()
 	if err != nil {
@@ -46,9 +46,9 @@ func (worker *RefreshPatternWorker) Start() error {
 				return nil
 			case <-checkTicker.C:
 				timer := time.Now()
-				err := worker.patternStorage.RefreshTree()
+				err := worker.patternStorage.UpdateTree()
 				if err != nil {
-					worker.logger.Errorf("Pattern refresh failed: %s", err.Error())
+					worker.logger.Errorf("Pattern update failed: %s", err.Error())
 				}
 				worker.metrics.BuildTreeTimer.UpdateSince(timer)
 			}
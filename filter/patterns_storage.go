@@ -1,34 +1,71 @@
 package filter
 
 import (
+	"bytes"
 	"fmt"
 	"github.com/moira-alert/moira"
+	"github.com/moira-alert/moira/database"
 	"github.com/moira-alert/moira/metrics/graphite"
+	"github.com/moira-alert/moira/tagged"
 	"github.com/vova616/xxhash"
-	"path"
+	"regexp"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 	"unicode"
 )
 
 var asteriskHash = xxhash.Checksum32([]byte("*"))
+var emptyGlob = regexp.MustCompile("^$")
 
 // PatternStorage contains pattern tree
 type PatternStorage struct {
-	database    moira.Database
-	metrics     *graphite.FilterMetrics
-	logger      moira.Logger
-	PatternTree *patternNode
+	database   moira.Database
+	metrics    *graphite.FilterMetrics
+	logger     moira.Logger
+	index      atomic.Value
+	aggregator *Aggregator
+	rules      *MetricRules
+	stats      *MatchStats
+
+	// fields below are used only by tree updaters and guarded by updateLock
+	updateLock   sync.Mutex
+	version      int64
+	treePatterns map[string]bool
+	tagQueries   map[string]*tagged.SeriesByTag
+}
+
+// patternIndex contains pattern tree and tag patterns index
+// It is never modified after creation, so it can be read without locks while updaters build and swap new one
+type patternIndex struct {
+	tree        *patternNode
+	tagPatterns *tagPatternIndex
 }
 
 // patternNode contains pattern node
+// Exact path parts and * are matched by Hash, other patterns are matched by Glob compiled from Part
 type patternNode struct {
 	Children   []*patternNode
 	Part       string
 	Hash       uint32
 	Prefix     string
 	InnerParts []string
+	Glob       *regexp.Regexp
+}
+
+// tagPatternIndex contains seriesByTag patterns indexed by exact series name
+type tagPatternIndex struct {
+	byName map[string][]tagPattern
+	other  []tagPattern
+}
+
+// tagPattern contains seriesByTag pattern as it stored in database and its parsed representation
+type tagPattern struct {
+	pattern string
+	query   *tagged.SeriesByTag
 }
 
 // NewPatternStorage creates new PatternStorage struct
@@ -44,25 +81,180 @@ func NewPatternStorage(database moira.Database, metrics *graphite.FilterMetrics,
 
 // RefreshTree builds pattern tree from redis data
 func (storage *PatternStorage) RefreshTree() error {
+	storage.updateLock.Lock()
+	defer storage.updateLock.Unlock()
+	return storage.refreshTree()
+}
+
+// UpdateTree applies patterns changes made since last update to pattern tree
+// Only changed tree branches are rebuilt, the whole tree is reloaded if changes log is unavailable
+func (storage *PatternStorage) UpdateTree() error {
+	storage.updateLock.Lock()
+	defer storage.updateLock.Unlock()
+
+	changes, version, err := storage.database.GetPatternsChanges(storage.version)
+	if err == database.ErrPatternsChangesLost {
+		storage.logger.Infof("Patterns changes since version %d are lost, reload all patterns", storage.version)
+		return storage.refreshTree()
+	}
+	if err != nil {
+		return err
+	}
+	if len(changes) > 0 {
+		storage.applyChanges(changes)
+	}
+	storage.version = version
+	return nil
+}
+
+// PatternTree returns current pattern tree
+func (storage *PatternStorage) PatternTree() *patternNode {
+	return storage.getIndex().tree
+}
+
+func (storage *PatternStorage) getIndex() *patternIndex {
+	index, _ := storage.index.Load().(*patternIndex)
+	if index == nil {
+		return &patternIndex{tree: &patternNode{}}
+	}
+	return index
+}
+
+func (storage *PatternStorage) refreshTree() error {
+	// version is read before patterns, so changes made in between will be applied again by next update
+	version, err := storage.database.GetPatternsVersion()
+	if err != nil {
+		return err
+	}
 	patterns, err := storage.database.GetPatterns()
 	if err != nil {
 		return err
 	}
-	return storage.buildTree(patterns)
+	if err := storage.buildTree(patterns); err != nil {
+		return err
+	}
+	storage.version = version
+	return nil
 }
 
 // ProcessIncomingMetric validates, parses and matches incoming raw string
 func (storage *PatternStorage) ProcessIncomingMetric(lineBytes []byte) *moira.MatchedMetric {
+	matchedMetric, err := storage.ParseAndMatchMetric(lineBytes)
+	if err != nil {
+		storage.logger.Infof("cannot parse input: %v", err)
+	}
+	return matchedMetric
+}
+
+// ParseAndMatchMetric is the same as ProcessIncomingMetric, but returns parse error instead of logging it
+func (storage *PatternStorage) ParseAndMatchMetric(lineBytes []byte) (*moira.MatchedMetric, error) {
 	storage.metrics.TotalMetricsReceived.Mark(1)
-	count := storage.metrics.TotalMetricsReceived.Count()
 
 	metric, value, timestamp, err := storage.parseMetricFromString(lineBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	return storage.matchMetric(metric, value, timestamp)
+}
+
+// ProcessParsedMetric validates and matches metric already decoded by non-plaintext protocol listeners
+func (storage *PatternStorage) ProcessParsedMetric(metric []byte, value float64, timestamp int64) *moira.MatchedMetric {
+	matchedMetric, err := storage.MatchParsedMetric(metric, value, timestamp)
 	if err != nil {
 		storage.logger.Infof("cannot parse input: %v", err)
+	}
+	return matchedMetric
+}
+
+// MatchParsedMetric is the same as ProcessParsedMetric, but returns validation error instead of logging it
+func (storage *PatternStorage) MatchParsedMetric(metric []byte, value float64, timestamp int64) (*moira.MatchedMetric, error) {
+	storage.metrics.TotalMetricsReceived.Mark(1)
+
+	if err := validateMetricName(metric); err != nil {
+		return nil, err
+	}
+	if timestamp == 0 {
+		return nil, fmt.Errorf("timestamp is empty for metric '%s'", metric)
+	}
+
+	return storage.matchMetric(metric, value, timestamp)
+}
+
+// SetMetricRules sets rules applied to incoming metrics before matching, it must be called before metrics are received
+func (storage *PatternStorage) SetMetricRules(rules *MetricRules) {
+	storage.rules = rules
+}
+
+// SetMatchStats sets stats counting metrics matched by every pattern, it must be called before metrics are received
+func (storage *PatternStorage) SetMatchStats(stats *MatchStats) {
+	storage.stats = stats
+}
+
+// GetPatterns returns sorted list of patterns in current pattern tree and tag patterns index
+func (storage *PatternStorage) GetPatterns() []string {
+	storage.updateLock.Lock()
+	patterns := make([]string, 0, len(storage.treePatterns)+len(storage.tagQueries))
+	for pattern := range storage.treePatterns {
+		patterns = append(patterns, pattern)
+	}
+	for pattern := range storage.tagQueries {
+		patterns = append(patterns, pattern)
+	}
+	storage.updateLock.Unlock()
+	sort.Strings(patterns)
+	return patterns
+}
+
+// GetPatternsMatchStats returns match stats of all current patterns, nil if match stats are not set
+func (storage *PatternStorage) GetPatternsMatchStats() []PatternMatchStats {
+	if storage.stats == nil {
 		return nil
 	}
+	return storage.stats.get(storage.GetPatterns(), time.Now())
+}
+
+// GetUnmatchedPatterns returns current patterns which have matched nothing since start, nil if match stats are not set
+func (storage *PatternStorage) GetUnmatchedPatterns() []string {
+	if storage.stats == nil {
+		return nil
+	}
+	return storage.stats.getUnmatched(storage.GetPatterns())
+}
 
+// MatchPattern returns patterns matched by metric name
+func (storage *PatternStorage) MatchPattern(metric string) []string {
+	return storage.matchPattern([]byte(metric))
+}
+
+func (storage *PatternStorage) matchMetric(metric []byte, value float64, timestamp int64) (*moira.MatchedMetric, error) {
+	if storage.rules != nil {
+		renamed, ok := storage.rules.apply(metric)
+		if !ok {
+			storage.metrics.RulesDroppedMetrics.Mark(1)
+			return nil, nil
+		}
+		if !bytes.Equal(renamed, metric) {
+			if err := validateMetricName(renamed); err != nil {
+				return nil, fmt.Errorf("metric '%s' renamed by rules is invalid: %s", metric, err.Error())
+			}
+			storage.metrics.RulesRenamedMetrics.Mark(1)
+			metric = renamed
+		}
+	}
+	if tagged.IsTaggedMetric(metric) {
+		taggedMetric, err := tagged.ParseMetric(string(metric))
+		if err != nil {
+			return nil, err
+		}
+		metric = []byte(taggedMetric.String())
+	}
+
+	count := storage.metrics.TotalMetricsReceived.Count()
 	storage.metrics.ValidMetricsReceived.Mark(1)
+	if storage.aggregator != nil {
+		storage.aggregator.add(string(metric), value, timestamp)
+	}
 
 	matchingStart := time.Now()
 	matched := storage.matchPattern(metric)
@@ -71,6 +263,9 @@ func (storage *PatternStorage) ProcessIncomingMetric(lineBytes []byte) *moira.Ma
 	}
 	if len(matched) > 0 {
 		storage.metrics.MatchingMetricsReceived.Mark(1)
+		if storage.stats != nil {
+			storage.stats.add(matched, matchingStart)
+		}
 		return &moira.MatchedMetric{
 			Metric:             string(metric),
 			Patterns:           matched,
@@ -78,14 +273,33 @@ func (storage *PatternStorage) ProcessIncomingMetric(lineBytes []byte) *moira.Ma
 			Timestamp:          timestamp,
 			RetentionTimestamp: timestamp,
 			Retention:          60,
-		}
+		}, nil
 	}
-	return nil
+	return nil, nil
 }
 
 // matchPattern returns array of matched patterns
+// Tagged series are matched only by seriesByTag patterns, plain series are matched by both kinds of patterns
 func (storage *PatternStorage) matchPattern(metric []byte) []string {
-	currentLevel := []*patternNode{storage.PatternTree}
+	index := storage.getIndex()
+	tagPatterns := index.tagPatterns
+	if tagged.IsTaggedMetric(metric) {
+		taggedMetric, err := tagged.ParseMetric(string(metric))
+		if err != nil {
+			return []string{}
+		}
+		return tagPatterns.match(taggedMetric, make([]string, 0))
+	}
+
+	matched := matchTreePattern(index.tree, metric)
+	if tagPatterns.isEmpty() {
+		return matched
+	}
+	return tagPatterns.match(&tagged.Metric{Name: string(metric)}, matched)
+}
+
+func matchTreePattern(patternTree *patternNode, metric []byte) []string {
+	currentLevel := []*patternNode{patternTree}
 	var found, index int
 	for i, c := range metric {
 		if c == '.' {
@@ -165,10 +379,37 @@ func (*PatternStorage) parseMetricFromString(line []byte) ([]byte, float64, int6
 	return metric, value, timestamp, nil
 }
 
+// validateMetricName checks metric name for emptiness, spaces and non-printable chars
+func validateMetricName(metric []byte) error {
+	if len(metric) < 1 {
+		return fmt.Errorf("metric name is empty")
+	}
+	for _, b := range metric {
+		r := rune(b)
+		if r > unicode.MaxASCII || !strconv.IsPrint(r) || b == ' ' {
+			return fmt.Errorf("non-ascii, non-printable or space chars in metric name: '%s'", metric)
+		}
+	}
+	return nil
+}
+
 func (storage *PatternStorage) buildTree(patterns []string) error {
 	newTree := &patternNode{}
+	treePatterns := make(map[string]bool, len(patterns))
+	tagQueries := make(map[string]*tagged.SeriesByTag)
 
 	for _, pattern := range patterns {
+		if tagged.IsSeriesByTag(pattern) {
+			query, err := tagged.ParseSeriesByTag(pattern)
+			if err != nil {
+				storage.logger.Warningf("Skip invalid tag pattern: %s", err.Error())
+				continue
+			}
+			tagQueries[pattern] = query
+			continue
+		}
+
+		treePatterns[pattern] = true
 		currentNode := newTree
 		parts := strings.Split(pattern, ".")
 		for _, part := range parts {
@@ -181,58 +422,226 @@ func (storage *PatternStorage) buildTree(patterns []string) error {
 				}
 			}
 			if !found {
-				newNode := &patternNode{Part: part}
-
-				if currentNode.Prefix == "" {
-					newNode.Prefix = part
-				} else {
-					newNode.Prefix = fmt.Sprintf("%s.%s", currentNode.Prefix, part)
-				}
-
-				if part == "*" || !strings.ContainsAny(part, "{*?") {
-					newNode.Hash = xxhash.Checksum32([]byte(part))
-				} else {
-					if strings.Contains(part, "{") && strings.Contains(part, "}") {
-						prefix, bigSuffix := split2(part, "{")
-						inner, suffix := split2(bigSuffix, "}")
-						innerParts := strings.Split(inner, ",")
-
-						newNode.InnerParts = make([]string, 0, len(innerParts))
-						for _, innerPart := range innerParts {
-							newNode.InnerParts = append(newNode.InnerParts, fmt.Sprintf("%s%s%s", prefix, innerPart, suffix))
-						}
-					} else {
-						newNode.InnerParts = []string{part}
-					}
-
-				}
+				newNode := newPatternNode(currentNode.Prefix, part)
 				currentNode.Children = append(currentNode.Children, newNode)
 				currentNode = newNode
 			}
 		}
 	}
 
-	storage.PatternTree = newTree
+	storage.treePatterns = treePatterns
+	storage.tagQueries = tagQueries
+	storage.index.Store(&patternIndex{
+		tree:        newTree,
+		tagPatterns: buildTagPatternIndex(tagQueries),
+	})
+	storage.pruneMatchStats()
 	return nil
 }
 
+// applyChanges builds new pattern tree from current one and swaps it
+// Unchanged tree branches are shared between old and new trees
+func (storage *PatternStorage) applyChanges(changes []moira.PatternChange) {
+	current := storage.getIndex()
+	newTree := current.tree
+	tagPatternsChanged := false
+	removed := false
+
+	for _, change := range changes {
+		if tagged.IsSeriesByTag(change.Pattern) {
+			_, exists := storage.tagQueries[change.Pattern]
+			if change.Removed && exists {
+				delete(storage.tagQueries, change.Pattern)
+				tagPatternsChanged = true
+				removed = true
+			}
+			if !change.Removed && !exists {
+				query, err := tagged.ParseSeriesByTag(change.Pattern)
+				if err != nil {
+					storage.logger.Warningf("Skip invalid tag pattern: %s", err.Error())
+					continue
+				}
+				storage.tagQueries[change.Pattern] = query
+				tagPatternsChanged = true
+			}
+			continue
+		}
+
+		exists := storage.treePatterns[change.Pattern]
+		parts := strings.Split(change.Pattern, ".")
+		if change.Removed && exists {
+			delete(storage.treePatterns, change.Pattern)
+			removed = true
+			newTree = removeTreePattern(newTree, parts, storage.treePatterns)
+			if newTree == nil {
+				newTree = &patternNode{}
+			}
+		}
+		if !change.Removed && !exists {
+			storage.treePatterns[change.Pattern] = true
+			newTree = addTreePattern(newTree, parts)
+		}
+	}
+
+	newTagPatterns := current.tagPatterns
+	if tagPatternsChanged {
+		newTagPatterns = buildTagPatternIndex(storage.tagQueries)
+	}
+	storage.index.Store(&patternIndex{
+		tree:        newTree,
+		tagPatterns: newTagPatterns,
+	})
+	if removed {
+		storage.pruneMatchStats()
+	}
+}
+
+// pruneMatchStats drops match stats of removed patterns
+// Stats added by matchers which still used previous index are dropped by next prune
+func (storage *PatternStorage) pruneMatchStats() {
+	if storage.stats == nil {
+		return
+	}
+	storage.stats.prune(func(pattern string) bool {
+		if storage.treePatterns[pattern] {
+			return true
+		}
+		_, ok := storage.tagQueries[pattern]
+		return ok
+	})
+}
+
+func newPatternNode(parentPrefix string, part string) *patternNode {
+	newNode := &patternNode{Part: part}
+
+	if parentPrefix == "" {
+		newNode.Prefix = part
+	} else {
+		newNode.Prefix = fmt.Sprintf("%s.%s", parentPrefix, part)
+	}
+
+	if part == "*" || !isGlob(part) {
+		newNode.Hash = xxhash.Checksum32([]byte(part))
+		return newNode
+	}
+
+	newNode.InnerParts = expandBraces(part)
+	glob, err := compileGlob(part)
+	if err != nil {
+		// graphite-web matches nothing by invalid pattern, path parts are never empty
+		glob = emptyGlob
+	}
+	newNode.Glob = glob
+	return newNode
+}
+
+// addTreePattern returns copy of node with pattern parts added
+// Only nodes on the pattern path are copied, other nodes are shared with original tree
+func addTreePattern(node *patternNode, parts []string) *patternNode {
+	newNode := *node
+	if len(parts) == 0 {
+		return &newNode
+	}
+	newNode.Children = make([]*patternNode, len(node.Children), len(node.Children)+1)
+	copy(newNode.Children, node.Children)
+	for i, child := range node.Children {
+		if child.Part == parts[0] {
+			newNode.Children[i] = addTreePattern(child, parts[1:])
+			return &newNode
+		}
+	}
+	newNode.Children = append(newNode.Children, addTreePattern(newPatternNode(node.Prefix, parts[0]), parts[1:]))
+	return &newNode
+}
+
+// removeTreePattern returns copy of node with pattern parts removed or nil if node is not needed anymore
+// Node is kept while it has children or it is the last node of one of remaining patterns
+func removeTreePattern(node *patternNode, parts []string, patterns map[string]bool) *patternNode {
+	if len(parts) == 0 {
+		if len(node.Children) > 0 {
+			return node
+		}
+		return nil
+	}
+	for i, child := range node.Children {
+		if child.Part != parts[0] {
+			continue
+		}
+		newChild := removeTreePattern(child, parts[1:], patterns)
+		if newChild == child {
+			return node
+		}
+		newNode := *node
+		newNode.Children = make([]*patternNode, 0, len(node.Children))
+		newNode.Children = append(newNode.Children, node.Children[:i]...)
+		if newChild != nil {
+			newNode.Children = append(newNode.Children, newChild)
+		}
+		newNode.Children = append(newNode.Children, node.Children[i+1:]...)
+		if len(newNode.Children) == 0 && !patterns[newNode.Prefix] {
+			return nil
+		}
+		return &newNode
+	}
+	return node
+}
+
+// buildTagPatternIndex builds index of given seriesByTag patterns, patterns are added in sorted order
+func buildTagPatternIndex(tagQueries map[string]*tagged.SeriesByTag) *tagPatternIndex {
+	patterns := make([]string, 0, len(tagQueries))
+	for pattern := range tagQueries {
+		patterns = append(patterns, pattern)
+	}
+	sort.Strings(patterns)
+
+	index := &tagPatternIndex{byName: make(map[string][]tagPattern)}
+	for _, pattern := range patterns {
+		index.add(pattern, tagQueries[pattern])
+	}
+	return index
+}
+
+func (index *tagPatternIndex) add(pattern string, query *tagged.SeriesByTag) {
+	item := tagPattern{pattern: pattern, query: query}
+	if name, ok := query.ExactName(); ok {
+		index.byName[name] = append(index.byName[name], item)
+	} else {
+		index.other = append(index.other, item)
+	}
+}
+
+func (index *tagPatternIndex) isEmpty() bool {
+	return index == nil || (len(index.byName) == 0 && len(index.other) == 0)
+}
+
+// match appends patterns matched given series to matched list
+func (index *tagPatternIndex) match(metric *tagged.Metric, matched []string) []string {
+	if index == nil {
+		return matched
+	}
+	for _, item := range index.byName[metric.Name] {
+		if item.query.Matches(metric) {
+			matched = append(matched, item.pattern)
+		}
+	}
+	for _, item := range index.other {
+		if item.query.Matches(metric) {
+			matched = append(matched, item.pattern)
+		}
+	}
+	return matched
+}
+
 func findPart(part []byte, currentLevel []*patternNode) ([]*patternNode, int) {
 	nextLevel := make([]*patternNode, 0, 64)
 	hash := xxhash.Checksum32(part)
 	for _, node := range currentLevel {
 		for _, child := range node.Children {
-			match := false
-
-			if child.Hash == asteriskHash || child.Hash == hash {
-				match = true
-			} else if len(child.InnerParts) > 0 {
-				for _, innerPart := range child.InnerParts {
-					innerMatch, _ := path.Match(innerPart, string(part))
-					if innerMatch {
-						match = true
-						break
-					}
-				}
+			var match bool
+			if child.Glob != nil {
+				match = child.Glob.Match(part)
+			} else {
+				match = child.Hash == asteriskHash || child.Hash == hash
 			}
 
 			if match {
@@ -242,11 +651,3 @@ func findPart(part []byte, currentLevel []*patternNode) ([]*patternNode, int) {
 	}
 	return nextLevel, len(nextLevel)
 }
-
-func split2(s, sep string) (string, string) {
-	splitResult := strings.SplitN(s, sep, 2)
-	if len(splitResult) < 2 {
-		return splitResult[0], ""
-	}
-	return splitResult[0], splitResult[1]
-}
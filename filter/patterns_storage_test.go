@@ -3,6 +3,8 @@ package filter
 import (
 	"fmt"
 	"github.com/golang/mock/gomock"
+	"github.com/moira-alert/moira"
+	"github.com/moira-alert/moira/database"
 	"github.com/moira-alert/moira/metrics/graphite/go-metrics"
 	"github.com/moira-alert/moira/mock/moira-alert"
 	"github.com/op/go-logging"
@@ -115,11 +117,13 @@ func TestProcessIncomingMetric(t *testing.T) {
 	logger, _ := logging.GetLogger("Scheduler")
 
 	Convey("Create new pattern storage, GetPatterns returns error, should error", t, func() {
+		database.EXPECT().GetPatternsVersion().Return(int64(0), nil)
 		database.EXPECT().GetPatterns().Return(nil, fmt.Errorf("Some error here"))
 		_, err := NewPatternStorage(database, metrics2, logger)
 		So(err, ShouldBeError, fmt.Errorf("Some error here"))
 	})
 
+	database.EXPECT().GetPatternsVersion().Return(int64(0), nil)
 	database.EXPECT().GetPatterns().Return(testPatterns, nil)
 	patternsStorage, err := NewPatternStorage(database, metrics2, logger)
 
@@ -175,3 +179,188 @@ func TestProcessIncomingMetric(t *testing.T) {
 
 	mockCtrl.Finish()
 }
+
+func TestProcessParsedMetric(t *testing.T) {
+	metrics2 := metrics.ConfigureFilterMetrics("test")
+
+	mockCtrl := gomock.NewController(t)
+	database := mock_moira_alert.NewMockDatabase(mockCtrl)
+	logger, _ := logging.GetLogger("Scheduler")
+
+	database.EXPECT().GetPatternsVersion().Return(int64(0), nil)
+	database.EXPECT().GetPatterns().Return([]string{"Simple.matching.pattern", "Star.single.*"}, nil)
+	patternsStorage, err := NewPatternStorage(database, metrics2, logger)
+
+	Convey("Create new pattern storage, should no error", t, func() {
+		So(err, ShouldBeEmpty)
+	})
+
+	Convey("When invalid parsed metric arrives, should be properly counted", t, func() {
+		patternsStorage.metrics = metrics.ConfigureFilterMetrics("test")
+		invalidMetrics := []string{"", "Space in.the.name", "Non-ascii.こんにちは", "Non-printable.\000"}
+		for _, metric := range invalidMetrics {
+			So(patternsStorage.ProcessParsedMetric([]byte(metric), 12, 1234567890), ShouldBeNil)
+		}
+		So(patternsStorage.ProcessParsedMetric([]byte("Simple.matching.pattern"), 12, 0), ShouldBeNil)
+		So(patternsStorage.metrics.TotalMetricsReceived.Count(), ShouldEqual, len(invalidMetrics)+1)
+		So(patternsStorage.metrics.ValidMetricsReceived.Count(), ShouldEqual, 0)
+	})
+
+	Convey("When valid parsed metric arrives, should match it", t, func() {
+		patternsStorage.metrics = metrics.ConfigureFilterMetrics("test")
+		So(patternsStorage.ProcessParsedMetric([]byte("Simple.notmatching.pattern"), 12, 1234567890), ShouldBeNil)
+		matchedMetric := patternsStorage.ProcessParsedMetric([]byte("Star.single.anything"), 12, 1234567890)
+		So(matchedMetric, ShouldNotBeNil)
+		So(matchedMetric.Metric, ShouldEqual, "Star.single.anything")
+		So(matchedMetric.Patterns, ShouldResemble, []string{"Star.single.*"})
+		So(matchedMetric.Value, ShouldEqual, 12)
+		So(matchedMetric.Timestamp, ShouldEqual, 1234567890)
+		So(patternsStorage.metrics.ValidMetricsReceived.Count(), ShouldEqual, 2)
+		So(patternsStorage.metrics.MatchingMetricsReceived.Count(), ShouldEqual, 1)
+	})
+
+	mockCtrl.Finish()
+}
+
+func TestProcessIncomingTaggedMetric(t *testing.T) {
+	testPatterns := []string{
+		"cpu.usage",
+		"seriesByTag('name=cpu.usage','dc=~eu.*')",
+		"seriesByTag('name=cpu.usage','host!=web2')",
+		"seriesByTag('name=~mem\\..*')",
+		"seriesByTag('name=cpu.usage','dc=~(')",
+	}
+
+	metrics2 := metrics.ConfigureFilterMetrics("test")
+
+	mockCtrl := gomock.NewController(t)
+	database := mock_moira_alert.NewMockDatabase(mockCtrl)
+	logger, _ := logging.GetLogger("Scheduler")
+
+	database.EXPECT().GetPatternsVersion().Return(int64(0), nil)
+	database.EXPECT().GetPatterns().Return(testPatterns, nil)
+	patternsStorage, err := NewPatternStorage(database, metrics2, logger)
+
+	Convey("Create new pattern storage with invalid tag pattern, should skip it without error", t, func() {
+		So(err, ShouldBeEmpty)
+		So(patternsStorage.getIndex().tagPatterns.byName["cpu.usage"], ShouldHaveLength, 2)
+		So(patternsStorage.getIndex().tagPatterns.other, ShouldHaveLength, 1)
+	})
+
+	Convey("When tagged metric arrives, should match only tag patterns and normalize name", t, func() {
+		matchedMetric := patternsStorage.ProcessIncomingMetric([]byte("cpu.usage;host=web1;dc=eu-west 12 1234567890"))
+		So(matchedMetric, ShouldNotBeNil)
+		So(matchedMetric.Metric, ShouldEqual, "cpu.usage;dc=eu-west;host=web1")
+		So(matchedMetric.Patterns, ShouldResemble, []string{
+			"seriesByTag('name=cpu.usage','dc=~eu.*')",
+			"seriesByTag('name=cpu.usage','host!=web2')",
+		})
+
+		matchedMetric = patternsStorage.ProcessIncomingMetric([]byte("cpu.usage;host=web2;dc=us 12 1234567890"))
+		So(matchedMetric, ShouldBeNil)
+
+		matchedMetric = patternsStorage.ProcessIncomingMetric([]byte("mem.free;host=web2 12 1234567890"))
+		So(matchedMetric, ShouldNotBeNil)
+		So(matchedMetric.Patterns, ShouldResemble, []string{"seriesByTag('name=~mem\\..*')"})
+	})
+
+	Convey("When plain metric arrives, should match tree and tag patterns", t, func() {
+		matchedMetric := patternsStorage.ProcessIncomingMetric([]byte("cpu.usage 12 1234567890"))
+		So(matchedMetric, ShouldNotBeNil)
+		So(matchedMetric.Patterns, ShouldResemble, []string{"cpu.usage", "seriesByTag('name=cpu.usage','host!=web2')"})
+	})
+
+	Convey("When malformed tagged metric arrives, should not be valid", t, func() {
+		patternsStorage.metrics = metrics.ConfigureFilterMetrics("test")
+		_, err := patternsStorage.ParseAndMatchMetric([]byte("cpu.usage;host 12 1234567890"))
+		So(err, ShouldNotBeNil)
+		So(patternsStorage.metrics.ValidMetricsReceived.Count(), ShouldEqual, 0)
+	})
+
+	mockCtrl.Finish()
+}
+
+func TestUpdateTree(t *testing.T) {
+	testPatterns := []string{
+		"Simple.matching.pattern",
+		"Simple.matching",
+		"Star.single.*",
+		"seriesByTag('name=cpu.usage')",
+	}
+
+	mockCtrl := gomock.NewController(t)
+	dataBase := mock_moira_alert.NewMockDatabase(mockCtrl)
+	logger, _ := logging.GetLogger("Scheduler")
+
+	dataBase.EXPECT().GetPatternsVersion().Return(int64(10), nil)
+	dataBase.EXPECT().GetPatterns().Return(testPatterns, nil)
+	patternsStorage, err := NewPatternStorage(dataBase, metrics.ConfigureFilterMetrics("test"), logger)
+
+	Convey("Create new pattern storage, should no error", t, func() {
+		So(err, ShouldBeEmpty)
+		So(patternsStorage.version, ShouldEqual, 10)
+	})
+
+	Convey("When there are no changes, should keep the same tree", t, func() {
+		tree := patternsStorage.PatternTree()
+		dataBase.EXPECT().GetPatternsChanges(int64(10)).Return([]moira.PatternChange{}, int64(10), nil)
+		So(patternsStorage.UpdateTree(), ShouldBeNil)
+		So(patternsStorage.PatternTree(), ShouldEqual, tree)
+	})
+
+	Convey("When patterns are added and removed, should apply only changes", t, func() {
+		oldTree := patternsStorage.PatternTree()
+		dataBase.EXPECT().GetPatternsChanges(int64(10)).Return([]moira.PatternChange{
+			{Pattern: "Simple.matching.pattern", Removed: true},
+			{Pattern: "Star.single.*", Removed: true},
+			{Pattern: "Star.single.*"},
+			{Pattern: "Question.?at_begin"},
+			{Pattern: "Question.?at_begin"},
+			{Pattern: "Not.existing.pattern", Removed: true},
+			{Pattern: "seriesByTag('name=cpu.usage')", Removed: true},
+			{Pattern: "seriesByTag('name=mem.free')"},
+		}, int64(18), nil)
+		So(patternsStorage.UpdateTree(), ShouldBeNil)
+		So(patternsStorage.version, ShouldEqual, 18)
+
+		So(patternsStorage.matchPattern([]byte("Simple.matching.pattern")), ShouldBeEmpty)
+		So(patternsStorage.matchPattern([]byte("Simple.matching")), ShouldResemble, []string{"Simple.matching"})
+		So(patternsStorage.matchPattern([]byte("Star.single.anything")), ShouldResemble, []string{"Star.single.*"})
+		So(patternsStorage.matchPattern([]byte("Question.1at_begin")), ShouldResemble, []string{"Question.?at_begin"})
+		So(patternsStorage.matchPattern([]byte("cpu.usage")), ShouldBeEmpty)
+		So(patternsStorage.matchPattern([]byte("mem.free;host=web1")), ShouldResemble, []string{"seriesByTag('name=mem.free')"})
+		So(patternsStorage.PatternTree().Children, ShouldHaveLength, 3)
+
+		Convey("Old tree should not be modified", func() {
+			So(matchTreePattern(oldTree, []byte("Simple.matching.pattern")), ShouldResemble, []string{"Simple.matching.pattern"})
+			So(matchTreePattern(oldTree, []byte("Question.1at_begin")), ShouldBeEmpty)
+		})
+	})
+
+	Convey("When all tree patterns are removed, should return empty tree", t, func() {
+		dataBase.EXPECT().GetPatternsChanges(int64(18)).Return([]moira.PatternChange{
+			{Pattern: "Simple.matching", Removed: true},
+			{Pattern: "Star.single.*", Removed: true},
+			{Pattern: "Question.?at_begin", Removed: true},
+		}, int64(21), nil)
+		So(patternsStorage.UpdateTree(), ShouldBeNil)
+		So(patternsStorage.PatternTree().Children, ShouldBeEmpty)
+	})
+
+	Convey("When changes are lost, should reload all patterns", t, func() {
+		dataBase.EXPECT().GetPatternsChanges(int64(21)).Return(nil, int64(100), database.ErrPatternsChangesLost)
+		dataBase.EXPECT().GetPatternsVersion().Return(int64(100), nil)
+		dataBase.EXPECT().GetPatterns().Return(testPatterns, nil)
+		So(patternsStorage.UpdateTree(), ShouldBeNil)
+		So(patternsStorage.version, ShouldEqual, 100)
+		So(patternsStorage.matchPattern([]byte("Simple.matching.pattern")), ShouldResemble, []string{"Simple.matching.pattern"})
+	})
+
+	Convey("When changes request fails, should return error and keep version", t, func() {
+		dataBase.EXPECT().GetPatternsChanges(int64(100)).Return(nil, int64(0), fmt.Errorf("Some error here"))
+		So(patternsStorage.UpdateTree(), ShouldNotBeNil)
+		So(patternsStorage.version, ShouldEqual, 100)
+	})
+
+	mockCtrl.Finish()
+}
@@ -0,0 +1,150 @@
+package filter
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"time"
+
+	"github.com/moira-alert/moira"
+)
+
+// maxReplayLineSize limits length of single line in replayed dump
+const maxReplayLineSize = 1024 * 1024
+
+var gzipMagic = []byte{0x1f, 0x8b}
+
+// ReplayConfig contains historical metrics replay settings
+type ReplayConfig struct {
+	// RewriteTime shifts all timestamps by the same offset, so the first replayed metric appears as sent now
+	RewriteTime bool
+	// Realtime keeps original intervals between metric timestamps instead of replaying as fast as possible
+	Realtime bool
+}
+
+// ReplayStats contains counts of lines processed by replayer
+type ReplayStats struct {
+	Lines   int
+	Invalid int
+	Matched int
+}
+
+// Replayer reads graphite plaintext dumps and passes them through patterns storage
+// the same way metrics received by listeners are processed
+// Aggregation windows attached to patterns storage are closed by replayed timestamps instead of current time
+type Replayer struct {
+	logger          moira.Logger
+	patternsStorage *PatternStorage
+	config          ReplayConfig
+	started         bool
+	firstTimestamp  int64
+	lastTimestamp   int64
+	flushedUntil    int64
+	startTime       time.Time
+}
+
+// NewReplayer creates new Replayer, time offset is shared by all replayed files
+func NewReplayer(logger moira.Logger, patternsStorage *PatternStorage, config ReplayConfig) *Replayer {
+	return &Replayer{
+		logger:          logger,
+		patternsStorage: patternsStorage,
+		config:          config,
+	}
+}
+
+// ReplayFile replays plain or gzipped dump file
+func (replayer *Replayer) ReplayFile(fileName string, metricsChan chan<- *moira.MatchedMetric) (ReplayStats, error) {
+	file, err := os.Open(fileName)
+	if err != nil {
+		return ReplayStats{}, err
+	}
+	defer file.Close()
+	return replayer.Replay(file, metricsChan)
+}
+
+// Replay reads metric lines from reader, gzipped data is detected and decompressed,
+// matched metrics are sent to metricsChan
+func (replayer *Replayer) Replay(reader io.Reader, metricsChan chan<- *moira.MatchedMetric) (ReplayStats, error) {
+	stats := ReplayStats{}
+	bufferedReader := bufio.NewReader(reader)
+	if magic, _ := bufferedReader.Peek(len(gzipMagic)); bytes.Equal(magic, gzipMagic) {
+		gzipReader, err := gzip.NewReader(bufferedReader)
+		if err != nil {
+			return stats, fmt.Errorf("failed to read gzip data: %s", err.Error())
+		}
+		defer gzipReader.Close()
+		reader = gzipReader
+	} else {
+		reader = bufferedReader
+	}
+
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxReplayLineSize)
+	for scanner.Scan() {
+		line := bytes.TrimRight(scanner.Bytes(), "\r")
+		if len(line) == 0 {
+			continue
+		}
+		stats.Lines++
+		matchedMetric, err := replayer.replayLine(line)
+		if err != nil {
+			stats.Invalid++
+			replayer.logger.Debugf("cannot parse input: %v", err)
+			continue
+		}
+		if matchedMetric != nil {
+			stats.Matched++
+			metricsChan <- matchedMetric
+		}
+		replayer.flushAggregations(replayer.lastTimestamp, metricsChan)
+	}
+	return stats, scanner.Err()
+}
+
+// Flush sends values of aggregation windows left open after all replayed files to metricsChan
+func (replayer *Replayer) Flush(metricsChan chan<- *moira.MatchedMetric) {
+	replayer.flushAggregations(math.MaxInt64, metricsChan)
+}
+
+// flushAggregations sends values of aggregation windows closed till replayed time now
+func (replayer *Replayer) flushAggregations(now int64, metricsChan chan<- *moira.MatchedMetric) {
+	aggregator := replayer.patternsStorage.aggregator
+	if aggregator == nil || now <= replayer.flushedUntil {
+		return
+	}
+	replayer.flushedUntil = now
+	for _, matchedMetric := range aggregator.flush(now) {
+		metricsChan <- matchedMetric
+	}
+}
+
+func (replayer *Replayer) replayLine(line []byte) (*moira.MatchedMetric, error) {
+	storage := replayer.patternsStorage
+	storage.metrics.TotalMetricsReceived.Mark(1)
+	metric, value, timestamp, err := storage.parseMetricFromString(line)
+	if err != nil {
+		return nil, err
+	}
+	if !replayer.started {
+		replayer.started = true
+		replayer.firstTimestamp = timestamp
+		replayer.startTime = time.Now()
+	}
+	if replayer.config.Realtime {
+		elapsed := time.Duration(timestamp-replayer.firstTimestamp) * time.Second
+		if delay := replayer.startTime.Add(elapsed).Sub(time.Now()); delay > 0 {
+			time.Sleep(delay)
+		}
+	}
+	if replayer.config.RewriteTime {
+		timestamp += replayer.startTime.Unix() - replayer.firstTimestamp
+	}
+	if timestamp > replayer.lastTimestamp {
+		replayer.lastTimestamp = timestamp
+	}
+	return storage.matchMetric(metric, value, timestamp)
+}
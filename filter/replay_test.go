@@ -0,0 +1,110 @@
+package filter
+
+import (
+	"bytes"
+	"compress/gzip"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/op/go-logging"
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/moira-alert/moira"
+	"github.com/moira-alert/moira/metrics/graphite/go-metrics"
+	"github.com/moira-alert/moira/mock/moira-alert"
+)
+
+func TestReplay(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	database := mock_moira_alert.NewMockDatabase(mockCtrl)
+	logger, _ := logging.GetLogger("Filter")
+
+	database.EXPECT().GetPatternsVersion().Return(int64(0), nil)
+	database.EXPECT().GetPatterns().Return([]string{"Replay.*.requests"}, nil)
+	patternsStorage, err := NewPatternStorage(database, metrics.ConfigureFilterMetrics("test"), logger)
+
+	dump := strings.Join([]string{
+		"Replay.first.requests 1 1234567800",
+		"Replay.first.errors 2 1234567800",
+		"",
+		"Invalid line",
+		"Replay.second.requests 3 1234567860\r",
+	}, "\n")
+
+	Convey("Create pattern storage, should no error", t, func() {
+		So(err, ShouldBeNil)
+	})
+
+	Convey("Replay plain dump, should match metrics with original timestamps", t, func() {
+		replayer := NewReplayer(logger, patternsStorage, ReplayConfig{})
+		metricsChan := make(chan *moira.MatchedMetric, 10)
+		stats, err := replayer.Replay(strings.NewReader(dump), metricsChan)
+		So(err, ShouldBeNil)
+		So(stats, ShouldResemble, ReplayStats{Lines: 4, Invalid: 1, Matched: 2})
+		So(len(metricsChan), ShouldEqual, 2)
+		first := <-metricsChan
+		So(first.Metric, ShouldEqual, "Replay.first.requests")
+		So(first.Timestamp, ShouldEqual, 1234567800)
+		second := <-metricsChan
+		So(second.Metric, ShouldEqual, "Replay.second.requests")
+		So(second.Value, ShouldEqual, 3)
+		So(second.Timestamp, ShouldEqual, 1234567860)
+	})
+
+	Convey("Replay gzipped dump with time rewrite, should shift timestamps to now", t, func() {
+		var compressed bytes.Buffer
+		gzipWriter := gzip.NewWriter(&compressed)
+		gzipWriter.Write([]byte(dump))
+		gzipWriter.Close()
+
+		replayer := NewReplayer(logger, patternsStorage, ReplayConfig{RewriteTime: true})
+		metricsChan := make(chan *moira.MatchedMetric, 10)
+		before := time.Now().Unix()
+		stats, err := replayer.Replay(&compressed, metricsChan)
+		after := time.Now().Unix()
+		So(err, ShouldBeNil)
+		So(stats.Matched, ShouldEqual, 2)
+		first := <-metricsChan
+		So(first.Timestamp, ShouldBeGreaterThanOrEqualTo, before)
+		So(first.Timestamp, ShouldBeLessThanOrEqualTo, after)
+		second := <-metricsChan
+		So(second.Timestamp-first.Timestamp, ShouldEqual, 60)
+	})
+
+	Convey("Replay with aggregation rules, should close windows by replayed timestamps", t, func() {
+		database.EXPECT().GetPatternsVersion().Return(int64(0), nil)
+		database.EXPECT().GetPatterns().Return([]string{"Replay.all.requests"}, nil)
+		aggregatedStorage, err := NewPatternStorage(database, metrics.ConfigureFilterMetrics("test"), logger)
+		So(err, ShouldBeNil)
+		_, err = NewAggregator(logger, aggregatedStorage, strings.NewReader("Replay.all.requests (60) = sum Replay.*.requests"))
+		So(err, ShouldBeNil)
+
+		aggregatedDump := strings.Join([]string{
+			"Replay.first.requests 1 1234567800",
+			"Replay.second.requests 2 1234567810",
+			"Replay.first.requests 4 1234567860",
+			"Replay.first.requests 8 1234567980",
+		}, "\n")
+		replayer := NewReplayer(logger, aggregatedStorage, ReplayConfig{})
+		metricsChan := make(chan *moira.MatchedMetric, 10)
+		stats, err := replayer.Replay(strings.NewReader(aggregatedDump), metricsChan)
+		So(err, ShouldBeNil)
+		So(stats.Matched, ShouldEqual, 0)
+		values := map[int64]float64{}
+		for len(metricsChan) > 0 {
+			metric := <-metricsChan
+			So(metric.Metric, ShouldEqual, "Replay.all.requests")
+			values[metric.Timestamp] = metric.Value
+		}
+		So(values, ShouldResemble, map[int64]float64{1234567800: 3, 1234567860: 4})
+
+		replayer.Flush(metricsChan)
+		So(len(metricsChan), ShouldEqual, 1)
+		last := <-metricsChan
+		So(last.Value, ShouldEqual, 8)
+		So(last.Timestamp, ShouldEqual, 1234567980)
+	})
+}
@@ -27,6 +27,7 @@ type Database interface {
 
 	// Trigger storing
 	GetTriggerIDs() ([]string, error)
+	GetRemoteTriggerIDs() ([]string, error)
 	GetTrigger(triggerID string) (Trigger, error)
 	GetTriggers(triggerIDs []string) ([]*Trigger, error)
 	GetTriggerChecks(triggerIDs []string) ([]*TriggerCheck, error)
@@ -72,23 +73,34 @@ type Database interface {
 
 	// Patterns and metrics storing
 	GetPatterns() ([]string, error)
-	AddPatternMetric(pattern, metric string) error
+	GetPatternsVersion() (int64, error)
+	GetPatternsChanges(version int64) ([]PatternChange, int64, error)
+	AddPatternMetric(pattern, metric string, limit int64) error
 	GetPatternMetrics(pattern string) ([]string, error)
 	RemovePattern(pattern string) error
 	RemovePatternsMetrics(pattern []string) error
 	RemovePatternWithMetrics(pattern string) error
 
 	SubscribeMetricEvents(tomb *tomb.Tomb) (<-chan *MetricEvent, error)
+	AckMetricEvent(event *MetricEvent) error
 	SaveMetrics(buffer map[string]*MatchedMetric) error
 	GetMetricRetention(metric string) (int64, error)
+	GetMetricRetentionArchives(metric string) ([]RetentionArchive, error)
 	GetMetricsValues(metrics []string, from int64, until int64) (map[string][]*MetricValue, error)
+	GetMetricsArchiveValues(metrics []string, step int64, from int64, until int64) (map[string][]*MetricValue, error)
 	RemoveMetricValues(metric string, toTime int64) error
+	ExpireMetricValues(metric string, ttl int64) error
 
 	// TriggerCheckLock storing
 	AcquireTriggerCheckLock(triggerID string, timeout int) error
 	DeleteTriggerCheckLock(triggerID string) error
 	SetTriggerCheckLock(triggerID string) (bool, error)
 
+	// Checker shards storing
+	UpdateCheckerHeartbeat(checkerID string) error
+	GetAliveCheckers(ttl int64) ([]string, error)
+	RemoveCheckerHeartbeat(checkerID string) error
+
 	// Bot data storing
 	GetIDByUsername(messenger, username string) (string, error)
 	SetUsernameID(messenger, username, id string) error
@@ -2,7 +2,11 @@ package graphite
 
 // CheckerMetrics is a collection of metrics used in checker
 type CheckerMetrics struct {
-	CheckError       Meter
-	HandleError      Meter
-	TriggerCheckTime Timer
+	CheckError                  Meter
+	HandleError                 Meter
+	TriggerCheckTime            Timer
+	PatternMetricsLimitExceeded Meter
+	CheckQueueLength            Gauge
+	CheckQueueWait              Timer
+	CheckQueueDropped           Meter
 }
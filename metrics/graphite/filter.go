@@ -2,10 +2,24 @@ package graphite
 
 // FilterMetrics is a collection of metrics used in filter
 type FilterMetrics struct {
-	TotalMetricsReceived    Meter // TotalMetricsReceived metrics counter
-	ValidMetricsReceived    Meter // ValidMetricsReceived metrics counter
-	MatchingMetricsReceived Meter // MatchingMetricsReceived metrics counter
-	MatchingTimer           Timer // MatchingTimer metrics timer
-	SavingTimer             Timer // SavingTimer metrics timer
-	BuildTreeTimer          Timer // BuildTreeTimer metrics timer
+	TotalMetricsReceived    Meter      // TotalMetricsReceived metrics counter
+	ValidMetricsReceived    Meter      // ValidMetricsReceived metrics counter
+	MatchingMetricsReceived Meter      // MatchingMetricsReceived metrics counter
+	MatchingTimer           Timer      // MatchingTimer metrics timer
+	SavingTimer             Timer      // SavingTimer metrics timer
+	BuildTreeTimer          Timer      // BuildTreeTimer metrics timer
+	UDPMetricsReceived      Meter      // UDPMetricsReceived lines received by udp listener counter
+	UDPMetricsDropped       Meter      // UDPMetricsDropped matched metrics dropped by udp listener counter
+	UDPMetricsMalformed     Meter      // UDPMetricsMalformed lines received by udp listener which can not be parsed counter
+	LinesTooLong            Meter      // LinesTooLong lines exceeding max line size skipped by connection handler counter
+	LinesRateLimited        Meter      // LinesRateLimited lines skipped by connection handler due to remote address rate limit counter
+	MatchedMetricsDropped   Meter      // MatchedMetricsDropped matched metrics dropped by connection handler due to full channel counter
+	ConnectionsDisconnected Meter      // ConnectionsDisconnected connections closed by connection handler due to full channel counter
+	LinesForbidden          Meter      // LinesForbidden lines skipped by connection handler because metric prefix is not allowed for client certificate counter
+	RulesDroppedMetrics     Meter      // RulesDroppedMetrics metrics dropped by metric rules counter
+	RulesRenamedMetrics     Meter      // RulesRenamedMetrics metrics renamed or rewritten by metric rules counter
+	AggregatedMetrics       Meter      // AggregatedMetrics values emitted by aggregation rules counter
+	AggregationLateMetrics  Meter      // AggregationLateMetrics metrics skipped by aggregation rules because their window is already emitted counter
+	ShardsRoutedMetrics     MetricsMap // ShardsRoutedMetrics lines routed to every shard by shard forwarder counters
+	ShardsDroppedMetrics    MetricsMap // ShardsDroppedMetrics lines which were not sent to other shards due to full queue or connection errors counters
 }
@@ -14,6 +14,20 @@ func ConfigureFilterMetrics(prefix string) *graphite.FilterMetrics {
 		MatchingTimer:           newRegisteredTimer(metricNameWithPrefix(prefix, "time.match")),
 		SavingTimer:             newRegisteredTimer(metricNameWithPrefix(prefix, "time.save")),
 		BuildTreeTimer:          newRegisteredTimer(metricNameWithPrefix(prefix, "time.buildtree")),
+		UDPMetricsReceived:      newRegisteredMeter(metricNameWithPrefix(prefix, "udp.received")),
+		UDPMetricsDropped:       newRegisteredMeter(metricNameWithPrefix(prefix, "udp.dropped")),
+		UDPMetricsMalformed:     newRegisteredMeter(metricNameWithPrefix(prefix, "udp.malformed")),
+		LinesTooLong:            newRegisteredMeter(metricNameWithPrefix(prefix, "connection.too_long")),
+		LinesRateLimited:        newRegisteredMeter(metricNameWithPrefix(prefix, "connection.rate_limited")),
+		MatchedMetricsDropped:   newRegisteredMeter(metricNameWithPrefix(prefix, "connection.dropped")),
+		ConnectionsDisconnected: newRegisteredMeter(metricNameWithPrefix(prefix, "connection.disconnected")),
+		LinesForbidden:          newRegisteredMeter(metricNameWithPrefix(prefix, "connection.forbidden")),
+		RulesDroppedMetrics:     newRegisteredMeter(metricNameWithPrefix(prefix, "rules.dropped")),
+		RulesRenamedMetrics:     newRegisteredMeter(metricNameWithPrefix(prefix, "rules.renamed")),
+		AggregatedMetrics:       newRegisteredMeter(metricNameWithPrefix(prefix, "aggregation.emitted")),
+		AggregationLateMetrics:  newRegisteredMeter(metricNameWithPrefix(prefix, "aggregation.late")),
+		ShardsRoutedMetrics:     newMetricsMap(),
+		ShardsDroppedMetrics:    newMetricsMap(),
 	}
 }
 
@@ -33,9 +47,13 @@ func ConfigureNotifierMetrics(prefix string) *graphite.NotifierMetrics {
 // ConfigureCheckerMetrics is checker metrics configurator
 func ConfigureCheckerMetrics(prefix string) *graphite.CheckerMetrics {
 	return &graphite.CheckerMetrics{
-		CheckError:       newRegisteredMeter(metricNameWithPrefix(prefix, "errors.check")),
-		HandleError:      newRegisteredMeter(metricNameWithPrefix(prefix, "errors.handle")),
-		TriggerCheckTime: newRegisteredTimer(metricNameWithPrefix(prefix, "triggers")),
+		CheckError:                  newRegisteredMeter(metricNameWithPrefix(prefix, "errors.check")),
+		HandleError:                 newRegisteredMeter(metricNameWithPrefix(prefix, "errors.handle")),
+		TriggerCheckTime:            newRegisteredTimer(metricNameWithPrefix(prefix, "triggers")),
+		PatternMetricsLimitExceeded: newRegisteredMeter(metricNameWithPrefix(prefix, "pattern_metrics.limit_exceeded")),
+		CheckQueueLength:            newRegisteredGauge(metricNameWithPrefix(prefix, "queue.length")),
+		CheckQueueWait:              newRegisteredTimer(metricNameWithPrefix(prefix, "queue.wait")),
+		CheckQueueDropped:           newRegisteredMeter(metricNameWithPrefix(prefix, "queue.dropped")),
 	}
 }
 
@@ -71,16 +71,28 @@ func (mr *MockDatabaseMockRecorder) AddNotifications(arg0, arg1 interface{}) *go
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AddNotifications", reflect.TypeOf((*MockDatabase)(nil).AddNotifications), arg0, arg1)
 }
 
+// AckMetricEvent mocks base method
+func (m *MockDatabase) AckMetricEvent(arg0 *moira.MetricEvent) error {
+	ret := m.ctrl.Call(m, "AckMetricEvent", arg0)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// AckMetricEvent indicates an expected call of AckMetricEvent
+func (mr *MockDatabaseMockRecorder) AckMetricEvent(arg0 interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AckMetricEvent", reflect.TypeOf((*MockDatabase)(nil).AckMetricEvent), arg0)
+}
+
 // AddPatternMetric mocks base method
-func (m *MockDatabase) AddPatternMetric(arg0, arg1 string) error {
-	ret := m.ctrl.Call(m, "AddPatternMetric", arg0, arg1)
+func (m *MockDatabase) AddPatternMetric(arg0, arg1 string, arg2 int64) error {
+	ret := m.ctrl.Call(m, "AddPatternMetric", arg0, arg1, arg2)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
 // AddPatternMetric indicates an expected call of AddPatternMetric
-func (mr *MockDatabaseMockRecorder) AddPatternMetric(arg0, arg1 interface{}) *gomock.Call {
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AddPatternMetric", reflect.TypeOf((*MockDatabase)(nil).AddPatternMetric), arg0, arg1)
+func (mr *MockDatabaseMockRecorder) AddPatternMetric(arg0, arg1, arg2 interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AddPatternMetric", reflect.TypeOf((*MockDatabase)(nil).AddPatternMetric), arg0, arg1, arg2)
 }
 
 // DeleteTriggerCheckLock mocks base method
@@ -129,6 +141,18 @@ func (mr *MockDatabaseMockRecorder) DeregisterBots() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeregisterBots", reflect.TypeOf((*MockDatabase)(nil).DeregisterBots))
 }
 
+// ExpireMetricValues mocks base method
+func (m *MockDatabase) ExpireMetricValues(arg0 string, arg1 int64) error {
+	ret := m.ctrl.Call(m, "ExpireMetricValues", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// ExpireMetricValues indicates an expected call of ExpireMetricValues
+func (mr *MockDatabaseMockRecorder) ExpireMetricValues(arg0, arg1 interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ExpireMetricValues", reflect.TypeOf((*MockDatabase)(nil).ExpireMetricValues), arg0, arg1)
+}
+
 // FetchNotificationEvent mocks base method
 func (m *MockDatabase) FetchNotificationEvent() (moira.NotificationEvent, error) {
 	ret := m.ctrl.Call(m, "FetchNotificationEvent")
@@ -155,6 +179,19 @@ func (mr *MockDatabaseMockRecorder) FetchNotifications(arg0 interface{}) *gomock
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FetchNotifications", reflect.TypeOf((*MockDatabase)(nil).FetchNotifications), arg0)
 }
 
+// GetAliveCheckers mocks base method
+func (m *MockDatabase) GetAliveCheckers(arg0 int64) ([]string, error) {
+	ret := m.ctrl.Call(m, "GetAliveCheckers", arg0)
+	ret0, _ := ret[0].([]string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetAliveCheckers indicates an expected call of GetAliveCheckers
+func (mr *MockDatabaseMockRecorder) GetAliveCheckers(arg0 interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetAliveCheckers", reflect.TypeOf((*MockDatabase)(nil).GetAliveCheckers), arg0)
+}
+
 // GetAllContacts mocks base method
 func (m *MockDatabase) GetAllContacts() ([]*moira.ContactData, error) {
 	ret := m.ctrl.Call(m, "GetAllContacts")
@@ -233,6 +270,32 @@ func (mr *MockDatabaseMockRecorder) GetMetricRetention(arg0 interface{}) *gomock
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetMetricRetention", reflect.TypeOf((*MockDatabase)(nil).GetMetricRetention), arg0)
 }
 
+// GetMetricRetentionArchives mocks base method
+func (m *MockDatabase) GetMetricRetentionArchives(arg0 string) ([]moira.RetentionArchive, error) {
+	ret := m.ctrl.Call(m, "GetMetricRetentionArchives", arg0)
+	ret0, _ := ret[0].([]moira.RetentionArchive)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetMetricRetentionArchives indicates an expected call of GetMetricRetentionArchives
+func (mr *MockDatabaseMockRecorder) GetMetricRetentionArchives(arg0 interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetMetricRetentionArchives", reflect.TypeOf((*MockDatabase)(nil).GetMetricRetentionArchives), arg0)
+}
+
+// GetMetricsArchiveValues mocks base method
+func (m *MockDatabase) GetMetricsArchiveValues(arg0 []string, arg1, arg2, arg3 int64) (map[string][]*moira.MetricValue, error) {
+	ret := m.ctrl.Call(m, "GetMetricsArchiveValues", arg0, arg1, arg2, arg3)
+	ret0, _ := ret[0].(map[string][]*moira.MetricValue)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetMetricsArchiveValues indicates an expected call of GetMetricsArchiveValues
+func (mr *MockDatabaseMockRecorder) GetMetricsArchiveValues(arg0, arg1, arg2, arg3 interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetMetricsArchiveValues", reflect.TypeOf((*MockDatabase)(nil).GetMetricsArchiveValues), arg0, arg1, arg2, arg3)
+}
+
 // GetMetricsUpdatesCount mocks base method
 func (m *MockDatabase) GetMetricsUpdatesCount() (int64, error) {
 	ret := m.ctrl.Call(m, "GetMetricsUpdatesCount")
@@ -337,6 +400,46 @@ func (mr *MockDatabaseMockRecorder) GetPatterns() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetPatterns", reflect.TypeOf((*MockDatabase)(nil).GetPatterns))
 }
 
+// GetPatternsChanges mocks base method
+func (m *MockDatabase) GetPatternsChanges(arg0 int64) ([]moira.PatternChange, int64, error) {
+	ret := m.ctrl.Call(m, "GetPatternsChanges", arg0)
+	ret0, _ := ret[0].([]moira.PatternChange)
+	ret1, _ := ret[1].(int64)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// GetPatternsChanges indicates an expected call of GetPatternsChanges
+func (mr *MockDatabaseMockRecorder) GetPatternsChanges(arg0 interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetPatternsChanges", reflect.TypeOf((*MockDatabase)(nil).GetPatternsChanges), arg0)
+}
+
+// GetPatternsVersion mocks base method
+func (m *MockDatabase) GetPatternsVersion() (int64, error) {
+	ret := m.ctrl.Call(m, "GetPatternsVersion")
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetPatternsVersion indicates an expected call of GetPatternsVersion
+func (mr *MockDatabaseMockRecorder) GetPatternsVersion() *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetPatternsVersion", reflect.TypeOf((*MockDatabase)(nil).GetPatternsVersion))
+}
+
+// GetRemoteTriggerIDs mocks base method
+func (m *MockDatabase) GetRemoteTriggerIDs() ([]string, error) {
+	ret := m.ctrl.Call(m, "GetRemoteTriggerIDs")
+	ret0, _ := ret[0].([]string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetRemoteTriggerIDs indicates an expected call of GetRemoteTriggerIDs
+func (mr *MockDatabaseMockRecorder) GetRemoteTriggerIDs() *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetRemoteTriggerIDs", reflect.TypeOf((*MockDatabase)(nil).GetRemoteTriggerIDs))
+}
+
 // GetSubscription mocks base method
 func (m *MockDatabase) GetSubscription(arg0 string) (moira.SubscriptionData, error) {
 	ret := m.ctrl.Call(m, "GetSubscription", arg0)
@@ -543,6 +646,18 @@ func (mr *MockDatabaseMockRecorder) RegisterBotIfAlreadyNot(arg0, arg1 interface
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RegisterBotIfAlreadyNot", reflect.TypeOf((*MockDatabase)(nil).RegisterBotIfAlreadyNot), arg0, arg1)
 }
 
+// RemoveCheckerHeartbeat mocks base method
+func (m *MockDatabase) RemoveCheckerHeartbeat(arg0 string) error {
+	ret := m.ctrl.Call(m, "RemoveCheckerHeartbeat", arg0)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RemoveCheckerHeartbeat indicates an expected call of RemoveCheckerHeartbeat
+func (mr *MockDatabaseMockRecorder) RemoveCheckerHeartbeat(arg0 interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RemoveCheckerHeartbeat", reflect.TypeOf((*MockDatabase)(nil).RemoveCheckerHeartbeat), arg0)
+}
+
 // RemoveContact mocks base method
 func (m *MockDatabase) RemoveContact(arg0 string) error {
 	ret := m.ctrl.Call(m, "RemoveContact", arg0)
@@ -834,6 +949,18 @@ func (mr *MockDatabaseMockRecorder) SubscribeMetricEvents(arg0 interface{}) *gom
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SubscribeMetricEvents", reflect.TypeOf((*MockDatabase)(nil).SubscribeMetricEvents), arg0)
 }
 
+// UpdateCheckerHeartbeat mocks base method
+func (m *MockDatabase) UpdateCheckerHeartbeat(arg0 string) error {
+	ret := m.ctrl.Call(m, "UpdateCheckerHeartbeat", arg0)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UpdateCheckerHeartbeat indicates an expected call of UpdateCheckerHeartbeat
+func (mr *MockDatabaseMockRecorder) UpdateCheckerHeartbeat(arg0 interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateCheckerHeartbeat", reflect.TypeOf((*MockDatabase)(nil).UpdateCheckerHeartbeat), arg0)
+}
+
 // UpdateMetricsHeartbeat mocks base method
 func (m *MockDatabase) UpdateMetricsHeartbeat() error {
 	ret := m.ctrl.Call(m, "UpdateMetricsHeartbeat")
@@ -40,6 +40,7 @@ func BenchmarkProcessIncomingMetric(b *testing.B) {
 	database := mock_moira_alert.NewMockDatabase(mockCtrl)
 	logger, _ := logging.GetLogger("Benchmark")
 
+	database.EXPECT().GetPatternsVersion().Return(int64(0), nil)
 	database.EXPECT().GetPatterns().Return(patterns, nil)
 	patternsStorage, err := filter.NewPatternStorage(database, metrics2, logger)
 	if err != nil {
@@ -56,11 +57,12 @@ func BenchmarkProcessIncomingMetric(b *testing.B) {
 func generateMetrics(patterns *filter.PatternStorage, count int) []string {
 	result := make([]string, 0, count)
 	timestamp := time.Now()
+	tree := patterns.PatternTree()
 	i := 0
 	for i < count {
 		parts := make([]string, 0, 16)
 
-		node := patterns.PatternTree.Children[rand.Intn(len(patterns.PatternTree.Children))]
+		node := tree.Children[rand.Intn(len(tree.Children))]
 		matched := rand.Float64() < 0.02
 		level := float64(0)
 		for {
@@ -0,0 +1,120 @@
+package remote
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/go-graphite/carbonapi/expr"
+	pb "github.com/go-graphite/carbonzipper/carbonzipperpb3"
+
+	"github.com/moira-alert/moira/target"
+)
+
+// ErrGraphiteNotConfigured is returned if trigger uses remote graphite, but its URL is not set
+var ErrGraphiteNotConfigured = fmt.Errorf("Remote graphite is not configured")
+
+// GraphiteConfig contains remote graphite-web or carbonapi settings
+type GraphiteConfig struct {
+	// URL is render API address, for example http://graphite.example.com/render
+	URL      string
+	Timeout  time.Duration
+	User     string
+	Password string
+}
+
+// IsEnabled checks that remote graphite URL is set
+func (config *GraphiteConfig) IsEnabled() bool {
+	return config != nil && config.URL != ""
+}
+
+type graphiteSeries struct {
+	Target     string        `json:"target"`
+	DataPoints [][2]*float64 `json:"datapoints"`
+}
+
+// EvaluateGraphiteTarget evaluates target by remote graphite render API for given interval
+// Result has no patterns and metrics, because metrics of remote target are not stored by Moira
+func EvaluateGraphiteTarget(config *GraphiteConfig, tar string, from int64, until int64) (*target.EvaluationResult, error) {
+	if !config.IsEnabled() {
+		return nil, ErrGraphiteNotConfigured
+	}
+	body, err := fetchGraphiteRender(config, tar, from, until)
+	if err != nil {
+		return nil, err
+	}
+	series := make([]graphiteSeries, 0)
+	if err := json.Unmarshal(body, &series); err != nil {
+		return nil, fmt.Errorf("Failed to parse remote graphite response: %s", err.Error())
+	}
+	result := &target.EvaluationResult{
+		TimeSeries: make([]*target.TimeSeries, 0, len(series)),
+		Patterns:   make([]string, 0),
+		Metrics:    make([]string, 0),
+	}
+	for _, oneSeries := range series {
+		timeSeries, err := convertGraphiteSeries(oneSeries, from, until)
+		if err != nil {
+			return nil, err
+		}
+		result.TimeSeries = append(result.TimeSeries, timeSeries)
+	}
+	return result, nil
+}
+
+func fetchGraphiteRender(config *GraphiteConfig, tar string, from int64, until int64) ([]byte, error) {
+	query := url.Values{}
+	query.Set("target", tar)
+	query.Set("from", strconv.FormatInt(from, 10))
+	query.Set("until", strconv.FormatInt(until, 10))
+	query.Set("format", "json")
+	return fetch("graphite", config.URL+"?"+query.Encode(), config.User, config.Password, config.Timeout)
+}
+
+// convertGraphiteSeries converts datapoints "[value, timestamp]" to timeseries, null values are absent
+// Step is interval between first datapoints, it must be positive and kept by all datapoints
+// Series without datapoints covers requested interval
+func convertGraphiteSeries(series graphiteSeries, from int64, until int64) (*target.TimeSeries, error) {
+	fetchResponse := pb.FetchResponse{
+		Name:      series.Target,
+		StartTime: int32(from),
+		StopTime:  int32(until),
+		StepTime:  60,
+		Values:    make([]float64, 0, len(series.DataPoints)),
+		IsAbsent:  make([]bool, 0, len(series.DataPoints)),
+	}
+	points := make([][2]*float64, 0, len(series.DataPoints))
+	for _, point := range series.DataPoints {
+		if point[1] != nil {
+			points = append(points, point)
+		}
+	}
+	if len(points) > 0 {
+		fetchResponse.StartTime = int32(*points[0][1])
+		if len(points) > 1 {
+			fetchResponse.StepTime = int32(*points[1][1] - *points[0][1])
+			if fetchResponse.StepTime <= 0 {
+				return nil, fmt.Errorf("Invalid step %d of remote graphite series %s", fetchResponse.StepTime, series.Target)
+			}
+		}
+		for i, point := range points {
+			if expected := fetchResponse.StartTime + int32(i)*fetchResponse.StepTime; int32(*point[1]) != expected {
+				return nil, fmt.Errorf("Remote graphite series %s has datapoint at %d instead of %d", series.Target, int32(*point[1]), expected)
+			}
+		}
+		fetchResponse.StopTime = fetchResponse.StartTime + int32(len(points))*fetchResponse.StepTime
+	}
+	for _, point := range points {
+		if point[0] == nil {
+			fetchResponse.Values = append(fetchResponse.Values, math.NaN())
+			fetchResponse.IsAbsent = append(fetchResponse.IsAbsent, true)
+			continue
+		}
+		fetchResponse.Values = append(fetchResponse.Values, *point[0])
+		fetchResponse.IsAbsent = append(fetchResponse.IsAbsent, false)
+	}
+	return &target.TimeSeries{MetricData: expr.MetricData{FetchResponse: fetchResponse}}, nil
+}
@@ -0,0 +1,106 @@
+package remote
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestEvaluateGraphiteTarget(t *testing.T) {
+	var requests []*http.Request
+	responseStatus := http.StatusOK
+	responseBody := `[{"target": "my.metric", "datapoints": [[1, 1000], [null, 1060], [3.5, 1120]]}, {"target": "empty.metric", "datapoints": []}]`
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		requests = append(requests, request)
+		writer.WriteHeader(responseStatus)
+		fmt.Fprint(writer, responseBody)
+	}))
+	defer server.Close()
+	config := &GraphiteConfig{URL: server.URL + "/render", Timeout: time.Second, User: "moira", Password: "secret"}
+
+	Convey("Target is evaluated by render API", t, func() {
+		requests = nil
+		result, err := EvaluateGraphiteTarget(config, "sumSeries(my.*)", 1000, 1200)
+		So(err, ShouldBeNil)
+
+		So(requests, ShouldHaveLength, 1)
+		So(requests[0].URL.Path, ShouldEqual, "/render")
+		So(requests[0].URL.Query().Get("target"), ShouldEqual, "sumSeries(my.*)")
+		So(requests[0].URL.Query().Get("from"), ShouldEqual, "1000")
+		So(requests[0].URL.Query().Get("until"), ShouldEqual, "1200")
+		So(requests[0].URL.Query().Get("format"), ShouldEqual, "json")
+		user, password, ok := requests[0].BasicAuth()
+		So(ok, ShouldBeTrue)
+		So(user, ShouldEqual, "moira")
+		So(password, ShouldEqual, "secret")
+
+		So(result.Patterns, ShouldBeEmpty)
+		So(result.Metrics, ShouldBeEmpty)
+		So(result.TimeSeries, ShouldHaveLength, 2)
+
+		timeSeries := result.TimeSeries[0]
+		So(timeSeries.Name, ShouldEqual, "my.metric")
+		So(timeSeries.StartTime, ShouldEqual, 1000)
+		So(timeSeries.StopTime, ShouldEqual, 1180)
+		So(timeSeries.StepTime, ShouldEqual, 60)
+		So(timeSeries.IsAbsent, ShouldResemble, []bool{false, true, false})
+		So(timeSeries.GetTimestampValue(1000), ShouldEqual, 1)
+		So(math.IsNaN(timeSeries.GetTimestampValue(1060)), ShouldBeTrue)
+		So(timeSeries.GetTimestampValue(1120), ShouldEqual, 3.5)
+
+		empty := result.TimeSeries[1]
+		So(empty.Name, ShouldEqual, "empty.metric")
+		So(empty.StartTime, ShouldEqual, 1000)
+		So(empty.StopTime, ShouldEqual, 1200)
+		So(empty.Values, ShouldBeEmpty)
+	})
+
+	Convey("Basic auth is not sent without credentials", t, func() {
+		requests = nil
+		_, err := EvaluateGraphiteTarget(&GraphiteConfig{URL: server.URL}, "my.metric", 1000, 1200)
+		So(err, ShouldBeNil)
+		_, _, ok := requests[0].BasicAuth()
+		So(ok, ShouldBeFalse)
+	})
+
+	Convey("Error status is returned as error", t, func() {
+		responseStatus = http.StatusBadRequest
+		responseBody = "invalid target"
+		defer func() { responseStatus = http.StatusOK }()
+		_, err := EvaluateGraphiteTarget(config, "bad(", 1000, 1200)
+		So(err, ShouldResemble, fmt.Errorf("Remote graphite response status 400: invalid target"))
+	})
+
+	Convey("Invalid response is error", t, func() {
+		responseBody = "<html></html>"
+		_, err := EvaluateGraphiteTarget(config, "my.metric", 1000, 1200)
+		So(err, ShouldNotBeNil)
+	})
+
+	Convey("Series with inconsistent step is error", t, func() {
+		defer func() { responseBody = "[]" }()
+		responseBody = `[{"target": "my.metric", "datapoints": [[1, 1060], [2, 1000]]}]`
+		_, err := EvaluateGraphiteTarget(config, "my.metric", 1000, 1200)
+		So(err, ShouldResemble, fmt.Errorf("Invalid step -60 of remote graphite series my.metric"))
+
+		responseBody = `[{"target": "my.metric", "datapoints": [[1, 1000], [2, 1000]]}]`
+		_, err = EvaluateGraphiteTarget(config, "my.metric", 1000, 1200)
+		So(err, ShouldResemble, fmt.Errorf("Invalid step 0 of remote graphite series my.metric"))
+
+		responseBody = `[{"target": "my.metric", "datapoints": [[1, 1000], [2, 1060], [3, 1180]]}]`
+		_, err = EvaluateGraphiteTarget(config, "my.metric", 1000, 1200)
+		So(err, ShouldResemble, fmt.Errorf("Remote graphite series my.metric has datapoint at 1180 instead of 1120"))
+	})
+
+	Convey("Remote graphite must be configured", t, func() {
+		_, err := EvaluateGraphiteTarget(&GraphiteConfig{}, "my.metric", 1000, 1200)
+		So(err, ShouldEqual, ErrGraphiteNotConfigured)
+		_, err = EvaluateGraphiteTarget(nil, "my.metric", 1000, 1200)
+		So(err, ShouldEqual, ErrGraphiteNotConfigured)
+	})
+}
@@ -0,0 +1,168 @@
+package remote
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/url"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/go-graphite/carbonapi/expr"
+	pb "github.com/go-graphite/carbonzipper/carbonzipperpb3"
+
+	"github.com/moira-alert/moira/target"
+)
+
+// defaultPrometheusStep is used if query_range step is not set
+const defaultPrometheusStep = 60 * time.Second
+
+// ErrPrometheusNotConfigured is returned if trigger uses prometheus, but its URL is not set
+var ErrPrometheusNotConfigured = fmt.Errorf("Remote prometheus is not configured")
+
+// PrometheusConfig contains prometheus compatible API settings
+type PrometheusConfig struct {
+	// URL is API address, for example http://prometheus.example.com, query_range path is added to it
+	URL      string
+	Timeout  time.Duration
+	Step     time.Duration
+	User     string
+	Password string
+}
+
+// IsEnabled checks that prometheus URL is set
+func (config *PrometheusConfig) IsEnabled() bool {
+	return config != nil && config.URL != ""
+}
+
+type prometheusResponse struct {
+	Status string `json:"status"`
+	Error  string `json:"error"`
+	Data   struct {
+		ResultType string             `json:"resultType"`
+		Result     []prometheusSeries `json:"result"`
+	} `json:"data"`
+}
+
+type prometheusSeries struct {
+	Metric map[string]string `json:"metric"`
+	Values [][2]interface{}  `json:"values"`
+}
+
+// EvaluatePrometheusTarget executes PromQL query by prometheus query_range API for given interval
+// Every returned series is timeseries named by its labels, values are placed by query step starting from interval beginning
+func EvaluatePrometheusTarget(config *PrometheusConfig, query string, from int64, until int64) (*target.EvaluationResult, error) {
+	if !config.IsEnabled() {
+		return nil, ErrPrometheusNotConfigured
+	}
+	step := int64(config.Step / time.Second)
+	if step <= 0 {
+		step = int64(defaultPrometheusStep / time.Second)
+	}
+	body, err := fetchPrometheusQueryRange(config, query, from, until, step)
+	if err != nil {
+		return nil, err
+	}
+	response := prometheusResponse{}
+	if err := json.Unmarshal(body, &response); err != nil {
+		return nil, fmt.Errorf("Failed to parse remote prometheus response: %s", err.Error())
+	}
+	if response.Status != "success" {
+		return nil, fmt.Errorf("Remote prometheus query failed: %s", response.Error)
+	}
+	if response.Data.ResultType != "matrix" {
+		return nil, fmt.Errorf("Remote prometheus returned %s instead of matrix", response.Data.ResultType)
+	}
+	result := &target.EvaluationResult{
+		TimeSeries: make([]*target.TimeSeries, 0, len(response.Data.Result)),
+		Patterns:   make([]string, 0),
+		Metrics:    make([]string, 0),
+	}
+	for _, series := range response.Data.Result {
+		timeSeries, err := convertPrometheusSeries(series, query, from, until, step)
+		if err != nil {
+			return nil, err
+		}
+		result.TimeSeries = append(result.TimeSeries, timeSeries)
+	}
+	return result, nil
+}
+
+func fetchPrometheusQueryRange(config *PrometheusConfig, query string, from int64, until int64, step int64) ([]byte, error) {
+	values := url.Values{}
+	values.Set("query", query)
+	values.Set("start", strconv.FormatInt(from, 10))
+	values.Set("end", strconv.FormatInt(until, 10))
+	values.Set("step", strconv.FormatInt(step, 10))
+	return fetch("prometheus", config.URL+"/api/v1/query_range?"+values.Encode(), config.User, config.Password, config.Timeout)
+}
+
+// convertPrometheusSeries converts values "[timestamp, "value"]" to timeseries with query step,
+// missing and NaN values are absent
+func convertPrometheusSeries(series prometheusSeries, query string, from int64, until int64, step int64) (*target.TimeSeries, error) {
+	count := int((until-from)/step) + 1
+	fetchResponse := pb.FetchResponse{
+		Name:      getPrometheusSeriesName(series.Metric, query),
+		StartTime: int32(from),
+		StopTime:  int32(from + int64(count)*step),
+		StepTime:  int32(step),
+		Values:    make([]float64, count),
+		IsAbsent:  make([]bool, count),
+	}
+	for i := range fetchResponse.Values {
+		fetchResponse.Values[i] = math.NaN()
+		fetchResponse.IsAbsent[i] = true
+	}
+	for _, point := range series.Values {
+		timestamp, ok := point[0].(float64)
+		if !ok {
+			return nil, fmt.Errorf("Invalid remote prometheus timestamp %v of %s", point[0], fetchResponse.Name)
+		}
+		rawValue, ok := point[1].(string)
+		if !ok {
+			return nil, fmt.Errorf("Invalid remote prometheus value %v of %s", point[1], fetchResponse.Name)
+		}
+		value, err := strconv.ParseFloat(rawValue, 64)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid remote prometheus value %s of %s", rawValue, fetchResponse.Name)
+		}
+		index := int((int64(timestamp) - from) / step)
+		if index < 0 || index >= count || math.IsNaN(value) {
+			continue
+		}
+		fetchResponse.Values[index] = value
+		fetchResponse.IsAbsent[index] = false
+	}
+	return &target.TimeSeries{MetricData: expr.MetricData{FetchResponse: fetchResponse}}, nil
+}
+
+// getPrometheusSeriesName formats series labels as prometheus does, for example up{instance="host:9100", job="node"}
+// Series without labels, for example result of aggregation without grouping, is named by query
+func getPrometheusSeriesName(labels map[string]string, query string) string {
+	name := labels["__name__"]
+	labelNames := make([]string, 0, len(labels))
+	for labelName := range labels {
+		if labelName != "__name__" {
+			labelNames = append(labelNames, labelName)
+		}
+	}
+	if name == "" && len(labelNames) == 0 {
+		return query
+	}
+	sort.Strings(labelNames)
+	var buffer bytes.Buffer
+	buffer.WriteString(name)
+	buffer.WriteString("{")
+	for i, labelName := range labelNames {
+		if i > 0 {
+			buffer.WriteString(", ")
+		}
+		buffer.WriteString(labelName)
+		buffer.WriteString("=")
+		buffer.WriteString(strconv.Quote(labels[labelName]))
+	}
+	buffer.WriteString("}")
+	return buffer.String()
+}
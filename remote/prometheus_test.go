@@ -0,0 +1,104 @@
+package remote
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestEvaluatePrometheusTarget(t *testing.T) {
+	var requests []*http.Request
+	responseStatus := http.StatusOK
+	responseBody := `{"status": "success", "data": {"resultType": "matrix", "result": [
+		{"metric": {"__name__": "up", "job": "node", "instance": "host:9100"}, "values": [[1000, "1"], [1120.5, "0.5"], [1180, "NaN"], [1240, "7"]]},
+		{"metric": {}, "values": [[1060, "3"]]}
+	]}}`
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		requests = append(requests, request)
+		writer.WriteHeader(responseStatus)
+		fmt.Fprint(writer, responseBody)
+	}))
+	defer server.Close()
+	config := &PrometheusConfig{URL: server.URL, Timeout: time.Second, Step: time.Minute, User: "moira", Password: "secret"}
+
+	Convey("Query is executed by query_range API", t, func() {
+		requests = nil
+		result, err := EvaluatePrometheusTarget(config, "sum(up)", 1000, 1200)
+		So(err, ShouldBeNil)
+
+		So(requests, ShouldHaveLength, 1)
+		So(requests[0].URL.Path, ShouldEqual, "/api/v1/query_range")
+		So(requests[0].URL.Query().Get("query"), ShouldEqual, "sum(up)")
+		So(requests[0].URL.Query().Get("start"), ShouldEqual, "1000")
+		So(requests[0].URL.Query().Get("end"), ShouldEqual, "1200")
+		So(requests[0].URL.Query().Get("step"), ShouldEqual, "60")
+		user, password, ok := requests[0].BasicAuth()
+		So(ok, ShouldBeTrue)
+		So(user, ShouldEqual, "moira")
+		So(password, ShouldEqual, "secret")
+
+		So(result.Patterns, ShouldBeEmpty)
+		So(result.Metrics, ShouldBeEmpty)
+		So(result.TimeSeries, ShouldHaveLength, 2)
+
+		timeSeries := result.TimeSeries[0]
+		So(timeSeries.Name, ShouldEqual, `up{instance="host:9100", job="node"}`)
+		So(timeSeries.StartTime, ShouldEqual, 1000)
+		So(timeSeries.StopTime, ShouldEqual, 1240)
+		So(timeSeries.StepTime, ShouldEqual, 60)
+		So(timeSeries.IsAbsent, ShouldResemble, []bool{false, true, false, true})
+		So(timeSeries.GetTimestampValue(1000), ShouldEqual, 1)
+		So(math.IsNaN(timeSeries.GetTimestampValue(1060)), ShouldBeTrue)
+		So(timeSeries.GetTimestampValue(1120), ShouldEqual, 0.5)
+		So(math.IsNaN(timeSeries.GetTimestampValue(1180)), ShouldBeTrue)
+
+		So(result.TimeSeries[1].Name, ShouldEqual, "sum(up)")
+		So(result.TimeSeries[1].IsAbsent, ShouldResemble, []bool{true, false, true, true})
+		So(result.TimeSeries[1].GetTimestampValue(1060), ShouldEqual, 3)
+	})
+
+	Convey("Default step is used if not set", t, func() {
+		requests = nil
+		_, err := EvaluatePrometheusTarget(&PrometheusConfig{URL: server.URL}, "up", 1000, 1200)
+		So(err, ShouldBeNil)
+		So(requests[0].URL.Query().Get("step"), ShouldEqual, "60")
+		_, _, ok := requests[0].BasicAuth()
+		So(ok, ShouldBeFalse)
+	})
+
+	Convey("Error status is returned as error", t, func() {
+		responseStatus = http.StatusBadRequest
+		responseBody = `{"status": "error", "errorType": "bad_data", "error": "parse error"}`
+		defer func() { responseStatus = http.StatusOK }()
+		_, err := EvaluatePrometheusTarget(config, "up{", 1000, 1200)
+		So(err, ShouldResemble, fmt.Errorf(`Remote prometheus response status 400: {"status": "error", "errorType": "bad_data", "error": "parse error"}`))
+	})
+
+	Convey("Failed query is error", t, func() {
+		responseBody = `{"status": "error", "error": "query timed out"}`
+		_, err := EvaluatePrometheusTarget(config, "up", 1000, 1200)
+		So(err, ShouldResemble, fmt.Errorf("Remote prometheus query failed: query timed out"))
+	})
+
+	Convey("Not matrix result is error", t, func() {
+		responseBody = `{"status": "success", "data": {"resultType": "scalar", "result": []}}`
+		_, err := EvaluatePrometheusTarget(config, "1", 1000, 1200)
+		So(err, ShouldResemble, fmt.Errorf("Remote prometheus returned scalar instead of matrix"))
+	})
+
+	Convey("Invalid value is error", t, func() {
+		responseBody = `{"status": "success", "data": {"resultType": "matrix", "result": [{"metric": {"__name__": "up"}, "values": [[1000, "one"]]}]}}`
+		_, err := EvaluatePrometheusTarget(config, "up", 1000, 1200)
+		So(err, ShouldResemble, fmt.Errorf("Invalid remote prometheus value one of up{}"))
+	})
+
+	Convey("Prometheus must be configured", t, func() {
+		_, err := EvaluatePrometheusTarget(&PrometheusConfig{}, "up", 1000, 1200)
+		So(err, ShouldEqual, ErrPrometheusNotConfigured)
+	})
+}
@@ -0,0 +1,45 @@
+package remote
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"time"
+)
+
+// defaultTimeout is used if remote API timeout is not set
+const defaultTimeout = 60 * time.Second
+
+// maxErrorBodySize limits length of remote API response body included to error
+const maxErrorBodySize = 512
+
+// fetch gets response body of remote API request, response with not OK status is returned as error
+func fetch(source string, requestURL string, user string, password string, timeout time.Duration) ([]byte, error) {
+	request, err := http.NewRequest("GET", requestURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	if user != "" || password != "" {
+		request.SetBasicAuth(user, password)
+	}
+	if timeout <= 0 {
+		timeout = defaultTimeout
+	}
+	client := &http.Client{Timeout: timeout}
+	response, err := client.Do(request)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to request remote %s: %s", source, err.Error())
+	}
+	defer response.Body.Close()
+	body, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read remote %s response: %s", source, err.Error())
+	}
+	if response.StatusCode != http.StatusOK {
+		if len(body) > maxErrorBodySize {
+			body = body[:maxErrorBodySize]
+		}
+		return nil, fmt.Errorf("Remote %s response status %d: %s", source, response.StatusCode, string(body))
+	}
+	return body, nil
+}
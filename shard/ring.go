@@ -0,0 +1,81 @@
+package shard
+
+import (
+	"crypto/md5"
+	"encoding/binary"
+	"fmt"
+	"sort"
+	"strconv"
+)
+
+// defaultReplicas is the number of points every shard has on hash ring
+const defaultReplicas = 100
+
+// Ring maps metric names to shards by consistent hashing, md5 is used like in carbon-relay
+// because names of metrics and shards differ by few chars and need well distributed hashes
+// Adding or removing shard moves only metrics of ring ranges owned by that shard
+type Ring struct {
+	shards []string
+	points []point
+}
+
+type point struct {
+	hash  uint32
+	shard int
+}
+
+// NewRing creates hash ring with replicas points per shard, shards order does not matter
+func NewRing(shards []string, replicas int) (*Ring, error) {
+	if len(shards) == 0 {
+		return nil, fmt.Errorf("shards list is empty")
+	}
+	if replicas <= 0 {
+		replicas = defaultReplicas
+	}
+	ring := &Ring{
+		shards: make([]string, len(shards)),
+		points: make([]point, 0, len(shards)*replicas),
+	}
+	copy(ring.shards, shards)
+	sort.Strings(ring.shards)
+	for i, shard := range ring.shards {
+		if shard == "" {
+			return nil, fmt.Errorf("shard name is empty")
+		}
+		if i > 0 && ring.shards[i-1] == shard {
+			return nil, fmt.Errorf("shard '%s' is duplicated", shard)
+		}
+		for replica := 0; replica < replicas; replica++ {
+			hash := ringHash([]byte(shard + "#" + strconv.Itoa(replica)))
+			ring.points = append(ring.points, point{hash: hash, shard: i})
+		}
+	}
+	sort.Slice(ring.points, func(i, j int) bool {
+		if ring.points[i].hash == ring.points[j].hash {
+			return ring.points[i].shard < ring.points[j].shard
+		}
+		return ring.points[i].hash < ring.points[j].hash
+	})
+	return ring, nil
+}
+
+// Shards returns sorted list of ring shards
+func (ring *Ring) Shards() []string {
+	return ring.shards
+}
+
+// GetShard returns shard owning metric, it is the first shard point clockwise from metric hash
+func (ring *Ring) GetShard(metric []byte) string {
+	hash := ringHash(metric)
+	i := sort.Search(len(ring.points), func(i int) bool { return ring.points[i].hash >= hash })
+	if i == len(ring.points) {
+		i = 0
+	}
+	return ring.shards[ring.points[i].shard]
+}
+
+// ringHash returns first 4 bytes of md5 sum as ring position
+func ringHash(data []byte) uint32 {
+	sum := md5.Sum(data)
+	return binary.BigEndian.Uint32(sum[:4])
+}
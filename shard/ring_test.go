@@ -0,0 +1,50 @@
+package shard
+
+import (
+	"fmt"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestRing(t *testing.T) {
+	Convey("Given invalid shards, should return error", t, func() {
+		_, err := NewRing([]string{}, 0)
+		So(err, ShouldNotBeNil)
+		_, err = NewRing([]string{"filter1:2003", ""}, 0)
+		So(err, ShouldNotBeNil)
+		_, err = NewRing([]string{"filter1:2003", "filter2:2003", "filter1:2003"}, 0)
+		So(err, ShouldNotBeNil)
+	})
+
+	Convey("Metrics should be spread over shards independently of shards order", t, func() {
+		ring, err := NewRing([]string{"filter1:2003", "filter2:2003", "filter3:2003"}, 0)
+		So(err, ShouldBeNil)
+		reversedRing, err := NewRing([]string{"filter3:2003", "filter2:2003", "filter1:2003"}, 0)
+		So(err, ShouldBeNil)
+		So(ring.Shards(), ShouldResemble, []string{"filter1:2003", "filter2:2003", "filter3:2003"})
+
+		counts := make(map[string]int)
+		for i := 0; i < 3000; i++ {
+			metric := []byte(fmt.Sprintf("Sharded.metric.%d", i))
+			shard := ring.GetShard(metric)
+			So(reversedRing.GetShard(metric), ShouldEqual, shard)
+			counts[shard]++
+		}
+		So(len(counts), ShouldEqual, 3)
+		for _, count := range counts {
+			So(count, ShouldBeGreaterThan, 500)
+		}
+	})
+
+	Convey("Removing shard should move only its metrics", t, func() {
+		ring, _ := NewRing([]string{"filter1:2003", "filter2:2003", "filter3:2003"}, 0)
+		smallerRing, _ := NewRing([]string{"filter1:2003", "filter2:2003"}, 0)
+		for i := 0; i < 1000; i++ {
+			metric := []byte(fmt.Sprintf("Sharded.metric.%d", i))
+			if shard := ring.GetShard(metric); shard != "filter3:2003" {
+				So(smallerRing.GetShard(metric), ShouldEqual, shard)
+			}
+		}
+	})
+}
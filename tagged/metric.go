@@ -0,0 +1,83 @@
+package tagged
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// NameTag is the special tag which contains tagged series path
+const NameTag = "name"
+
+// Metric represents graphite tagged series "name;tag1=value1;tag2=value2"
+type Metric struct {
+	Name string
+	Tags map[string]string
+}
+
+// IsTaggedMetric checks if given metric name has tags
+func IsTaggedMetric(metric []byte) bool {
+	return bytes.IndexByte(metric, ';') >= 0
+}
+
+// ParseMetric parses graphite tagged series, series without tags are also valid
+func ParseMetric(metric string) (*Metric, error) {
+	parts := strings.Split(metric, ";")
+	if parts[0] == "" {
+		return nil, fmt.Errorf("metric name is empty: '%s'", metric)
+	}
+	parsed := &Metric{
+		Name: parts[0],
+		Tags: make(map[string]string, len(parts)-1),
+	}
+	for _, part := range parts[1:] {
+		tag, value := split2(part, "=")
+		if tag == "" || value == "" || !strings.Contains(part, "=") {
+			return nil, fmt.Errorf("tag must be in 'tag=value' format: '%s'", metric)
+		}
+		if strings.ContainsAny(tag, "!^~") || strings.Contains(value, "~") {
+			return nil, fmt.Errorf("tag contains forbidden chars: '%s'", metric)
+		}
+		if tag == NameTag {
+			return nil, fmt.Errorf("tag '%s' is reserved: '%s'", NameTag, metric)
+		}
+		parsed.Tags[tag] = value
+	}
+	return parsed, nil
+}
+
+// Get returns tag value or empty string if series has no such tag
+func (metric *Metric) Get(tag string) string {
+	if tag == NameTag {
+		return metric.Name
+	}
+	return metric.Tags[tag]
+}
+
+// String returns canonical series name with tags sorted by tag name, as graphite does
+func (metric *Metric) String() string {
+	if len(metric.Tags) == 0 {
+		return metric.Name
+	}
+	tags := make([]string, 0, len(metric.Tags))
+	for tag := range metric.Tags {
+		tags = append(tags, tag)
+	}
+	sort.Strings(tags)
+
+	var buffer bytes.Buffer
+	buffer.WriteString(metric.Name)
+	for _, tag := range tags {
+		buffer.WriteString(fmt.Sprintf(";%s=%s", tag, metric.Tags[tag]))
+	}
+	return buffer.String()
+}
+
+func split2(s, sep string) (string, string) {
+	splitResult := strings.SplitN(s, sep, 2)
+	if len(splitResult) < 2 {
+		return splitResult[0], ""
+	}
+	return splitResult[0], splitResult[1]
+}
@@ -0,0 +1,211 @@
+package tagged
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+const seriesByTagPrefix = "seriesByTag("
+
+// Tag expression operators, see graphite seriesByTag function documentation
+const (
+	operatorEqual    = "="
+	operatorNotEqual = "!="
+	operatorMatch    = "=~"
+	operatorNotMatch = "!=~"
+)
+
+type tagExpression struct {
+	tag      string
+	operator string
+	value    string
+	regex    *regexp.Regexp
+}
+
+// SeriesByTag represents parsed graphite seriesByTag('tag=value', 'tag=~regex', ...) pattern
+type SeriesByTag struct {
+	expressions []tagExpression
+}
+
+// IsSeriesByTag checks if given pattern is seriesByTag call
+func IsSeriesByTag(pattern string) bool {
+	return strings.HasPrefix(pattern, seriesByTagPrefix)
+}
+
+// ParseSeriesByTag parses seriesByTag call, whole pattern must be single call
+func ParseSeriesByTag(pattern string) (*SeriesByTag, error) {
+	if !IsSeriesByTag(pattern) {
+		return nil, fmt.Errorf("pattern is not seriesByTag call: %s", pattern)
+	}
+	args, length, err := parseCallArgs(pattern[len(seriesByTagPrefix):])
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %s", pattern, err.Error())
+	}
+	if len(seriesByTagPrefix)+length != len(pattern) {
+		return nil, fmt.Errorf("unexpected chars after seriesByTag call: %s", pattern)
+	}
+	return newSeriesByTag(args)
+}
+
+// FindSeriesByTag returns all seriesByTag calls contained in given graphite target
+func FindSeriesByTag(target string) ([]string, error) {
+	calls := make([]string, 0)
+	offset := 0
+	for {
+		index := strings.Index(target[offset:], seriesByTagPrefix)
+		if index < 0 {
+			return calls, nil
+		}
+		start := offset + index
+		_, length, err := parseCallArgs(target[start+len(seriesByTagPrefix):])
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse seriesByTag in target %s: %s", target, err.Error())
+		}
+		offset = start + len(seriesByTagPrefix) + length
+		calls = append(calls, target[start:offset])
+	}
+}
+
+func newSeriesByTag(args []string) (*SeriesByTag, error) {
+	if len(args) == 0 {
+		return nil, fmt.Errorf("seriesByTag must have at least one tag expression")
+	}
+	seriesByTag := &SeriesByTag{expressions: make([]tagExpression, 0, len(args))}
+	matchesEmpty := true
+	for _, arg := range args {
+		expression, err := parseTagExpression(arg)
+		if err != nil {
+			return nil, err
+		}
+		if !expression.matches("") {
+			matchesEmpty = false
+		}
+		seriesByTag.expressions = append(seriesByTag.expressions, expression)
+	}
+	if matchesEmpty {
+		return nil, fmt.Errorf("at least one tag expression must not match empty value")
+	}
+	return seriesByTag, nil
+}
+
+func parseTagExpression(arg string) (tagExpression, error) {
+	index := strings.Index(arg, "=")
+	if index < 0 {
+		return tagExpression{}, fmt.Errorf("tag expression must contain operator: '%s'", arg)
+	}
+	expression := tagExpression{
+		tag:      arg[:index],
+		operator: operatorEqual,
+		value:    arg[index+1:],
+	}
+	if strings.HasSuffix(expression.tag, "!") {
+		expression.tag = strings.TrimSuffix(expression.tag, "!")
+		expression.operator = operatorNotEqual
+	}
+	if strings.HasPrefix(expression.value, "~") {
+		expression.value = expression.value[1:]
+		expression.operator += "~"
+	}
+	if expression.tag == "" {
+		return tagExpression{}, fmt.Errorf("tag name is empty: '%s'", arg)
+	}
+	if expression.operator == operatorMatch || expression.operator == operatorNotMatch {
+		regex, err := regexp.Compile(fmt.Sprintf("^(?:%s)", expression.value))
+		if err != nil {
+			return tagExpression{}, fmt.Errorf("invalid regex in tag expression '%s': %s", arg, err.Error())
+		}
+		expression.regex = regex
+	}
+	return expression, nil
+}
+
+// Matches checks if given series satisfies all tag expressions
+func (seriesByTag *SeriesByTag) Matches(metric *Metric) bool {
+	for _, expression := range seriesByTag.expressions {
+		if !expression.matches(metric.Get(expression.tag)) {
+			return false
+		}
+	}
+	return true
+}
+
+// ExactName returns series name if pattern has 'name=value' expression, it can be used for pattern indexing
+func (seriesByTag *SeriesByTag) ExactName() (string, bool) {
+	for _, expression := range seriesByTag.expressions {
+		if expression.tag == NameTag && expression.operator == operatorEqual && expression.value != "" {
+			return expression.value, true
+		}
+	}
+	return "", false
+}
+
+// String returns canonical seriesByTag call
+func (seriesByTag *SeriesByTag) String() string {
+	var buffer bytes.Buffer
+	buffer.WriteString(seriesByTagPrefix)
+	for i, expression := range seriesByTag.expressions {
+		if i > 0 {
+			buffer.WriteString(",")
+		}
+		buffer.WriteString(fmt.Sprintf("'%s%s%s'", expression.tag, expression.operator, expression.value))
+	}
+	buffer.WriteString(")")
+	return buffer.String()
+}
+
+func (expression *tagExpression) matches(value string) bool {
+	switch expression.operator {
+	case operatorEqual:
+		return value == expression.value
+	case operatorNotEqual:
+		return value != expression.value
+	case operatorMatch:
+		return expression.regex.MatchString(value)
+	case operatorNotMatch:
+		return !expression.regex.MatchString(value)
+	}
+	return false
+}
+
+// parseCallArgs parses quoted comma-separated arguments until closing bracket
+// Returns arguments and length of parsed string including closing bracket
+func parseCallArgs(s string) ([]string, int, error) {
+	args := make([]string, 0)
+	i := skipSpaces(s, 0)
+	if i < len(s) && s[i] == ')' {
+		return args, i + 1, nil
+	}
+	for i < len(s) {
+		quote := s[i]
+		if quote != '\'' && quote != '"' {
+			return nil, 0, fmt.Errorf("argument must be quoted string at position %d", i)
+		}
+		end := strings.IndexByte(s[i+1:], quote)
+		if end < 0 {
+			return nil, 0, fmt.Errorf("unclosed quote at position %d", i)
+		}
+		args = append(args, s[i+1:i+1+end])
+		i = skipSpaces(s, i+end+2)
+		if i >= len(s) {
+			break
+		}
+		switch s[i] {
+		case ')':
+			return args, i + 1, nil
+		case ',':
+			i = skipSpaces(s, i+1)
+		default:
+			return nil, 0, fmt.Errorf("unexpected char '%c' at position %d", s[i], i)
+		}
+	}
+	return nil, 0, fmt.Errorf("unclosed bracket")
+}
+
+func skipSpaces(s string, i int) int {
+	for i < len(s) && s[i] == ' ' {
+		i++
+	}
+	return i
+}
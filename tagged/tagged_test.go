@@ -0,0 +1,139 @@
+package tagged
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestParseMetric(t *testing.T) {
+	Convey("Given valid tagged series, should return canonical name", t, func() {
+		metric, err := ParseMetric("cpu.usage;host=web1;dc=eu")
+		So(err, ShouldBeNil)
+		So(metric.Name, ShouldEqual, "cpu.usage")
+		So(metric.Tags, ShouldResemble, map[string]string{"host": "web1", "dc": "eu"})
+		So(metric.String(), ShouldEqual, "cpu.usage;dc=eu;host=web1")
+		So(metric.Get("name"), ShouldEqual, "cpu.usage")
+		So(metric.Get("dc"), ShouldEqual, "eu")
+		So(metric.Get("rack"), ShouldEqual, "")
+	})
+
+	Convey("Given series without tags, should be valid", t, func() {
+		metric, err := ParseMetric("cpu.usage")
+		So(err, ShouldBeNil)
+		So(metric.String(), ShouldEqual, "cpu.usage")
+	})
+
+	Convey("Given invalid tagged series, should return error", t, func() {
+		invalidMetrics := []string{
+			";dc=eu",
+			"cpu;dc",
+			"cpu;dc=",
+			"cpu;=eu",
+			"cpu;dc=eu;",
+			"cpu;name=other",
+			"cpu;dc!=eu",
+			"cpu;dc=~eu",
+		}
+		for _, invalidMetric := range invalidMetrics {
+			_, err := ParseMetric(invalidMetric)
+			So(err, ShouldNotBeNil)
+		}
+	})
+}
+
+func TestParseSeriesByTag(t *testing.T) {
+	Convey("Given valid seriesByTag, should parse all expressions", t, func() {
+		seriesByTag, err := ParseSeriesByTag(`seriesByTag('name=cpu', "dc=~eu.*",'host!=web2','rack!=~a(b|c)')`)
+		So(err, ShouldBeNil)
+		So(seriesByTag.String(), ShouldEqual, "seriesByTag('name=cpu','dc=~eu.*','host!=web2','rack!=~a(b|c)')")
+		name, ok := seriesByTag.ExactName()
+		So(ok, ShouldBeTrue)
+		So(name, ShouldEqual, "cpu")
+	})
+
+	Convey("Given seriesByTag without exact name, should not return name", t, func() {
+		seriesByTag, err := ParseSeriesByTag("seriesByTag('name=~cpu.*')")
+		So(err, ShouldBeNil)
+		_, ok := seriesByTag.ExactName()
+		So(ok, ShouldBeFalse)
+	})
+
+	Convey("Given invalid seriesByTag, should return error", t, func() {
+		invalidPatterns := []string{
+			"seriesByTag()",
+			"seriesByTag('name=cpu'",
+			"seriesByTag('name=cpu)",
+			"seriesByTag(name=cpu)",
+			"seriesByTag('name=cpu') ",
+			"seriesByTag('name=cpu' 'dc=eu')",
+			"seriesByTag('=cpu')",
+			"seriesByTag('namecpu')",
+			"seriesByTag('name=~(cpu')",
+			"seriesByTag('dc!=eu')",
+			"seriesByTag('dc=')",
+			"sumSeries(seriesByTag('name=cpu'))",
+		}
+		for _, invalidPattern := range invalidPatterns {
+			_, err := ParseSeriesByTag(invalidPattern)
+			So(err, ShouldNotBeNil)
+		}
+	})
+}
+
+func TestSeriesByTagMatches(t *testing.T) {
+	metric, _ := ParseMetric("cpu;dc=eu-west;host=web1")
+	untagged, _ := ParseMetric("cpu")
+
+	Convey("Test tag expression operators", t, func() {
+		cases := []struct {
+			pattern  string
+			metric   *Metric
+			expected bool
+		}{
+			{"seriesByTag('name=cpu')", metric, true},
+			{"seriesByTag('name=cpu')", untagged, true},
+			{"seriesByTag('name=mem')", metric, false},
+			{"seriesByTag('name=cpu','dc=eu-west')", metric, true},
+			{"seriesByTag('name=cpu','dc=eu')", metric, false},
+			{"seriesByTag('name=cpu','dc=~eu')", metric, true},
+			{"seriesByTag('name=cpu','dc=~west')", metric, false},
+			{"seriesByTag('name=cpu','dc=~.*west')", metric, true},
+			{"seriesByTag('name=cpu','host!=web2')", metric, true},
+			{"seriesByTag('name=cpu','host!=web1')", metric, false},
+			{"seriesByTag('name=cpu','host!=~web')", metric, false},
+			{"seriesByTag('name=cpu','host!=~db')", metric, true},
+			{"seriesByTag('name=cpu','rack=')", metric, true},
+			{"seriesByTag('name=cpu','host=')", metric, false},
+			{"seriesByTag('name=cpu','host!=')", metric, true},
+			{"seriesByTag('name=cpu','host!=')", untagged, false},
+			{"seriesByTag('dc=~eu.*')", untagged, false},
+		}
+		for _, testCase := range cases {
+			seriesByTag, err := ParseSeriesByTag(testCase.pattern)
+			So(err, ShouldBeNil)
+			So(seriesByTag.Matches(testCase.metric), ShouldEqual, testCase.expected)
+		}
+	})
+}
+
+func TestFindSeriesByTag(t *testing.T) {
+	Convey("Given target with several seriesByTag calls, should find all of them", t, func() {
+		calls, err := FindSeriesByTag("divideSeries(sumSeries(seriesByTag('name=errors', 'dc=(eu|us)')),seriesByTag(\"name=requests\"))")
+		So(err, ShouldBeNil)
+		So(calls, ShouldResemble, []string{"seriesByTag('name=errors', 'dc=(eu|us)')", "seriesByTag(\"name=requests\")"})
+	})
+
+	Convey("Given target without seriesByTag, should return empty list", t, func() {
+		calls, err := FindSeriesByTag("sumSeries(my.metric.*)")
+		So(err, ShouldBeNil)
+		So(calls, ShouldBeEmpty)
+	})
+
+	Convey("Given target with unclosed seriesByTag, should return error", t, func() {
+		_, err := FindSeriesByTag("sumSeries(seriesByTag('name=errors')")
+		So(err, ShouldBeNil)
+		_, err = FindSeriesByTag("sumSeries(seriesByTag('name=errors)")
+		So(err, ShouldNotBeNil)
+	})
+}
@@ -8,7 +8,9 @@ import (
 )
 
 // FetchData gets values of given pattern metrics from given interval and returns values and all found pattern metrics
-func FetchData(database moira.Database, pattern string, from int64, until int64, allowRealTimeAlerting bool) ([]*expr.MetricData, []string, error) {
+// metricsTTL is time checker keeps raw metric values, raw values are kept by first retention archive TTL if it is not positive
+// Retention archives are not looked up for ranges checker keeps raw values for
+func FetchData(database moira.Database, pattern string, from int64, until int64, allowRealTimeAlerting bool, metricsTTL int64) ([]*expr.MetricData, []string, error) {
 	metrics, err := database.GetPatternMetrics(pattern)
 	if err != nil {
 		return nil, nil, err
@@ -21,7 +23,20 @@ func FetchData(database moira.Database, pattern string, from int64, until int64,
 		if err != nil {
 			return nil, nil, err
 		}
-		dataList, err := database.GetMetricsValues(metrics, from, until)
+		var archives []moira.RetentionArchive
+		if metricsTTL <= 0 || until-from > metricsTTL {
+			archives, err = database.GetMetricRetentionArchives(firstMetric)
+			if err != nil {
+				return nil, nil, err
+			}
+		}
+		var dataList map[string][]*moira.MetricValue
+		if archive := selectArchive(archives, from, until, metricsTTL); archive != nil {
+			retention = archive.Step
+			dataList, err = database.GetMetricsArchiveValues(metrics, archive.Step, from, until)
+		} else {
+			dataList, err = database.GetMetricsValues(metrics, from, until)
+		}
 		if err != nil {
 			return nil, nil, err
 		}
@@ -37,6 +52,28 @@ func FetchData(database moira.Database, pattern string, from int64, until int64,
 	return metricDatas, metrics, nil
 }
 
+// selectArchive returns lower precision archive with the highest precision which keeps values of requested range
+// nil is returned if raw values keep requested range or metric has only one archive
+// Raw values are kept by the first archive TTL, but checker removes them after metricsTTL
+func selectArchive(archives []moira.RetentionArchive, from int64, until int64, metricsTTL int64) *moira.RetentionArchive {
+	if len(archives) < 2 {
+		return nil
+	}
+	rawTTL := archives[0].TTL
+	if metricsTTL > 0 && metricsTTL < rawTTL {
+		rawTTL = metricsTTL
+	}
+	if rawTTL >= until-from {
+		return nil
+	}
+	for i := 1; i < len(archives); i++ {
+		if archives[i].TTL >= until-from {
+			return &archives[i]
+		}
+	}
+	return &archives[len(archives)-1]
+}
+
 func createMetricData(metric string, from int64, until int64, retention int64, values []float64) *expr.MetricData {
 	fetchResponse := pb.FetchResponse{
 		Name:      metric,
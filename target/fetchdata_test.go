@@ -57,7 +57,7 @@ func TestFetchData(t *testing.T) {
 	Convey("Errors Test", t, func() {
 		Convey("GetPatternMetricsError", func() {
 			dataBase.EXPECT().GetPatternMetrics(pattern).Return(nil, patternErr)
-			metricData, metrics, err := FetchData(dataBase, pattern, from, until, true)
+			metricData, metrics, err := FetchData(dataBase, pattern, from, until, true, 0)
 			So(metricData, ShouldBeNil)
 			So(metrics, ShouldBeNil)
 			So(err, ShouldResemble, patternErr)
@@ -65,7 +65,7 @@ func TestFetchData(t *testing.T) {
 		Convey("GetMetricRetentionError", func() {
 			dataBase.EXPECT().GetPatternMetrics(pattern).Return([]string{metric}, nil)
 			dataBase.EXPECT().GetMetricRetention(metric).Return(int64(0), retentionErr)
-			metricData, metrics, err := FetchData(dataBase, pattern, from, until, true)
+			metricData, metrics, err := FetchData(dataBase, pattern, from, until, true, 0)
 			So(metricData, ShouldBeNil)
 			So(metrics, ShouldBeNil)
 			So(err, ShouldResemble, retentionErr)
@@ -73,8 +73,9 @@ func TestFetchData(t *testing.T) {
 		Convey("GetMetricsValuesError", func() {
 			dataBase.EXPECT().GetPatternMetrics(pattern).Return([]string{metric}, nil)
 			dataBase.EXPECT().GetMetricRetention(metric).Return(retention, nil)
+			dataBase.EXPECT().GetMetricRetentionArchives(metric).Return(nil, nil)
 			dataBase.EXPECT().GetMetricsValues([]string{metric}, from, until).Return(nil, metricErr)
-			metricData, metrics, err := FetchData(dataBase, pattern, from, until, true)
+			metricData, metrics, err := FetchData(dataBase, pattern, from, until, true, 0)
 			So(metricData, ShouldBeNil)
 			So(metrics, ShouldBeNil)
 			So(err, ShouldResemble, metricErr)
@@ -83,7 +84,7 @@ func TestFetchData(t *testing.T) {
 
 	Convey("Test no metrics", t, func() {
 		dataBase.EXPECT().GetPatternMetrics(pattern).Return([]string{}, nil)
-		metricData, metrics, err := FetchData(dataBase, pattern, from, until, false)
+		metricData, metrics, err := FetchData(dataBase, pattern, from, until, false, 0)
 		fetchResponse := pb.FetchResponse{
 			Name:      pattern,
 			StartTime: int32(from),
@@ -101,8 +102,9 @@ func TestFetchData(t *testing.T) {
 	Convey("Test allowRealTimeAlerting=true", t, func() {
 		dataBase.EXPECT().GetPatternMetrics(pattern).Return([]string{metric}, nil)
 		dataBase.EXPECT().GetMetricRetention(metric).Return(retention, nil)
+		dataBase.EXPECT().GetMetricRetentionArchives(metric).Return(nil, nil)
 		dataBase.EXPECT().GetMetricsValues([]string{metric}, from, until).Return(dataList, nil)
-		metricData, metrics, err := FetchData(dataBase, pattern, from, until, false)
+		metricData, metrics, err := FetchData(dataBase, pattern, from, until, false, 0)
 		fetchResponse := pb.FetchResponse{
 			Name:      metric,
 			StartTime: int32(from),
@@ -120,8 +122,9 @@ func TestFetchData(t *testing.T) {
 	Convey("Test allowRealTimeAlerting=true", t, func() {
 		dataBase.EXPECT().GetPatternMetrics(pattern).Return([]string{metric}, nil)
 		dataBase.EXPECT().GetMetricRetention(metric).Return(retention, nil)
+		dataBase.EXPECT().GetMetricRetentionArchives(metric).Return(nil, nil)
 		dataBase.EXPECT().GetMetricsValues([]string{metric}, from, until).Return(dataList, nil)
-		metricData, metrics, err := FetchData(dataBase, pattern, from, until, true)
+		metricData, metrics, err := FetchData(dataBase, pattern, from, until, true, 0)
 		fetchResponse := pb.FetchResponse{
 			Name:      metric,
 			StartTime: int32(from),
@@ -168,8 +171,9 @@ func TestFetchData(t *testing.T) {
 	Convey("Test multiple metrics", t, func() {
 		dataBase.EXPECT().GetPatternMetrics(pattern).Return([]string{metric, metric2}, nil)
 		dataBase.EXPECT().GetMetricRetention(metric).Return(retention, nil)
+		dataBase.EXPECT().GetMetricRetentionArchives(metric).Return(nil, nil)
 		dataBase.EXPECT().GetMetricsValues([]string{metric, metric2}, from, until).Return(dataList, nil)
-		metricData, metrics, err := FetchData(dataBase, pattern, from, until, true)
+		metricData, metrics, err := FetchData(dataBase, pattern, from, until, true, 0)
 		fetchResponse := pb.FetchResponse{
 			Name:      metric,
 			StartTime: int32(from),
@@ -186,9 +190,77 @@ func TestFetchData(t *testing.T) {
 		So(err, ShouldBeNil)
 	})
 
+	Convey("Test range longer than first archive TTL, should fetch lower precision archive", t, func() {
+		archives := []moira.RetentionArchive{{Step: 5, TTL: 30}, {Step: 10, TTL: 100}}
+		dataBase.EXPECT().GetPatternMetrics(pattern).Return([]string{metric}, nil)
+		dataBase.EXPECT().GetMetricRetention(metric).Return(int64(5), nil)
+		dataBase.EXPECT().GetMetricRetentionArchives(metric).Return(archives, nil)
+		dataBase.EXPECT().GetMetricsArchiveValues([]string{metric}, int64(10), from, until).Return(dataList, nil)
+		metricData, metrics, err := FetchData(dataBase, pattern, from, until, true, 0)
+		fetchResponse := pb.FetchResponse{
+			Name:      metric,
+			StartTime: int32(from),
+			StopTime:  int32(until),
+			StepTime:  10,
+			Values:    []float64{0, 1, 2, 3, 4},
+			IsAbsent:  make([]bool, 5),
+		}
+		expected := &expr.MetricData{FetchResponse: fetchResponse}
+		So(metricData, ShouldResemble, []*expr.MetricData{expected})
+		So(metrics, ShouldResemble, []string{metric})
+		So(err, ShouldBeNil)
+	})
+
+	Convey("Test range kept by checker, should not get retention archives", t, func() {
+		dataBase.EXPECT().GetPatternMetrics(pattern).Return([]string{metric}, nil)
+		dataBase.EXPECT().GetMetricRetention(metric).Return(retention, nil)
+		dataBase.EXPECT().GetMetricsValues([]string{metric}, from, until).Return(dataList, nil)
+		metricData, metrics, err := FetchData(dataBase, pattern, from, until, true, until-from)
+		fetchResponse := pb.FetchResponse{
+			Name:      metric,
+			StartTime: int32(from),
+			StopTime:  int32(until),
+			StepTime:  int32(retention),
+			Values:    []float64{0, 1, 2, 3, 4},
+			IsAbsent:  make([]bool, 5),
+		}
+		expected := &expr.MetricData{FetchResponse: fetchResponse}
+		So(metricData, ShouldResemble, []*expr.MetricData{expected})
+		So(metrics, ShouldResemble, []string{metric})
+		So(err, ShouldBeNil)
+	})
+
 	mockCtrl.Finish()
 }
 
+func TestSelectArchive(t *testing.T) {
+	archives := []moira.RetentionArchive{{Step: 10, TTL: 3600}, {Step: 60, TTL: 86400}, {Step: 600, TTL: 604800}}
+
+	Convey("Metric with single archive, should use it", t, func() {
+		So(selectArchive(nil, 0, 100000, 0), ShouldBeNil)
+		So(selectArchive(archives[:1], 0, 100000, 0), ShouldBeNil)
+	})
+
+	Convey("Range kept by first archive, should use it", t, func() {
+		So(selectArchive(archives, 1000, 4600, 0), ShouldBeNil)
+	})
+
+	Convey("Range longer than first archive TTL, should select archive with highest precision keeping range", t, func() {
+		So(selectArchive(archives, 1000, 4601, 0), ShouldResemble, &archives[1])
+		So(selectArchive(archives, 0, 86401, 0), ShouldResemble, &archives[2])
+	})
+
+	Convey("Range longer than all archives TTL, should select the last archive", t, func() {
+		So(selectArchive(archives, 0, 10000000, 0), ShouldResemble, &archives[2])
+	})
+
+	Convey("Raw values removed by checker earlier than first archive TTL, should select archive", t, func() {
+		So(selectArchive(archives, 1000, 2800, 1800), ShouldBeNil)
+		So(selectArchive(archives, 1000, 2801, 1800), ShouldResemble, &archives[1])
+		So(selectArchive(archives, 1000, 4601, 7200), ShouldResemble, &archives[1])
+	})
+}
+
 func TestAllowRealTimeAlerting(t *testing.T) {
 	metricsValues := []*moira.MetricValue{
 		{
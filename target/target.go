@@ -8,6 +8,7 @@ import (
 	"github.com/go-graphite/carbonapi/expr"
 
 	"github.com/moira-alert/moira"
+	"github.com/moira-alert/moira/tagged"
 )
 
 // ErrEvaluateTarget represent evaluation error by carbon-api eval method
@@ -26,13 +27,18 @@ type EvaluationResult struct {
 }
 
 // EvaluateTarget is analogue of evaluateTarget method in graphite-web, that gets target metrics value from DB and Evaluate it using carbon-api eval package
-func EvaluateTarget(database moira.Database, target string, from int64, until int64, allowRealTimeAlerting bool) (*EvaluationResult, error) {
+func EvaluateTarget(database moira.Database, target string, from int64, until int64, allowRealTimeAlerting bool, metricsTTL int64) (*EvaluationResult, error) {
 	result := &EvaluationResult{
 		TimeSeries: make([]*TimeSeries, 0),
 		Patterns:   make([]string, 0),
 		Metrics:    make([]string, 0),
 	}
 
+	target, tagPatterns, err := replaceSeriesByTag(target)
+	if err != nil {
+		return nil, err
+	}
+
 	targets := []string{target}
 	targetIdx := 0
 	for targetIdx < len(targets) {
@@ -43,7 +49,7 @@ func EvaluateTarget(database moira.Database, target string, from int64, until in
 			return nil, err
 		}
 		patterns := expr2.Metrics()
-		metricsMap, metrics, err := getPatternsMetricData(database, patterns, from, until, allowRealTimeAlerting)
+		metricsMap, metrics, err := getPatternsMetricData(database, patterns, tagPatterns, from, until, allowRealTimeAlerting, metricsTTL)
 		if err != nil {
 			return nil, err
 		}
@@ -77,20 +83,20 @@ func EvaluateTarget(database moira.Database, target string, from int64, until in
 			}
 			result.Metrics = append(result.Metrics, metrics...)
 			for _, pattern := range patterns {
-				result.Patterns = append(result.Patterns, pattern.Metric)
+				result.Patterns = append(result.Patterns, resolvePattern(pattern.Metric, tagPatterns))
 			}
 		}
 	}
 	return result, nil
 }
 
-func getPatternsMetricData(database moira.Database, patterns []expr.MetricRequest, from int64, until int64, allowRealTimeAlerting bool) (map[expr.MetricRequest][]*expr.MetricData, []string, error) {
+func getPatternsMetricData(database moira.Database, patterns []expr.MetricRequest, tagPatterns map[string]string, from int64, until int64, allowRealTimeAlerting bool, metricsTTL int64) (map[expr.MetricRequest][]*expr.MetricData, []string, error) {
 	metrics := make([]string, 0)
 	metricsMap := make(map[expr.MetricRequest][]*expr.MetricData)
 	for _, pattern := range patterns {
 		pattern.From += int32(from)
 		pattern.Until += int32(until)
-		metricDatas, patternMetrics, err := FetchData(database, pattern.Metric, int64(pattern.From), int64(pattern.Until), allowRealTimeAlerting)
+		metricDatas, patternMetrics, err := FetchData(database, resolvePattern(pattern.Metric, tagPatterns), int64(pattern.From), int64(pattern.Until), allowRealTimeAlerting, metricsTTL)
 		if err != nil {
 			return nil, nil, err
 		}
@@ -99,3 +105,33 @@ func getPatternsMetricData(database moira.Database, patterns []expr.MetricReques
 	}
 	return metricsMap, metrics, nil
 }
+
+// replaceSeriesByTag replaces seriesByTag calls, which carbon-api can not parse, with placeholder metric names
+// Returns rewritten target and map of placeholder to canonical seriesByTag pattern
+func replaceSeriesByTag(target string) (string, map[string]string, error) {
+	tagPatterns := make(map[string]string)
+	calls, err := tagged.FindSeriesByTag(target)
+	if err != nil {
+		return "", nil, err
+	}
+	for i, call := range calls {
+		seriesByTag, err := tagged.ParseSeriesByTag(call)
+		if err != nil {
+			return "", nil, err
+		}
+		placeholder := fmt.Sprintf("%s%d", seriesByTagPlaceholderPrefix, i)
+		tagPatterns[placeholder] = seriesByTag.String()
+		target = strings.Replace(target, call, placeholder, 1)
+	}
+	return target, tagPatterns, nil
+}
+
+// resolvePattern returns seriesByTag pattern for placeholder or pattern itself
+func resolvePattern(pattern string, tagPatterns map[string]string) string {
+	if tagPattern, ok := tagPatterns[pattern]; ok {
+		return tagPattern
+	}
+	return pattern
+}
+
+const seriesByTagPlaceholderPrefix = "_moira_series_by_tag_"
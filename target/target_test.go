@@ -55,7 +55,7 @@ func TestEvaluateTarget(t *testing.T) {
 
 	Convey("Errors tests", t, func() {
 		Convey("Error while ParseExpr", func() {
-			result, err := EvaluateTarget(dataBase, "", from, until, true)
+			result, err := EvaluateTarget(dataBase, "", from, until, true, 0)
 			So(err, ShouldResemble, expr.ErrMissingExpr)
 			So(result, ShouldBeNil)
 		})
@@ -63,8 +63,9 @@ func TestEvaluateTarget(t *testing.T) {
 		Convey("Error in fetch data", func() {
 			dataBase.EXPECT().GetPatternMetrics(pattern).Return([]string{metric}, nil)
 			dataBase.EXPECT().GetMetricRetention(metric).Return(retention, nil)
+			dataBase.EXPECT().GetMetricRetentionArchives(metric).Return(nil, nil)
 			dataBase.EXPECT().GetMetricsValues([]string{metric}, from, until).Return(nil, metricErr)
-			result, err := EvaluateTarget(dataBase, "super.puper.pattern", from, until, true)
+			result, err := EvaluateTarget(dataBase, "super.puper.pattern", from, until, true, 0)
 			So(err, ShouldResemble, metricErr)
 			So(result, ShouldBeNil)
 		})
@@ -72,8 +73,9 @@ func TestEvaluateTarget(t *testing.T) {
 		Convey("Error evaluate target", func() {
 			dataBase.EXPECT().GetPatternMetrics("super.puper.pattern").Return([]string{metric}, nil)
 			dataBase.EXPECT().GetMetricRetention(metric).Return(retention, nil)
+			dataBase.EXPECT().GetMetricRetentionArchives(metric).Return(nil, nil)
 			dataBase.EXPECT().GetMetricsValues([]string{metric}, from, until).Return(dataList, nil)
-			result, err := EvaluateTarget(dataBase, "aliasByNoe(super.puper.pattern, 2)", from, until, true)
+			result, err := EvaluateTarget(dataBase, "aliasByNoe(super.puper.pattern, 2)", from, until, true, 0)
 			So(err.Error(), ShouldResemble, "unknown function in evalExpr: \"aliasByNoe\"")
 			So(result, ShouldBeNil)
 		})
@@ -81,7 +83,7 @@ func TestEvaluateTarget(t *testing.T) {
 
 	Convey("Test no metrics", t, func() {
 		dataBase.EXPECT().GetPatternMetrics("super.puper.pattern").Return([]string{}, nil)
-		result, err := EvaluateTarget(dataBase, "aliasByNode(super.puper.pattern, 2)", from, until, true)
+		result, err := EvaluateTarget(dataBase, "aliasByNode(super.puper.pattern, 2)", from, until, true, 0)
 		So(err, ShouldBeNil)
 		fetchResponse := pb.FetchResponse{
 			Name:      "pattern",
@@ -104,8 +106,9 @@ func TestEvaluateTarget(t *testing.T) {
 	Convey("Test success evaluate", t, func() {
 		dataBase.EXPECT().GetPatternMetrics("super.puper.pattern").Return([]string{metric}, nil)
 		dataBase.EXPECT().GetMetricRetention(metric).Return(retention, nil)
+		dataBase.EXPECT().GetMetricRetentionArchives(metric).Return(nil, nil)
 		dataBase.EXPECT().GetMetricsValues([]string{metric}, from, until).Return(dataList, nil)
-		result, err := EvaluateTarget(dataBase, "aliasByNode(super.puper.pattern, 2)", from, until, true)
+		result, err := EvaluateTarget(dataBase, "aliasByNode(super.puper.pattern, 2)", from, until, true, 0)
 		fetchResponse := pb.FetchResponse{
 			Name:      "metric",
 			StartTime: int32(from),
@@ -123,4 +126,39 @@ func TestEvaluateTarget(t *testing.T) {
 			Patterns: []string{"super.puper.pattern"},
 		})
 	})
+	Convey("Test seriesByTag evaluate", t, func() {
+		tagPattern := "seriesByTag('name=cpu','dc=~eu.*')"
+		taggedMetric := "cpu;dc=eu-west;host=web1"
+		taggedDataList := map[string][]*moira.MetricValue{taggedMetric: dataList[metric]}
+		dataBase.EXPECT().GetPatternMetrics(tagPattern).Return([]string{taggedMetric}, nil)
+		dataBase.EXPECT().GetMetricRetention(taggedMetric).Return(retention, nil)
+		dataBase.EXPECT().GetMetricRetentionArchives(taggedMetric).Return(nil, nil)
+		dataBase.EXPECT().GetMetricsValues([]string{taggedMetric}, from, until).Return(taggedDataList, nil)
+		result, err := EvaluateTarget(dataBase, "sumSeries(seriesByTag('name=cpu', 'dc=~eu.*'))", from, until, true, 0)
+		So(err, ShouldBeNil)
+		So(result.Patterns, ShouldResemble, []string{tagPattern})
+		So(result.Metrics, ShouldResemble, []string{taggedMetric})
+		So(result.TimeSeries, ShouldHaveLength, 1)
+		So(result.TimeSeries[0].Values, ShouldResemble, []float64{0, 1, 2, 3, 4})
+	})
+
+	Convey("Test invalid seriesByTag", t, func() {
+		result, err := EvaluateTarget(dataBase, "seriesByTag('dc!=eu')", from, until, true, 0)
+		So(err, ShouldNotBeNil)
+		So(result, ShouldBeNil)
+	})
+}
+
+func TestReplaceSeriesByTag(t *testing.T) {
+	Convey("Target with seriesByTag calls should be rewritten with placeholders", t, func() {
+		target, tagPatterns, err := replaceSeriesByTag("divideSeries(seriesByTag('name=errors'), seriesByTag(\"name=requests\", 'dc=eu'))")
+		So(err, ShouldBeNil)
+		So(target, ShouldEqual, "divideSeries(_moira_series_by_tag_0, _moira_series_by_tag_1)")
+		So(tagPatterns, ShouldResemble, map[string]string{
+			"_moira_series_by_tag_0": "seriesByTag('name=errors')",
+			"_moira_series_by_tag_1": "seriesByTag('name=requests','dc=eu')",
+		})
+		So(resolvePattern("_moira_series_by_tag_1", tagPatterns), ShouldEqual, "seriesByTag('name=requests','dc=eu')")
+		So(resolvePattern("super.puper.pattern", tagPatterns), ShouldEqual, "super.puper.pattern")
+	})
 }